@@ -1,29 +1,105 @@
+//go:build !minimal
+
 package api
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"runtime/debug"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/snippets"
+	"github.com/advayc/nums/store"
+	"github.com/advayc/nums/store/dynamodb"
+	"github.com/advayc/nums/store/firestore"
+	"github.com/advayc/nums/web"
+	"github.com/getsentry/sentry-go"
+	sentryhttp "github.com/getsentry/sentry-go/http"
 	redis "github.com/redis/go-redis/v9"
 )
 
+// devHosts lists development hostnames whose hits are not counted
+// (IGNORE_DEV_TRAFFIC / DEV_HOSTNAMES); nil disables the filter.
+var devHosts = web.DevHostsFromEnv()
+
+// environment is the ENVIRONMENT keyspace; keyPrefix is where its counters
+// live in Redis ("hits:" in production, "<env>:hits:" otherwise).
+var environment, keyPrefix = envKeyspace()
+
+func envKeyspace() (string, string) {
+	env, err := web.EnvironmentFromEnv()
+	if err != nil {
+		// refuse to run rather than fall back to production keys
+		log.Fatalf("(error) %v", err)
+	}
+	layout, err := store.RedisLayoutFromEnv()
+	if err != nil {
+		log.Fatalf("(error) %v", err)
+	}
+	return env, store.LayoutPrefix(layout, core.EnvKeyPrefix(env)+"hits:")
+}
+
+// v1Prefix is where counters were kept before REDIS_KEY_LAYOUT=v2. The first
+// request an instance serves moves every key from it (store.MigrateLayout),
+// unless "nums migrate-keys" or a standalone server already did, which
+// costs one EXISTS. A migration cut short is resumed by the next request;
+// layoutUpgraded is set once it is done or can't be done (Redis Cluster).
+var (
+	v1Prefix       = core.EnvKeyPrefix(environment) + "hits:"
+	layoutMu       sync.Mutex
+	layoutUpgraded atomic.Bool
+)
+
+func upgradeKeys() {
+	rc := getRedis()
+	if rc == nil || keyPrefix == v1Prefix || layoutUpgraded.Load() {
+		return
+	}
+	layoutMu.Lock()
+	defer layoutMu.Unlock()
+	if layoutUpgraded.Load() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	m, err := store.NewRedisCounterFromClient(rc, keyPrefix).MigrateLayout(ctx, v1Prefix)
+	switch {
+	case errors.Is(err, store.ErrLayoutCluster):
+		log.Printf("(error) %v", err)
+		layoutUpgraded.Store(true)
+	case err != nil:
+		log.Printf("(warn) moving keys to the %s layout stopped, the next request resumes it: %v", keyPrefix, err)
+	default:
+		layoutUpgraded.Store(true)
+		if !m.Skipped {
+			log.Printf("key layout migration from %s to %s done: %d keys moved, %d counters added up, %d conflicts left in place", m.From, m.To, m.Moved, m.Merged, m.Conflicts)
+		}
+	}
+}
+
 // In-memory fallback (used only if Redis not configured or errors)
 var globalCount atomic.Uint64
 
 // Redis client (lazy init)
 var (
 	redisOnce   sync.Once
-	redisClient *redis.Client
+	redisClient redis.UniversalClient
 )
 
 // buildUpstashRedisURL normalizes a host/password combo (optional helper for Upstash env vars)
@@ -44,7 +120,9 @@ func buildUpstashRedisURL(rawHost, password string) string {
 	return u.String()
 }
 
-func getRedis() *redis.Client {
+// getRedis returns the client for REDIS_URL (or the Upstash variables), a
+// Sentinel-managed master or a Redis Cluster (see store.RedisConfig), or nil.
+func getRedis() redis.UniversalClient {
 	redisOnce.Do(func() {
 		redisURL := os.Getenv("REDIS_URL")
 		if redisURL == "" { // attempt construction from Upstash REST style vars (host + password)
@@ -54,130 +132,2988 @@ func getRedis() *redis.Client {
 				redisURL = buildUpstashRedisURL(host, pass)
 			}
 		}
-		if redisURL == "" {
+		cfg, err := store.RedisConfigFromEnv(redisURL)
+		if err != nil {
+			log.Printf("(warn) redis config: %v", err)
+			return
+		}
+		if !cfg.Configured() {
 			return
 		}
-		opt, err := redis.ParseURL(redisURL)
+		c, err := cfg.NewClient()
 		if err != nil {
-			log.Printf("(warn) parse redis url failed: %v", err)
+			log.Printf("(warn) redis client: %v", err)
 			return
 		}
-		c := redis.NewClient(opt)
 		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 		defer cancel()
 		if err := c.Ping(ctx).Err(); err != nil {
 			log.Printf("(warn) redis ping failed: %v", err)
+			c.Close()
 			return
 		}
 		redisClient = c
-		log.Printf("redis enabled (addr=%s)", c.Options().Addr)
+		log.Printf("redis enabled (%s)", cfg)
 	})
 	return redisClient
 }
 
-func init() {
-	if seed := os.Getenv("INITIAL_HIT_COUNT"); seed != "" {
-		if v, err := strconv.ParseUint(seed, 10, 64); err == nil {
-			globalCount.Store(v)
+// Non-Redis hosted store selected by STORAGE (lazy init); only used when
+// Redis is not configured.
+var (
+	storeOnce   sync.Once
+	hostedStore store.Store
+	storageName string // resolved STORAGE value
+)
+
+// getStore returns the STORAGE=kv (Vercel KV over REST), STORAGE=edge-config,
+// STORAGE=dynamodb or STORAGE=firestore backend, or nil. DYNAMO_TABLE alone
+// also selects DynamoDB.
+func getStore() store.Store {
+	storeOnce.Do(func() {
+		storageName = os.Getenv("STORAGE")
+		if storageName == "" && os.Getenv("DYNAMO_TABLE") != "" {
+			storageName = "dynamodb"
+		}
+		var err error
+		switch storageName {
+		case "kv":
+			hostedStore, err = store.NewKVFromEnv()
+		case "edge-config":
+			hostedStore, err = store.NewEdgeConfigFromEnv()
+		case "dynamodb":
+			hostedStore, err = dynamodb.NewFromEnv()
+		case "firestore":
+			hostedStore, err = firestore.NewFromEnv()
+		default:
+			return
+		}
+		if err != nil {
+			hostedStore = nil
+			log.Printf("(warn) STORAGE=%s disabled: %v", storageName, err)
+			return
 		}
+		if p := core.EnvKeyPrefix(environment); p != "" {
+			hostedStore = store.NewNamespaced(hostedStore, p)
+		}
+		if caps := hostedStore.Capabilities(); !caps.AtomicIncrement || !caps.ReadYourWrites {
+			log.Printf("(warn) STORAGE=%s is eventually consistent and may drop concurrent hits", storageName)
+		}
+	})
+	return hostedStore
+}
+
+// storageSource names the backend in responses: "redis", the STORAGE value or "memory".
+func storageSource() string {
+	if getRedis() != nil {
+		return "redis"
+	}
+	if getStore() != nil {
+		return storageName
 	}
+	return "memory"
 }
 
-func authorize(r *http.Request) bool {
-	secret := os.Getenv("SECRET_TOKEN")
-	if secret == "" {
-		return true
+// readCount returns the stored value for id (Redis when configured, else the
+// in-memory fallback), mirroring the /count read path.
+func readCount(r *http.Request, id string) core.Value {
+	var val core.Value
+	if v, ok := takeWarmValue(id); ok {
+		val = v
+	} else if rc := getRedis(); rc != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+		defer cancel()
+		s, err := rc.Get(ctx, keyPrefix+id).Result()
+		if err == nil {
+			if parsed, perr := core.ParseValue(s); perr == nil {
+				val = parsed
+			}
+		} else if err != redis.Nil {
+			captureError(r, "(warn) redis GET failed: %v", err)
+		}
+	} else if st := getStore(); st != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+		defer cancel()
+		v, err := st.Get(ctx, id)
+		if err != nil {
+			captureError(r, "(warn) store get failed: %v", err)
+		}
+		val = v
 	}
-	if r.Header.Get("X-Auth-Token") == secret {
-		return true
+	if val.IsZero() { // fallback memory value (not id-specific; legacy behavior)
+		val = core.Uint(globalCount.Load())
 	}
-	if r.URL.Query().Get("token") == secret {
+	return val
+}
+
+// errNoPerIDCounts is returned by storedCount on the memory fallback, which
+// keeps one shared counter rather than a value per id.
+var errNoPerIDCounts = errors.New("per-counter values require redis or a STORAGE backend")
+
+// storedCount returns id's stored value (0 for a counter that doesn't
+// exist) or the error reading it, for the routes that must not answer with
+// the fallbacks readCount uses.
+func storedCount(r *http.Request, id string) (core.Value, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+	defer cancel()
+	if rc := getRedis(); rc != nil {
+		s, err := rc.Get(ctx, keyPrefix+id).Result()
+		if err == redis.Nil {
+			return core.Value{}, nil
+		}
+		if err != nil {
+			return core.Value{}, err
+		}
+		return core.ParseValue(s)
+	}
+	if st := getStore(); st != nil {
+		return st.Get(ctx, id)
+	}
+	return core.Value{}, errNoPerIDCounts
+}
+
+// roundingSteps are the ROUND_COUNTS steps; with Redis, /admin/round entries
+// in the hash "rounding:<keyPrefix>" override them per id.
+var roundingSteps = mustRoundingSteps()
+
+func mustRoundingSteps() map[string]uint64 {
+	steps, err := web.RoundingFromEnv()
+	if err != nil {
+		// refuse to run rather than show exact numbers the owner wanted hidden
+		log.Fatalf("(error) %v", err)
+	}
+	return steps
+}
+
+// roundStep returns id's public rounding step (0 or 1 for exact).
+func roundStep(r *http.Request, id string) uint64 {
+	if rc := getRedis(); rc != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+		defer cancel()
+		s, err := rc.HGet(ctx, "rounding:"+keyPrefix, id).Result()
+		if err == nil {
+			if step, err := strconv.ParseUint(s, 10, 64); err == nil {
+				return step
+			}
+		} else if err != redis.Nil {
+			captureError(r, "(warn) redis HGET failed: %v", err)
+		}
+	}
+	if step, ok := roundingSteps[id]; ok {
+		return step
+	}
+	return roundingSteps[core.RoundingDefault]
+}
+
+// displayOffsets are the DISPLAY_OFFSETS; with Redis, /admin/offset entries
+// in the hash "offsets:<keyPrefix>" override them per id.
+var displayOffsets = mustDisplayOffsets()
+
+func mustDisplayOffsets() map[string]uint64 {
+	offsets, err := web.DisplayOffsetsFromEnv()
+	if err != nil {
+		log.Fatalf("(error) %v", err)
+	}
+	return offsets
+}
+
+// displayOffset returns the hits added to id's public value (0 for none).
+func displayOffset(r *http.Request, id string) uint64 {
+	if rc := getRedis(); rc != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+		defer cancel()
+		s, err := rc.HGet(ctx, "offsets:"+keyPrefix, id).Result()
+		if err == nil {
+			if off, err := strconv.ParseUint(s, 10, 64); err == nil {
+				return off
+			}
+		} else if err != redis.Nil {
+			captureError(r, "(warn) redis HGET failed: %v", err)
+		}
+	}
+	return displayOffsets[id]
+}
+
+// display turns a stored value into the public one: id's display offset is
+// added, then it is rounded.
+func display(r *http.Request, id string, v core.Value) core.Value {
+	return v.Offset(displayOffset(r, id)).Round(roundStep(r, id))
+}
+
+// readCache (READ_CACHE_TTL, READ_CACHE_SIZE) keeps public reads in memory
+// for a short time while the function instance stays warm; nil when off.
+var readCache = mustReadCache()
+
+func mustReadCache() *store.ReadCache {
+	c, err := store.ReadCacheFromEnv()
+	if err != nil {
+		log.Fatalf("(error) %v", err)
+	}
+	return c
+}
+
+// lastKnown is readCache or, when that is off, a cache that serves nothing
+// fresh but still remembers the values last read and written here, to answer
+// with while the store is down.
+var lastKnown = orLastKnown(readCache)
+
+func orLastKnown(c *store.ReadCache) *store.ReadCache {
+	if c == nil {
+		return store.NewReadCache(0, 0)
+	}
+	return c
+}
+
+func cachePut(id string, v core.Value) {
+	lastKnown.Put(id, v)
+	recordHistory(id, v)
+}
+
+// historyInterval and historyRetention are HISTORY_INTERVAL and
+// HISTORY_RETENTION. With Redis every write also sets the counter's snapshot
+// of the current interval for /history; without it there is no history.
+var historyInterval, historyRetention = mustHistory()
+
+func mustHistory() (time.Duration, time.Duration) {
+	interval, retention, err := web.HistoryFromEnv()
+	if err != nil {
+		log.Fatalf("(error) %v", err)
+	}
+	return interval, retention
+}
+
+func recordHistory(id string, v core.Value) {
+	rc := getRedis()
+	if rc == nil || historyInterval == 0 || core.IsTestID(id) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	slot := core.HistorySlot(core.Now(), historyInterval)
+	if err := store.NewRedisCounterFromClient(rc, keyPrefix).RecordHistory(ctx, id, slot, v, historyRetention); err != nil {
+		log.Printf("(warn) redis history record failed: %v", err)
+	}
+}
+
+// lastPublic returns the last known values offset and rounded as public
+// reads show them; lastKnown.Last returns them as stored.
+func lastPublic(r *http.Request) web.LastKnown {
+	return func(id string) (core.Value, time.Time, bool) {
+		v, at, ok := lastKnown.Last(id)
+		return display(r, id, v), at, ok
+	}
+}
+
+// storeUnavailable answers 503 for a failed store call, with Retry-After and
+// fields, e.g. from web.Stale.
+func storeUnavailable(w http.ResponseWriter, fields map[string]any) {
+	web.WriteUnavailable(w, web.StoreRetryAfter, fields)
+}
+
+// maxHitBy (MAX_HIT_BY) is the most hits one /hit?by=N may record.
+var maxHitBy = mustMaxHitBy()
+
+func mustMaxHitBy() uint64 {
+	n, err := web.MaxHitByFromEnv()
+	if err != nil {
+		log.Fatalf("(error) %v", err)
+	}
+	return n
+}
+
+// COMPAT gives /hit and /count responses another hit counter's keys.
+func init() {
+	if err := web.CompatFromEnv(); err != nil {
+		log.Fatalf("(error) %v", err)
+	}
+}
+
+// ID_NORMALIZE makes ids that differ only in Unicode form (or case) one id.
+func init() {
+	if _, err := web.IDNormFromEnv(); err != nil {
+		log.Fatalf("(error) %v", err)
+	}
+}
+
+// TRUST_PROXY is how many proxies report client IPs in X-Forwarded-For. On
+// Vercel (VERCEL is set) it defaults to 1, its edge, which replaces any
+// X-Forwarded-For the client sent.
+func init() {
+	def := 0
+	if os.Getenv("VERCEL") != "" {
+		def = 1
+	}
+	if _, err := web.TrustProxyFromEnv(def); err != nil {
+		log.Fatalf("(error) %v", err)
+	}
+}
+
+// compatRoutes are the services named in COMPAT_ROUTES whose badge URLs
+// serve answers.
+var compatRoutes = mustCompatRoutes()
+
+func mustCompatRoutes() map[string]bool {
+	on, err := web.CompatRoutesFromEnv()
+	if err != nil {
+		log.Fatalf("(error) %v", err)
+	}
+	return on
+}
+
+// maxValues are the MAX_VALUES caps: per-counter maximums and overflow
+// policies.
+var maxValues = mustMaxValues()
+
+func mustMaxValues() map[string]core.Cap {
+	caps, err := web.CapsFromEnv()
+	if err != nil {
+		log.Fatalf("(error) %v", err)
+	}
+	return caps
+}
+
+// capHit adds a hit of n to id through tx and applies id's MAX_VALUES cap
+// in the same transaction (store.ApplyCapped), after an if_below check when
+// below > 0. A hit the cap refuses returns a *core.OverflowError.
+func capHit(ctx context.Context, tx store.Transactor, id string, n, below uint64) (core.CappedHit, error) {
+	c, _ := core.CapFor(maxValues, id)
+	var guards []store.Op
+	if below > 0 {
+		guards = ifBelowOps(id, below, n)[:1]
+	}
+	hits, err := store.ApplyCapped(ctx, tx, guards, []store.Op{{Kind: store.OpInc, ID: id, N: n}}, func(string) (core.Cap, bool) { return c, true })
+	if err != nil {
+		return core.CappedHit{}, err
+	}
+	if h := hits[0]; h.Rejected {
+		return h, &core.OverflowError{ID: id, Max: c.Max, Hits: h.To}
+	}
+	return hits[0], nil
+}
+
+// writeOverflow refuses a hit past a counter's max with 409.
+func writeOverflow(w http.ResponseWriter, r *http.Request, over *core.OverflowError, fields map[string]any) {
+	body := map[string]any{"error": over.Error(), "id": over.ID, "hits": display(r, over.ID, core.Uint(over.Hits)), "max": over.Max}
+	for k, v := range fields {
+		body[k] = v
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// ifBelowOps add n hits to id in a transaction only while it is below
+// below (/hit?if_below=).
+func ifBelowOps(id string, below, n uint64) []store.Op {
+	return []store.Op{{Kind: store.OpBelow, ID: id, N: below}, {Kind: store.OpInc, ID: id, N: n}}
+}
+
+// refusedIfBelow answers a hit whose if_below transaction err refused, and
+// reports whether it did.
+func refusedIfBelow(w http.ResponseWriter, r *http.Request, id string, below uint64, idemKey string, err error) bool {
+	var mismatch *store.MismatchError
+	switch {
+	case errors.As(err, &mismatch):
+		releaseIdempotencyKey(r, id, idemKey)
+		writeIfBelow(w, r, id, below, mismatch.Current, nil)
+	case errors.Is(err, store.ErrNotInteger):
+		releaseIdempotencyKey(r, id, idemKey)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	default:
+		return false
+	}
+	return true
+}
+
+// claimGauge fixes id's gauge type at its first write, in Redis or a
+// STORAGE backend with a settings table (store.GaugeTable), and refuses a
+// write of another type with 409. It reports whether the write may go on.
+func claimGauge(w http.ResponseWriter, r *http.Request, id, kind string) bool {
+	if id == "" {
+		id = "default"
+	}
+	var settings store.Settings
+	if rc := getRedis(); rc != nil {
+		settings = store.NewRedisCounterFromClient(rc, keyPrefix)
+	} else if s, ok := getStore().(store.Settings); ok {
+		settings = s
+	} else {
+		return true // the memory fallback has no gauges
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+	defer cancel()
+	var mismatch *store.GaugeTypeError
+	switch err := store.ClaimGauge(ctx, settings, id, kind); {
+	case errors.As(err, &mismatch):
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return false
+	case err != nil:
+		captureError(r, "(warn) gauge type lookup failed: %v", err)
+		storeUnavailable(w, nil)
+		return false
+	}
+	return true
+}
+
+// writeIfBelow refuses a hit on id, whose stored value is hits, that
+// if_below=below does not allow with 412.
+func writeIfBelow(w http.ResponseWriter, r *http.Request, id string, below, hits uint64, fields map[string]any) {
+	body := map[string]any{"error": web.IfBelowError(id, below), "id": id, "hits": display(r, id, core.Uint(hits)), "if_below": below}
+	for k, v := range fields {
+		body[k] = v
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusPreconditionFailed)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// rateLimit (RATE_LIMIT) caps requests per client; nil when off. Windows are
+// counted in Redis (store.RedisCounter.RateWindow) so every function
+// instance shares them; without Redis each warm instance counts its own.
+var rateLimit = mustRateLimit()
+
+func mustRateLimit() *web.RateLimit {
+	l, err := web.RateLimitFromEnv()
+	if err != nil {
+		log.Fatalf("(error) %v", err)
+	}
+	return l
+}
+
+// allowRate counts r against RATE_LIMIT and sets the rate-limit headers;
+// false means r was answered with 429.
+func allowRate(w http.ResponseWriter, r *http.Request) bool {
+	if rateLimit == nil || r.Method == http.MethodOptions {
 		return true
 	}
-	return false
+	now := core.Now()
+	reset, client := rateLimit.Reset(now), web.ClientIP(r)
+	if rc := getRedis(); rc != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+		defer cancel()
+		n, err := store.NewRedisCounterFromClient(rc, keyPrefix).RateWindow(ctx, client, reset, rateLimit.Window)
+		if err == nil {
+			return rateLimit.Allow(w, n, reset)
+		}
+		log.Printf("(warn) redis rate limit failed, counting in memory: %v", err)
+	}
+	return rateLimit.Allow(w, rateLimit.Take(client, now), reset)
 }
 
-func Handler(w http.ResponseWriter, r *http.Request) {
-	switch r.URL.Path {
-	case "/hit":
-		// Only the mutating endpoint (/hit) is protected by auth so badges/counts can be public.
-		if !authorize(r) {
-			w.WriteHeader(http.StatusUnauthorized)
-			_ = json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+// publicCount is readCount offset and rounded for public display; the admin
+// routes keep the stored values.
+func publicCount(r *http.Request, id string) core.Value {
+	v, ok := lastKnown.Get(id)
+	if !ok {
+		v = readCount(r, id)
+		lastKnown.Put(id, v)
+	}
+	return display(r, id, v)
+}
+
+// badgeMins are the BADGE_MIN thresholds below which badges show "<N".
+var badgeMins = mustBadgeMins()
+
+func mustBadgeMins() map[string]uint64 {
+	mins, err := web.BadgeMinFromEnv()
+	if err != nil {
+		log.Fatalf("(error) %v", err)
+	}
+	return mins
+}
+
+// badgeMin returns id's badge threshold: the min query param when given
+// (min=0 turns it off), otherwise BADGE_MIN.
+func badgeMin(r *http.Request, id string) uint64 {
+	if m, err := strconv.ParseUint(r.URL.Query().Get("min"), 10, 64); err == nil {
+		return m
+	}
+	if m, ok := badgeMins[id]; ok {
+		return m
+	}
+	return badgeMins[core.RoundingDefault]
+}
+
+// badgeTarget reads the goal of target badges (target=10000): 0, meaning a
+// plain badge, when unset or invalid.
+func badgeTarget(r *http.Request) uint64 {
+	target, _ := strconv.ParseUint(r.URL.Query().Get("target"), 10, 64)
+	return target
+}
+
+// badgeValue renders id's val with the badge format controls: precision=N
+// rounds float counters to N decimals, suffix is appended (e.g.
+// suffix=%20MB) and values below the badge threshold show as "<N";
+// uniques=1 appends the unique visitors when they are counted. target=N
+// shows val against that goal ("7,842 / 10k", or "78%" with
+// style=progress). With style=velocity, val is the hourly rate from
+// badgeRead.
+func badgeValue(r *http.Request, id string, val core.Value) string {
+	style := r.URL.Query().Get("style")
+	if style == "velocity" {
+		return core.Velocity{PerHour: val.Float64()}.BadgeText()
+	}
+	target := badgeTarget(r)
+	if target > 0 && style == "progress" {
+		text, _ := core.Progress(val, target, badgeMin(r, id))
+		return text
+	}
+	precision := -1
+	if p, err := strconv.Atoi(r.URL.Query().Get("precision")); err == nil && p >= 0 && p <= 6 {
+		precision = p
+	}
+	min := badgeMin(r, id)
+	text := val.FormatMin(precision, r.URL.Query().Get("suffix"), min)
+	if target > 0 {
+		return core.TargetText(text, target)
+	}
+	if r.URL.Query().Get("uniques") != "1" || !tracksUniques(id) {
+		return text
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+	defer cancel()
+	n, err := uniqueCount(ctx, id)
+	if err != nil {
+		captureError(r, "(warn) redis unique visitors read failed: %v", err)
+		return text
+	}
+	return web.WithUniques(text, n, min)
+}
+
+var (
+	signingKeyOnce sync.Once
+	signingKey     ed25519.PrivateKey
+)
+
+// getSigningKey loads VERIFY_SIGNING_KEY (base64 Ed25519 seed); nil when unset or invalid.
+func getSigningKey() ed25519.PrivateKey {
+	signingKeyOnce.Do(func() {
+		k := os.Getenv("VERIFY_SIGNING_KEY")
+		if k == "" {
 			return
 		}
-		if r.Method != http.MethodGet && r.Method != http.MethodPost {
-			w.Header().Set("Allow", "GET, POST")
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			_ = json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+		key, err := core.ParseSigningKey(k)
+		if err != nil {
+			log.Printf("(warn) invalid VERIFY_SIGNING_KEY, /verify disabled: %v", err)
 			return
 		}
-		var newVal uint64
-		id := r.URL.Query().Get("id")
-		if id == "" {
-			id = "home" // default page id
-		}
-		// Prefer Redis if configured
-		if rc := getRedis(); rc != nil {
-			ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
-			defer cancel()
-			v, err := rc.Incr(ctx, "hits:"+id).Result()
-			if err == nil {
-				newVal = uint64(v)
-			} else {
-				log.Printf("(warn) redis INCR failed (falling back to memory): %v", err)
-			}
+		signingKey = key
+	})
+	return signingKey
+}
+
+// recordMilestones appends an event to "milestones:<keyPrefix><id>" (newest first,
+// capped at 50) for each milestone crossed between prev and next.
+func recordMilestones(ctx context.Context, rc redis.UniversalClient, id string, prev, next uint64) {
+	if core.IsTestID(id) {
+		return
+	}
+	for _, m := range core.MilestonesCrossed(prev, next) {
+		b, _ := json.Marshal(core.MilestoneEvent{ID: id, Milestone: m, At: core.Now().UTC()})
+		pipe := rc.TxPipeline()
+		pipe.LPush(ctx, "milestones:"+keyPrefix+id, b)
+		pipe.LTrim(ctx, "milestones:"+keyPrefix+id, 0, 49)
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Printf("(warn) redis milestone record failed: %v", err)
 		}
-		if newVal == 0 { // fallback path
-			newVal = globalCount.Add(1)
+	}
+}
+
+// recordChange marks id as changed now in the "changes:<keyPrefix>" sorted set read by /changes.
+func recordChange(ctx context.Context, rc redis.UniversalClient, id string) {
+	if core.IsTestID(id) {
+		return
+	}
+	if err := rc.ZAdd(ctx, "changes:"+keyPrefix, redis.Z{Score: float64(core.Now().UnixMicro()), Member: id}).Err(); err != nil {
+		log.Printf("(warn) redis change log failed: %v", err)
+	}
+}
+
+// recordHitMeta adds n hits that took id from prev to prev+n to the
+// "meta:<keyPrefix><id>" hash read by /counter/meta.
+func recordHitMeta(ctx context.Context, rc redis.UniversalClient, id string, prev, n uint64) {
+	if core.IsTestID(id) {
+		return
+	}
+	if err := store.NewRedisCounterFromClient(rc, keyPrefix).RecordHit(ctx, id, prev, n, core.Now()); err != nil {
+		log.Printf("(warn) redis counter metadata failed: %v", err)
+	}
+}
+
+// addTimes fills in c's first-seen and last-hit times from the counter
+// metadata when the fields param asks for them (fields=hits,lastHit). The
+// metadata is kept in Redis only.
+func addTimes(r *http.Request, id string, c *web.Counter) {
+	rc := getRedis()
+	if rc == nil || !(web.FieldRequested(r, "firstSeen") || web.FieldRequested(r, "lastHit")) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+	defer cancel()
+	m, err := store.NewRedisCounterFromClient(rc, keyPrefix).Meta(ctx, id)
+	if err != nil {
+		captureError(r, "(warn) redis counter metadata read failed: %v", err)
+		return
+	}
+	c.FirstSeen, c.LastHit = m.FirstSeen, m.LastHit
+}
+
+// counterValues returns every counter in namespace ns ("" for all of them)
+// but playground ones and day buckets; ok is false when the store cannot
+// list counters.
+func counterValues(ctx context.Context, ns string) (hits map[string]core.Value, ok bool, err error) {
+	var lister store.Lister
+	if rc := getRedis(); rc != nil {
+		lister = store.NewRedisCounterFromClient(rc, keyPrefix)
+	} else if l, isLister := getStore().(store.Lister); isLister {
+		lister = l
+	} else {
+		return nil, false, nil
+	}
+	hits = make(map[string]core.Value)
+	err = lister.Each(ctx, func(id string, v core.Value) error {
+		if !core.IsTestID(id) && !core.IsDayBucketID(id) && (ns == "" || core.InNamespace(id, ns)) {
+			hits[id] = v
 		}
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "hits": newVal, "source": func() string {
-			if getRedis() != nil {
-				return "redis"
-			}
-			return "memory"
-		}()})
-	case "/count":
+		return nil
+	})
+	if err != nil {
+		return nil, true, err
+	}
+	return hits, true, nil
+}
+
+// listCounters returns the counterValues of namespace ns with their
+// metadata, least recently hit first. Without Redis the metadata is empty.
+func listCounters(ctx context.Context, ns string) (list []core.CounterMeta, ok bool, err error) {
+	hits, ok, err := counterValues(ctx, ns)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	rc := getRedis()
+	ids := make([]string, 0, len(hits))
+	for id := range hits {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if rc != nil {
+		rcc := store.NewRedisCounterFromClient(rc, keyPrefix)
+		for start := 0; start < len(ids); start += 500 {
+			ms, err := rcc.MetaMany(ctx, ids[start:min(start+500, len(ids))])
+			if err != nil {
+				return nil, true, err
+			}
+			list = append(list, ms...)
+		}
+	} else {
+		for _, id := range ids {
+			list = append(list, core.CounterMeta{ID: id})
+		}
+	}
+	for i := range list {
+		list[i].Hits = hits[list[i].ID]
+	}
+	core.SortByLastHit(list)
+	return list, true, nil
+}
+
+// groups are the GROUPS that /count?group= and /badge?group= add up.
+var groups = mustGroups()
+
+func mustGroups() map[string][]string {
+	g, err := web.GroupsFromEnv()
+	if err != nil {
+		log.Fatalf("(error) %v", err)
+	}
+	return g
+}
+
+// groupTotal adds up the public counts of group name's members, each counter
+// once and each passing allowRead. done is true once it has answered
+// instead: for an unknown group, a refused read or a failed listing.
+func groupTotal(w http.ResponseWriter, r *http.Request, name string) (total core.Aggregate, done bool) {
+	fail := func(status int, msg string) (core.Aggregate, bool) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+		return total, true
+	}
+	members, ok := groups[name]
+	if !ok {
+		return fail(http.StatusNotFound, "unknown group; define it in GROUPS")
+	}
+	ids, namespaces := core.GroupMembers(members)
+	values := make(map[string]core.Value)
+	for _, ns := range namespaces {
+		hits, ok, err := counterValues(r.Context(), ns)
+		switch {
+		case !ok:
+			return fail(http.StatusNotImplemented, "namespace members need redis or a STORAGE backend that can list counters")
+		case err != nil:
+			captureError(r, "(warn) group listing failed: %v", err)
+			storeUnavailable(w, nil)
+			return total, true
+		}
+		for id, v := range hits {
+			values[id] = display(r, id, v)
+		}
+	}
+	for _, id := range ids {
+		if _, listed := values[id]; !listed {
+			values[id] = publicCount(r, id)
+		}
+	}
+	for id, v := range values {
+		if !allowRead(w, r, id) {
+			return total, true
+		}
+		total.Add(v)
+	}
+	return total, false
+}
+
+// uniqueIDs are the counters whose unique visitors (hashed IP and
+// User-Agent) are counted, from UNIQUES, in the Redis HyperLogLog
+// "uniques:<keyPrefix><id>"; without Redis nothing is counted.
+var uniqueIDs = web.UniquesFromEnv()
+
+func tracksUniques(id string) bool {
+	return getRedis() != nil && web.TracksUniques(uniqueIDs, id)
+}
+
+// recordUnique adds the visitor sending r to id's unique visitors; a ttl > 0
+// expires them with the counter the hit created.
+func recordUnique(ctx context.Context, rc redis.UniversalClient, r *http.Request, id string, ttl time.Duration) {
+	if !web.TracksUniques(uniqueIDs, id) {
+		return
+	}
+	if err := store.NewRedisCounterFromClient(rc, keyPrefix).AddUnique(ctx, id, web.UniqueVisitor(r), ttl); err != nil {
+		log.Printf("(warn) redis unique visitors failed: %v", err)
+	}
+}
+
+// uniqueCount estimates id's unique visitors.
+func uniqueCount(ctx context.Context, id string) (uint64, error) {
+	return store.NewRedisCounterFromClient(getRedis(), keyPrefix).Uniques(ctx, id)
+}
+
+// dayBuckets (DAY_BUCKETS, on by default) also counts hits per UTC day, in
+// "<id>:YYYYMMDD" counters next to the total, for period reads. The memory
+// fallback and stores without atomic increments (store.FeatureTimeSeries)
+// keep no buckets.
+var dayBuckets = web.DayBucketsFromEnv()
+
+// errNoDayBuckets is returned by bucketCounts for the memory fallback and
+// stores without store.FeatureTimeSeries.
+var errNoDayBuckets = errors.New("day buckets (period counts, velocity and charts) require redis or a STORAGE backend")
+
+// recordBucket adds n hits to id's bucket for today, which expires
+// core.DayBucketTTL after its first hit; playground counters have none.
+func recordBucket(ctx context.Context, r *http.Request, id string, n uint64) {
+	if !dayBuckets || core.IsTestID(id) {
+		return
+	}
+	bucket := core.DayBucketID(id, core.Now())
+	var err error
+	if rc := getRedis(); rc != nil {
+		// the bucket only gets hits today, so renewing the TTL on each
+		// keeps it at most a day longer
+		_, err = rc.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.IncrBy(ctx, keyPrefix+bucket, int64(n))
+			p.Expire(ctx, keyPrefix+bucket, core.DayBucketTTL)
+			return nil
+		})
+	} else if st := getStore(); st != nil && store.Supports(st, store.FeatureTimeSeries) == nil {
+		var v uint64
+		if a, ok := st.(store.Adder); ok {
+			v, err = a.IncBy(ctx, bucket, n)
+		} else if n == 1 {
+			v, err = st.Inc(ctx, bucket)
+		} else {
+			err = store.ErrUnsupported
+		}
+		if e, ok := st.(store.Expirer); ok && err == nil && v == n {
+			err = e.Expire(ctx, bucket, core.DayBucketTTL)
+		}
+	}
+	if err != nil {
+		captureError(r, "(warn) day bucket increment failed: %v", err)
+	}
+}
+
+// bucketCounts reads id's day buckets for days.
+func bucketCounts(r *http.Request, id string, days []time.Time) ([]uint64, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+	defer cancel()
+	counts := make([]uint64, len(days))
+	switch rc, st := getRedis(), getStore(); {
+	case rc != nil:
+		keys := make([]string, len(days))
+		for i, day := range days {
+			keys[i] = keyPrefix + core.DayBucketID(id, day)
+		}
+		vals, ok, err := store.GetMany(ctx, rc, keys)
+		if err != nil {
+			return nil, err
+		}
+		for i, s := range vals {
+			if ok[i] {
+				counts[i], _ = strconv.ParseUint(s, 10, 64)
+			}
+		}
+	case st != nil:
+		if err := store.Supports(st, store.FeatureTimeSeries); err != nil {
+			return nil, fmt.Errorf("%w: %w", errNoDayBuckets, err)
+		}
+		for i, day := range days {
+			v, err := st.Get(ctx, core.DayBucketID(id, day))
+			if err != nil {
+				return nil, err
+			}
+			counts[i] = v.Uint64()
+		}
+	default:
+		return nil, errNoDayBuckets
+	}
+	return counts, nil
+}
+
+// periodCount sums id's day buckets over period (today, week or month),
+// rounded for public display; display offsets only apply to totals.
+func periodCount(r *http.Request, id, period string) (core.Value, error) {
+	days, _ := core.PeriodDays(period, core.Now())
+	counts, err := bucketCounts(r, id, days)
+	if err != nil {
+		return core.Value{}, err
+	}
+	var sum uint64
+	for _, n := range counts {
+		sum += n
+	}
+	return core.Uint(sum).Round(roundStep(r, id)), nil
+}
+
+// velocity estimates id's hits per hour and per day over the last 24 hours
+// from its buckets for today and yesterday.
+func velocity(r *http.Request, id string) (core.Velocity, error) {
+	now := core.Now()
+	today := now.UTC().Truncate(24 * time.Hour)
+	counts, err := bucketCounts(r, id, []time.Time{today, today.AddDate(0, 0, -1)})
+	if err != nil {
+		return core.Velocity{}, err
+	}
+	return core.NewVelocity(counts[0], counts[1], now, roundStep(r, id)), nil
+}
+
+// addVelocity fills in id's velocity when the fields param asks for it
+// (fields=hits,velocity).
+func addVelocity(r *http.Request, id string, c *web.Counter) {
+	if !web.FieldRequested(r, "velocity") {
+		return
+	}
+	v, err := velocity(r, id)
+	if err != nil {
+		if !errors.Is(err, errNoDayBuckets) {
+			captureError(r, "(warn) day bucket read failed: %v", err)
+		}
+		return
+	}
+	c.Velocity = &v
+}
+
+// badgeRead reads the count shown on id's badge: the public total,
+// answering 304 for If-Modified-Since, or with period=today|week|month the
+// sum of its day buckets. With style=velocity it is the hourly rate
+// instead, which badgeValue shows as "12/hr". done is true once it has
+// written the response.
+func badgeRead(w http.ResponseWriter, r *http.Request, id string) (val core.Value, done bool) {
+	if r.URL.Query().Get("style") == "velocity" {
+		v, err := velocity(r, id)
+		switch {
+		case errors.Is(err, errNoDayBuckets):
+			w.WriteHeader(http.StatusNotImplemented)
+			_, _ = w.Write([]byte(err.Error()))
+			return core.Value{}, true
+		case err != nil:
+			captureError(r, "(error) day bucket read failed: %v", err)
+		}
+		return core.Float(v.PerHour), false
+	}
+	period, err := web.ParsePeriod(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return core.Value{}, true
+	}
+	if period == "" {
+		return conditionalRead(w, r, id, func() core.Value { return publicCount(r, id) })
+	}
+	val, err = periodCount(r, id, period)
+	switch {
+	case errors.Is(err, errNoDayBuckets):
+		w.WriteHeader(http.StatusNotImplemented)
+		_, _ = w.Write([]byte(err.Error()))
+		return core.Value{}, true
+	case err != nil:
+		captureError(r, "(error) day bucket read failed: %v", err)
+	}
+	return val, false
+}
+
+// deleteRetention is DELETE_RETENTION. Deleted counters are kept in the
+// Redis hash "deleted:<keyPrefix>" for it; with no background work between
+// requests, later deletes and restores purge the expired ones.
+var deleteRetention = mustDeleteRetention()
+
+func mustDeleteRetention() time.Duration {
+	d, err := web.DeleteRetentionFromEnv()
+	if err != nil {
+		log.Fatalf("(error) %v", err)
+	}
+	return d
+}
+
+// purgeTombstones deletes the counters whose DELETE_RETENTION has passed
+// for good.
+func purgeTombstones(ctx context.Context, r *http.Request, rs *store.RedisCounter) {
+	tombs, err := rs.Tombstones(ctx)
+	if err != nil {
+		captureError(r, "(warn) redis deleted counters read failed: %v", err)
+		return
+	}
+	for _, t := range tombs {
+		if !t.Expired(deleteRetention, core.Now()) {
+			continue
+		}
+		if err := rs.PurgeTombstone(ctx, t.ID); err != nil {
+			captureError(r, "(warn) redis deleted counter purge failed: %v", err)
+			return
+		}
+	}
+}
+
+// deleteCounter serves DELETE /counter?id=foo: the counter goes back to
+// zero, and the hits it held are kept for DELETE_RETENTION so
+// POST /counter/restore can undo it. Needs Redis.
+func deleteCounter(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodDelete)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if !authorizeID(r, id) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+		return
+	}
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "id is required"})
+		return
+	}
+	rc := getRedis()
+	if rc == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "deleting counters requires redis; POST /reset sets one to 0"})
+		return
+	}
+	if isFrozen(r, id) {
+		w.WriteHeader(http.StatusLocked)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "counter is frozen; unfreeze it with DELETE /admin/freeze first"})
+		return
+	}
+	if dry, _ := strconv.ParseBool(r.URL.Query().Get("dryRun")); dry {
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "hits": 0, "deleted": true, "dryRun": true})
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+	rs := store.NewRedisCounterFromClient(rc, keyPrefix)
+	purgeTombstones(ctx, r, rs)
+	// zero it only if no hit came in since reading it, so every hit is kept
+	var prev uint64
+	var err error
+	var mismatch *store.MismatchError
+	for attempt := 0; attempt < 3; attempt++ {
+		var v core.Value
+		if v, err = rs.Get(ctx, id); err != nil {
+			break
+		}
+		if v.IsFloat() {
+			err = store.ErrNotInteger
+			break
+		}
+		prev = v.Uint64()
+		_, err = rs.Apply(ctx, []store.Op{{Kind: store.OpExpect, ID: id, N: prev}, {Kind: store.OpSet, ID: id}})
+		if !errors.As(err, &mismatch) {
+			break
+		}
+	}
+	switch {
+	case errors.Is(err, store.ErrNotInteger), errors.As(err, &mismatch):
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	case err != nil:
+		captureError(r, "(error) delete failed: %v", err)
+		storeUnavailable(w, web.Stale(lastKnown.Last, id))
+		return
+	}
+	tomb, err := rs.AddTombstone(ctx, core.Tombstone{ID: id, Hits: prev, DeletedAt: core.Now().UTC()})
+	if err != nil { // put the hits back rather than lose them
+		captureError(r, "(error) saving deleted counter failed: %v", err)
+		if _, err := rs.IncBy(ctx, id, prev); err != nil {
+			captureError(r, "(error) undoing delete failed: %v", fmt.Errorf("%s lost %d hits: %w", id, prev, err))
+		}
+		storeUnavailable(w, web.Stale(lastKnown.Last, id))
+		return
+	}
+	recordChange(ctx, rc, id)
+	if !core.IsTestID(id) {
+		if err := rs.RecordReset(ctx, id, prev, core.Now()); err != nil {
+			log.Printf("(warn) redis counter metadata failed: %v", err)
+		}
+	}
+	if tracksUniques(id) { // a deleted counter forgets its unique visitors, as a reset does
+		if err := rs.ResetUniques(ctx, id); err != nil {
+			captureError(r, "(warn) redis unique visitors reset failed: %v", err)
+		}
+	}
+	cachePut(id, core.Uint(0))
+	_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "hits": 0, "deleted": true, "restorable_until": tomb.RestorableUntil(deleteRetention)})
+}
+
+// restoreCounter serves POST /counter/restore?id=foo, which undoes
+// DELETE /counter within DELETE_RETENTION: the hits the counter held are
+// added to any counted since.
+func restoreCounter(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if !authorizeID(r, id) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+		return
+	}
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "id is required"})
+		return
+	}
+	rc := getRedis()
+	if rc == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "deleting counters requires redis"})
+		return
+	}
+	if isFrozen(r, id) {
+		w.WriteHeader(http.StatusLocked)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "counter is frozen; unfreeze it with DELETE /admin/freeze first"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+	rs := store.NewRedisCounterFromClient(rc, keyPrefix)
+	purgeTombstones(ctx, r, rs)
+	dry, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	lookup := rs.TakeTombstone
+	if dry {
+		lookup = rs.GetTombstone
+	}
+	tomb, ok, err := lookup(ctx, id)
+	switch {
+	case err != nil:
+		captureError(r, "(error) redis deleted counter read failed: %v", err)
+		storeUnavailable(w, web.Stale(lastKnown.Last, id))
+		return
+	case !ok || tomb.Expired(deleteRetention, core.Now()):
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "no deleted counter " + id + " to restore"})
+		return
+	}
+	if dry {
+		cur := publicCount(r, id)
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "hits": cur.Add(tomb.Hits), "restored": true, "dryRun": true})
+		return
+	}
+	v, err := rs.IncBy(ctx, id, tomb.Hits)
+	if err != nil {
+		captureError(r, "(error) restore failed: %v", err)
+		if err := rs.SetTombstone(ctx, tomb); err != nil {
+			captureError(r, "(error) saving deleted counter failed: %v", fmt.Errorf("%s lost %d hits: %w", id, tomb.Hits, err))
+		}
+		storeUnavailable(w, web.Stale(lastKnown.Last, id))
+		return
+	}
+	recordChange(ctx, rc, id)
+	cachePut(id, core.Uint(v))
+	_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "hits": display(r, id, core.Uint(v)), "restored": true})
+}
+
+// resetNamespace sets every counter of namespace ns back to zero, as
+// DELETE /counter does for one. Frozen and float counters are left as they
+// are and listed in the response.
+func resetNamespace(ctx context.Context, w http.ResponseWriter, r *http.Request, ns string) {
+	if ns == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "namespace is required"})
+		return
+	}
+	status, msg := 0, ""
+	hits, ok, err := counterValues(ctx, ns)
+	switch {
+	case !ok:
+		status, msg = http.StatusNotImplemented, "resetting a namespace requires redis or a store that can list counters"
+	case err != nil:
+		captureError(r, "(error) counter listing failed: %v", err)
+		web.SetRetryAfter(w.Header(), web.StoreRetryAfter)
+		status, msg = http.StatusServiceUnavailable, "store unavailable"
+	case getRedis() == nil:
+		if err := store.Supports(getStore(), store.FeatureTx); err != nil {
+			status, msg = http.StatusNotImplemented, err.Error()
+		}
+	}
+	if status != 0 {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+		return
+	}
+	ids := make([]string, 0, len(hits))
+	for id := range hits {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	resetIDs := []string{}
+	var frozen, floats []string
+	for _, id := range ids {
+		switch {
+		case isFrozen(r, id):
+			frozen = append(frozen, id)
+		case hits[id].IsFloat():
+			floats = append(floats, id)
+		default:
+			resetIDs = append(resetIDs, id)
+		}
+	}
+	resp := map[string]any{"namespace": ns, "reset": resetIDs}
+	if len(frozen) > 0 {
+		resp["frozen"] = frozen
+	}
+	if len(floats) > 0 {
+		resp["float"] = floats
+	}
+	if dry, _ := strconv.ParseBool(r.URL.Query().Get("dryRun")); dry {
+		resp["dryRun"] = true
+		_ = json.NewEncoder(w).Encode(resp)
+		return
+	}
+	for i, id := range resetIDs {
+		if err := setCounter(ctx, id, 0); err != nil {
+			captureError(r, "(error) namespace reset failed: %v", err)
+			storeUnavailable(w, map[string]any{"reset": resetIDs[:i]})
+			return
+		}
+		if tracksUniques(id) {
+			if err := store.NewRedisCounterFromClient(getRedis(), keyPrefix).ResetUniques(ctx, id); err != nil {
+				captureError(r, "(warn) redis unique visitors reset failed: %v", err)
+			}
+		}
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// badgeUsage counts badge requests in memory when Redis is not configured;
+// with Redis they go to the "badgeusage:<keyPrefix>" hash, shared by every
+// instance.
+var badgeUsage web.BadgeUsage
+
+// recordBadgeUsage counts a badge request on route for /admin/stats and
+// /metrics.
+func recordBadgeUsage(r *http.Request, route string) {
+	rc := getRedis()
+	if rc == nil {
+		badgeUsage.Record(route, r.URL.Query())
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+	_, err := rc.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for _, k := range web.BadgeUsageKeys(route, r.URL.Query()) {
+			p.HIncrBy(ctx, "badgeusage:"+keyPrefix, k, 1)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("(warn) redis badge usage failed: %v", err)
+	}
+}
+
+// badgeUsageReport reads the badge usage counters.
+func badgeUsageReport(ctx context.Context) (web.BadgeUsageReport, error) {
+	rc := getRedis()
+	if rc == nil {
+		return web.NewBadgeUsageReport(badgeUsage.Counts()), nil
+	}
+	h, err := rc.HGetAll(ctx, "badgeusage:"+keyPrefix).Result()
+	if err != nil {
+		return web.BadgeUsageReport{}, err
+	}
+	counts := make(map[string]uint64, len(h))
+	for k, v := range h {
+		counts[k], _ = strconv.ParseUint(v, 10, 64)
+	}
+	return web.NewBadgeUsageReport(counts), nil
+}
+
+// startedAt is the floor for Last-Modified: DISPLAY_OFFSETS, ROUND_COUNTS
+// and the badge renderer may have changed with the deployment.
+var startedAt = time.Now()
+
+// conditionalRead reads id's public value with get and sets Last-Modified
+// from the change log ("changes:<keyPrefix>", so only with Redis), reporting
+// true once it has answered 304 for If-Modified-Since. A counter that reads
+// zero gets no Last-Modified, as it may have expired without a logged change.
+func conditionalRead(w http.ResponseWriter, r *http.Request, id string, get func() core.Value) (core.Value, bool) {
+	rc := getRedis()
+	if rc == nil || core.IsTestID(id) {
+		return get(), false
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+	score, err := rc.ZScore(ctx, "changes:"+keyPrefix, id).Result()
+	cancel()
+	val := get()
+	if err != nil || val.IsZero() {
+		return val, false
+	}
+	changed := time.UnixMicro(int64(score))
+	if changed.Before(startedAt) {
+		changed = startedAt
+	}
+	// Changes newer than this may not show yet in the warm-up value or
+	// the read cache.
+	settle := time.Second + warmValueMaxAge
+	if readCache != nil {
+		settle += readCache.TTL
+	}
+	return val, web.NotModified(w, r, changed, settle)
+}
+
+// setCounter overwrites id with v: Redis keeps the key's expiry, so
+// playground counters still go; other stores need transactions (check
+// store.FeatureTx first), and the memory fallback is a single counter shared
+// by every id.
+func setCounter(ctx context.Context, id string, v uint64) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	if rc := getRedis(); rc != nil {
+		old, err := rc.SetArgs(ctx, keyPrefix+id, v, redis.SetArgs{KeepTTL: true, Get: true}).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		recordChange(ctx, rc, id)
+		if old == "" { // new counter
+			old = "0"
+		}
+		// float counters ("1.5") have no metadata
+		if prev, err := strconv.ParseUint(old, 10, 64); err == nil && !core.IsTestID(id) {
+			if err := store.NewRedisCounterFromClient(rc, keyPrefix).RecordReset(ctx, id, prev, core.Now()); err != nil {
+				log.Printf("(warn) redis counter metadata failed: %v", err)
+			}
+		}
+	} else if st := getStore(); st != nil {
+		if _, err := st.(store.Transactor).Apply(ctx, []store.Op{{Kind: store.OpSet, ID: id, N: v}}); err != nil {
+			return err
+		}
+	} else {
+		globalCount.Store(v)
+	}
+	cachePut(id, core.Uint(v))
+	return nil
+}
+
+// maxLongPoll caps /count?wait= below the default time limit of serverless
+// functions; clients simply ask again.
+const maxLongPoll = 8 * time.Second
+
+// dedupe is the DEDUPE configuration. Seen visitors are Redis keys
+// "seen:<keyPrefix><hash>" expiring after the window; without Redis every
+// hit counts.
+var dedupe = mustDedupe()
+
+func mustDedupe() *web.Dedupe {
+	d, err := web.DedupeFromEnv()
+	if err != nil {
+		log.Fatalf("(error) %v", err)
+	}
+	return d
+}
+
+// The anon identity's daily salts are Redis keys "salt:<keyPrefix><day>";
+// without Redis it has none, and every hit counts as elsewhere.
+func init() {
+	web.UseDailySalt(func(ctx context.Context, day string) (string, error) {
+		rc := getRedis()
+		if rc == nil {
+			return "", nil
+		}
+		return store.NewRedisCounterFromClient(rc, keyPrefix).DailySalt(ctx, day)
+	})
+}
+
+// firstVisit reports whether this is the visitor's first hit on id within
+// DEDUPE_WINDOW, marking it seen. Store errors count the hit. The signed
+// cookie identity needs no Redis.
+func firstVisit(w http.ResponseWriter, r *http.Request, id string) bool {
+	if dd, ok := dedupe.For(id).(web.Deduper); ok {
+		return dd.First(w, r, id, dedupe.WindowFor(id))
+	}
+	rc := getRedis()
+	if rc == nil {
+		return true
+	}
+	visitor := dedupe.For(id).Visitor(w, r)
+	if visitor == "" {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+	defer cancel()
+	first, err := rc.SetNX(ctx, "seen:"+keyPrefix+web.SeenKey(id, visitor), 1, dedupe.WindowFor(id)).Result()
+	if err != nil {
+		captureError(r, "(warn) redis SETNX failed, counting the hit: %v", err)
+		return true
+	}
+	return first
+}
+
+// idempotencyWindow is IDEMPOTENCY_WINDOW. Delivered Idempotency-Keys are
+// Redis keys "idem:<keyPrefix><hash>" expiring after it; without Redis every
+// delivery counts.
+var idempotencyWindow = mustIdempotencyWindow()
+
+func mustIdempotencyWindow() time.Duration {
+	d, err := web.IdempotencyWindowFromEnv()
+	if err != nil {
+		log.Fatalf("(error) %v", err)
+	}
+	return d
+}
+
+// replayedHit answers a /hit whose Idempotency-Key (key) was already
+// delivered within IDEMPOTENCY_WINDOW with the current count, and claims the
+// key otherwise. Store errors count the hit.
+func replayedHit(w http.ResponseWriter, r *http.Request, id, key string) bool {
+	rc := getRedis()
+	if rc == nil || key == "" {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+	defer cancel()
+	first, err := rc.SetNX(ctx, "idem:"+keyPrefix+web.SeenKey(id, key), 1, idempotencyWindow).Result()
+	if err != nil {
+		captureError(r, "(warn) redis SETNX failed, counting the hit: %v", err)
+		return false
+	}
+	if first {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", "true")
+	web.WriteCounter(w, r, web.Counter{ID: id, Hits: publicCount(r, id), Duplicate: true, Environment: environment})
+	return true
+}
+
+// releaseIdempotencyKey gives up the claim of replayedHit, for a hit that
+// was not recorded, so a retry is counted.
+func releaseIdempotencyKey(r *http.Request, id, key string) {
+	rc := getRedis()
+	if rc == nil || key == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+	defer cancel()
+	if err := rc.Del(ctx, "idem:"+keyPrefix+web.SeenKey(id, key)).Err(); err != nil {
+		captureError(r, "(warn) redis DEL failed: %v", err)
+	}
+}
+
+// frozenIDs are the FROZEN_IDS counters, which ignore hits.
+var frozenIDs = web.FrozenIDsFromEnv()
+
+// isFrozen reports whether id is in FROZEN_IDS or, with Redis, in the
+// "frozen:<keyPrefix>" set managed by /admin/freeze. A Redis error counts as
+// not frozen so hits keep working.
+func isFrozen(r *http.Request, id string) bool {
+	if frozenIDs[id] {
+		return true
+	}
+	rc := getRedis()
+	if rc == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+	defer cancel()
+	on, err := rc.SIsMember(ctx, "frozen:"+keyPrefix, id).Result()
+	if err != nil {
+		captureError(r, "(warn) redis SISMEMBER failed: %v", err)
+	}
+	return on
+}
+
+// listMilestones returns recorded milestone events for id, newest first.
+func listMilestones(r *http.Request, id string) []core.MilestoneEvent {
+	rc := getRedis()
+	if rc == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+	defer cancel()
+	raw, err := rc.LRange(ctx, "milestones:"+keyPrefix+id, 0, -1).Result()
+	if err != nil {
+		captureError(r, "(warn) redis LRANGE failed: %v", err)
+	}
+	events := make([]core.MilestoneEvent, 0, len(raw))
+	for _, s := range raw {
+		var e core.MilestoneEvent
+		if json.Unmarshal([]byte(s), &e) == nil {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// INITIAL_HIT_COUNT seeds the memory fallback at cold start. Deprecated:
+// seed any counter, in any store, with POST /set?id=foo&value=N.
+func init() {
+	if seed := os.Getenv("INITIAL_HIT_COUNT"); seed != "" {
+		if v, err := strconv.ParseUint(seed, 10, 64); err == nil {
+			globalCount.Store(v)
+		}
+	}
+}
+
+// Cold-start warm-up (WARMUP=1): at init, connect to Redis (or the STORAGE
+// backend) and read the default counter, waiting at most WARMUP_TIMEOUT
+// (default 800ms) so a slow store never delays startup further. The value
+// read is served once to a read of the default id arriving shortly after.
+const warmValueMaxAge = 5 * time.Second
+
+var warm struct {
+	sync.Mutex
+	val core.Value
+	at  time.Time
+}
+
+func init() {
+	if ok, _ := strconv.ParseBool(os.Getenv("WARMUP")); !ok {
+		return
+	}
+	deadline := 800 * time.Millisecond
+	if d, err := time.ParseDuration(os.Getenv("WARMUP_TIMEOUT")); err == nil && d > 0 {
+		deadline = d
+	}
+	if err := warmUp(deadline); err != nil {
+		log.Printf("(warn) warm-up: %v", err)
+	}
+}
+
+// warmUp connects to the configured store and reads the default counter
+// within deadline, without counting anything. It backs WARMUP and /warm.
+func warmUp(deadline time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), deadline)
+		defer cancel()
+		var val core.Value
+		if rc := getRedis(); rc != nil {
+			s, err := rc.Get(ctx, keyPrefix+"home").Result()
+			if err != nil && err != redis.Nil {
+				done <- err
+				return
+			}
+			val, _ = core.ParseValue(s)
+		} else if st := getStore(); st != nil {
+			v, err := st.Get(ctx, "home")
+			if err != nil {
+				done <- err
+				return
+			}
+			val = v
+		} else {
+			done <- nil // memory only: nothing to warm
+			return
+		}
+		warm.Lock()
+		warm.val, warm.at = val, time.Now()
+		warm.Unlock()
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(deadline):
+		return fmt.Errorf("did not finish within %s", deadline)
+	}
+}
+
+// takeWarmValue returns the warm-up value for id once, if it is still fresh.
+func takeWarmValue(id string) (core.Value, bool) {
+	if id != "home" {
+		return core.Value{}, false
+	}
+	warm.Lock()
+	defer warm.Unlock()
+	if warm.at.IsZero() || time.Since(warm.at) > warmValueMaxAge {
+		return core.Value{}, false
+	}
+	warm.at = time.Time{}
+	return warm.val, true
+}
+
+func authorize(r *http.Request) bool {
+	if authorizeHook != nil {
+		return authorizeHook(r)
+	}
+	secret := os.Getenv("SECRET_TOKEN")
+	if secret == "" {
+		return true
+	}
+	if r.Header.Get("X-Auth-Token") == secret {
+		return true
+	}
+	if r.URL.Query().Get("token") == secret {
+		return true
+	}
+	return false
+}
+
+// namespaceTokens (NAMESPACE_TOKENS) authorize what SECRET_TOKEN does, but
+// only for ids in their namespace, such as "blog/home".
+var namespaceTokens = mustNamespaceTokens()
+
+func mustNamespaceTokens() map[string]string {
+	tokens, err := web.NamespaceTokensFromEnv()
+	if err != nil {
+		log.Fatalf("(error) %v", err)
+	}
+	return tokens
+}
+
+// authorizeID is authorize, also accepting the token of a namespace id is
+// in.
+func authorizeID(r *http.Request, id string) bool {
+	return authorize(r) || web.IDAuthorized(namespaceTokens, r, id) || web.CompatRequest(r)
+}
+
+// Hooks for Go programs that embed Handler (e.g. mux.HandleFunc("/",
+// api.Handler)) to add their own filtering, auth and enrichment. Register
+// them before serving; registration is not synchronized with requests.
+var (
+	authorizeHook func(r *http.Request) bool
+	hitHooks      []func(r *http.Request, id string) (map[string]any, error)
+	readHooks     []func(r *http.Request, id string) error
+)
+
+// ErrSkipHit, returned by an OnHit hook, answers the hit with the current
+// count and "skipped": true without recording it.
+var ErrSkipHit = errors.New("hit skipped")
+
+// HookError rejects a request from a hook with a status code (default 403)
+// and message.
+type HookError struct {
+	Status  int
+	Message string
+}
+
+func (e *HookError) Error() string { return e.Message }
+
+// Authorize replaces the SECRET_TOKEN check on /hit and the admin routes.
+func Authorize(fn func(r *http.Request) bool) { authorizeHook = fn }
+
+// OnHit registers a hook that runs, in registration order, before an
+// authorized /hit is recorded, and for each counter of a POST /hits and each
+// inc op of a POST /tx. Returning ErrSkipHit skips the hit (on /tx it
+// refuses the whole transaction with a 409), any other error rejects it (see
+// HookError), and the returned fields are added to the response of a
+// recorded /hit.
+func OnHit(fn func(r *http.Request, id string) (map[string]any, error)) {
+	hitHooks = append(hitHooks, fn)
+}
+
+// UseRedis makes the handler keep counts in c, a client the embedding
+// program already has, instead of connecting to REDIS_URL; nil falls back to
+// STORAGE or memory. Like the hooks, call it before serving.
+func UseRedis(c redis.UniversalClient) {
+	redisOnce.Do(func() {}) // REDIS_URL is no longer consulted
+	redisClient = c
+}
+
+// OnRead registers a hook that runs before a count is served on /count,
+// /count.txt and the badge routes. Returning an error rejects the read (see
+// HookError).
+func OnRead(fn func(r *http.Request, id string) error) { readHooks = append(readHooks, fn) }
+
+// writeHookError answers a request rejected by a hook.
+func writeHookError(w http.ResponseWriter, err error) {
+	status, msg := http.StatusForbidden, err.Error()
+	var he *HookError
+	if errors.As(err, &he) && he.Status != 0 {
+		status = he.Status
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// runHitHooks runs the OnHit hooks and returns their fields; false means the
+// response was written (skipped or rejected).
+func runHitHooks(w http.ResponseWriter, r *http.Request, id string) (map[string]any, bool) {
+	var fields map[string]any
+	for _, hook := range hitHooks {
+		f, err := hook(r, id)
+		if errors.Is(err, ErrSkipHit) {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "hits": publicCount(r, id), "skipped": true})
+			return nil, false
+		}
+		if err != nil {
+			writeHookError(w, err)
+			return nil, false
+		}
+		for k, v := range f {
+			if fields == nil {
+				fields = make(map[string]any)
+			}
+			fields[k] = v
+		}
+	}
+	return fields, true
+}
+
+// skipHit runs the OnHit hooks for one counter of a POST /hits: true means
+// a hook skipped it (ErrSkipHit), and any other error rejects the request.
+func skipHit(r *http.Request, id string) (bool, error) {
+	for _, hook := range hitHooks {
+		if _, err := hook(r, id); errors.Is(err, ErrSkipHit) {
+			return true, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// allowRead runs the OnRead hooks; false means the response was written.
+func allowRead(w http.ResponseWriter, r *http.Request, id string) bool {
+	for _, hook := range readHooks {
+		if err := hook(r, id); err != nil {
+			writeHookError(w, err)
+			return false
+		}
+	}
+	return true
+}
+
+// PanicHook, if set, receives every panic recovered by Handler along with the
+// stack trace. Defaults to a JSON webhook when PANIC_WEBHOOK_URL is set.
+var PanicHook func(r *http.Request, rec any, stack []byte)
+
+func init() {
+	if u := os.Getenv("PANIC_WEBHOOK_URL"); u != "" {
+		PanicHook = func(r *http.Request, rec any, stack []byte) {
+			body, _ := json.Marshal(map[string]any{
+				"method": r.Method,
+				"path":   r.URL.Path,
+				"error":  fmt.Sprint(rec),
+				"stack":  string(stack),
+				"time":   time.Now().UTC(),
+			})
+			// Synchronous: the invocation may be frozen as soon as Handler returns.
+			client := &http.Client{Timeout: 2 * time.Second}
+			if resp, err := client.Post(u, "application/json", bytes.NewReader(body)); err == nil {
+				_ = resp.Body.Close()
+			} else {
+				log.Printf("(warn) panic webhook failed: %v", err)
+			}
+		}
+	}
+}
+
+// sentryHandler is non-nil when SENTRY_DSN is configured.
+var sentryHandler *sentryhttp.Handler
+
+func init() {
+	dsn := os.Getenv("SENTRY_DSN")
+	if dsn == "" {
+		return
+	}
+	rate, _ := strconv.ParseFloat(os.Getenv("SENTRY_TRACES_SAMPLE_RATE"), 64)
+	env := os.Getenv("SENTRY_ENVIRONMENT")
+	if env == "" {
+		env = "production"
+	}
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:                   dsn,
+		Environment:           env,
+		EnableTracing:         rate > 0,
+		TracesSampleRate:      rate,
+		BeforeSend:            func(e *sentry.Event, _ *sentry.EventHint) *sentry.Event { return scrubSentryEvent(e) },
+		BeforeSendTransaction: func(e *sentry.Event, _ *sentry.EventHint) *sentry.Event { return scrubSentryEvent(e) },
+	})
+	if err != nil {
+		log.Printf("(warn) sentry init failed: %v", err)
+		return
+	}
+	sentryHandler = sentryhttp.New(sentryhttp.Options{Repanic: true})
+}
+
+// scrubSentryEvent removes the tokens (web.SecretHeaders and
+// web.SecretParams) from captured request data.
+func scrubSentryEvent(e *sentry.Event) *sentry.Event {
+	if e == nil || e.Request == nil {
+		return e
+	}
+	for k := range e.Request.Headers {
+		if web.SecretHeader(k) {
+			e.Request.Headers[k] = "[Filtered]"
+		}
+	}
+	e.Request.QueryString = web.ScrubQuery(e.Request.QueryString)
+	return e
+}
+
+// captureError logs err and, when Sentry is enabled, reports it on the request hub.
+func captureError(r *http.Request, format string, err error) {
+	log.Printf(format, err)
+	if sentryHandler == nil {
+		return
+	}
+	hub := sentry.GetHubFromContext(r.Context())
+	if hub == nil {
+		hub = sentry.CurrentHub()
+	}
+	hub.CaptureException(fmt.Errorf(strings.TrimPrefix(format, "(warn) "), err))
+}
+
+// recoverPanic logs a panic with its stack, reports it, and answers with a JSON 500.
+func recoverPanic(w http.ResponseWriter, r *http.Request) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+	if rec == http.ErrAbortHandler {
+		panic(rec)
+	}
+	stack := debug.Stack()
+	log.Printf("(error) panic serving %s %s: %v\n%s", r.Method, r.URL.Path, rec, stack)
+	if PanicHook != nil {
+		PanicHook(r, rec, stack)
+	}
+	if sentryHandler != nil {
+		hub := sentry.GetHubFromContext(r.Context())
+		if hub == nil {
+			hub = sentry.CurrentHub()
+		}
+		hub.RecoverWithContext(r.Context(), rec)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": "internal server error"})
+}
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	if sentryHandler == nil {
+		serve(w, r)
+		return
+	}
+	// Serverless: deliver queued events before the invocation is frozen.
+	defer sentry.Flush(2 * time.Second)
+	sentryHandler.HandleFunc(serve)(w, r)
+}
+
+func serve(w http.ResponseWriter, r *http.Request) {
+	defer recoverPanic(w, r)
+	w.Header().Set("X-Nums-Environment", environment)
+	if !web.CompatRequest(r) && !allowRate(w, r) { // a compat route was limited once already
+		return
+	}
+	r, _ = web.PathID(r) // /hit/{id...} and /badge/{id...}
+	r, _ = web.NormalizeIDs(r)
+	if err := web.CheckIDs(r); err != nil { // only recordBucket writes day buckets
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	upgradeKeys() // REDIS_KEY_LAYOUT=v2
+	if route, ok := web.ParseCompatRoute(r, compatRoutes); ok {
+		web.ServeCompatRoute(w, r, route, http.HandlerFunc(serve))
+		return
+	}
+	switch r.URL.Path {
+	case "/hit":
+		// Only the mutating endpoint (/hit) is protected by auth so badges/counts can be public.
+		if !authorizeID(r, r.URL.Query().Get("id")) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.Header().Set("Allow", "GET, POST")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+			return
+		}
+		var newVal uint64
+		var stored bool         // false falls back to the in-memory count
+		var expiresAt time.Time // set when the hit created a counter with ?ttl=
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			id = "home" // default page id
+		}
+		fields, ok := runHitHooks(w, r, id)
+		if !ok {
+			return
+		}
+		if isFrozen(r, id) { // final value kept forever; the hit is acknowledged but not recorded
+			w.Header().Set("Content-Type", "application/json")
+			web.WriteCounter(w, r, web.Counter{ID: id, Hits: publicCount(r, id), Frozen: true, Environment: environment})
+			return
+		}
+		if web.Excluded(r, os.Getenv("EXCLUDE_TOKEN")) { // owner's own traffic (/optout cookie or exclude token)
+			w.Header().Set("Content-Type", "application/json")
+			web.WriteCounter(w, r, web.Counter{ID: id, Hits: publicCount(r, id), Excluded: true})
+			return
+		}
+		if web.FromDevHost(r, devHosts) { // sent from a page under local development
+			w.Header().Set("Content-Type", "application/json")
+			web.WriteCounter(w, r, web.Counter{ID: id, Hits: publicCount(r, id), Excluded: true, Reason: "development"})
+			return
+		}
+		idemKey, err := web.ParseIdempotencyKey(r) // names this delivery, so retries count once
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		dry, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+		if st := getStore(); st != nil && getRedis() == nil && core.IsTestID(id) {
+			// playground counters must expire; refuse them rather than keep them forever
+			if err := store.Supports(st, store.FeaturePlayground); err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		if kind, by, err := web.ParseGauge(r); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		} else if kind != "" { // float aggregate (e.g. MB downloaded) or a signed gauge such as a score
+			w.Header().Set("Content-Type", "application/json")
+			if dry {
+				cur := publicCount(r, id)
+				web.WriteCounter(w, r, web.Counter{ID: id, Hits: cur.AddFloat(by), Previous: &cur, DryRun: true})
+				return
+			}
+			if !claimGauge(w, r, id, kind) {
+				return
+			}
+			if replayedHit(w, r, id, idemKey) {
+				return
+			}
+			rc := getRedis()
+			if fi, ok := getStore().(store.FloatIncrementer); rc == nil && ok {
+				ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+				defer cancel()
+				f, err := fi.IncFloat(ctx, id, by)
+				if err != nil {
+					captureError(r, "(warn) store incrbyfloat failed: %v", err)
+					storeUnavailable(w, web.Stale(lastPublic(r), id))
+					return
+				}
+				web.WriteCounter(w, r, web.Counter{ID: id, Hits: display(r, id, core.Float(f)), Source: storageSource(), Extra: fields})
+				return
+			}
+			if rc == nil { // the memory fallback is a single integer; nowhere to keep floats
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": "float and int counters require redis"})
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+			defer cancel()
+			f, err := rc.IncrByFloat(ctx, keyPrefix+id, by).Result()
+			if err != nil {
+				captureError(r, "(warn) redis INCRBYFLOAT failed: %v", err)
+				releaseIdempotencyKey(r, id, idemKey)
+				storeUnavailable(w, web.Stale(lastPublic(r), id))
+				return
+			}
+			recordChange(ctx, rc, id)
+			cachePut(id, core.Float(f))
+			web.WriteCounter(w, r, web.Counter{ID: id, Hits: display(r, id, core.Float(f)), Source: "redis", Extra: fields})
+			return
+		}
+		by, err := web.ParseHitBy(r, maxHitBy) // ?by=N records N hits at once (batch clients)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		ttl, err := web.ParseTTL(r) // ?ttl=24h: a counter created by this hit expires after 24h
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if ttl > 0 && getRedis() == nil {
+			err := errors.New("ttl requires redis or a STORAGE backend") // the memory fallback is one shared counter
+			if st := getStore(); st != nil {
+				err = store.Supports(st, store.FeatureExpiring)
+			}
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusNotImplemented)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		ifBelow, err := web.ParseIfBelow(r) // ?if_below=100: count only while the counter is below 100
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if ifBelow > 0 && getRedis() == nil {
+			err := errors.New("needs redis or a STORAGE backend") // the memory fallback has no transactions
+			if st := getStore(); st != nil {
+				err = store.Supports(st, store.FeatureTx)
+			}
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusNotImplemented)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("if_below: %v", err)})
+				return
+			}
+		}
+		c, capped := core.CapFor(maxValues, id)
+		if st := getStore(); capped && st != nil && getRedis() == nil {
+			if err := store.Supports(st, store.FeatureTx); err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusNotImplemented)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("counter %s has a max: %v", id, err)})
+				return
+			}
+		}
+		if dry {
+			// Auth, method and id are validated; report the would-be value without writing.
+			cur := publicCount(r, id)
+			next := cur.Add(by)
+			if stored := readCount(r, id).Uint64(); ifBelow > 0 && stored >= ifBelow {
+				writeIfBelow(w, r, id, ifBelow, stored, map[string]any{"dryRun": true})
+				return
+			}
+			if capped {
+				h := c.Hit(readCount(r, id).Uint64()+by, by)
+				if h.Rejected {
+					writeOverflow(w, r, &core.OverflowError{ID: id, Max: c.Max, Hits: h.To}, map[string]any{"dryRun": true})
+					return
+				}
+				next = display(r, id, core.Uint(h.To))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			web.WriteCounter(w, r, web.Counter{ID: id, Hits: next, Previous: &cur, DryRun: true})
+			return
+		}
+		if replayedHit(w, r, id, idemKey) {
+			return
+		}
+		if !firstVisit(w, r, id) { // repeat visitor within DEDUPE_WINDOW
+			w.Header().Set("Content-Type", "application/json")
+			web.WriteCounter(w, r, web.Counter{ID: id, Hits: publicCount(r, id), Duplicate: true, Environment: environment})
+			return
+		}
+		// Prefer Redis if configured
+		if rc := getRedis(); rc != nil {
+			ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+			defer cancel()
+			var h core.CappedHit
+			switch counter := store.NewRedisCounterFromClient(rc, keyPrefix); {
+			case capped: // the cap is applied in the hit's own script
+				h, err = capHit(ctx, counter, id, by, ifBelow)
+			case ifBelow > 0: // the check and the add in one script
+				var res []uint64
+				if res, err = counter.Apply(ctx, ifBelowOps(id, ifBelow, by)); err == nil {
+					h = core.CappedHit{From: res[1] - by, To: res[1], Counted: by}
+				}
+			default:
+				var n uint64
+				n, err = counter.IncBy(ctx, id, by) // refuses gauges
+				h = core.CappedHit{From: n - by, To: n, Counted: by}
+			}
+			if refusedIfBelow(w, r, id, ifBelow, idemKey, err) {
+				return
+			}
+			var over *core.OverflowError
+			if errors.As(err, &over) {
+				releaseIdempotencyKey(r, id, idemKey)
+				writeOverflow(w, r, over, nil)
+				return
+			}
+			if err == nil {
+				newVal = h.To
+				if h.From == 0 && h.To > 0 && ttl > 0 { // new counter created with ?ttl=
+					if err := rc.Expire(ctx, keyPrefix+id, ttl).Err(); err != nil {
+						captureError(r, "(warn) redis EXPIRE failed, the counter will not expire: %v", err)
+					} else {
+						expiresAt = core.Now().Add(ttl)
+					}
+				}
+				recordMilestones(ctx, rc, id, h.From, newVal)
+				recordChange(ctx, rc, id)
+				var expires time.Duration
+				if !expiresAt.IsZero() {
+					expires = ttl
+				}
+				recordUnique(ctx, rc, r, id, expires)
+				if h.Counted > 0 {
+					recordHitMeta(ctx, rc, id, h.From, h.Counted)
+					recordBucket(ctx, r, id, h.Counted)
+				}
+				cachePut(id, core.Uint(newVal))
+				stored = true
+			} else {
+				captureError(r, "(warn) redis INCR failed (falling back to memory): %v", err)
+			}
+		}
+		if st := getStore(); st != nil && getRedis() == nil {
+			ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+			defer cancel()
+			inc := st.Inc
+			if by > 1 {
+				a, ok := st.(store.Adder)
+				if !ok {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusNotImplemented)
+					_ = json.NewEncoder(w).Encode(map[string]string{"error": "by=N is not supported by this storage backend"})
+					return
+				}
+				inc = func(ctx context.Context, id string) (uint64, error) { return a.IncBy(ctx, id, by) }
+			}
+			if ifBelow > 0 {
+				inc = func(ctx context.Context, id string) (uint64, error) {
+					res, err := st.(store.Transactor).Apply(ctx, ifBelowOps(id, ifBelow, by))
+					if err != nil {
+						return 0, err
+					}
+					return res[1], nil
+				}
+			}
+			var h core.CappedHit
+			if capped { // the cap is applied in the hit's own transaction
+				h, err = capHit(ctx, st.(store.Transactor), id, by, ifBelow)
+			} else {
+				var v uint64
+				v, err = inc(ctx, id)
+				h = core.CappedHit{From: v - by, To: v, Counted: by}
+			}
+			if refusedIfBelow(w, r, id, ifBelow, idemKey, err) {
+				return
+			}
+			var over *core.OverflowError
+			if errors.As(err, &over) {
+				releaseIdempotencyKey(r, id, idemKey)
+				writeOverflow(w, r, over, nil)
+				return
+			}
+			if err == nil {
+				newVal, stored = h.To, true
+				cachePut(id, core.Uint(newVal))
+				if h.Counted > 0 {
+					recordBucket(ctx, r, id, h.Counted)
+				}
+				created := h.From == 0 && h.To > 0
+				if ex, ok := st.(store.Expirer); ok && created && ttl > 0 {
+					if err := ex.Expire(ctx, id, ttl); err != nil {
+						captureError(r, "(warn) store expire failed, the counter will not expire: %v", err)
+					} else {
+						expiresAt = core.Now().Add(ttl)
+					}
+				} else if ok && created && core.IsTestID(id) {
+					_ = ex.Expire(ctx, id, core.TestCounterTTL)
+				}
+			} else {
+				captureError(r, "(warn) store increment failed (falling back to memory): %v", err)
+			}
+		}
+		if !stored { // fallback path
+			newVal = globalCount.Add(by)
+		}
+		resp := web.Counter{ID: id, Hits: display(r, id, core.Uint(newVal)), Source: storageSource(), Environment: environment, Test: core.IsTestID(id), Offset: displayOffset(r, id), Extra: fields}
+		if !expiresAt.IsZero() {
+			at := expiresAt.UTC().Truncate(time.Second)
+			resp.ExpiresAt = &at
+		}
+		if step := roundStep(r, id); step > 1 {
+			resp.Rounded = step
+		}
+		web.WriteCounter(w, r, resp)
+	case "/hits":
+		// POST /hits records hits on several counters at once, all or nothing
+		// (one script on Redis, a transaction on stores that have them), e.g.
+		// a static site generator flushing buffered events:
+		// {"increments":{"home":3,"blog":1}}
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+			return
+		}
+		incs, err := web.ParseIncrements(http.MaxBytesReader(w, r.Body, 1<<16), maxHitBy)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		for _, inc := range incs {
+			if !authorizeID(r, inc.ID) {
+				w.WriteHeader(http.StatusUnauthorized)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+				return
+			}
+		}
+		hits := make(map[string]core.Value, len(incs))
+		resp := map[string]any{"hits": hits, "source": storageSource(), "environment": environment}
+		var ops []store.Op
+		var skipped, frozen []string
+		for _, inc := range incs {
+			skip, err := skipHit(r, inc.ID)
+			if err != nil {
+				writeHookError(w, err)
+				return
+			}
+			switch {
+			case skip:
+				skipped = append(skipped, inc.ID)
+				hits[inc.ID] = publicCount(r, inc.ID)
+			case isFrozen(r, inc.ID): // acknowledged but not recorded, as on /hit
+				frozen = append(frozen, inc.ID)
+				hits[inc.ID] = publicCount(r, inc.ID)
+			default:
+				ops = append(ops, store.Op{Kind: store.OpInc, ID: inc.ID, N: inc.N})
+			}
+		}
+		if len(skipped) > 0 {
+			resp["skipped"] = skipped
+		}
+		if len(frozen) > 0 {
+			resp["frozen"] = frozen
+		}
+		if web.Excluded(r, os.Getenv("EXCLUDE_TOKEN")) || web.FromDevHost(r, devHosts) { // nothing is counted
+			for _, op := range ops {
+				hits[op.ID] = publicCount(r, op.ID)
+			}
+			resp["excluded"] = true
+			_ = json.NewEncoder(w).Encode(resp)
+			return
+		}
+		if dry, _ := strconv.ParseBool(r.URL.Query().Get("dryRun")); dry {
+			for _, op := range ops {
+				hits[op.ID] = publicCount(r, op.ID).Add(op.N)
+			}
+			resp["dryRun"] = true
+			_ = json.NewEncoder(w).Encode(resp)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+		var capped []core.CappedHit // MAX_VALUES is applied in the batch's transaction
+		capFor := func(id string) (core.Cap, bool) { return core.CapFor(maxValues, id) }
+		rc, st := getRedis(), getStore()
+		switch {
+		case len(ops) == 0:
+		case rc != nil:
+			capped, err = store.ApplyCapped(ctx, store.NewRedisCounterFromClient(rc, keyPrefix), nil, ops, capFor)
+		case st != nil:
+			for _, op := range ops {
+				if core.IsTestID(op.ID) { // playground counters must expire, as on /hit
+					if err := store.Supports(st, store.FeaturePlayground); err != nil {
+						w.WriteHeader(http.StatusBadRequest)
+						_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+						return
+					}
+				}
+			}
+			if err := store.Supports(st, store.FeatureTx); err != nil {
+				w.WriteHeader(http.StatusNotImplemented)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+			capped, err = store.ApplyCapped(ctx, st.(store.Transactor), nil, ops, capFor)
+		default: // the memory fallback is a single counter shared by every id
+			var sum uint64
+			for _, op := range ops {
+				sum += op.N
+			}
+			next := globalCount.Add(sum) - sum
+			for _, op := range ops {
+				next += op.N
+				capped = append(capped, core.CappedHit{From: next - op.N, To: next, Counted: op.N})
+			}
+		}
+		switch {
+		case errors.Is(err, store.ErrNotInteger), errors.Is(err, store.ErrCrossSlot):
+			w.WriteHeader(http.StatusConflict)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		case err != nil:
+			captureError(r, "(warn) bulk increment failed: %v", err)
+			storeUnavailable(w, web.StaleBatch(lastPublic(r), store.OpIDs(ops)))
+			return
+		}
+		var refused []string
+		for i, op := range ops {
+			if capped[i].Rejected {
+				refused = append(refused, op.ID)
+			}
+		}
+		if len(refused) > 0 { // all or nothing: nothing in the batch was written
+			w.WriteHeader(http.StatusConflict)
+			_ = json.NewEncoder(w).Encode(map[string]any{"error": "hits would take counters past their max", "capped": refused})
+			return
+		}
+		for i, op := range ops {
+			h := capped[i]
+			if rc != nil {
+				recordMilestones(ctx, rc, op.ID, h.From, h.To)
+				recordChange(ctx, rc, op.ID)
+				if h.Counted > 0 {
+					recordHitMeta(ctx, rc, op.ID, h.From, h.Counted)
+				}
+			}
+			if (rc != nil || st != nil) && h.Counted > 0 {
+				recordBucket(ctx, r, op.ID, h.Counted)
+			}
+			cachePut(op.ID, core.Uint(h.To))
+			hits[op.ID] = display(r, op.ID, core.Uint(h.To))
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	case "/tx", "/transact":
+		// POST /tx (or /transact) applies up to 20 inc/dec/set/expect
+		// operations all or nothing (one Lua script on Redis, a transaction on
+		// stores that have them), e.g. to move hits between aliases:
+		// {"ops":[{"op":"dec","id":"old","by":10},{"op":"inc","id":"new","by":10}]}
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+			return
+		}
+		ops, err := web.ParseTx(http.MaxBytesReader(w, r.Body, 1<<16))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		for _, op := range ops {
+			if !authorizeID(r, op.ID) {
+				w.WriteHeader(http.StatusUnauthorized)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+				return
+			}
+		}
+		rc, st := getRedis(), getStore()
+		if rc == nil {
+			err := errors.New("transactions require redis or a STORAGE backend") // the memory fallback is one shared counter
+			if st != nil {
+				err = store.Supports(st, store.FeatureTx)
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusNotImplemented)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		for i, op := range ops {
+			if op.Kind != store.OpInc {
+				continue
+			}
+			skip, err := skipHit(r, op.ID)
+			if err != nil {
+				writeHookError(w, err)
+				return
+			}
+			if skip { // the ops stand or fall together, so one skipped hit refuses them all
+				w.WriteHeader(http.StatusConflict)
+				_ = json.NewEncoder(w).Encode(map[string]any{"error": fmt.Sprintf("ops[%d]: a hook skipped the hit on %s", i, op.ID), "id": op.ID, "skipped": true})
+				return
+			}
+		}
+		for i, op := range ops {
+			if op.Kind != store.OpExpect && op.Kind != store.OpBelow && isFrozen(r, op.ID) {
+				w.WriteHeader(http.StatusLocked)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("ops[%d]: counter %s is frozen", i, op.ID)})
+				return
+			}
+		}
+		if dry, _ := strconv.ParseBool(r.URL.Query().Get("dryRun")); dry {
+			_ = json.NewEncoder(w).Encode(map[string]any{"ops": len(ops), "dryRun": true})
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+		var results []uint64
+		if rc != nil {
+			results, err = store.NewRedisCounterFromClient(rc, keyPrefix).Apply(ctx, ops)
+		} else {
+			results, err = st.(store.Transactor).Apply(ctx, ops)
+		}
+		var mismatch *store.MismatchError
+		switch {
+		case errors.As(err, &mismatch):
+			w.WriteHeader(http.StatusPreconditionFailed)
+			_ = json.NewEncoder(w).Encode(map[string]any{"error": err.Error(), "id": mismatch.ID, "hits": mismatch.Current})
+			return
+		case errors.Is(err, store.ErrUnderflow), errors.Is(err, store.ErrOverflow), errors.Is(err, store.ErrNotInteger), errors.Is(err, store.ErrCrossSlot):
+			w.WriteHeader(http.StatusConflict)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		case err != nil:
+			captureError(r, "(warn) transaction failed: %v", err)
+			storeUnavailable(w, web.StaleBatch(lastKnown.Last, store.OpIDs(ops)))
+			return
+		}
+		type result struct {
+			ID   string `json:"id"`
+			Hits uint64 `json:"hits"`
+		}
+		out := make([]result, len(ops))
+		for i, op := range ops {
+			out[i] = result{ID: op.ID, Hits: results[i]}
+			cachePut(op.ID, core.Uint(results[i]))
+			if rc == nil {
+				continue
+			}
+			if op.Kind == store.OpInc {
+				recordMilestones(ctx, rc, op.ID, results[i]-op.N, results[i])
+				recordHitMeta(ctx, rc, op.ID, results[i]-op.N, op.N)
+			}
+			recordChange(ctx, rc, op.ID)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"results": out})
+	case "/counter":
+		deleteCounter(w, r)
+	case "/counter/restore":
+		restoreCounter(w, r)
+	case "/reset", "/set":
+		// POST /reset?id=foo sets a counter back to zero; POST /set?id=foo&value=N
+		// seeds it, e.g. with the count from another hit counter service.
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if !authorizeID(r, id) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+			return
+		}
+		if id == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "id is required"})
+			return
+		}
+		var value uint64
+		if r.URL.Path == "/set" {
+			v, err := strconv.ParseUint(r.URL.Query().Get("value"), 10, 64)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": "value must be a non-negative integer"})
+				return
+			}
+			value = v
+		}
+		if isFrozen(r, id) {
+			w.WriteHeader(http.StatusLocked)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "counter is frozen; unfreeze it with DELETE /admin/freeze first"})
+			return
+		}
+		if st := getStore(); getRedis() == nil && st != nil {
+			if err := store.Supports(st, store.FeatureTx); err != nil {
+				w.WriteHeader(http.StatusNotImplemented)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		resp := map[string]any{"id": id, "hits": value}
+		if r.URL.Path != "/set" {
+			resp["reset"] = true
+		}
+		if dry, _ := strconv.ParseBool(r.URL.Query().Get("dryRun")); dry {
+			resp["dryRun"] = true
+			_ = json.NewEncoder(w).Encode(resp)
+			return
+		}
+		err := setCounter(r.Context(), id, value)
+		if errors.Is(err, store.ErrNotInteger) {
+			w.WriteHeader(http.StatusConflict)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			captureError(r, "(error) counter update failed: %v", err)
+			storeUnavailable(w, web.Stale(lastKnown.Last, id))
+			return
+		}
+		if r.URL.Path != "/set" && tracksUniques(id) { // a reset forgets the unique visitors too
+			if err := store.NewRedisCounterFromClient(getRedis(), keyPrefix).ResetUniques(r.Context(), id); err != nil {
+				captureError(r, "(warn) redis unique visitors reset failed: %v", err)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	case "/counters":
+		// Every counter (or those in ?namespace=) with its metadata (first
+		// seen, last hit, lifetime hits), least recently hit first so stale
+		// counters stand out. DELETE ?namespace= resets every counter in it.
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+			w.Header().Set("Allow", "GET, DELETE")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+			return
+		}
+		ns, err := web.ParseNamespace(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if !authorize(r) && (ns == "" || !web.NamespaceAuthorized(namespaceTokens, r, ns)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+		if r.Method == http.MethodDelete {
+			resetNamespace(ctx, w, r, ns)
+			return
+		}
+		list, ok, err := listCounters(ctx, ns)
+		switch {
+		case !ok:
+			w.WriteHeader(http.StatusNotImplemented)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "listing counters requires redis or a store that can list them"})
+			return
+		case err != nil:
+			captureError(r, "(error) counter listing failed: %v", err)
+			storeUnavailable(w, nil)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"counters": list})
+	case "/counter/meta":
+		// GET /counter/meta?id=foo returns when the counter was created, last
+		// hit and last reset, and its lifetime hits next to the stored value.
+		// The metadata is kept in Redis only.
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			id = "home"
+		}
+		if !allowRead(w, r, id) {
+			return
+		}
+		rc := getRedis()
+		if rc == nil {
+			w.WriteHeader(http.StatusNotImplemented)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "counter metadata requires redis"})
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+		defer cancel()
+		m, err := store.NewRedisCounterFromClient(rc, keyPrefix).Meta(ctx, id)
+		if err != nil {
+			captureError(r, "(warn) redis HGETALL failed: %v", err)
+			storeUnavailable(w, web.Stale(lastPublic(r), id))
+			return
+		}
+		m.Hits = readCount(r, id)
+		_ = json.NewEncoder(w).Encode(m)
+	case "/admin/stats":
+		// Which badge styles and parameters are requested: across instances
+		// with Redis, per instance otherwise.
+		w.Header().Set("Content-Type", "application/json")
+		if !authorize(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+		rep, err := badgeUsageReport(ctx)
+		if err != nil {
+			captureError(r, "(error) badge usage read failed: %v", err)
+			storeUnavailable(w, nil)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"badges": rep})
+	case "/metrics":
+		// The badge usage counters in the Prometheus text format.
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorize(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("unauthorized"))
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+		rep, err := badgeUsageReport(ctx)
+		if err != nil {
+			captureError(r, "(error) badge usage read failed: %v", err)
+			web.SetRetryAfter(w.Header(), web.StoreRetryAfter)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = rep.WriteMetrics(w)
+	case "/admin/freeze":
+		// Lists (GET), freezes (POST ?id=) or unfreezes (DELETE ?id=) counters.
+		// Runtime freezes are kept in Redis; other stores only honor FROZEN_IDS.
+		w.Header().Set("Content-Type", "application/json")
+		if !authorizeID(r, r.URL.Query().Get("id")) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+			return
+		}
+		rc := getRedis()
+		if rc == nil {
+			w.WriteHeader(http.StatusNotImplemented)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "freezing at runtime needs Redis; list the ids in FROZEN_IDS instead"})
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+		id := r.URL.Query().Get("id")
+		var err error
+		switch {
+		case r.Method == http.MethodGet && id == "":
+			var ids []string
+			ids, err = rc.SMembers(ctx, "frozen:"+keyPrefix).Result()
+			if err == nil {
+				for fid := range frozenIDs {
+					ids = append(ids, fid)
+				}
+				sort.Strings(ids)
+				ids = slices.Compact(ids)
+				_ = json.NewEncoder(w).Encode(map[string]any{"frozen": ids})
+				return
+			}
+		case r.Method == http.MethodGet:
+			_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "frozen": isFrozen(r, id)})
+			return
+		case r.Method != http.MethodPost && r.Method != http.MethodDelete:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+			return
+		case id == "":
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "id is required"})
+			return
+		case r.Method == http.MethodDelete && frozenIDs[id]:
+			w.WriteHeader(http.StatusConflict)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": id + " is frozen by FROZEN_IDS; remove it there"})
+			return
+		case r.Method == http.MethodPost:
+			err = rc.SAdd(ctx, "frozen:"+keyPrefix, id).Err()
+		default:
+			err = rc.SRem(ctx, "frozen:"+keyPrefix, id).Err()
+		}
+		if err != nil {
+			captureError(r, "(error) freeze failed: %v", err)
+			storeUnavailable(w, nil)
+			return
+		}
+		recordChange(ctx, rc, id)
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "frozen": r.Method == http.MethodPost, "hits": readCount(r, id)})
+	case "/admin/round":
+		// Lists (GET) admin rounding steps, sets one (POST ?id=&step=, step=0
+		// shows the counter exactly) or removes one (DELETE ?id=). Admin steps
+		// are kept in Redis; other stores only honor ROUND_COUNTS.
+		w.Header().Set("Content-Type", "application/json")
+		if !authorizeID(r, r.URL.Query().Get("id")) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+			return
+		}
+		rc := getRedis()
+		if rc == nil {
+			w.WriteHeader(http.StatusNotImplemented)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "rounding at runtime needs Redis; use ROUND_COUNTS instead"})
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+		id := r.URL.Query().Get("id")
+		var err error
+		switch {
+		case r.Method == http.MethodGet && id == "":
+			var raw map[string]string
+			if raw, err = rc.HGetAll(ctx, "rounding:"+keyPrefix).Result(); err == nil {
+				steps := make(map[string]uint64, len(roundingSteps)+len(raw))
+				for sid, step := range roundingSteps {
+					steps[sid] = step
+				}
+				for sid, v := range raw {
+					if step, perr := strconv.ParseUint(v, 10, 64); perr == nil {
+						steps[sid] = step
+					}
+				}
+				_ = json.NewEncoder(w).Encode(map[string]any{"steps": steps})
+				return
+			}
+		case r.Method == http.MethodGet:
+		case r.Method != http.MethodPost && r.Method != http.MethodDelete:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+			return
+		case id == "":
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "id is required"})
+			return
+		case r.Method == http.MethodPost:
+			step, perr := core.ParseRoundingStep(r.URL.Query().Get("step"))
+			if perr != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": perr.Error()})
+				return
+			}
+			err = rc.HSet(ctx, "rounding:"+keyPrefix, id, step).Err()
+		default:
+			err = rc.HDel(ctx, "rounding:"+keyPrefix, id).Err()
+		}
+		if err != nil {
+			captureError(r, "(error) rounding update failed: %v", err)
+			storeUnavailable(w, nil)
+			return
+		}
+		recordChange(ctx, rc, id)
+		val := readCount(r, id)
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "step": roundStep(r, id), "hits": val, "public": display(r, id, val)})
+	case "/admin/offset":
+		// Lists (GET) display offsets, sets one (POST ?id=&offset=) or removes
+		// one (DELETE ?id=). Only public reads add the offset; the stored count
+		// is unchanged. Admin offsets are kept in Redis; other stores only
+		// honor DISPLAY_OFFSETS.
+		w.Header().Set("Content-Type", "application/json")
+		if !authorizeID(r, r.URL.Query().Get("id")) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+			return
+		}
+		rc := getRedis()
+		if rc == nil {
+			w.WriteHeader(http.StatusNotImplemented)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "offsets at runtime need Redis; use DISPLAY_OFFSETS instead"})
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+		id := r.URL.Query().Get("id")
+		var err error
+		switch {
+		case r.Method == http.MethodGet && id == "":
+			var raw map[string]string
+			if raw, err = rc.HGetAll(ctx, "offsets:"+keyPrefix).Result(); err == nil {
+				offsets := make(map[string]uint64, len(displayOffsets)+len(raw))
+				for oid, off := range displayOffsets {
+					offsets[oid] = off
+				}
+				for oid, v := range raw {
+					if off, perr := strconv.ParseUint(v, 10, 64); perr == nil {
+						offsets[oid] = off
+					}
+				}
+				_ = json.NewEncoder(w).Encode(map[string]any{"offsets": offsets})
+				return
+			}
+		case r.Method == http.MethodGet:
+		case r.Method != http.MethodPost && r.Method != http.MethodDelete:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+			return
+		case id == "":
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "id is required"})
+			return
+		case r.Method == http.MethodPost:
+			off, perr := core.ParseOffset(r.URL.Query().Get("offset"))
+			if perr != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": perr.Error()})
+				return
+			}
+			err = rc.HSet(ctx, "offsets:"+keyPrefix, id, off).Err()
+		default:
+			err = rc.HDel(ctx, "offsets:"+keyPrefix, id).Err()
+		}
+		if err != nil {
+			captureError(r, "(error) offset update failed: %v", err)
+			storeUnavailable(w, nil)
+			return
+		}
+		recordChange(ctx, rc, id)
+		val := readCount(r, id)
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "offset": displayOffset(r, id), "hits": val, "public": display(r, id, val)})
+	case "/optout":
+		// Sets (or with off=1 clears) the cookie that stops /hit counting this browser.
+		on := r.URL.Query().Get("off") == ""
+		http.SetCookie(w, web.OptOutCookieFor(r, on))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write([]byte(web.OptOutPage(on)))
+	case "/warm":
+		// Keep-alive target for uptime pingers and crons: initializes the
+		// store connection without counting a hit.
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		start := time.Now()
+		if err := warmUp(2 * time.Second); err != nil {
+			captureError(r, "(warn) warm failed: %v", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_ = json.NewEncoder(w).Encode(map[string]any{"ok": false, "source": storageSource(), "error": err.Error()})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "source": storageSource(), "ms": time.Since(start).Milliseconds()})
+	case "/count":
 		if r.Method != http.MethodGet {
 			w.Header().Set("Allow", "GET")
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			_ = json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
 			return
 		}
+		if name, err := web.ParseGroup(r); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		} else if name != "" { // the total of a GROUPS entry
+			if total, done := groupTotal(w, r, name); !done {
+				web.WriteGroup(w, r, name, total, environment)
+			}
+			return
+		}
 		id := r.URL.Query().Get("id")
 		if id == "" {
 			id = "home"
 		}
-		var val uint64
-		if rc := getRedis(); rc != nil {
+		if !allowRead(w, r, id) {
+			return
+		}
+		lp, err := web.ParseLongPoll(r, maxLongPoll)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		metric, err := web.ParseMetric(r)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		period, err := web.ParsePeriod(r)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		step, off := roundStep(r, id), displayOffset(r, id)
+		if period != "" {
+			// Hits today, this week or this month, summed from day buckets.
+			status, msg := 0, ""
+			switch {
+			case metric == "uniques":
+				status, msg = http.StatusBadRequest, "period is not supported with metric=uniques"
+			case lp.Wait > 0:
+				status, msg = http.StatusBadRequest, "wait is not supported with period"
+			}
+			val, err := core.Value{}, error(nil)
+			if status == 0 {
+				val, err = periodCount(r, id, period)
+			}
+			switch {
+			case errors.Is(err, errNoDayBuckets):
+				status, msg = http.StatusNotImplemented, err.Error()
+			case err != nil:
+				captureError(r, "(error) day bucket read failed: %v", err)
+				web.SetRetryAfter(w.Header(), web.StoreRetryAfter)
+				status, msg = http.StatusServiceUnavailable, "store unavailable"
+			}
+			if status != 0 {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+				return
+			}
+			switch r.URL.Query().Get("format") {
+			case "txt", "text":
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				_, _ = w.Write([]byte(val.String()))
+				return
+			case "github-output":
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				_, _ = w.Write([]byte(core.GitHubOutput([2]string{"hits", val.String()}, [2]string{"id", id}, [2]string{"period", period})))
+				return
+			}
+			resp := web.Counter{ID: id, Hits: val, Period: period, Source: storageSource(), Environment: environment, Frozen: isFrozen(r, id)}
+			if step > 1 {
+				resp.Rounded = step
+			}
+			addTimes(r, id, &resp)
+			addVelocity(r, id, &resp)
+			web.WriteCounter(w, r, resp)
+			return
+		}
+		if metric == "uniques" {
+			// Estimated unique visitors of a counter listed in UNIQUES (Redis only).
+			status, msg := 0, ""
+			switch {
+			case getRedis() == nil:
+				status, msg = http.StatusNotImplemented, "unique visitors require redis"
+			case !tracksUniques(id):
+				status, msg = http.StatusNotFound, "unique visitors are not counted for this id; add it to UNIQUES"
+			case lp.Wait > 0:
+				status, msg = http.StatusBadRequest, "wait is not supported with metric=uniques"
+			}
+			if status != 0 {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+				return
+			}
 			ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
 			defer cancel()
-			s, err := rc.Get(ctx, "hits:"+id).Result()
-			if err == nil {
-				if parsed, perr := strconv.ParseUint(s, 10, 64); perr == nil {
-					val = parsed
-				}
-			} else if err != redis.Nil {
-				log.Printf("(warn) redis GET failed: %v", err)
+			n, err := uniqueCount(ctx, id)
+			if err != nil {
+				captureError(r, "(error) redis unique visitors read failed: %v", err)
+				storeUnavailable(w, nil)
+				return
+			}
+			switch r.URL.Query().Get("format") {
+			case "txt", "text":
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				_, _ = w.Write([]byte(strconv.FormatUint(n, 10)))
+				return
+			case "github-output":
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				_, _ = w.Write([]byte(core.GitHubOutput([2]string{"uniques", strconv.FormatUint(n, 10)}, [2]string{"id", id})))
+				return
+			}
+			resp := web.Counter{ID: id, Hits: readCount(r, id).Offset(off).Round(step), Uniques: &n, Source: storageSource(), Environment: environment, Frozen: isFrozen(r, id), Offset: off}
+			if step > 1 {
+				resp.Rounded = step
 			}
+			addTimes(r, id, &resp)
+			addVelocity(r, id, &resp)
+			web.WriteCounter(w, r, resp)
+			return
 		}
-		if val == 0 { // fallback memory value (not id-specific; legacy behavior)
-			val = globalCount.Load()
+		// wait=8s&ifChangedFrom=N re-reads every second until the count differs from N
+		val, done := conditionalRead(w, r, id, func() core.Value {
+			return lp.Await(r.Context(), time.Second, nil, func() core.Value { return readCount(r, id).Offset(off).Round(step) })
+		})
+		if done {
+			return
 		}
 		// optional plain text via format=txt
 		if f := r.URL.Query().Get("format"); f == "txt" || f == "text" {
 			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-			_, _ = w.Write([]byte(strconv.FormatUint(val, 10)))
+			_, _ = w.Write([]byte(val.String()))
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "hits": val, "source": func() string {
-			if getRedis() != nil {
-				return "redis"
+		// format=github-output emits GITHUB_OUTPUT lines (hits=<n>) for Actions workflows
+		if r.URL.Query().Get("format") == "github-output" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte(core.GitHubOutput([2]string{"hits", val.String()}, [2]string{"id", id})))
+			return
+		}
+		resp := web.Counter{ID: id, Hits: val, Source: storageSource(), Environment: environment, Frozen: isFrozen(r, id), Offset: off}
+		if st := getStore(); st != nil && getRedis() == nil && !st.Capabilities().Exact() {
+			resp.Approximate = true // eventually consistent store: may lag recent hits
+		}
+		if step > 1 {
+			resp.Rounded = step
+		}
+		addTimes(r, id, &resp)
+		addVelocity(r, id, &resp)
+		web.WriteCounter(w, r, resp)
+	case "/counts":
+		// GET /counts?ids=home,blog reads several counters in one request,
+		// e.g. for a profile page showing a badge per project
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+			return
+		}
+		ids, err := web.ParseCountIDs(r)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		hits := make(map[string]core.Value, len(ids))
+		for _, id := range ids {
+			if !allowRead(w, r, id) {
+				return
 			}
-			return "memory"
-		}()})
+			hits[id] = publicCount(r, id)
+		}
+		web.WriteCounts(w, r, hits, environment)
 	case "/count.txt":
 		if r.Method != http.MethodGet {
 			w.Header().Set("Allow", "GET")
@@ -188,85 +3124,175 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		if id == "" {
 			id = "home"
 		}
-		var val uint64
-		if rc := getRedis(); rc != nil {
-			ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
-			defer cancel()
-			if s, err := rc.Get(ctx, "hits:"+id).Result(); err == nil {
-				if parsed, perr := strconv.ParseUint(s, 10, 64); perr == nil {
-					val = parsed
-				}
-			}
+		if !allowRead(w, r, id) {
+			return
 		}
-		if val == 0 {
-			val = globalCount.Load()
+		val, done := conditionalRead(w, r, id, func() core.Value { return publicCount(r, id) })
+		if done {
+			return
 		}
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.Header().Set("Cache-Control", "no-cache")
-		_, _ = w.Write([]byte(strconv.FormatUint(val, 10)))
+		_, _ = w.Write([]byte(val.String()))
 	case "/badge":
 		if r.Method != http.MethodGet {
 			w.Header().Set("Allow", "GET")
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		id := r.URL.Query().Get("id")
-		if id == "" {
-			id = "home"
-		}
-		var val uint64
-		if rc := getRedis(); rc != nil {
-			ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
-			defer cancel()
-			if s, err := rc.Get(ctx, "hits:"+id).Result(); err == nil {
-				if parsed, perr := strconv.ParseUint(s, 10, 64); perr == nil {
-					val = parsed
-				}
-			}
-		}
-		if val == 0 {
-			val = globalCount.Load()
-		}
-		label := r.URL.Query().Get("label")
-		if label == "" {
-			label = "views"
-		}
-		style := r.URL.Query().Get("style")
-		if style == "terminal" || style == "mono" { // custom terminal style
-			bg := normalizeColor(r.URL.Query().Get("bg"), "#1e1e1e")
-			labelColor := normalizeColor(r.URL.Query().Get("labelColor"), "#aaa")
-			valueColor := normalizeColor(r.URL.Query().Get("valueColor"), "#3cffb3")
-			font := r.URL.Query().Get("font")
-			if font == "" {
-				font = "SFMono-Regular, SF Mono, Menlo, ui-monospace, monospace"
+		if name, err := web.ParseGroup(r); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		} else if name != "" { // the total of a GROUPS entry
+			total, done := groupTotal(w, r, name)
+			if done {
+				return
 			}
-			svg := buildTerminalBadge(label, val, font, bg, labelColor, valueColor)
+			recordBadgeUsage(r, "badge")
+			svg, _ := renderBadge(r, name, core.Uint(total.TotalHits))
 			w.Header().Set("Content-Type", "image/svg+xml;charset=utf-8")
-			// Strong anti-cache headers so GitHub's image proxy (camo) revalidates frequently
 			w.Header().Set("Cache-Control", "no-cache, no-store, max-age=0, must-revalidate")
-			w.Header().Set("Pragma", "no-cache")
-			w.Header().Set("Expires", "0")
-			w.Header().Set("ETag", fmt.Sprintf("\"badge-%s-%d-terminal\"", id, val))
 			_, _ = w.Write([]byte(svg))
 			return
 		}
-		color := r.URL.Query().Get("color")
-		if color == "" {
-			color = "blue"
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			id = "home"
 		}
-		font := r.URL.Query().Get("font")
-		if font == "" {
-			font = "Verdana,Geneva,DejaVu Sans,sans-serif"
+		if !allowRead(w, r, id) {
+			return
+		}
+		recordBadgeUsage(r, "badge")
+		val, done := badgeRead(w, r, id)
+		if done {
+			return
+		}
+		svg, terminal := renderBadge(r, id, val)
+		etag := fmt.Sprintf("\"badge-%s-%s\"", id, val)
+		if terminal {
+			etag = fmt.Sprintf("\"badge-%s-%s-terminal\"", id, val)
 		}
-		svg := buildBadgeSVG(label, val, color, font)
 		w.Header().Set("Content-Type", "image/svg+xml;charset=utf-8")
+		// Strong anti-cache headers so GitHub's image proxy (camo) revalidates frequently
 		w.Header().Set("Cache-Control", "no-cache, no-store, max-age=0, must-revalidate")
 		w.Header().Set("Pragma", "no-cache")
 		w.Header().Set("Expires", "0")
-		w.Header().Set("ETag", fmt.Sprintf("\"badge-%s-%d\"", id, val))
+		w.Header().Set("ETag", etag)
 		_, _ = w.Write([]byte(svg))
 		return
 
+	case "/history":
+		// GET /history?id=home&from=&to= returns the counter's value snapshots
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		id, from, to, err := web.ParseHistory(r)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if !allowRead(w, r, id) {
+			return
+		}
+		rc := getRedis()
+		if rc == nil || historyInterval == 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotImplemented)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "history requires redis and HISTORY_INTERVAL other than 0"})
+			return
+		}
+		points, err := store.NewRedisCounterFromClient(rc, keyPrefix).History(r.Context(), id, from, to)
+		if err != nil {
+			captureError(r, "(error) history read failed: %v", err)
+			storeUnavailable(w, nil)
+			return
+		}
+		for i := range points {
+			points[i].Hits = display(r, id, points[i].Hits)
+		}
+		web.WriteHistory(w, id, historyInterval, from, to, points)
+		return
+
+	case "/chart":
+		// GET /chart?id=a&id=b&days=30 draws the daily hits of a few counters
+		// as one SVG line chart with a legend, from their day buckets
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		ids, n, err := web.ParseChart(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+		for _, id := range ids {
+			if !allowRead(w, r, id) {
+				return
+			}
+		}
+		days := core.LastDays(n, core.Now())
+		series := make([]core.ChartSeries, len(ids))
+		for i, id := range ids {
+			counts, err := bucketCounts(r, id, days)
+			switch {
+			case errors.Is(err, errNoDayBuckets):
+				w.WriteHeader(http.StatusNotImplemented)
+				_, _ = w.Write([]byte(err.Error()))
+				return
+			case err != nil:
+				captureError(r, "(error) day bucket read failed: %v", err)
+				web.SetRetryAfter(w.Header(), web.StoreRetryAfter)
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write([]byte("store unavailable"))
+				return
+			}
+			step := roundStep(r, id) // rounded as periodCount rounds sums
+			for j, c := range counts {
+				counts[j] = core.Uint(c).Round(step).Uint64()
+			}
+			series[i] = core.ChartSeries{Label: id, Points: counts}
+		}
+		w.Header().Set("Content-Type", "image/svg+xml;charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache, no-store, max-age=0, must-revalidate")
+		_, _ = w.Write([]byte(core.ChartSVG(series, days, core.BadgeFont)))
+
+	case "/badge.datauri":
+		// The badge as a data: URI for tooling that inlines images (HTML, emails)
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			id = "home"
+		}
+		if !allowRead(w, r, id) {
+			return
+		}
+		recordBadgeUsage(r, "badge.datauri")
+		val, done := badgeRead(w, r, id)
+		if done {
+			return
+		}
+		svg, _ := renderBadge(r, id, val)
+		uri := svgDataURI(svg)
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]string{"id": id, "dataUri": uri})
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(uri))
+
 	case "/badge.json":
 		// JSON schema for Shields.io endpoint badge proxy
 		if r.Method != http.MethodGet {
@@ -278,18 +3304,13 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		if id == "" {
 			id = "home"
 		}
-		var val uint64
-		if rc := getRedis(); rc != nil {
-			ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
-			defer cancel()
-			if s, err := rc.Get(ctx, "hits:"+id).Result(); err == nil {
-				if parsed, perr := strconv.ParseUint(s, 10, 64); perr == nil {
-					val = parsed
-				}
-			}
+		if !allowRead(w, r, id) {
+			return
 		}
-		if val == 0 {
-			val = globalCount.Load()
+		recordBadgeUsage(r, "badge.json")
+		val, done := badgeRead(w, r, id)
+		if done {
+			return
 		}
 		label := r.URL.Query().Get("label")
 		if label == "" {
@@ -317,82 +3338,306 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		_ = json.NewEncoder(w).Encode(map[string]any{
 			"schemaVersion": 1,
 			"label":         label,
-			"message":       strconv.FormatUint(val, 10),
+			"message":       badgeValue(r, id, val),
 			"color":         color,
 			"cacheSeconds":  cacheSeconds,
 		})
+	case "/verify":
+		// Signed attestation of the current count (VERIFY_SIGNING_KEY required).
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		key := getSigningKey()
+		if key == nil {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "not found"})
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			id = "home"
+		}
+		if roundStep(r, id) > 1 { // an attestation of the exact count would defeat the rounding
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "counter is shown rounded; attestations are disabled for it"})
+			return
+		}
+		hits, err := storedCount(r, id)
+		switch {
+		case errors.Is(err, errNoPerIDCounts):
+			w.WriteHeader(http.StatusNotImplemented)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		case err != nil: // never sign a value that isn't the counter's
+			captureError(r, "(warn) verify read failed: %v", err)
+			storeUnavailable(w, nil)
+			return
+		}
+		signed, err := core.Sign(key, core.Attestation{
+			ID:       id,
+			Hits:     hits,
+			IssuedAt: core.Now().UTC().Truncate(time.Second),
+			Issuer:   strings.TrimRight(os.Getenv("PUBLIC_URL"), "/"),
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(signed)
+	case "/.well-known/nums-verify-key":
+		key := getSigningKey()
+		if key == nil {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "not found"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		_ = json.NewEncoder(w).Encode(core.NewPublicKeyDocument(key.Public().(ed25519.PublicKey)))
+	case "/feed":
+		// Milestone events as RSS (default) or Atom (format=atom).
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			id = "home"
+		}
+		events := listMilestones(r, id)
+		link := snippets.BaseURL(r, os.Getenv("PUBLIC_URL")) + "/badge?" + url.Values{"id": {id}}.Encode()
+		var body []byte
+		var err error
+		if r.URL.Query().Get("format") == "atom" {
+			w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+			body, err = core.MilestoneAtom(id, link, events)
+		} else {
+			w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+			body, err = core.MilestoneRSS(id, link, events)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(body)
+	case "/milestones.ics":
+		// Past and projected milestone dates as a subscribable calendar.
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			id = "home"
+		}
+		now := core.Now()
+		events := listMilestones(r, id)
+		projected := core.ProjectMilestones(events, readCount(r, id).Uint64(), now, 3)
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		_, _ = w.Write(core.MilestoneICal(id, events, projected, now))
+	case "/changes":
+		// Counters changed after ?since=<cursor>, oldest first, as a flat array for
+		// Zapier/IFTTT polling triggers. Cursors are Unix microseconds.
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if !authorize(r) { // lists every counter id
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+			return
+		}
+		if st := getStore(); st != nil && getRedis() == nil {
+			if err := store.Supports(st, store.FeatureChangeFeed); err != nil {
+				w.WriteHeader(http.StatusNotImplemented)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		since, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+		if err != nil {
+			since = 0
+		}
+		limit := 100
+		if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 500 {
+			limit = l
+		}
+		type change struct {
+			ID        string     `json:"id"`
+			Counter   string     `json:"counter"`
+			Hits      core.Value `json:"hits"`
+			ChangedAt time.Time  `json:"changed_at"`
+			Cursor    int64      `json:"cursor"`
+		}
+		out := []change{}
+		next := since
+		if rc := getRedis(); rc != nil {
+			ctx, cancel := context.WithTimeout(r.Context(), 1500*time.Millisecond)
+			defer cancel()
+			changes, err := store.NewRedisCounterFromClient(rc, keyPrefix).ChangesSince(ctx, since, limit)
+			if err != nil {
+				captureError(r, "(warn) redis change log read failed: %v", err)
+			}
+			for _, c := range changes {
+				out = append(out, change{
+					ID:        c.ID + "@" + strconv.FormatInt(c.Cursor, 10),
+					Counter:   c.ID,
+					Hits:      publicCount(r, c.ID),
+					ChangedAt: time.UnixMicro(c.Cursor).UTC(),
+					Cursor:    c.Cursor,
+				})
+				next = c.Cursor // oldest first: the last is the next page's start
+			}
+		}
+		w.Header().Set("X-Next-Cursor", strconv.FormatInt(next, 10))
+		_ = json.NewEncoder(w).Encode(out)
+	case "/public/aggregate":
+		// Anonymized deployment-wide totals, opt-in via PUBLIC_AGGREGATE=1.
+		if os.Getenv("PUBLIC_AGGREGATE") != "1" {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "not found"})
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		var agg core.Aggregate
+		if rc := getRedis(); rc != nil {
+			if err := scanAggregate(r.Context(), rc, &agg); err != nil {
+				captureError(r, "(warn) redis aggregate scan failed: %v", err)
+			}
+		} else if st := getStore(); st != nil {
+			if err := store.Supports(st, store.FeatureAggregate); err != nil {
+				w.WriteHeader(http.StatusNotImplemented)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+			defer cancel()
+			err := st.(store.Lister).Each(ctx, func(id string, v core.Value) error {
+				if !core.IsTestID(id) && !core.IsDayBucketID(id) {
+					agg.Add(v)
+				}
+				return nil
+			})
+			if err != nil {
+				captureError(r, "(warn) store aggregate listing failed: %v", err)
+			}
+			agg.Approximate = !st.Capabilities().Exact()
+		} else if n := globalCount.Load(); n > 0 {
+			agg.Add(core.Uint(n))
+		}
+		agg.GeneratedAt = time.Now().UTC()
+		w.Header().Set("Cache-Control", "public, s-maxage=60, max-age=60")
+		_ = json.NewEncoder(w).Encode(agg)
+	case "/snippets":
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			id = "home"
+		}
+		base := snippets.BaseURL(r, os.Getenv("PUBLIC_URL"))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "baseUrl": base, "snippets": snippets.Generate(base, id)})
 	default:
 		w.WriteHeader(http.StatusNotFound)
 		_ = json.NewEncoder(w).Encode(map[string]string{"error": "not found"})
 	}
 }
 
-// normalizeColor restricts colors to safe values (basic allowlist)
-func normalizeColor(c string, fallback string) string {
-	if c == "" {
-		return fallback
-	}
-	c = strings.TrimSpace(c)
-	lc := strings.ToLower(c)
-	if strings.HasPrefix(lc, "#") {
-		if len(lc) == 4 || len(lc) == 7 { // #rgb or #rrggbb
-			return lc
-		}
-		return fallback
-	}
-	switch lc {
-	case "blue", "green", "red", "orange", "yellow", "gray", "grey", "purple", "teal":
-		return lc
-	}
-	return fallback
-}
-
-// buildBadgeSVG creates a small classic style badge, allowing a custom font
-func buildBadgeSVG(label string, count uint64, color string, font string) string {
-	textVal := strconv.FormatUint(count, 10)
-	labelWidth := 6*len(label) + 10
-	valWidth := 6*len(textVal) + 10
-	total := labelWidth + valWidth
-	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
-<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">
-<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
-<rect rx="3" width="%d" height="20" fill="#555"/>
-<rect rx="3" x="%d" width="%d" height="20" fill="%s"/>
-<rect rx="3" width="%d" height="20" fill="url(#s)"/>
-<g fill="#fff" text-anchor="middle" font-family="%s" font-size="11">
-<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text>
-<text x="%d" y="15">%s</text>
-<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text>
-<text x="%d" y="15">%s</text>
-</g>
-</svg>`,
-		total, label, textVal,
-		total, labelWidth, valWidth, color,
-		total, font,
-		labelWidth/2, label,
-		labelWidth/2, label,
-		labelWidth+valWidth/2, textVal,
-		labelWidth+valWidth/2, textVal,
-	)
-}
-
-// buildTerminalBadge outputs a terminal-like monospace badge with label:value styling
-func buildTerminalBadge(label string, count uint64, font, bg, labelColor, valueColor string) string {
-	textVal := strconv.FormatUint(count, 10)
-	labelText := label + ":"
-	// approximate monospace width ~8px per char + padding
-	labelWidth := 8*len(labelText) + 14
-	valWidth := 8*len(textVal) + 14
-	total := labelWidth + valWidth
-	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
-<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="24" role="img" aria-label="%s: %s">
-<rect rx="4" width="%d" height="24" fill="%s" />
-<text x="%d" y="16" font-family="%s" font-size="12" fill="%s">%s</text>
-<text x="%d" y="16" font-family="%s" font-size="12" font-weight="600" fill="%s">%s</text>
-</svg>`,
-		total, label, textVal,
-		total, bg,
-		8, font, labelColor, labelText,
-		labelWidth, font, valueColor, textVal,
-	)
+// scanAggregate sums every "<keyPrefix>*" counter (SCAN + pipelined GETs in
+// batches), skipping playground ids and day buckets.
+func scanAggregate(ctx context.Context, rc redis.UniversalClient, agg *core.Aggregate) error {
+	ctx, cancel := context.WithTimeout(ctx, 8*time.Second)
+	defer cancel()
+	var keys []string
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		vals, found, err := store.GetMany(ctx, rc, keys)
+		if err != nil {
+			return err
+		}
+		for i, s := range vals {
+			if !found[i] {
+				continue
+			}
+			if val, err := core.ParseValue(s); err == nil {
+				agg.Add(val)
+			}
+		}
+		keys = keys[:0]
+		return nil
+	}
+	err := store.ScanKeys(ctx, rc, keyPrefix+"*", func(key string) error {
+		if id := strings.TrimPrefix(key, keyPrefix); core.IsTestID(id) || core.IsDayBucketID(id) {
+			return nil
+		}
+		keys = append(keys, key)
+		if len(keys) == 500 {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// renderBadge builds the SVG for the /badge query params (style, label,
+// colors, font, target). terminal reports whether the terminal style was used.
+func renderBadge(r *http.Request, id string, val core.Value) (svg string, terminal bool) {
+	q := r.URL.Query()
+	label := q.Get("label")
+	if label == "" {
+		label = "views"
+	}
+	style := q.Get("style")
+	if style == "terminal" || style == "mono" { // custom terminal style
+		bg := core.NormalizeColor(q.Get("bg"), "#1e1e1e")
+		labelColor := core.NormalizeColor(q.Get("labelColor"), "#aaa")
+		valueColor := core.NormalizeColor(q.Get("valueColor"), "#3cffb3")
+		font := q.Get("font")
+		if font == "" {
+			font = core.TerminalBadgeFont
+		}
+		return core.TerminalBadgeSVG(label, badgeValue(r, id, val), font, bg, labelColor, valueColor), true
+	}
+	color := q.Get("color")
+	if color == "" {
+		color = "blue"
+	}
+	font := q.Get("font")
+	if font == "" {
+		font = core.BadgeFont
+	}
+	if target := badgeTarget(r); target > 0 && style == "progress" { // bar filled to val/target
+		text, fraction := core.Progress(val, target, badgeMin(r, id))
+		labelColor := core.NormalizeColor(q.Get("labelColor"), core.ProgressLabelColor)
+		trackColor := core.NormalizeColor(q.Get("trackColor"), core.ProgressTrackColor)
+		return core.ProgressBadgeSVG(label, text, font, fraction, labelColor, color, trackColor), false
+	}
+	return core.BadgeSVG(label, badgeValue(r, id, val), color, font), false
+}
+
+// svgDataURI encodes an SVG document as a base64 data: URI.
+func svgDataURI(svg string) string {
+	return "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(svg))
 }
@@ -0,0 +1,202 @@
+//go:build !minimal
+
+// Command analytics-sync seeds counters from pageview totals in Cloudflare Web
+// Analytics or Netlify Analytics, once or on a schedule, so existing analytics
+// carry over into badge counts.
+//
+//	CLOUDFLARE_API_TOKEN=... go run ./cmd/analytics-sync -provider cloudflare \
+//	    -account <account id> -site <site tag> -since 2023-01-01 -map "/=home"
+//	NETLIFY_AUTH_TOKEN=... go run ./cmd/analytics-sync -provider netlify \
+//	    -site <site id> -since 2024-01-01 -map pages.csv -every 1h
+//
+// Totals are summed per mapped id over [-since, now] and written to
+// "<prefix><id>" in Redis, where prefix is the servers': REDIS_PREFIX in the
+// ENVIRONMENT keyspace, under REDIS_KEY_LAYOUT. The default -mode max only ever raises a counter
+// (hits recorded by nums since the switch are kept); -mode set overwrites it.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/importer"
+	"github.com/advayc/nums/store"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// pageviews is one path's total as reported by a provider.
+type pageviews struct {
+	Path  string
+	Views uint64
+}
+
+// provider fetches per-path pageview totals for [from, to).
+type provider interface {
+	Pageviews(ctx context.Context, from, to time.Time) ([]pageviews, error)
+}
+
+// setIfGreater raises KEYS[1] to ARGV[1] atomically and returns the resulting value.
+var setIfGreater = redis.NewScript(`
+local cur = tonumber(redis.call('GET', KEYS[1]) or '0')
+local v = tonumber(ARGV[1])
+if v > cur then
+  redis.call('SET', KEYS[1], ARGV[1])
+  return v
+end
+return cur
+`)
+
+func main() {
+	providerName := flag.String("provider", "", "cloudflare or netlify (required)")
+	account := flag.String("account", os.Getenv("CLOUDFLARE_ACCOUNT_ID"), "Cloudflare account id (defaults to CLOUDFLARE_ACCOUNT_ID)")
+	site := flag.String("site", "", "Cloudflare site tag or Netlify site id (required)")
+	sinceStr := flag.String("since", "", "start date YYYY-MM-DD (required)")
+	mapping := flag.String("map", "", `page to id mapping: "page=id,page=id" or a CSV file of page,id rows (required)`)
+	redisURL := flag.String("redis", os.Getenv("REDIS_URL"), "Redis URL (defaults to REDIS_URL)")
+	prefix := flag.String("prefix", getenv("REDIS_PREFIX", "hits:"), "Redis key prefix before the environment is added (defaults to REDIS_PREFIX or hits:)")
+	envFlag := flag.String("env", os.Getenv("ENVIRONMENT"), "environment keyspace (defaults to ENVIRONMENT or production)")
+	layoutFlag := flag.String("layout", getenv("REDIS_KEY_LAYOUT", store.LayoutV1), "Redis key layout, v1 or v2 (defaults to REDIS_KEY_LAYOUT or v1)")
+	mode := flag.String("mode", "max", "max (only raise counters) or set (overwrite)")
+	every := flag.Duration("every", 0, "repeat the sync at this interval (0 runs once)")
+	dryRun := flag.Bool("dry-run", false, "print what would be written without touching Redis")
+	flag.Parse()
+
+	if *providerName == "" || *site == "" || *sinceStr == "" || *mapping == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *mode != "max" && *mode != "set" {
+		log.Fatalf("-mode must be max or set, got %q", *mode)
+	}
+	since, err := time.Parse("2006-01-02", *sinceStr)
+	if err != nil {
+		log.Fatalf("-since: %v", err)
+	}
+	env, err := core.ParseEnvironment(*envFlag)
+	if err != nil {
+		log.Fatalf("-env: %v", err)
+	}
+	layout, err := store.ParseLayout(*layoutFlag)
+	if err != nil {
+		log.Fatalf("-layout: %v", err)
+	}
+	pages, err := importer.LoadMapping(*mapping)
+	if err != nil {
+		log.Fatalf("load mapping: %v", err)
+	}
+
+	var src provider
+	switch *providerName {
+	case "cloudflare":
+		token := os.Getenv("CLOUDFLARE_API_TOKEN")
+		if token == "" || *account == "" {
+			log.Fatal("cloudflare needs CLOUDFLARE_API_TOKEN and -account (or CLOUDFLARE_ACCOUNT_ID)")
+		}
+		src = newCloudflare(token, *account, *site)
+	case "netlify":
+		token := os.Getenv("NETLIFY_AUTH_TOKEN")
+		if token == "" {
+			log.Fatal("netlify needs NETLIFY_AUTH_TOKEN")
+		}
+		src = newNetlify(token, *site)
+	default:
+		log.Fatalf("unknown -provider %q (want cloudflare or netlify)", *providerName)
+	}
+
+	var rdb *redis.Client
+	if !*dryRun {
+		if *redisURL == "" {
+			log.Fatal("no Redis configured (set -redis or REDIS_URL)")
+		}
+		opt, err := redis.ParseURL(*redisURL)
+		if err != nil {
+			log.Fatalf("parse redis url: %v", err)
+		}
+		rdb = redis.NewClient(opt)
+		defer rdb.Close()
+	}
+
+	for {
+		if err := syncOnce(src, pages, since, rdb, layout, core.EnvKeyPrefix(env)+*prefix, *mode); err != nil {
+			if *every == 0 {
+				log.Fatalf("sync: %v", err)
+			}
+			log.Printf("(warn) sync failed, retrying in %s: %v", *every, err)
+		}
+		if *every == 0 {
+			break
+		}
+		time.Sleep(*every)
+	}
+	if *dryRun {
+		fmt.Println("(dry run, nothing written)")
+	}
+}
+
+// syncOnce fetches totals since the start date and writes them per mapped id
+// under the v1 prefix prefix in layout (rdb nil means dry run).
+func syncOnce(src provider, pages importer.Mapping, since time.Time, rdb *redis.Client, layout, prefix, mode string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	if rdb != nil { // every run, as the keys may have been migrated since the last
+		var err error
+		if prefix, err = store.ResolvePrefix(ctx, rdb, layout, prefix); err != nil {
+			return err
+		}
+	}
+	rows, err := src.Pageviews(ctx, since, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	totals := make(map[string]uint64)
+	skipped := 0
+	for _, row := range rows {
+		id, ok := pages.Lookup(row.Path)
+		if !ok {
+			skipped++
+			continue
+		}
+		totals[id] += row.Views
+	}
+	if skipped > 0 {
+		log.Printf("skipped %d unmapped paths", skipped)
+	}
+	ids := make([]string, 0, len(totals))
+	for id := range totals {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		imported := totals[id]
+		if rdb == nil {
+			fmt.Printf("%s: %d views\n", id, imported)
+			continue
+		}
+		if mode == "set" {
+			if err := rdb.Set(ctx, prefix+id, imported, 0).Err(); err != nil {
+				return fmt.Errorf("set %s: %w", id, err)
+			}
+			fmt.Printf("%s: %d views (set)\n", id, imported)
+			continue
+		}
+		cur, err := setIfGreater.Run(ctx, rdb, []string{prefix + id}, imported).Uint64()
+		if err != nil {
+			return fmt.Errorf("update %s: %w", id, err)
+		}
+		fmt.Printf("%s: %d views imported, counter now %d\n", id, imported, cur)
+	}
+	return nil
+}
+
+func getenv(k, def string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,177 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// cloudflareWindow is the longest range requested per GraphQL query; longer
+// syncs are split into consecutive windows and summed.
+const cloudflareWindow = 7 * 24 * time.Hour
+
+// cloudflare reads Web Analytics (RUM) page loads via the GraphQL Analytics API.
+type cloudflare struct {
+	client   *http.Client
+	endpoint string
+	token    string
+	account  string
+	siteTag  string
+}
+
+func newCloudflare(token, account, siteTag string) *cloudflare {
+	return &cloudflare{
+		client:   &http.Client{Timeout: 30 * time.Second},
+		endpoint: "https://api.cloudflare.com/client/v4/graphql",
+		token:    token,
+		account:  account,
+		siteTag:  siteTag,
+	}
+}
+
+const cloudflareQuery = `query($account: string!, $filter: AccountRumPageloadEventsAdaptiveGroupsFilter_InputObject) {
+  viewer {
+    accounts(filter: {accountTag: $account}) {
+      rumPageloadEventsAdaptiveGroups(filter: $filter, limit: 5000) {
+        count
+        dimensions { requestPath }
+      }
+    }
+  }
+}`
+
+func (c *cloudflare) Pageviews(ctx context.Context, from, to time.Time) ([]pageviews, error) {
+	sums := make(map[string]uint64)
+	for start := from; start.Before(to); start = start.Add(cloudflareWindow) {
+		end := start.Add(cloudflareWindow)
+		if end.After(to) {
+			end = to
+		}
+		if err := c.window(ctx, start, end, sums); err != nil {
+			return nil, err
+		}
+	}
+	out := make([]pageviews, 0, len(sums))
+	for path, n := range sums {
+		out = append(out, pageviews{Path: path, Views: n})
+	}
+	return out, nil
+}
+
+func (c *cloudflare) window(ctx context.Context, from, to time.Time, sums map[string]uint64) error {
+	body, err := json.Marshal(map[string]any{
+		"query": cloudflareQuery,
+		"variables": map[string]any{
+			"account": c.account,
+			"filter": map[string]any{"AND": []map[string]any{
+				{"datetime_geq": from.Format(time.RFC3339), "datetime_lt": to.Format(time.RFC3339)},
+				{"siteTag": c.siteTag},
+			}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+	var resp struct {
+		Data struct {
+			Viewer struct {
+				Accounts []struct {
+					Groups []struct {
+						Count      uint64 `json:"count"`
+						Dimensions struct {
+							RequestPath string `json:"requestPath"`
+						} `json:"dimensions"`
+					} `json:"rumPageloadEventsAdaptiveGroups"`
+				} `json:"accounts"`
+			} `json:"viewer"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := doJSON(c.client, req, &resp); err != nil {
+		return fmt.Errorf("cloudflare: %w", err)
+	}
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("cloudflare: %s", resp.Errors[0].Message)
+	}
+	for _, acct := range resp.Data.Viewer.Accounts {
+		for _, g := range acct.Groups {
+			sums[g.Dimensions.RequestPath] += g.Count
+		}
+	}
+	return nil
+}
+
+// netlify reads page rankings from Netlify Analytics. This is the API the
+// Netlify dashboard itself uses; it is not formally documented.
+type netlify struct {
+	client   *http.Client
+	endpoint string
+	token    string
+	siteID   string
+}
+
+func newNetlify(token, siteID string) *netlify {
+	return &netlify{
+		client:   &http.Client{Timeout: 30 * time.Second},
+		endpoint: "https://analytics.services.netlify.com/v2/",
+		token:    token,
+		siteID:   siteID,
+	}
+}
+
+func (n *netlify) Pageviews(ctx context.Context, from, to time.Time) ([]pageviews, error) {
+	q := url.Values{}
+	q.Set("from", strconv.FormatInt(from.UnixMilli(), 10))
+	q.Set("to", strconv.FormatInt(to.UnixMilli(), 10))
+	q.Set("timezone", "+0000")
+	q.Set("limit", "1000")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.endpoint+url.PathEscape(n.siteID)+"/ranking/pages?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+n.token)
+	var resp struct {
+		Data []struct {
+			Resource string `json:"resource"`
+			Count    uint64 `json:"count"`
+		} `json:"data"`
+	}
+	if err := doJSON(n.client, req, &resp); err != nil {
+		return nil, fmt.Errorf("netlify: %w", err)
+	}
+	out := make([]pageviews, 0, len(resp.Data))
+	for _, d := range resp.Data {
+		out = append(out, pageviews{Path: d.Resource, Views: d.Count})
+	}
+	return out, nil
+}
+
+// doJSON performs req and decodes a 2xx JSON response into v.
+func doJSON(client *http.Client, req *http.Request, v any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
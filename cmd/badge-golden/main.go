@@ -0,0 +1,101 @@
+// Command badge-golden compares the badge SVG builders with golden files, one
+// per style and parameter case in core.BadgeMatrix, so a change to the SVG
+// output is seen before it ships:
+//
+//	go run ./cmd/badge-golden           # list changed badges, exit 1 if any
+//	go run ./cmd/badge-golden -update   # accept the current output
+//
+// go test ./core runs the same comparison (TestBadgeMatrix). After an
+// intended change, look at /debug/badge-matrix on the standalone server, then
+// run -update and commit the golden files with the change.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/advayc/nums/core"
+)
+
+func main() {
+	dir := flag.String("dir", filepath.Join("core", "testdata", "badges"), "directory of golden <case>.svg files")
+	update := flag.Bool("update", false, "write the current output as the new golden files")
+	flag.Parse()
+
+	cases := core.BadgeMatrix()
+	if *update {
+		if err := os.MkdirAll(*dir, 0o755); err != nil {
+			log.Fatal(err)
+		}
+	}
+	known := make(map[string]bool)
+	changed := 0
+	for _, c := range cases {
+		known[c.Name+".svg"] = true
+		path := filepath.Join(*dir, c.Name+".svg")
+		if *update {
+			if err := os.WriteFile(path, []byte(c.SVG+"\n"), 0o644); err != nil {
+				log.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			fmt.Printf("%s: no golden file (run with -update)\n", c.Name)
+			changed++
+			continue
+		} else if err != nil {
+			log.Fatal(err)
+		}
+		if got := []byte(c.SVG + "\n"); !bytes.Equal(got, want) {
+			fmt.Printf("%s: %s\n", c.Name, firstDiff(string(want), string(got)))
+			changed++
+		}
+	}
+	entries, err := os.ReadDir(*dir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".svg") && !known[e.Name()] {
+			if *update {
+				_ = os.Remove(filepath.Join(*dir, e.Name()))
+				continue
+			}
+			fmt.Printf("%s: golden file has no case in core.BadgeMatrix\n", e.Name())
+			changed++
+		}
+	}
+	if *update {
+		fmt.Printf("wrote %d golden badges to %s\n", len(cases), *dir)
+		return
+	}
+	if changed > 0 {
+		fmt.Printf("%d of %d badges differ from %s\n", changed, len(cases), *dir)
+		os.Exit(1)
+	}
+	fmt.Printf("%d badges match %s\n", len(cases), *dir)
+}
+
+// firstDiff describes the first line where got differs from want.
+func firstDiff(want, got string) string {
+	w, g := strings.Split(want, "\n"), strings.Split(got, "\n")
+	for i := 0; i < len(w) || i < len(g); i++ {
+		var wl, gl string
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		if wl != gl {
+			return fmt.Sprintf("line %d\n  want %s\n  got  %s", i+1, wl, gl)
+		}
+	}
+	return "differs"
+}
@@ -0,0 +1,205 @@
+//go:build !minimal
+
+// Command env-promote copies counters between ENVIRONMENT keyspaces in Redis,
+// e.g. to seed staging from production or promote staging counts after a
+// migration dry run.
+//
+//	go run ./cmd/env-promote -from production -to staging
+//	go run ./cmd/env-promote -from staging -to production -ids home,blog -mode max -yes
+//
+// Every "<from prefix><id>" counter (day buckets included, playground ids
+// skipped) is written to "<to prefix><id>". -mode set (the default) copies
+// the value and its TTL, -mode max only raises the target, and -mode add adds
+// the source to it. Writing into production requires -yes.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// setIfGreater raises KEYS[1] to ARGV[1] atomically and returns the resulting value.
+var setIfGreater = redis.NewScript(`
+local cur = tonumber(redis.call('GET', KEYS[1]) or '0')
+local v = tonumber(ARGV[1])
+if v > cur then
+  redis.call('SET', KEYS[1], ARGV[1])
+  return ARGV[1]
+end
+return tostring(redis.call('GET', KEYS[1]) or '0')
+`)
+
+func main() {
+	fromFlag := flag.String("from", "", "source environment, e.g. production (required)")
+	toFlag := flag.String("to", "", "target environment, e.g. staging (required)")
+	redisURL := flag.String("redis", os.Getenv("REDIS_URL"), "Redis URL (defaults to REDIS_URL)")
+	prefix := flag.String("prefix", getenv("REDIS_PREFIX", "hits:"), "Redis key prefix before the environment is added (defaults to REDIS_PREFIX or hits:)")
+	layoutFlag := flag.String("layout", getenv("REDIS_KEY_LAYOUT", store.LayoutV1), "Redis key layout, v1 or v2 (defaults to REDIS_KEY_LAYOUT or v1)")
+	idList := flag.String("ids", "", "comma-separated ids to copy (default all)")
+	mode := flag.String("mode", "set", "set (overwrite), max (only raise) or add")
+	yes := flag.Bool("yes", false, "confirm writing into production")
+	dryRun := flag.Bool("dry-run", false, "print what would be written without touching the target")
+	flag.Parse()
+
+	if *fromFlag == "" || *toFlag == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	from, err := core.ParseEnvironment(*fromFlag)
+	if err != nil {
+		log.Fatalf("-from: %v", err)
+	}
+	to, err := core.ParseEnvironment(*toFlag)
+	if err != nil {
+		log.Fatalf("-to: %v", err)
+	}
+	if from == to {
+		log.Fatal("-from and -to are the same environment")
+	}
+	layout, err := store.ParseLayout(*layoutFlag)
+	if err != nil {
+		log.Fatalf("-layout: %v", err)
+	}
+	if *mode != "set" && *mode != "max" && *mode != "add" {
+		log.Fatalf("-mode must be set, max or add, got %q", *mode)
+	}
+	if to == core.Production && !*yes && !*dryRun {
+		log.Fatal("refusing to write into production without -yes")
+	}
+	if *redisURL == "" {
+		log.Fatal("no Redis configured (set -redis or REDIS_URL)")
+	}
+	opt, err := redis.ParseURL(*redisURL)
+	if err != nil {
+		log.Fatalf("parse redis url: %v", err)
+	}
+	rdb := redis.NewClient(opt)
+	defer rdb.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	src, err := store.ResolvePrefix(ctx, rdb, layout, core.EnvKeyPrefix(from)+*prefix)
+	if err != nil {
+		log.Fatalf("-from: %v", err)
+	}
+	dst, err := store.ResolvePrefix(ctx, rdb, layout, core.EnvKeyPrefix(to)+*prefix)
+	if err != nil {
+		log.Fatalf("-to: %v", err)
+	}
+	ids, err := sourceIDs(ctx, rdb, src, *idList)
+	if err != nil {
+		log.Fatalf("list %s: %v", from, err)
+	}
+	copied := 0
+	for _, id := range ids {
+		ok, err := promote(ctx, rdb, src+id, dst+id, *mode, *dryRun)
+		if err != nil {
+			log.Fatalf("%s: %v", id, err)
+		}
+		if ok {
+			copied++
+		}
+	}
+	fmt.Printf("%d counters from %s to %s (mode %s)\n", copied, from, to, *mode)
+	if *dryRun {
+		fmt.Println("(dry run, nothing written)")
+	}
+}
+
+// sourceIDs returns the ids to copy: the -ids list, or every non-playground
+// id under src.
+func sourceIDs(ctx context.Context, rdb *redis.Client, src, list string) ([]string, error) {
+	var ids []string
+	if list != "" {
+		for _, id := range strings.Split(list, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+		return ids, nil
+	}
+	iter := rdb.Scan(ctx, 0, src+"*", 500).Iterator()
+	for iter.Next(ctx) {
+		id := strings.TrimPrefix(iter.Val(), src)
+		if core.IsTestID(id) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// promote copies srcKey to dstKey and reports whether the source existed.
+func promote(ctx context.Context, rdb *redis.Client, srcKey, dstKey, mode string, dryRun bool) (bool, error) {
+	raw, err := rdb.Get(ctx, srcKey).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	v, err := core.ParseValue(raw)
+	if err != nil {
+		return false, fmt.Errorf("%s is not a counter: %w", srcKey, err)
+	}
+	if dryRun {
+		fmt.Printf("%s -> %s: %s (%s)\n", srcKey, dstKey, v, mode)
+		return true, nil
+	}
+	var now string
+	switch mode {
+	case "set":
+		ttl, err := rdb.PTTL(ctx, srcKey).Result()
+		if err != nil {
+			return false, err
+		}
+		if ttl < 0 {
+			ttl = 0 // no expiry
+		}
+		if err := rdb.Set(ctx, dstKey, raw, ttl).Err(); err != nil {
+			return false, err
+		}
+		now = raw
+	case "max":
+		if now, err = setIfGreater.Run(ctx, rdb, []string{dstKey}, raw).Text(); err != nil {
+			return false, err
+		}
+	case "add":
+		if v.IsFloat() {
+			f, err := rdb.IncrByFloat(ctx, dstKey, v.Float64()).Result()
+			if err != nil {
+				return false, err
+			}
+			now = core.Float(f).String()
+		} else {
+			n, err := rdb.IncrBy(ctx, dstKey, int64(v.Uint64())).Result()
+			if err != nil {
+				return false, err
+			}
+			now = fmt.Sprint(n)
+		}
+	}
+	fmt.Printf("%s -> %s: %s (now %s)\n", srcKey, dstKey, v, now)
+	return true, nil
+}
+
+func getenv(k, def string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,224 @@
+//go:build !minimal
+
+// Command ga-import backfills per-day hit buckets from a Google Analytics
+// export so historical charts survive a switch from GA to nums.
+//
+// It reads a GA4 or Universal Analytics CSV export (date, page and views
+// columns; "#" comment lines are ignored), maps page paths to counter ids and
+// writes one Redis key per id and day ("<prefix><id>:<YYYYMMDD>"). The prefix
+// is the servers': REDIS_PREFIX in the ENVIRONMENT keyspace, under
+// REDIS_KEY_LAYOUT.
+//
+//	go run ./cmd/ga-import -csv ga4-export.csv -map "/=home,/blog/hello=hello"
+//	go run ./cmd/ga-import -csv ua-export.csv -map pages.csv -add-total
+//
+// -map is either a comma separated list of page=id pairs or a CSV file with
+// page,id rows. Several pages may map to the same id; unmapped pages are
+// skipped. Day buckets are SET, so re-running an import is safe; -add-total
+// also adds the imported views to each counter's total (not idempotent).
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/importer"
+	"github.com/advayc/nums/store"
+	redis "github.com/redis/go-redis/v9"
+)
+
+func main() {
+	csvPath := flag.String("csv", "", "GA4/UA export CSV (required)")
+	mapping := flag.String("map", "", `page to id mapping: "page=id,page=id" or a CSV file of page,id rows (required)`)
+	redisURL := flag.String("redis", os.Getenv("REDIS_URL"), "Redis URL (defaults to REDIS_URL)")
+	prefix := flag.String("prefix", getenv("REDIS_PREFIX", "hits:"), "Redis key prefix before the environment is added (defaults to REDIS_PREFIX or hits:)")
+	envFlag := flag.String("env", os.Getenv("ENVIRONMENT"), "environment keyspace (defaults to ENVIRONMENT or production)")
+	layoutFlag := flag.String("layout", getenv("REDIS_KEY_LAYOUT", store.LayoutV1), "Redis key layout, v1 or v2 (defaults to REDIS_KEY_LAYOUT or v1)")
+	addTotal := flag.Bool("add-total", false, "also add imported views to each counter's total")
+	dryRun := flag.Bool("dry-run", false, "print what would be written without touching Redis")
+	flag.Parse()
+
+	if *csvPath == "" || *mapping == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	env, err := core.ParseEnvironment(*envFlag)
+	if err != nil {
+		log.Fatalf("-env: %v", err)
+	}
+	layout, err := store.ParseLayout(*layoutFlag)
+	if err != nil {
+		log.Fatalf("-layout: %v", err)
+	}
+	pages, err := importer.LoadMapping(*mapping)
+	if err != nil {
+		log.Fatalf("load mapping: %v", err)
+	}
+	f, err := os.Open(*csvPath)
+	if err != nil {
+		log.Fatalf("open csv: %v", err)
+	}
+	days, skipped, err := readExport(f, pages)
+	_ = f.Close()
+	if err != nil {
+		log.Fatalf("read %s: %v", *csvPath, err)
+	}
+	if skipped > 0 {
+		log.Printf("skipped %d rows for unmapped pages", skipped)
+	}
+
+	ids := make([]string, 0, len(days))
+	for id := range days {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var rdb *redis.Client
+	if !*dryRun {
+		if *redisURL == "" {
+			log.Fatal("no Redis configured (set -redis or REDIS_URL); day buckets are only stored in Redis")
+		}
+		opt, err := redis.ParseURL(*redisURL)
+		if err != nil {
+			log.Fatalf("parse redis url: %v", err)
+		}
+		rdb = redis.NewClient(opt)
+		defer rdb.Close()
+	}
+
+	ctx := context.Background()
+	v1 := core.EnvKeyPrefix(env) + *prefix
+	keys := store.LayoutPrefix(layout, v1)
+	if rdb != nil {
+		if keys, err = store.ResolvePrefix(ctx, rdb, layout, v1); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, id := range ids {
+		var total uint64
+		var pipe redis.Pipeliner
+		if rdb != nil {
+			pipe = rdb.TxPipeline()
+		}
+		for day, views := range days[id] {
+			total += views
+			// buckets expire core.DayBucketTTL after their day, as the
+			// servers' do; older days only count towards the total
+			if ttl := day.Add(core.DayBucketTTL).Sub(time.Now()); pipe != nil && ttl > 0 {
+				pipe.Set(ctx, keys+core.DayBucketID(id, day), views, ttl)
+			}
+		}
+		if *addTotal && pipe != nil {
+			pipe.IncrBy(ctx, keys+id, int64(total))
+		}
+		if pipe != nil {
+			if _, err := pipe.Exec(ctx); err != nil {
+				log.Fatalf("write %s: %v", id, err)
+			}
+		}
+		fmt.Printf("%s: %d days, %d views\n", id, len(days[id]), total)
+	}
+	if *dryRun {
+		fmt.Println("(dry run, nothing written)")
+	}
+}
+
+// Header names used by GA4 and UA exports (lower-cased).
+var (
+	dateHeaders  = []string{"date", "day"}
+	pageHeaders  = []string{"page path and screen class", "page path", "page", "landing page"}
+	viewsHeaders = []string{"views", "pageviews", "screen page views", "screenpageviews", "unique pageviews"}
+)
+
+// readExport sums views per mapped id and UTC day. It returns the number of
+// data rows skipped because their page is not mapped.
+func readExport(in io.Reader, pages importer.Mapping) (map[string]map[time.Time]uint64, int, error) {
+	r := csv.NewReader(in)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+
+	var dateCol, pageCol, viewsCol = -1, -1, -1
+	days := make(map[string]map[time.Time]uint64)
+	skipped := 0
+	for line := 1; ; line++ {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if dateCol < 0 { // first row is the header (blank lines are skipped by csv)
+			dateCol, pageCol, viewsCol = findColumn(row, dateHeaders), findColumn(row, pageHeaders), findColumn(row, viewsHeaders)
+			if dateCol < 0 || pageCol < 0 || viewsCol < 0 {
+				return nil, 0, fmt.Errorf("header %q: need date, page path and views columns", row)
+			}
+			continue
+		}
+		if len(row) <= max(dateCol, pageCol, viewsCol) || strings.TrimSpace(row[pageCol]) == "" {
+			continue // totals/footer rows
+		}
+		id, ok := pages.Lookup(row[pageCol])
+		if !ok {
+			skipped++
+			continue
+		}
+		day, err := parseDay(row[dateCol])
+		if err != nil {
+			return nil, 0, fmt.Errorf("line %d: %w", line, err)
+		}
+		views, err := strconv.ParseUint(strings.ReplaceAll(strings.TrimSpace(row[viewsCol]), ",", ""), 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("line %d: bad views %q", line, row[viewsCol])
+		}
+		if days[id] == nil {
+			days[id] = make(map[time.Time]uint64)
+		}
+		days[id][day] += views
+	}
+	if dateCol < 0 {
+		return nil, 0, errors.New("empty export")
+	}
+	return days, skipped, nil
+}
+
+func findColumn(header []string, names []string) int {
+	for _, name := range names {
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), name) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parseDay accepts the date formats GA exports use: 20240131 (GA4 and UA
+// "Date" dimension), 2024-01-31 and 01/31/2024.
+func parseDay(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"20060102", "2006-01-02", "01/02/2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", s)
+}
+
+func getenv(k, def string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const adminUsage = `Usage: nums admin [-server URL] [-token TOKEN] <command> [args]
+
+Manages a running server over HTTP. The server defaults to NUMS_SERVER or
+http://localhost:$PORT and the token to NUMS_TOKEN or SECRET_TOKEN (read from
+.env when they are not in the environment).
+
+Commands:
+  get <id>                  show a counter
+  set <id> <value>          overwrite a counter
+  reset <id>                set a counter to 0
+  delete <id>               delete a counter, restorable for DELETE_RETENTION
+  restore <id>              undo delete
+  merge <from> <into>       move every hit of <from> onto <into> atomically
+  freeze <id>               keep a counter at its current value
+  unfreeze <id>
+  frozen                    list frozen counters
+  round <id> <step>         show a counter rounded to step (0 for exact)
+  offset <id> <n>           add n to a counter's public value
+  schedule [<id> [<every>]] list scheduled resets, show one with its archive, or
+                            reset a counter daily, weekly, monthly or none
+  webhooks                  list webhook subscriptions
+  backend                   show the storage circuit state
+  clock [by|at|reset]       show or move the clock (72h, -30m, an RFC 3339 time)
+  export [-format csv]      print every counter as JSON or CSV
+`
+
+// adminClient calls the admin routes of a running server.
+type adminClient struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+// runAdmin is "nums admin": the admin API from the command line, so
+// operators need neither a shell in the container nor hand-written curl.
+func runAdmin(args []string) {
+	if _, err := loadEnvFile(".env"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "config: %v\n", err)
+	}
+	fset := flag.NewFlagSet("nums admin", flag.ExitOnError)
+	fset.Usage = func() { fmt.Fprint(fset.Output(), adminUsage) }
+	server := fset.String("server", getenv("NUMS_SERVER", "http://localhost:"+getenv("PORT", "8080")), "server base URL")
+	token := fset.String("token", getenv("NUMS_TOKEN", os.Getenv("SECRET_TOKEN")), "admin token (X-Auth-Token)")
+	_ = fset.Parse(args)
+	if fset.NArg() == 0 {
+		fset.Usage()
+		os.Exit(2)
+	}
+	c := &adminClient{server: strings.TrimRight(*server, "/"), token: *token, http: &http.Client{Timeout: 30 * time.Second}}
+	if err := c.run(fset.Arg(0), fset.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "nums admin %s: %v\n", fset.Arg(0), err)
+		os.Exit(1)
+	}
+}
+
+func (c *adminClient) run(cmd string, args []string) error {
+	need := func(n int, names string) error {
+		if len(args) != n {
+			return fmt.Errorf("usage: nums admin %s %s", cmd, names)
+		}
+		return nil
+	}
+	switch cmd {
+	case "get":
+		if err := need(1, "<id>"); err != nil {
+			return err
+		}
+		return c.print(http.MethodGet, "/admin/set", url.Values{"id": {args[0]}}, nil)
+	case "set":
+		if err := need(2, "<id> <value>"); err != nil {
+			return err
+		}
+		return c.print(http.MethodPost, "/admin/set", url.Values{"id": {args[0]}, "value": {args[1]}}, nil)
+	case "reset":
+		if err := need(1, "<id>"); err != nil {
+			return err
+		}
+		return c.print(http.MethodPost, "/reset", url.Values{"id": {args[0]}}, nil)
+	case "delete":
+		if err := need(1, "<id>"); err != nil {
+			return err
+		}
+		return c.print(http.MethodDelete, "/counter", url.Values{"id": {args[0]}}, nil)
+	case "restore":
+		if err := need(1, "<id>"); err != nil {
+			return err
+		}
+		return c.print(http.MethodPost, "/counter/restore", url.Values{"id": {args[0]}}, nil)
+	case "merge":
+		if err := need(2, "<from> <into>"); err != nil {
+			return err
+		}
+		return c.merge(args[0], args[1])
+	case "freeze", "unfreeze":
+		if err := need(1, "<id>"); err != nil {
+			return err
+		}
+		method := http.MethodPost
+		if cmd == "unfreeze" {
+			method = http.MethodDelete
+		}
+		return c.print(method, "/admin/freeze", url.Values{"id": {args[0]}}, nil)
+	case "frozen":
+		return c.print(http.MethodGet, "/admin/freeze", nil, nil)
+	case "round":
+		if err := need(2, "<id> <step>"); err != nil {
+			return err
+		}
+		return c.print(http.MethodPost, "/admin/round", url.Values{"id": {args[0]}, "step": {args[1]}}, nil)
+	case "offset":
+		if err := need(2, "<id> <n>"); err != nil {
+			return err
+		}
+		return c.print(http.MethodPost, "/admin/offset", url.Values{"id": {args[0]}, "offset": {args[1]}}, nil)
+	case "schedule":
+		switch len(args) {
+		case 0:
+			return c.print(http.MethodGet, "/admin/schedule", nil, nil)
+		case 1:
+			return c.print(http.MethodGet, "/admin/schedule", url.Values{"id": {args[0]}}, nil)
+		}
+		if err := need(2, "[<id> [<every>]]"); err != nil {
+			return err
+		}
+		return c.print(http.MethodPost, "/admin/schedule", url.Values{"id": {args[0]}, "every": {args[1]}}, nil)
+	case "webhooks":
+		return c.print(http.MethodGet, "/admin/webhooks", nil, nil)
+	case "backend":
+		return c.print(http.MethodGet, "/admin/backend", nil, nil)
+	case "clock":
+		switch {
+		case len(args) == 0:
+			return c.print(http.MethodGet, "/admin/clock", nil, nil)
+		case len(args) > 1:
+			return fmt.Errorf("usage: nums admin clock [72h | 2030-01-01T00:00:00Z | reset]")
+		case args[0] == "reset":
+			return c.print(http.MethodDelete, "/admin/clock", nil, nil)
+		case strings.Contains(args[0], "T"):
+			return c.print(http.MethodPost, "/admin/clock", url.Values{"at": {args[0]}}, nil)
+		}
+		return c.print(http.MethodPost, "/admin/clock", url.Values{"by": {args[0]}}, nil)
+	case "export":
+		fset := flag.NewFlagSet("nums admin export", flag.ExitOnError)
+		format := fset.String("format", "json", "json or csv")
+		_ = fset.Parse(args)
+		body, err := c.do(http.MethodGet, "/admin/export", url.Values{"format": {*format}}, nil)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(body)
+		return err
+	}
+	return fmt.Errorf("unknown command (see nums admin -h)")
+}
+
+// merge moves from's hits onto into in one transaction that fails if from
+// changed after it was read.
+func (c *adminClient) merge(from, into string) error {
+	body, err := c.do(http.MethodGet, "/admin/set", url.Values{"id": {from}}, nil)
+	if err != nil {
+		return err
+	}
+	var cur struct {
+		Hits json.Number `json:"hits"`
+	}
+	if err := json.Unmarshal(body, &cur); err != nil {
+		return err
+	}
+	n, err := strconv.ParseUint(cur.Hits.String(), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%s holds %s; only integer counters can be merged", from, cur.Hits)
+	}
+	if n == 0 {
+		fmt.Printf("%s has no hits; nothing to merge\n", from)
+		return nil
+	}
+	tx := map[string]any{"ops": []map[string]any{
+		{"op": "expect", "id": from, "value": n},
+		{"op": "set", "id": from, "value": 0},
+		{"op": "inc", "id": into, "by": n},
+	}}
+	payload, _ := json.Marshal(tx)
+	if err := c.print(http.MethodPost, "/tx", nil, payload); err != nil {
+		return fmt.Errorf("%w (if %s changed meanwhile, run merge again)", err, from)
+	}
+	return nil
+}
+
+// do sends one request and returns the body of a 2xx response.
+func (c *adminClient) do(method, path string, q url.Values, body []byte) ([]byte, error) {
+	u := c.server + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Auth-Token", c.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(out, &e) == nil && e.Error != "" {
+			return nil, fmt.Errorf("%s: %s", resp.Status, e.Error)
+		}
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
+
+// print runs the request and pretty-prints its JSON response.
+func (c *adminClient) print(method, path string, q url.Values, body []byte) error {
+	out, err := c.do(method, path, q, body)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if json.Indent(&buf, bytes.TrimSpace(out), "", "  ") != nil {
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err = buf.WriteTo(os.Stdout)
+	return err
+}
@@ -0,0 +1,30 @@
+//go:build !minimal
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// aggregateCacheTTL bounds how often /public/aggregate rescans all counters.
+const aggregateCacheTTL = time.Minute
+
+// aggregateCache memoizes the result of compute for aggregateCacheTTL.
+type aggregateCache struct {
+	compute func() core.Aggregate
+
+	mu   sync.Mutex
+	last core.Aggregate
+}
+
+func (c *aggregateCache) get() core.Aggregate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last.GeneratedAt.IsZero() || time.Since(c.last.GeneratedAt) > aggregateCacheTTL {
+		c.last = c.compute()
+	}
+	return c.last
+}
@@ -0,0 +1,119 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+	"github.com/redis/go-redis/v9"
+)
+
+// changeLog tracks when each counter last changed so pollers (Zapier, IFTTT)
+// can ask for everything that moved since a cursor. The cursor is the change
+// time in Unix microseconds. With Redis the log is the sorted set
+// "changes:<prefix>" (member id, score cursor); otherwise it lives in memory.
+type changeLog struct {
+	redis *store.RedisCounter
+
+	mu      sync.Mutex
+	last    map[string]int64
+	changed chan struct{} // closed on the next record, for long polls
+}
+
+func newChangeLog(rc *store.RedisCounter) *changeLog {
+	return &changeLog{redis: rc, last: make(map[string]int64), changed: make(chan struct{})}
+}
+
+// wake returns a channel closed when this instance next records a change.
+// Changes made by other instances are not signaled.
+func (c *changeLog) wake() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.changed
+}
+
+func (c *changeLog) redisKey() string { return "changes:" + c.redis.Prefix() }
+
+// record marks id as changed now and wakes long polls. Playground counters
+// are not logged.
+func (c *changeLog) record(id string) {
+	c.mu.Lock()
+	close(c.changed)
+	c.changed = make(chan struct{})
+	c.mu.Unlock()
+	if isTestID(id) {
+		return
+	}
+	if id == "" {
+		id = "default"
+	}
+	cursor := core.Now().UnixMicro()
+	if c.redis != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		err := c.redis.Client().ZAdd(ctx, c.redisKey(), redis.Z{Score: float64(cursor), Member: id}).Err()
+		if err == nil {
+			return
+		}
+		log.Printf("(warn) redis change log failed, keeping in memory: %v", err)
+	}
+	c.mu.Lock()
+	c.last[id] = cursor
+	c.mu.Unlock()
+}
+
+// since returns counters changed after cursor, oldest first, at most limit
+// (see store.PageChanges); the last one's cursor pages through the rest.
+func (c *changeLog) since(cursor int64, limit int) []store.Change {
+	if c.redis != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		out, err := c.redis.ChangesSince(ctx, cursor, limit)
+		if err == nil {
+			return out
+		}
+		log.Printf("(warn) redis change log read failed, using memory: %v", err)
+	}
+	c.mu.Lock()
+	var out []store.Change
+	for id, at := range c.last {
+		if at > cursor {
+			out = append(out, store.Change{ID: id, Cursor: at})
+		}
+	}
+	c.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Cursor < out[j].Cursor })
+	return store.PageChanges(out, limit)
+}
+
+// changedAt returns when id last changed, or the zero time if it is not in
+// the log (playground counters, or a memory log since the last restart).
+func (c *changeLog) changedAt(id string) time.Time {
+	if id == "" {
+		id = "default"
+	}
+	if c.redis != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		score, err := c.redis.Client().ZScore(ctx, c.redisKey(), id).Result()
+		switch {
+		case err == nil:
+			return time.UnixMicro(int64(score))
+		case err == redis.Nil:
+			return time.Time{}
+		}
+		log.Printf("(warn) redis change log read failed, using memory: %v", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if at, ok := c.last[id]; ok {
+		return time.UnixMicro(at)
+	}
+	return time.Time{}
+}
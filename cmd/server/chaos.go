@@ -0,0 +1,33 @@
+//go:build chaos && !minimal
+
+package main
+
+import (
+	"log"
+
+	"github.com/advayc/nums/store"
+)
+
+func init() {
+	settings = append(settings,
+		setting{env: "CHAOS_ERROR_RATE", usage: "share of durable store calls that fail, 0 to 1 (chaos builds)"},
+		setting{env: "CHAOS_LATENCY", usage: "delay added to durable store calls, e.g. 300ms (chaos builds)"},
+		setting{env: "CHAOS_LATENCY_RATE", usage: "share of calls that get CHAOS_LATENCY (default 1)"},
+		setting{env: "CHAOS_SEED", usage: "seed that makes the injected faults repeatable"},
+	)
+}
+
+// withChaos wraps the durable store in store.Chaos when CHAOS_ERROR_RATE or
+// CHAOS_LATENCY is set, below the failover and tiering layers so they see
+// the faults as a real backend outage would look.
+func withChaos(s store.Store) store.Store {
+	c, err := store.ChaosFromEnv(s)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if c == nil {
+		return s
+	}
+	log.Printf("(warn) chaos mode: injecting %s into the durable store", c)
+	return c
+}
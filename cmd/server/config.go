@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// setting is one environment variable the server reads, exposed as a flag
+// named after it in lower case with dashes (REDIS_URL is -redis-url).
+type setting struct {
+	env    string
+	usage  string
+	toggle bool // a switch: "-wal-fsync" alone means WAL_FSYNC=1
+}
+
+// commonSettings are read by every build; the full server adds its own in
+// options.go.
+var commonSettings = []setting{
+	{env: "PORT", usage: "port to listen on (default 8080)"},
+	{env: "SECRET_TOKEN", usage: "token required on every request (X-Auth-Token header or ?token=)"},
+	{env: "EXCLUDE_TOKEN", usage: "hits carrying this token (X-Nums-Exclude or ?exclude=) are not counted"},
+	{env: "IGNORE_DEV_TRAFFIC", usage: "do not count hits from localhost and other development hosts", toggle: true},
+	{env: "DEV_HOSTNAMES", usage: "comma-separated extra development hostnames"},
+	{env: "DATA_DIR", usage: "directory that relative file paths are resolved against"},
+	{env: "PERSIST_FILE", usage: "JSON file the in-memory counters are saved to"},
+	{env: "PERSIST_DEBOUNCE", usage: "how often PERSIST_FILE is rewritten at most (default 1s)"},
+	{env: "WAL_PATH", usage: "write-ahead log that keeps in-memory counters across crashes"},
+	{env: "WAL_FSYNC", usage: "fsync the write-ahead log after every write", toggle: true},
+	{env: "FROZEN_IDS", usage: "comma-separated counters that never change"},
+	{env: "ROUND_COUNTS", usage: "public rounding steps, e.g. home=100,*=10"},
+	{env: "DISPLAY_OFFSETS", usage: "public display offsets, e.g. home=15000"},
+	{env: "BADGE_MIN", usage: "minimum counts before badges show a number, e.g. home=100"},
+	{env: "MAX_HIT_BY", usage: "most hits one /hit?by=N may record (default 1000)"},
+	{env: "COMPAT", usage: "response keys of another hit counter: hitsdotsh or visitorbadge"},
+	{env: "ID_NORMALIZE", usage: "normalize incoming ids: nfc, or fold to also case-fold them"},
+	{env: "TRUST_PROXY", usage: "proxies in front of the server whose X-Forwarded-For is trusted for client IPs (default 0)"},
+}
+
+// envFlag sets its environment variable as soon as the flag is parsed, so
+// flags win over the environment and the config file.
+type envFlag setting
+
+func (f *envFlag) String() string   { return "" } // never print secrets as defaults
+func (f *envFlag) IsBoolFlag() bool { return f.toggle }
+
+func (f *envFlag) Set(v string) error {
+	if f.toggle {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		v = "0"
+		if b {
+			v = "1"
+		}
+	}
+	return os.Setenv(f.env, v)
+}
+
+func flagName(env string) string {
+	return strings.ReplaceAll(strings.ToLower(env), "_", "-")
+}
+
+// loadConfig applies command-line flags, then fills every variable still
+// unset from the config file (-config or CONFIG_FILE, default .env): flags
+// take precedence over the environment, and the environment over the file.
+func loadConfig(args []string, settings []setting) {
+	fset := flag.NewFlagSet("nums", flag.ExitOnError)
+	fset.Usage = func() {
+		fmt.Fprintf(fset.Output(), "Usage: nums [flags]\n       nums admin | init | healthcheck | version\n\nEvery flag sets the environment variable of the same name.\n\n")
+		fset.PrintDefaults()
+	}
+	configFile := fset.String("config", "", "KEY=VALUE file to read unset settings from (default .env if present; env CONFIG_FILE)")
+	for i := range settings {
+		fset.Var((*envFlag)(&settings[i]), flagName(settings[i].env), settings[i].usage)
+	}
+	_ = fset.Parse(args) // exits on error
+	if fset.NArg() > 0 {
+		fmt.Fprintf(fset.Output(), "unexpected argument %q\n", fset.Arg(0))
+		fset.Usage()
+		os.Exit(2)
+	}
+	path, explicit := *configFile, true
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path == "" {
+		path, explicit = ".env", false
+	}
+	n, err := loadEnvFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && !explicit:
+	case err != nil:
+		log.Fatalf("config: %v", err)
+	case n > 0:
+		log.Printf("read %d settings from %s", n, path)
+	}
+}
+
+// loadEnvFile sets the variables in a dotenv-style file (KEY=VALUE lines,
+// # comments, optional quotes and "export ") that are not already set. It
+// returns how many it set.
+func loadEnvFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	n := 0
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, val, ok := strings.Cut(strings.TrimPrefix(text, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return n, fmt.Errorf("%s:%d: want KEY=VALUE", path, line)
+		}
+		val = strings.TrimSpace(val)
+		if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+			val = val[1 : len(val)-1]
+		}
+		if _, set := os.LookupEnv(key); set || val == "" {
+			continue
+		}
+		if err := os.Setenv(key, val); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, sc.Err()
+}
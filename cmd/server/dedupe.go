@@ -0,0 +1,170 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+	"github.com/advayc/nums/web"
+)
+
+// seenKeys is a set of keys that each expire after window. With Redis each
+// one is a key "<kind>:<prefix><key>", shared by every instance; otherwise
+// they are kept in memory.
+type seenKeys struct {
+	kind   string
+	window time.Duration
+	redis  *store.RedisCounter // nil when Redis is not configured
+
+	mu   sync.Mutex
+	seen map[string]time.Time // key -> expiry
+}
+
+func newSeenKeys(kind string, window time.Duration, rc *store.RedisCounter) *seenKeys {
+	return &seenKeys{kind: kind, window: window, redis: rc, seen: make(map[string]time.Time)}
+}
+
+// add marks key seen, reporting whether it was not already.
+func (s *seenKeys) add(ctx context.Context, key string) (bool, error) {
+	return s.addFor(ctx, key, s.window)
+}
+
+// addFor is add with a window of its own.
+func (s *seenKeys) addFor(ctx context.Context, key string, window time.Duration) (bool, error) {
+	if s.redis != nil {
+		return s.redis.Client().SetNX(ctx, s.kind+":"+s.redis.Prefix()+key, 1, window).Result()
+	}
+	now := core.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if exp, ok := s.seen[key]; ok && now.Before(exp) {
+		return false, nil
+	}
+	s.seen[key] = now.Add(window)
+	return true, nil
+}
+
+// remove forgets key, so it counts as new again.
+func (s *seenKeys) remove(ctx context.Context, key string) error {
+	if s.redis != nil {
+		return s.redis.Client().Del(ctx, s.kind+":"+s.redis.Prefix()+key).Err()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.seen, key)
+	return nil
+}
+
+// janitor drops expired keys from memory (runs for the process lifetime).
+func (s *seenKeys) janitor(every time.Duration) {
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for now := range tick.C {
+		s.mu.Lock()
+		for key, exp := range s.seen {
+			if now.After(exp) {
+				delete(s.seen, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// dedupeWindow remembers which visitors (per web.Dedupe identity) were
+// already counted for a counter within the window, as "seen" keys.
+type dedupeWindow struct {
+	*web.Dedupe
+	keys *seenKeys
+}
+
+func newDedupeWindow(rc *store.RedisCounter) (*dedupeWindow, error) {
+	cfg, err := web.DedupeFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	d := &dedupeWindow{Dedupe: cfg, keys: newSeenKeys("seen", cfg.Window, rc)}
+	if rc == nil && cfg.Enabled() {
+		go d.keys.janitor(time.Minute)
+	}
+	web.UseDailySalt((&dailySalts{redis: rc}).get)
+	return d, nil
+}
+
+// dailySalts hands out the anon identity's salts: shared by every instance
+// with Redis (store.RedisCounter.DailySalt), otherwise made by this process
+// and lost on restart. Only today's is kept.
+type dailySalts struct {
+	redis *store.RedisCounter
+
+	mu   sync.Mutex
+	day  string
+	salt string
+}
+
+func (s *dailySalts) get(ctx context.Context, day string) (string, error) {
+	if s.redis != nil {
+		return s.redis.DailySalt(ctx, day)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.day != day {
+		salt, err := store.NewSalt()
+		if err != nil {
+			return "", err
+		}
+		s.day, s.salt = day, salt
+	}
+	return s.salt, nil
+}
+
+// first reports whether this is the visitor's first hit on id within the
+// window, marking it seen. Requests without an identity are always first.
+func (d *dedupeWindow) first(ctx context.Context, w http.ResponseWriter, r *http.Request, id string) (bool, error) {
+	if dd, ok := d.For(id).(web.Deduper); ok { // e.g. the signed cookie
+		return dd.First(w, r, id, d.WindowFor(id)), nil
+	}
+	visitor := d.For(id).Visitor(w, r)
+	if visitor == "" {
+		return true, nil
+	}
+	return d.keys.addFor(ctx, web.SeenKey(id, visitor), d.WindowFor(id))
+}
+
+// idempotencyKeys remembers the Idempotency-Key of each /hit delivery for
+// IDEMPOTENCY_WINDOW, as "idem" keys, so a retried delivery counts once.
+type idempotencyKeys struct{ keys *seenKeys }
+
+func newIdempotencyKeys(rc *store.RedisCounter) (*idempotencyKeys, error) {
+	window, err := web.IdempotencyWindowFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	k := &idempotencyKeys{keys: newSeenKeys("idem", window, rc)}
+	if rc == nil {
+		go k.keys.janitor(time.Minute)
+	}
+	return k, nil
+}
+
+// first reports whether key is the first delivery of a hit on id within the
+// window, claiming it. An empty key is always first.
+func (k *idempotencyKeys) first(ctx context.Context, id, key string) (bool, error) {
+	if key == "" {
+		return true, nil
+	}
+	return k.keys.add(ctx, web.SeenKey(id, key))
+}
+
+// release gives up the claim of first, for a hit that was not recorded, so
+// a retry is counted.
+func (k *idempotencyKeys) release(ctx context.Context, id, key string) error {
+	if key == "" {
+		return nil
+	}
+	return k.keys.remove(ctx, web.SeenKey(id, key))
+}
@@ -0,0 +1,154 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/store"
+	"github.com/advayc/nums/web"
+)
+
+// frozenSet holds the counters that no longer accept writes, e.g. the badge
+// of an archived project that should show its final number forever. Ids come
+// from FROZEN_IDS and /admin/freeze. With Redis the admin-frozen ids are the
+// set "frozen:<prefix>"; otherwise they are the keys of the "frozen" settings
+// table (see openSettings). Either is reloaded every frozenReload so freezes
+// made on other instances apply; without both they live in memory until
+// restart.
+type frozenSet struct {
+	redis    *store.RedisCounter // nil when Redis is not configured
+	settings store.Settings      // used without Redis; nil for memory only
+	fixed    map[string]bool     // FROZEN_IDS; can't be unfrozen at runtime
+
+	mu  sync.RWMutex
+	ids map[string]bool
+}
+
+const frozenReload = 30 * time.Second
+
+// errFrozenByEnv is returned when unfreezing an id listed in FROZEN_IDS.
+var errFrozenByEnv = errors.New("is frozen by FROZEN_IDS; remove it there")
+
+func newFrozenSet(rc *store.RedisCounter, settings store.Settings) *frozenSet {
+	f := &frozenSet{redis: rc, settings: settings, fixed: web.FrozenIDsFromEnv(), ids: make(map[string]bool)}
+	if rc != nil || settings != nil {
+		if err := f.reload(context.Background()); err != nil {
+			log.Printf("(warn) load frozen counters: %v", err)
+		}
+		go f.run(frozenReload)
+	}
+	return f
+}
+
+func (f *frozenSet) redisKey() string { return "frozen:" + f.redis.Prefix() }
+
+func frozenID(id string) string {
+	if id == "" {
+		return "default"
+	}
+	return id
+}
+
+// has reports whether id is frozen.
+func (f *frozenSet) has(id string) bool {
+	id = frozenID(id)
+	if f.fixed[id] {
+		return true
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.ids[id]
+}
+
+// set freezes (on) or unfreezes id.
+func (f *frozenSet) set(ctx context.Context, id string, on bool) error {
+	id = frozenID(id)
+	if !on && f.fixed[id] {
+		return fmt.Errorf("%s %w", id, errFrozenByEnv)
+	}
+	var err error
+	switch {
+	case f.redis != nil && on:
+		err = f.redis.Client().SAdd(ctx, f.redisKey(), id).Err()
+	case f.redis != nil:
+		err = f.redis.Client().SRem(ctx, f.redisKey(), id).Err()
+	case f.settings != nil && on:
+		err = f.settings.PutSetting(ctx, "frozen", id, "1")
+	case f.settings != nil:
+		err = f.settings.DeleteSetting(ctx, "frozen", id)
+	}
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if on {
+		f.ids[id] = true
+	} else {
+		delete(f.ids, id)
+	}
+	return nil
+}
+
+// list returns every frozen id, sorted.
+func (f *frozenSet) list() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	out := make([]string, 0, len(f.fixed)+len(f.ids))
+	for id := range f.fixed {
+		out = append(out, id)
+	}
+	for id := range f.ids {
+		if !f.fixed[id] {
+			out = append(out, id)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// reload replaces the admin-frozen ids with the stored ones.
+func (f *frozenSet) reload(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	ids := make(map[string]bool)
+	if f.redis != nil {
+		members, err := f.redis.Client().SMembers(ctx, f.redisKey()).Result()
+		if err != nil {
+			return err
+		}
+		for _, id := range members {
+			ids[id] = true
+		}
+	} else {
+		stored, err := f.settings.LoadSettings(ctx, "frozen")
+		if err != nil {
+			return err
+		}
+		for id := range stored {
+			ids[id] = true
+		}
+	}
+	f.mu.Lock()
+	f.ids = ids
+	f.mu.Unlock()
+	return nil
+}
+
+// run reloads the set every interval so freezes made on other instances apply.
+func (f *frozenSet) run(every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for range t.C {
+		if err := f.reload(context.Background()); err != nil {
+			log.Printf("(warn) reload frozen counters: %v", err)
+		}
+	}
+}
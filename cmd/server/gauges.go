@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/advayc/nums/store"
+)
+
+// gaugeTypes fixes each gauge's type (int or float) at its first write, in
+// the settings table store.GaugeTable so it holds on every instance and
+// across restarts (see openSettings); without a settings store it lives in
+// memory until restart.
+type gaugeTypes struct {
+	settings store.Settings // nil keeps types in memory only
+
+	mu sync.Mutex
+	m  map[string]string
+}
+
+func newGaugeTypes(settings store.Settings) *gaugeTypes {
+	return &gaugeTypes{settings: settings, m: make(map[string]string)}
+}
+
+// claim records kind as id's type if it has none, and returns a
+// *store.GaugeTypeError if it has another.
+func (g *gaugeTypes) claim(ctx context.Context, id, kind string) error {
+	if id == "" {
+		id = "default"
+	}
+	if g.settings != nil {
+		return store.ClaimGauge(ctx, g.settings, id, kind)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	cur, ok := g.m[id]
+	if !ok {
+		g.m[id], cur = kind, kind
+	}
+	if cur != kind {
+		return &store.GaugeTypeError{ID: id, Type: cur, Got: kind}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// version is set at build time (-ldflags "-X main.version=v1.2.3").
+var version = "dev"
+
+// runSubcommand handles "nums admin", "nums healthcheck", "nums init",
+// "nums migrate-keys" and "nums version" and exits; any other arguments are left to the flags. Container images
+// built FROM scratch have no curl or wget, so their HEALTHCHECK runs the
+// server binary itself.
+func runSubcommand(args []string) {
+	if len(args) == 0 {
+		return
+	}
+	switch args[0] {
+	case "healthcheck":
+		if err := healthcheck(); err != nil {
+			fmt.Fprintf(os.Stderr, "unhealthy: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	case "admin":
+		runAdmin(args[1:])
+		os.Exit(0)
+	case "init":
+		runInit(args[1:])
+		os.Exit(0)
+	case "migrate-keys":
+		runMigrateKeys(args[1:])
+		os.Exit(0)
+	case "version":
+		fmt.Println(version)
+		os.Exit(0)
+	}
+}
+
+// healthcheck asks the server on PORT (HEALTHCHECK_URL overrides the URL)
+// for /healthz.
+func healthcheck() error {
+	url := getenv("HEALTHCHECK_URL", "http://127.0.0.1:"+getenv("PORT", "8080")+"/healthz")
+	client := &http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// Playground counters (see core.IsTestID) expire testCounterTTL after
+// creation and must be skipped by anything that lists or exports counters.
+const testCounterTTL = core.TestCounterTTL
+
+func isTestID(id string) bool { return core.IsTestID(id) }
+
+// JSON response helpers
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// getenv returns env var or fallback
+func getenv(k, def string) string {
+	if v, ok := os.LookupEnv(k); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// dataPath reads a file path from env var k (def when unset). Relative paths
+// are resolved against DATA_DIR when it is set, so one volume mount holds
+// every file the server writes.
+func dataPath(k, def string) string {
+	p := getenv(k, def)
+	if dir := os.Getenv("DATA_DIR"); p != "" && dir != "" && !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+	return p
+}
+
+// parseDurationEnv reads a Go duration (e.g. "5s") from env var k.
+func parseDurationEnv(k string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(k)
+	if v == "" {
+		return def, nil
+	}
+	return time.ParseDuration(v)
+}
+
+// maxLongPoll caps /count?wait= (see web.ParseLongPoll).
+const maxLongPoll = time.Minute
+
+// contextUntil is ctx, also canceled once done is closed.
+func contextUntil(ctx context.Context, done <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// isDryRun reports whether a mutating request asked to validate only (?dryRun=1|true)
+func isDryRun(r *http.Request) bool {
+	v, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	return v
+}
+
+// authorize checks secret token if configured. If secretToken is empty, always true.
+func authorize(secretToken string, r *http.Request) bool {
+	if secretToken == "" {
+		return true
+	}
+	// Header first
+	if h := r.Header.Get("X-Auth-Token"); h != "" && h == secretToken {
+		return true
+	}
+	// Query param fallback (?token=...)
+	if q := r.URL.Query().Get("token"); q != "" && q == secretToken {
+		return true
+	}
+	return false
+}
+
+// requestLogger logs minimal info about each request
+func requestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		lrw := &loggingResponseWriter{ResponseWriter: w, status: 200}
+		next.ServeHTTP(lrw, r)
+		dur := time.Since(start)
+		log.Printf("%s %s %d %s", r.Method, r.URL.Path, lrw.status, dur)
+	})
+}
+
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (l *loggingResponseWriter) WriteHeader(code int) {
+	l.status = code
+	l.ResponseWriter.WriteHeader(code)
+}
+
+// renderBadge builds the badge SVG for value (see formatBadgeValue) from the
+// label/color query params.
+func renderBadge(r *http.Request, value string) string {
+	label, color := badgeLabelColor(r)
+	style := r.URL.Query().Get("style") // reserved for future (e.g., flat, flat-square)
+	_ = style
+	return core.BadgeSVG(label, value, color, core.BadgeFont)
+}
+
+// renderProgressBadge builds the style=progress badge: value (e.g. "78%")
+// over a bar filled to fraction with color, on a trackColor track, next to a
+// label on labelColor.
+func renderProgressBadge(r *http.Request, value string, fraction float64) string {
+	label, color := badgeLabelColor(r)
+	labelColor := core.NormalizeColor(r.URL.Query().Get("labelColor"), core.ProgressLabelColor)
+	trackColor := core.NormalizeColor(r.URL.Query().Get("trackColor"), core.ProgressTrackColor)
+	return core.ProgressBadgeSVG(label, value, core.BadgeFont, fraction, labelColor, color, trackColor)
+}
+
+// badgeLabelColor returns the label and color params, defaulting to "hits"
+// and blue.
+func badgeLabelColor(r *http.Request) (label, color string) {
+	label = r.URL.Query().Get("label")
+	if label == "" {
+		label = "hits"
+	}
+	color = r.URL.Query().Get("color")
+	if color == "" {
+		color = "blue"
+	}
+	return label, color
+}
+
+// badgeTarget reads the goal of target badges (target=10000): 0, meaning a
+// plain badge, when unset or invalid.
+func badgeTarget(r *http.Request) uint64 {
+	target, _ := strconv.ParseUint(r.URL.Query().Get("target"), 10, 64)
+	return target
+}
+
+// formatBadgeValue applies the badge format controls: precision=N rounds
+// float counters to N decimals, suffix is appended (e.g. suffix=%20MB), and
+// counts below min show as "<min".
+func formatBadgeValue(r *http.Request, v core.Value, min uint64) string {
+	precision := -1
+	if p, err := strconv.Atoi(r.URL.Query().Get("precision")); err == nil && p >= 0 && p <= 6 {
+		precision = p
+	}
+	return v.FormatMin(precision, r.URL.Query().Get("suffix"), min)
+}
+
+// badgeMin returns the threshold below which id's badge shows "<N": the min
+// query param when given (min=0 turns it off), otherwise BADGE_MIN.
+func badgeMin(r *http.Request, mins map[string]uint64, id string) uint64 {
+	if m, err := strconv.ParseUint(r.URL.Query().Get("min"), 10, 64); err == nil {
+		return m
+	}
+	if m, ok := mins[id]; ok {
+		return m
+	}
+	return mins[core.RoundingDefault]
+}
@@ -0,0 +1,151 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+	"github.com/advayc/nums/web"
+)
+
+// historyFlush is how often snapshots are written to Redis, which bounds
+// what a crash loses and how late other instances see them.
+const historyFlush = time.Minute
+
+// historyLog snapshots counter values for /history: the last value each
+// counter had in every HISTORY_INTERVAL, kept for HISTORY_RETENTION. With
+// Redis the snapshots are shared, each slot keeping the largest value any
+// instance wrote (see store.RedisCounter.RecordHistory), and written every
+// historyFlush; otherwise they live in memory until restart.
+type historyLog struct {
+	redis     *store.RedisCounter // nil when Redis is not configured
+	interval  time.Duration       // 0 when history is off
+	retention time.Duration
+
+	mu      sync.Mutex
+	pending map[historySlot]core.Value     // not yet written to Redis
+	m       map[string][]core.HistoryPoint // without Redis, oldest first
+}
+
+type historySlot struct {
+	id   string
+	slot time.Time
+}
+
+func newHistoryLog(rc *store.RedisCounter) (*historyLog, error) {
+	interval, retention, err := web.HistoryFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	h := &historyLog{
+		redis:     rc,
+		interval:  interval,
+		retention: retention,
+		pending:   make(map[historySlot]core.Value),
+		m:         make(map[string][]core.HistoryPoint),
+	}
+	if rc != nil && interval > 0 {
+		go h.run(historyFlush)
+	}
+	return h, nil
+}
+
+// record notes id's value after a write. Playground counters are skipped.
+func (h *historyLog) record(id string, v core.Value) {
+	if h.interval == 0 || isTestID(id) {
+		return
+	}
+	if id == "" {
+		id = "default"
+	}
+	slot := core.HistorySlot(core.Now(), h.interval)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.redis != nil {
+		h.pending[historySlot{id, slot}] = v
+		return
+	}
+	points := h.m[id]
+	if n := len(points); n > 0 && points[n-1].At.Equal(slot) {
+		points[n-1].Hits = v
+		return
+	}
+	oldest := slot.Add(-h.retention)
+	for len(points) > 0 && points[0].At.Before(oldest) {
+		points = points[1:]
+	}
+	h.m[id] = append(points, core.HistoryPoint{At: slot, Hits: v})
+}
+
+// list returns id's points from..to, oldest first, including the ones this
+// instance has not written yet.
+func (h *historyLog) list(ctx context.Context, id string, from, to time.Time) ([]core.HistoryPoint, error) {
+	if id == "" {
+		id = "default"
+	}
+	if h.redis == nil {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return core.HistoryRange(h.m[id], from, to), nil
+	}
+	points, err := h.redis.History(ctx, id, from, to)
+	if err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	for k, v := range h.pending {
+		if k.id != id {
+			continue
+		}
+		i := sort.Search(len(points), func(i int) bool { return !points[i].At.Before(k.slot) })
+		if i < len(points) && points[i].At.Equal(k.slot) {
+			points[i].Hits = v
+		} else {
+			points = append(points[:i], append([]core.HistoryPoint{{At: k.slot, Hits: v}}, points[i:]...)...)
+		}
+	}
+	h.mu.Unlock()
+	return core.HistoryRange(points, from, to), nil
+}
+
+// flush writes the pending snapshots to Redis. Ones that fail are kept for
+// the next flush unless a newer value replaced them.
+func (h *historyLog) flush() {
+	h.mu.Lock()
+	pending := h.pending
+	h.pending = make(map[historySlot]core.Value)
+	h.mu.Unlock()
+	var failed int
+	var lastErr error
+	for k, v := range pending {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err := h.redis.RecordHistory(ctx, k.id, k.slot, v, h.retention)
+		cancel()
+		if err == nil {
+			continue
+		}
+		failed, lastErr = failed+1, err
+		h.mu.Lock()
+		if _, ok := h.pending[k]; !ok {
+			h.pending[k] = v
+		}
+		h.mu.Unlock()
+	}
+	if failed > 0 {
+		log.Printf("(warn) history: %d snapshots not written, retrying: %v", failed, lastErr)
+	}
+}
+
+func (h *historyLog) run(every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for range t.C {
+		h.flush()
+	}
+}
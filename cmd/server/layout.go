@@ -0,0 +1,79 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+	"github.com/advayc/nums/web"
+)
+
+// upgradeLayout moves rc's keys from the v1 layout prefix from to rc's
+// (REDIS_KEY_LAYOUT=v2). The keys shared by all counters (admin settings,
+// frozen ids) move first, before they are loaded; counters then move as they
+// are used while the rest are migrated in the background.
+func upgradeLayout(rc *store.RedisCounter, from string) {
+	ctx := context.Background()
+	if err := rc.UpgradeFrom(ctx, from); err != nil {
+		log.Fatalf("REDIS_KEY_LAYOUT: %v", err)
+	}
+	if rc.Upgraded() {
+		return
+	}
+	if err := rc.MoveSharedKeys(ctx, from); err != nil {
+		log.Fatalf("REDIS_KEY_LAYOUT: %v", err)
+	}
+	go func() {
+		m, err := rc.MigrateLayout(ctx, from)
+		if err != nil {
+			log.Printf("(error) key layout migration from %s stopped, it restarts with the server: %v", from, err)
+			return
+		}
+		log.Printf("key layout migration from %s to %s done: %d keys moved, %d counters added up, %d conflicts left in place", m.From, m.To, m.Moved, m.Merged, m.Conflicts)
+	}()
+}
+
+// runMigrateKeys is "nums migrate-keys": it moves the keys of REDIS_URL to
+// the v2 layout and prints what it did, for deployments with no standalone
+// server to do it, such as the serverless handler's.
+func runMigrateKeys(args []string) {
+	if _, err := loadEnvFile(".env"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "config: %v\n", err)
+	}
+	fset := flag.NewFlagSet("nums migrate-keys", flag.ExitOnError)
+	fset.Usage = func() {
+		fmt.Fprintln(fset.Output(), "usage: nums migrate-keys\n\nMoves the Redis keys of REDIS_URL, REDIS_PREFIX and ENVIRONMENT to the v2 key layout (REDIS_KEY_LAYOUT=v2).")
+	}
+	_ = fset.Parse(args)
+	environment, err := web.EnvironmentFromEnv()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	cfg, err := store.RedisConfigFromEnv(os.Getenv("REDIS_URL"))
+	if err != nil {
+		log.Fatalf("redis config: %v", err)
+	}
+	if !cfg.Configured() {
+		log.Fatalf("REDIS_URL is not set")
+	}
+	from := core.EnvKeyPrefix(environment) + getenv("REDIS_PREFIX", "hits:")
+	rc, err := store.NewRedisCounterFromConfig(cfg, store.LayoutPrefix(store.LayoutV2, from))
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	m, err := rc.MigrateLayout(context.Background(), from)
+	if err != nil {
+		log.Fatalf("migrate-keys: %v", err)
+	}
+	out, _ := json.MarshalIndent(m, "", "  ")
+	fmt.Println(string(out))
+}
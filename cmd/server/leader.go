@@ -0,0 +1,143 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/store"
+)
+
+// leaderElection picks the one instance that runs the background jobs meant
+// to happen once per deployment: scheduled resets, the purge of deleted
+// counters and the archive sweep. With Redis the instances take turns
+// holding a lease of LEADER_TTL (see store.RedisCounter.ClaimLeader), renewed
+// every third of it. Without Redis each instance keeps its own data, so it
+// leads itself.
+type leaderElection struct {
+	redis    *store.RedisCounter // nil when Redis is not configured
+	instance string
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	holder  string    // the leader at the last claim, "" if unknown
+	renewed time.Time // when this instance last held the lease
+	since   time.Time // when it last became the leader
+	err     error     // of the last claim
+}
+
+func newLeaderElection(rc *store.RedisCounter) (*leaderElection, error) {
+	ttl, err := parseDurationEnv("LEADER_TTL", 15*time.Second)
+	if err != nil || ttl < 3*time.Second {
+		return nil, fmt.Errorf("LEADER_TTL: %q should be a duration of at least 3s", os.Getenv("LEADER_TTL"))
+	}
+	instance := strings.TrimSpace(os.Getenv("INSTANCE_ID"))
+	if instance == "" {
+		host, _ := os.Hostname()
+		b := make([]byte, 4)
+		_, _ = rand.Read(b)
+		instance = host + "-" + hex.EncodeToString(b)
+	}
+	l := &leaderElection{redis: rc, instance: instance, ttl: ttl}
+	if rc == nil {
+		l.holder, l.since = instance, time.Now().UTC()
+		return l, nil
+	}
+	l.claim()
+	go l.run()
+	return l, nil
+}
+
+// leading reports whether this instance should run the jobs now. A leader
+// that can't reach Redis steps down when its lease would have expired, since
+// another instance may have taken over by then.
+func (l *leaderElection) leading() bool {
+	if l.redis == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.leadingLocked()
+}
+
+func (l *leaderElection) leadingLocked() bool {
+	return !l.renewed.IsZero() && time.Since(l.renewed) < l.ttl
+}
+
+// claim takes or renews the lease and logs when the lead changes hands.
+func (l *leaderElection) claim() {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+	holder, err := l.redis.ClaimLeader(ctx, l.instance, l.ttl)
+	cancel()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	was := l.leadingLocked()
+	if l.err = err; err != nil {
+		if l.holder == l.instance && !was {
+			log.Printf("(warn) leader election: stepped down, Redis is unreachable: %v", err)
+			l.holder = ""
+		}
+		return
+	}
+	l.holder = holder
+	switch {
+	case holder == l.instance:
+		l.renewed = start
+		if !was {
+			l.since = start.UTC()
+			log.Printf("leader election: %s now runs the background jobs", l.instance)
+		}
+	case was:
+		l.renewed = time.Time{}
+		log.Printf("(warn) leader election: %s took over the background jobs", holder)
+	}
+}
+
+func (l *leaderElection) run() {
+	t := time.NewTicker(l.ttl / 3)
+	defer t.Stop()
+	for range t.C {
+		l.claim()
+	}
+}
+
+// resign hands the lead over at shutdown.
+func (l *leaderElection) resign() {
+	if l.redis == nil || !l.leading() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := l.redis.ResignLeader(ctx, l.instance); err != nil {
+		log.Printf("(warn) leader election: resign: %v", err)
+	}
+}
+
+// status describes the election for /healthz?verbose=1.
+func (l *leaderElection) status() map[string]any {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	leading := l.redis == nil || l.leadingLocked()
+	out := map[string]any{
+		"instance": l.instance,
+		"leader":   leading,
+		"holder":   l.holder,
+		"shared":   l.redis != nil,
+	}
+	if leading {
+		out["since"] = l.since
+	}
+	if l.err != nil {
+		out["error"] = l.err.Error()
+	}
+	return out
+}
@@ -1,22 +1,30 @@
+//go:build !minimal
+
 package main
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
 
-	redis "github.com/redis/go-redis/v9"
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/snippets"
+	"github.com/advayc/nums/store"
+	"github.com/advayc/nums/web"
 	"github.com/rs/cors"
 )
 
@@ -25,268 +33,2354 @@ import (
 // SingleCounter retained for backwards compatibility (default id)
 type HitCounter struct{ count uint64 }
 
-func (h *HitCounter) Inc() uint64 { return atomic.AddUint64(&h.count, 1) }
-func (h *HitCounter) Get() uint64 { return atomic.LoadUint64(&h.count) }
+func (h *HitCounter) Inc() uint64         { return atomic.AddUint64(&h.count, 1) }
+func (h *HitCounter) Add(n uint64) uint64 { return atomic.AddUint64(&h.count, n) }
+func (h *HitCounter) Get() uint64         { return atomic.LoadUint64(&h.count) }
 
-// MultiCounter manages counts per id (e.g., per link)
-type MultiCounter struct {
-	mu sync.RWMutex
-	m  map[string]*uint64
-}
+func main() {
+	runSubcommand(os.Args[1:])
+	loadConfig(os.Args[1:], settings)
+	port := getenv("PORT", "8080")
+	secretToken := os.Getenv("SECRET_TOKEN")    // if set, required via header X-Auth-Token or query param token
+	excludeToken := os.Getenv("EXCLUDE_TOKEN")  // if set, hits carrying it (X-Nums-Exclude or ?exclude=) are not counted
+	devHosts := web.DevHostsFromEnv()           // if set (IGNORE_DEV_TRAFFIC / DEV_HOSTNAMES), hits from these Origins/Referers are not counted
+	persistFile := dataPath("PERSIST_FILE", "") // if set, every in-memory counter is snapshotted to this file as JSON (when not using a durable store)
+	allowedOriginsEnv := os.Getenv("ALLOWED_ORIGINS")
+	redisURL := os.Getenv("REDIS_URL") // optional; if set enables persistent counts in Redis for all ids
+	redisPrefix := getenv("REDIS_PREFIX", "hits:")
+	environment, err := web.EnvironmentFromEnv() // ENVIRONMENT: non-production names get their own keyspace
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	envPrefix := core.EnvKeyPrefix(environment)
+	redisPrefix = envPrefix + redisPrefix
+
+	// Upstash convenience: if REDIS_URL not provided, try constructing from UPSTASH env vars.
+	if redisURL == "" {
+		upstashBase := os.Getenv("UPSTASH_REDIS_URL")      // e.g. global-fancy-123.upstash.io:12345 or rediss://... or redis://...
+		upstashPass := os.Getenv("UPSTASH_REDIS_PASSWORD") // password only
+		if upstashBase != "" && upstashPass != "" {
+			redisURL = buildUpstashRedisURL(upstashBase, upstashPass)
+			log.Printf("constructed redis URL from UPSTASH_REDIS_URL/PASSWORD (host=%s)", upstashBase)
+		}
+	}
+
+	failFastRedis := os.Getenv("FAIL_FAST_REDIS") == "1"
+
+	var signingKey ed25519.PrivateKey // VERIFY_SIGNING_KEY: base64 Ed25519 seed, enables /verify
+	if k := os.Getenv("VERIFY_SIGNING_KEY"); k != "" {
+		key, err := core.ParseSigningKey(k)
+		if err != nil {
+			log.Fatalf("invalid VERIFY_SIGNING_KEY: %v", err)
+		}
+		signingKey = key
+		log.Printf("signed /verify enabled (key_id=%s)", core.KeyID(key.Public().(ed25519.PublicKey)))
+	}
 
-func NewMultiCounter() *MultiCounter { return &MultiCounter{m: make(map[string]*uint64)} }
+	// TIME_TRAVEL=1 lets /admin/clock move the clock behind TTLs, dedupe and
+	// rate-limit windows, daily webhooks and milestone dates, for testing
+	var travel *core.TravelClock
+	if on, _ := strconv.ParseBool(os.Getenv("TIME_TRAVEL")); on {
+		travel = &core.TravelClock{}
+		core.SetClock(travel)
+		log.Printf("(warn) TIME_TRAVEL enabled: /admin/clock can move the server clock")
+	}
+
+	singleCounter := &HitCounter{}
+	multi := store.NewMultiCounter()
+	var redisCounter *store.RedisCounter
+	var durable store.Store // Redis, SQLite, bbolt or Postgres; nil keeps counts in memory only
 
-func (mc *MultiCounter) Inc(id string) uint64 {
-	if id == "" {
-		id = "default"
+	// REDIS_URL, or Sentinel / Cluster settings (see store.RedisConfig)
+	redisConfig, err := store.RedisConfigFromEnv(redisURL)
+	if err != nil {
+		log.Fatalf("redis config: %v", err)
 	}
-	mc.mu.RLock()
-	ptr, ok := mc.m[id]
-	mc.mu.RUnlock()
-	if !ok {
-		mc.mu.Lock()
-		if ptr, ok = mc.m[id]; !ok {
-			var v uint64
-			ptr = &v
-			mc.m[id] = ptr
+	redisLayout, err := store.RedisLayoutFromEnv() // REDIS_KEY_LAYOUT: v2 versions every key
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if redisConfig.Configured() {
+		rc, err := store.NewRedisCounterFromConfig(redisConfig, store.LayoutPrefix(redisLayout, redisPrefix))
+		if err != nil {
+			if failFastRedis {
+				log.Fatalf("redis init failed (FAIL_FAST_REDIS=1): %v", err)
+			}
+			log.Printf("(warn) redis disabled (init failed): %v", err)
+		} else {
+			redisCounter = rc
+			durable = rc
+			log.Printf("redis persistence enabled (prefix=%s, %s)", rc.Prefix(), redisConfig)
+			if redisLayout != store.LayoutV1 {
+				upgradeLayout(rc, redisPrefix)
+			}
 		}
-		mc.mu.Unlock()
 	}
-	return atomic.AddUint64(ptr, 1)
-}
+	if storage := os.Getenv("STORAGE"); durable == nil && storage != "" {
+		durable = openStorage("STORAGE="+storage, storage)
+	}
+	if databaseURL := os.Getenv("DATABASE_URL"); durable == nil && databaseURL != "" {
+		durable = openStorage("DATABASE_URL", "postgres")
+	}
+	adminSettings := openSettings(redisCounter, durable, envPrefix) // where admin changes to runtime settings are kept
+	// LEADER_TTL: which instance runs the once-per-deployment jobs
+	leader, err := newLeaderElection(redisCounter)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
 
-func (mc *MultiCounter) Get(id string) uint64 {
-	if id == "" {
-		id = "default"
+	// SECONDARY_STORAGE (a STORAGE value) dual-writes every change to a second
+	// backend that serves reads while the primary is down; REPLICA_RECONCILE_INTERVAL
+	// (default 5m) replays missed writes and heals divergence.
+	var secondary store.Store
+	if name := os.Getenv("SECONDARY_STORAGE"); name != "" {
+		if durable == nil {
+			log.Printf("(warn) SECONDARY_STORAGE ignored: there is no primary durable store")
+		} else if name == os.Getenv("STORAGE") {
+			log.Fatalf("SECONDARY_STORAGE must differ from STORAGE")
+		} else {
+			secondary = openStorage("SECONDARY_STORAGE="+name, name)
+			if envPrefix != "" {
+				secondary = store.NewNamespaced(secondary, envPrefix)
+			}
+		}
 	}
-	mc.mu.RLock()
-	ptr := mc.m[id]
-	mc.mu.RUnlock()
-	if ptr == nil {
-		return 0
+	if durable != nil && redisCounter == nil && envPrefix != "" {
+		durable = store.NewNamespaced(durable, envPrefix) // Redis has the prefix in REDIS_PREFIX already
+	}
+	if durable != nil {
+		durable = withChaos(durable) // CHAOS_* in -tags chaos builds, for failure testing
+	}
+	if environment != core.Production {
+		log.Printf("environment %s (keys prefixed %q)", environment, envPrefix)
 	}
-	return atomic.LoadUint64(ptr)
-}
 
-// RedisCounter provides persistent counts using Redis (if configured)
-type RedisCounter struct {
-	client *redis.Client
-	prefix string
-}
+	// counters is memory only, or memory tiered over the durable store: TIER_MODE
+	// (write-through, the default, or write-behind), TIER_CACHE_TTL (serve
+	// reads from memory for this long; 0 always reads Redis) and
+	// TIER_FLUSH_INTERVAL (write-behind flush period).
+	var counters store.Store = multi
+	var tiered *store.Tiered
+	var failover *store.Failover
+	var wal *store.WAL
+	// WAL_PATH: without a durable store, log every change so per-id counts
+	// survive restarts and crashes (WAL_FSYNC=1 also survives power loss)
+	if walPath := dataPath("WAL_PATH", ""); walPath != "" {
+		if durable != nil {
+			log.Printf("(warn) WAL_PATH ignored: counts are already kept in the durable store")
+		} else {
+			wal = openWAL(multi, walPath)
+			counters = wal
+		}
+	}
+	// expired counters (playground ids, /hit?ttl=) are dropped every minute;
+	// the WAL's janitor also logs them so a replay does not bring them back
+	if wal != nil {
+		go wal.Janitor(time.Minute)
+	} else {
+		go multi.Janitor(time.Minute)
+	}
+	if durable != nil {
+		mode, err := store.ParseTierMode(os.Getenv("TIER_MODE"))
+		if err != nil {
+			log.Fatalf("TIER_MODE: %v", err)
+		}
+		cacheTTL, err := parseDurationEnv("TIER_CACHE_TTL", 0)
+		if err != nil {
+			log.Fatalf("TIER_CACHE_TTL: %v", err)
+		}
+		flushEvery, err := parseDurationEnv("TIER_FLUSH_INTERVAL", time.Second)
+		if err != nil {
+			log.Fatalf("TIER_FLUSH_INTERVAL: %v", err)
+		}
+		remote := durable
+		if archiveURL := os.Getenv("ARCHIVE_URL"); archiveURL != "" && redisCounter != nil {
+			if environment != core.Production { // archives are keyed by id; keep environments apart
+				archiveURL = strings.TrimRight(archiveURL, "/") + "/" + environment
+			}
+			remote = newArchive(redisCounter, archiveURL, leader)
+		}
+		if secondary != nil {
+			every, err := parseDurationEnv("REPLICA_RECONCILE_INTERVAL", 5*time.Minute)
+			if err != nil {
+				log.Fatalf("REPLICA_RECONCILE_INTERVAL: %v", err)
+			}
+			rep, err := store.NewReplicated(remote, secondary)
+			if err != nil {
+				log.Fatalf("SECONDARY_STORAGE: %v", err)
+			}
+			go rep.Reconciler(every)
+			remote = rep
+			log.Printf("dual-writing to SECONDARY_STORAGE=%s (reconcile every %s)", os.Getenv("SECONDARY_STORAGE"), every)
+		} else {
+			// circuit breaker: after FAILOVER_THRESHOLD consecutive failures
+			// stop calling the backend for FAILOVER_COOLDOWN, count locally
+			// and replay those hits once it answers again (Replicated above
+			// already replays what the primary missed)
+			threshold, err := strconv.Atoi(getenv("FAILOVER_THRESHOLD", "3"))
+			if err != nil {
+				log.Fatalf("FAILOVER_THRESHOLD: %v", err)
+			}
+			cooldown, err := parseDurationEnv("FAILOVER_COOLDOWN", 5*time.Second)
+			if err != nil {
+				log.Fatalf("FAILOVER_COOLDOWN: %v", err)
+			}
+			if fo, err := store.NewFailover(remote, threshold, cooldown); err != nil {
+				log.Printf("(warn) failover disabled: %v", err)
+			} else {
+				go fo.Monitor(cooldown)
+				remote = fo
+				failover = fo
+			}
+		}
+		tiered, err = store.NewTiered(multi, remote, mode, cacheTTL, flushEvery)
+		if err != nil {
+			log.Fatalf("tiered store: %v", err)
+		}
+		counters = tiered
+		if mode == store.WriteBehind {
+			log.Printf("write-behind enabled (flush every %s)", flushEvery)
+		}
+	}
+
+	// Load persisted counters if configured. With a durable store the legacy
+	// single counter lives there as "default"; PERSIST_FILE only seeds it once.
+	var snapshots *snapshotWriter
+	if persistFile != "" && durable != nil {
+		if snap, err := loadSnapshot(persistFile); err == nil && !snap["default"].IsZero() {
+			v := snap["default"].Uint64()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			cur, err := durable.Get(ctx, "default")
+			if err == nil && cur.IsZero() {
+				if a, ok := durable.(store.Adder); ok {
+					if _, err := a.IncBy(ctx, "default", v); err == nil {
+						log.Printf("seeded default counter with %d from %s (PERSIST_FILE is no longer needed)", v, persistFile)
+					}
+				}
+			}
+			cancel()
+		}
+	} else if persistFile != "" {
+		snap, err := loadSnapshot(persistFile)
+		if err != nil {
+			log.Fatalf("PERSIST_FILE: %v", err)
+		}
+		// Only empty counters are filled, so newer WAL_PATH values win. The
+		// single counter and an explicit "default" id are both restored from
+		// "default" and saved as the larger of the two.
+		atomic.StoreUint64(&singleCounter.count, snap["default"].Uint64())
+		restoreSnapshot(counters, snap)
+		log.Printf("loaded %d counters from %s", len(snap), persistFile)
+		snapshots = startSnapshots(persistFile, func() map[string]core.Value {
+			snap := snapshotOf(counters)
+			if n := singleCounter.Get(); n > snap["default"].Uint64() {
+				snap["default"] = core.Uint(n)
+			}
+			return snap
+		})
+	}
 
-func NewRedisCounter(redisURL, prefix string) (*RedisCounter, error) {
-	opt, err := redis.ParseURL(redisURL)
+	milestones := newMilestoneLog(redisCounter)
+	changes := newChangeLog(redisCounter)
+	meta := newMetaLog(redisCounter)
+	uniques := newUniqueLog(redisCounter)
+	history, err := newHistoryLog(redisCounter) // HISTORY_INTERVAL: value snapshots for /history
 	if err != nil {
-		return nil, fmt.Errorf("parse redis url: %w", err)
+		log.Fatalf("%v", err)
 	}
-	c := redis.NewClient(opt)
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-	if err := c.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("redis ping: %w", err)
+	dayBuckets := web.DayBucketsFromEnv()
+	if err := store.Supports(counters, store.FeatureTimeSeries); dayBuckets && err != nil {
+		log.Printf("(warn) DAY_BUCKETS is off: %v", err)
+		dayBuckets = false
 	}
-	if prefix == "" {
-		prefix = "hits:"
+	badgeUsage := &web.BadgeUsage{} // per process, since start
+	started := time.Now().UTC().Truncate(time.Second)
+	stopping := make(chan struct{}) // closed on shutdown
+	frozen := newFrozenSet(redisCounter, adminSettings)
+	rounding, err := newRoundingTable(adminSettings)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	gauges := newGaugeTypes(adminSettings) // type of each gauge, fixed at its first write
+	offsets, err := newOffsetTable(adminSettings)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	dedupe, err := newDedupeWindow(redisCounter)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	idempotency, err := newIdempotencyKeys(redisCounter)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	quotas, err := newNamespaceQuotas(redisCounter)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	tombstones, err := newTombstoneTable(redisCounter, adminSettings, durable, leader)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	resets, err := newResetScheduler(redisCounter, adminSettings) // RESET_SCHEDULE: counters reset every day, week or month
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	badgeMins, err := web.BadgeMinFromEnv()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	webhooks, err := newWebhookRegistryFromEnv(adminSettings, redisCounter)
+	if err != nil {
+		log.Fatalf("webhook config: %v", err)
+	}
+	maxHitBy, err := web.MaxHitByFromEnv() // MAX_HIT_BY: the most hits one /hit?by=N may record
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := web.CompatFromEnv(); err != nil { // COMPAT: another hit counter's response keys
+		log.Fatalf("%v", err)
+	}
+	compatRoutes, err := web.CompatRoutesFromEnv() // COMPAT_ROUTES: other hit counters' badge URLs
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if mode, err := web.IDNormFromEnv(); err != nil { // ID_NORMALIZE: NFC and case-folded ids
+		log.Fatalf("%v", err)
+	} else if mode != core.IDNormNone {
+		log.Printf("ids are normalized (%s)", mode)
+	}
+	if _, err := web.TrustProxyFromEnv(0); err != nil { // TRUST_PROXY: take client IPs from X-Forwarded-For
+		log.Fatalf("%v", err)
+	}
+	caps, err := web.CapsFromEnv() // MAX_VALUES: per-counter maximums and overflow policies
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	nsTokens, err := web.NamespaceTokensFromEnv()
+	if err != nil {
+		log.Fatalf("%v", err)
 	}
-	return &RedisCounter{client: c, prefix: prefix}, nil
-}
 
-func (r *RedisCounter) key(id string) string {
-	if id == "" {
-		id = "default"
+	// authorizeID accepts SECRET_TOKEN or, for an id such as "blog/home", the
+	// NAMESPACE_TOKENS entry of a namespace it is in
+	authorizeID := func(r *http.Request, id string) bool {
+		return authorize(secretToken, r) || web.IDAuthorized(nsTokens, r, id) || web.CompatRequest(r)
 	}
-	return r.prefix + id
-}
 
-func (r *RedisCounter) Inc(id string) (uint64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-	v, err := r.client.Incr(ctx, r.key(id)).Result()
+	// display turns a stored value into the public one: the display offset
+	// (DISPLAY_OFFSETS) is added, then it is rounded (ROUND_COUNTS)
+	display := func(id string, v core.Value) core.Value {
+		return rounding.public(id, offsets.apply(id, v))
+	}
+
+	// READ_CACHE_TTL (e.g. 2s) serves public reads (/count, /count.txt and
+	// badges) from a READ_CACHE_SIZE-bounded LRU instead of the store; hits
+	// counted here update it, other instances' hits show up after the TTL
+	readCache, err := store.ReadCacheFromEnv()
 	if err != nil {
-		return 0, err
+		log.Fatalf("%v", err)
+	}
+	// lastKnown is the read cache or, when that is off, one that serves
+	// nothing fresh but still remembers the values last read and written, to
+	// answer with while the store is down
+	lastKnown := readCache
+	if readCache != nil {
+		log.Printf("read cache enabled (%d counters for %s)", readCache.Size, readCache.TTL)
+	} else {
+		lastKnown = store.NewReadCache(0, 0)
+	}
+	cachedGet := func(ctx context.Context, id string) (core.Value, error) {
+		return lastKnown.Read(ctx, id, counters.Get)
+	}
+	// cachePut remembers a counter's value after a write
+	cachePut := func(id string, v core.Value) {
+		lastKnown.Put(id, v)
+		history.record(id, v)
 	}
-	return uint64(v), nil
-}
 
-func (r *RedisCounter) Get(id string) (uint64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-	s, err := r.client.Get(ctx, r.key(id)).Result()
-	if err == redis.Nil {
-		return 0, nil
+	// unavailable answers 503 for a failed store call, with Retry-After set
+	// to when a failover will try the store again; fields are from web.Stale
+	retryAfter := func() time.Duration {
+		if failover != nil {
+			return failover.RetryAfter()
+		}
+		return web.StoreRetryAfter
 	}
-	if err != nil {
-		return 0, err
+	unavailable := func(w http.ResponseWriter, fields map[string]any) {
+		web.WriteUnavailable(w, retryAfter(), fields)
 	}
-	v, convErr := strconv.ParseUint(s, 10, 64)
-	if convErr != nil {
-		return 0, convErr
+	// lastPublic and lastStored are the counters' last known values, offset
+	// and rounded as public reads show them or as stored
+	lastPublic := func(id string) (core.Value, time.Time, bool) {
+		v, at, ok := lastKnown.Last(id)
+		return display(id, v), at, ok
 	}
-	return v, nil
-}
+	lastStored := lastKnown.Last
 
-// JSON response helpers
-func writeJSON(w http.ResponseWriter, status int, v interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(v)
-}
+	// badgeCount reads the value shown on badges ("default" maps to the legacy
+	// single counter), offset and rounded for public display
+	badgeCount := func(id string) core.Value {
+		count, _ := cachedGet(context.Background(), id)
+		if count.IsZero() && id == "default" && durable == nil {
+			count = core.Uint(singleCounter.Get())
+		}
+		return display(id, count)
+	}
 
-func main() {
-	port := getenv("PORT", "8080")
-	secretToken := os.Getenv("SECRET_TOKEN") // if set, required via header X-Auth-Token or query param token
-	persistFile := os.Getenv("PERSIST_FILE") // if set, counter value persisted to this file (single default counter only when not using Redis)
-	allowedOriginsEnv := os.Getenv("ALLOWED_ORIGINS")
-	redisURL := os.Getenv("REDIS_URL") // optional; if set enables persistent counts in Redis for all ids
-	redisPrefix := os.Getenv("REDIS_PREFIX")
+	// addTimes fills in the counter metadata's first-seen and last-hit times
+	// when the fields param asks for them (fields=hits,lastHit)
+	addTimes := func(r *http.Request, id string, c *web.Counter) {
+		if web.FieldRequested(r, "firstSeen") || web.FieldRequested(r, "lastHit") {
+			m := meta.get(id)
+			c.FirstSeen, c.LastHit = m.FirstSeen, m.LastHit
+		}
+	}
 
-	// Upstash convenience: if REDIS_URL not provided, try constructing from UPSTASH env vars.
-	if redisURL == "" {
-		upstashBase := os.Getenv("UPSTASH_REDIS_URL")      // e.g. global-fancy-123.upstash.io:12345 or rediss://... or redis://...
-		upstashPass := os.Getenv("UPSTASH_REDIS_PASSWORD") // password only
-		if upstashBase != "" && upstashPass != "" {
-			redisURL = buildUpstashRedisURL(upstashBase, upstashPass)
-			log.Printf("constructed redis URL from UPSTASH_REDIS_URL/PASSWORD (host=%s)", upstashBase)
+	// badgeText formats count for id's badge; uniques=1 appends its unique
+	// visitors when they are counted
+	badgeText := func(r *http.Request, id string, count core.Value) string {
+		min := badgeMin(r, badgeMins, id)
+		text := formatBadgeValue(r, count, min)
+		if r.URL.Query().Get("uniques") != "1" || !uniques.tracked(id) {
+			return text
+		}
+		n, err := uniques.count(r.Context(), id)
+		if err != nil {
+			captureError(r, "(warn) redis unique visitors read failed: %v", err)
+			return text
+		}
+		return web.WithUniques(text, n, min)
+	}
+
+	// readCount returns the current value for id (Redis first, memory fallback)
+	readCount := func(r *http.Request, id string) core.Value {
+		if id == "" && durable == nil {
+			return core.Uint(singleCounter.Get())
+		}
+		val, err := counters.Get(r.Context(), id)
+		if err != nil {
+			captureError(r, "(error) redis get failed, falling back to memory: %v", err)
+		}
+		return val
+	}
+
+	// publicCount is readCount offset and rounded for public display; the
+	// admin API and MCP tools keep the stored values.
+	publicCount := func(r *http.Request, id string) core.Value {
+		if id == "" && durable == nil {
+			return display(id, readCount(r, id))
+		}
+		val, err := cachedGet(r.Context(), id)
+		if err != nil {
+			captureError(r, "(error) redis get failed, falling back to memory: %v", err)
+		}
+		return display(id, val)
+	}
+
+	// settingChanged logs a change to id's offset, rounding or freeze, which
+	// changes its public responses without a hit. With Redis, other instances
+	// only pick the setting up on their next reload, so it is logged again
+	// after that, moving Last-Modified past what they served in between.
+	settingChanged := func(id string) {
+		changes.record(id)
+		if redisCounter != nil {
+			time.AfterFunc(idTableReload, func() { changes.record(id) })
+		}
+	}
+
+	// conditionalRead reads id's public value with get and sets Last-Modified
+	// from the change log, reporting true once it has answered 304 for
+	// If-Modified-Since. The server's start time is the floor, since
+	// DISPLAY_OFFSETS, ROUND_COUNTS and the badge renderer may have changed
+	// with it. A counter that reads zero gets no Last-Modified, as it may
+	// have expired without a logged change.
+	lastModifiedSettle := time.Second
+	if readCache != nil {
+		lastModifiedSettle += readCache.TTL
+	}
+	conditionalRead := func(w http.ResponseWriter, r *http.Request, id string, get func() core.Value) (core.Value, bool) {
+		changed := changes.changedAt(id)
+		val := get()
+		if changed.IsZero() || val.IsZero() {
+			return val, false
+		}
+		if changed.Before(started) {
+			changed = started
+		}
+		return val, web.NotModified(w, r, changed, lastModifiedSettle)
+	}
+
+	// bucketHit adds n hits to id's bucket for today (unless DAY_BUCKETS=0),
+	// which period reads sum; playground counters have none
+	bucketHit := func(r *http.Request, id string, n uint64) {
+		if !dayBuckets || isTestID(id) {
+			return
+		}
+		if id == "" {
+			id = "default"
+		}
+		bucket := core.DayBucketID(id, core.Now())
+		var v uint64
+		var err error
+		if a, ok := counters.(store.Adder); ok {
+			v, err = a.IncBy(r.Context(), bucket, n)
+		} else if n == 1 {
+			v, err = counters.Inc(r.Context(), bucket)
+		} else {
+			err = store.ErrUnsupported
+		}
+		if err == nil && v == n { // created it: expire it once charts no longer read it
+			if e, ok := counters.(store.Expirer); ok {
+				err = e.Expire(r.Context(), bucket, core.DayBucketTTL)
+			}
+		}
+		if err != nil {
+			captureError(r, "(warn) day bucket increment failed: %v", err)
+		}
+	}
+
+	// bucketCounts reads id's day buckets for days
+	bucketCounts := func(r *http.Request, id string, days []time.Time) ([]uint64, error) {
+		if id == "" {
+			id = "default"
+		}
+		counts := make([]uint64, len(days))
+		for i, day := range days {
+			v, err := counters.Get(r.Context(), core.DayBucketID(id, day))
+			if err != nil {
+				return nil, err
+			}
+			counts[i] = v.Uint64()
+		}
+		return counts, nil
+	}
+
+	// periodCount sums id's day buckets over period (today, week or month),
+	// rounded for public display; display offsets only apply to totals
+	periodCount := func(r *http.Request, id, period string) (core.Value, error) {
+		days, _ := core.PeriodDays(period, core.Now())
+		counts, err := bucketCounts(r, id, days)
+		if err != nil {
+			return core.Value{}, err
+		}
+		var sum uint64
+		for _, n := range counts {
+			sum += n
+		}
+		return rounding.public(id, core.Uint(sum)), nil
+	}
+
+	// velocity estimates id's hits per hour and per day over the last 24
+	// hours from its buckets for today and yesterday
+	velocity := func(r *http.Request, id string) (core.Velocity, error) {
+		now := core.Now()
+		today := now.UTC().Truncate(24 * time.Hour)
+		counts, err := bucketCounts(r, id, []time.Time{today, today.AddDate(0, 0, -1)})
+		if err != nil {
+			return core.Velocity{}, err
+		}
+		return core.NewVelocity(counts[0], counts[1], now, rounding.step(id)), nil
+	}
+
+	// addVelocity fills in id's velocity when the fields param asks for it
+	// (fields=hits,velocity)
+	addVelocity := func(r *http.Request, id string, c *web.Counter) {
+		if !web.FieldRequested(r, "velocity") {
+			return
+		}
+		v, err := velocity(r, id)
+		if err != nil {
+			captureError(r, "(warn) day bucket read failed: %v", err)
+			return
+		}
+		c.Velocity = &v
+	}
+
+	// badgeRead reads the count shown on id's badge: the total, answering
+	// 304 for If-Modified-Since, or with period=today|week|month the sum of
+	// its day buckets. done is true once it has written the response.
+	badgeRead := func(w http.ResponseWriter, r *http.Request, id string) (count core.Value, done bool) {
+		period, err := web.ParsePeriod(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return core.Value{}, true
+		}
+		if period == "" {
+			return conditionalRead(w, r, id, func() core.Value { return badgeCount(id) })
+		}
+		count, err = periodCount(r, id, period)
+		if err != nil {
+			captureError(r, "(error) day bucket read failed: %v", err)
+		}
+		return count, false
+	}
+
+	// badgeSVG renders id's badge: its count as read by badgeRead, against
+	// the goal with target=N ("7,842 / 10k", or a bar with style=progress),
+	// or with style=velocity its hourly rate ("12/hr"). done is true once it
+	// has written the response.
+	badgeSVG := func(w http.ResponseWriter, r *http.Request, id string) (svg string, done bool) {
+		style := r.URL.Query().Get("style")
+		if style == "velocity" {
+			v, err := velocity(r, id)
+			if err != nil {
+				captureError(r, "(error) day bucket read failed: %v", err)
+			}
+			return renderBadge(r, v.BadgeText()), false
+		}
+		count, done := badgeRead(w, r, id)
+		if done {
+			return "", true
+		}
+		target := badgeTarget(r)
+		switch {
+		case target == 0:
+			return renderBadge(r, badgeText(r, id, count)), false
+		case style == "progress":
+			text, fraction := core.Progress(count, target, badgeMin(r, badgeMins, id))
+			return renderProgressBadge(r, text, fraction), false
+		}
+		return renderBadge(r, core.TargetText(formatBadgeValue(r, count, badgeMin(r, badgeMins, id)), target)), false
+	}
+
+	// groupBadge renders a group's total as badgeSVG renders a count, with
+	// the BADGE_MIN of the group's name
+	groupBadge := func(r *http.Request, name string, total core.Value) string {
+		min := badgeMin(r, badgeMins, name)
+		target := badgeTarget(r)
+		switch {
+		case target == 0:
+			return renderBadge(r, formatBadgeValue(r, total, min))
+		case r.URL.Query().Get("style") == "progress":
+			text, fraction := core.Progress(total, target, min)
+			return renderProgressBadge(r, text, fraction)
+		}
+		return renderBadge(r, core.TargetText(formatBadgeValue(r, total, min), target))
+	}
+
+	// incrementBy adds n hits to id (Redis first, memory fallback) and
+	// notifies the milestone log, webhooks, change log and counter metadata.
+	// n > 1 needs a store that can add deltas (store.Adder), and a counter
+	// capped by MAX_VALUES one with transactions. A hit the cap refuses
+	// returns a *core.OverflowError. With below > 0 (if_below) the hit is
+	// only counted while the stored value is below it, checked in the same
+	// transaction; otherwise it returns a *store.MismatchError.
+	incrementBy := func(r *http.Request, id string, n, below uint64) (uint64, error) {
+		var newVal, from uint64
+		counted, stored := n, true
+		if id == "" && durable == nil { // legacy single counter path
+			newVal = singleCounter.Add(n)
+			from = newVal - n
+		} else {
+			c, capped := core.CapFor(caps, id)
+			if capped {
+				if err := store.Supports(counters, store.FeatureTx); err != nil {
+					return 0, fmt.Errorf("counter %s has a max: %w", id, err)
+				}
+			}
+			inc := counters.Inc
+			if n > 1 {
+				a, ok := counters.(store.Adder)
+				if !ok {
+					return 0, store.ErrUnsupported
+				}
+				inc = func(ctx context.Context, id string) (uint64, error) { return a.IncBy(ctx, id, n) }
+			}
+			if below > 0 {
+				tx := counters.(store.Transactor)
+				inc = func(ctx context.Context, id string) (uint64, error) {
+					res, err := tx.Apply(ctx, []store.Op{{Kind: store.OpBelow, ID: id, N: below}, {Kind: store.OpInc, ID: id, N: n}})
+					if err != nil {
+						return 0, err
+					}
+					return res[1], nil
+				}
+			}
+			var h core.CappedHit
+			var err error
+			if capped { // the cap is applied in the hit's own transaction
+				var guards []store.Op
+				if below > 0 {
+					guards = []store.Op{{Kind: store.OpBelow, ID: id, N: below}}
+				}
+				var hits []core.CappedHit
+				hits, err = store.ApplyCapped(r.Context(), counters.(store.Transactor), guards, []store.Op{{Kind: store.OpInc, ID: id, N: n}}, func(string) (core.Cap, bool) { return c, true })
+				if err != nil {
+					return 0, err
+				}
+				if h = hits[0]; h.Rejected {
+					return h.To, &core.OverflowError{ID: id, Max: c.Max, Hits: h.To}
+				}
+			} else {
+				var v uint64
+				v, err = inc(r.Context(), id)
+				h = core.CappedHit{From: v - n, To: v, Counted: n}
+			}
+			var mismatch *store.MismatchError
+			if errors.Is(err, store.ErrUnsupported) || errors.Is(err, store.ErrNotInteger) || errors.As(err, &mismatch) {
+				return 0, err // e.g. write-through to a remote that cannot add n, or a refused if_below
+			}
+			if err != nil {
+				captureError(r, "(error) redis incr failed, falling back to memory: %v", err)
+				stored = false
+			} else {
+				cachePut(id, core.Uint(h.To))
+				if h.Counted > 0 {
+					bucketHit(r, id, h.Counted)
+				}
+			}
+			newVal, from, counted = h.To, h.From, h.Counted
+		}
+		milestones.record(id, from, newVal)
+		webhooks.onHit(id, from, newVal)
+		changes.record(id)
+		if stored && counted > 0 {
+			meta.hit(id, from, counted)
+		}
+		return newVal, nil
+	}
+	// increment adds one hit, which every store supports.
+	increment := func(r *http.Request, id string) uint64 {
+		newVal, _ := incrementBy(r, id, 1, 0)
+		return newVal
+	}
+
+	// replayed answers a /hit whose Idempotency-Key (key) was already
+	// delivered within IDEMPOTENCY_WINDOW with the current count, and claims
+	// the key otherwise. An error counts the hit.
+	replayed := func(w http.ResponseWriter, r *http.Request, id, key string) bool {
+		first, err := idempotency.first(r.Context(), id, key)
+		if err != nil {
+			captureError(r, "(warn) idempotency check failed, counting the hit: %v", err)
+			return false
+		}
+		if first {
+			return false
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		web.WriteCounter(w, r, web.Counter{ID: id, Hits: publicCount(r, id), Duplicate: true, Environment: environment})
+		return true
+	}
+
+	mux := http.NewServeMux()
+
+	// POST /hit (or GET) increments the counter for given id and returns the new value
+	mux.HandleFunc("/hit", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET, POST")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if !authorizeID(r, id) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		if frozen.has(id) { // final value kept forever; the hit is acknowledged but not recorded
+			web.WriteCounter(w, r, web.Counter{ID: id, Hits: publicCount(r, id), Frozen: true, Environment: environment})
+			return
+		}
+		if web.Excluded(r, excludeToken) { // owner's own traffic (/optout cookie or exclude token)
+			web.WriteCounter(w, r, web.Counter{ID: id, Hits: publicCount(r, id), Excluded: true})
+			return
+		}
+		if web.FromDevHost(r, devHosts) { // sent from a page under local development
+			web.WriteCounter(w, r, web.Counter{ID: id, Hits: publicCount(r, id), Excluded: true, Reason: "development"})
+			return
+		}
+		idemKey, err := web.ParseIdempotencyKey(r) // names this delivery, so retries count once
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if kind, by, err := web.ParseGauge(r); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		} else if kind != "" { // float aggregate (e.g. MB downloaded) or a signed gauge such as a score
+			if isDryRun(r) {
+				cur := publicCount(r, id)
+				web.WriteCounter(w, r, web.Counter{ID: id, Hits: cur.AddFloat(by), Previous: &cur, DryRun: true})
+				return
+			}
+			var mismatch *store.GaugeTypeError
+			if err := gauges.claim(r.Context(), id, kind); errors.As(err, &mismatch) {
+				writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+				return
+			} else if err != nil {
+				captureError(r, "(error) gauge type lookup failed: %v", err)
+				unavailable(w, nil)
+				return
+			}
+			if replayed(w, r, id, idemKey) {
+				return
+			}
+			newVal, err := counters.(store.FloatIncrementer).IncFloat(r.Context(), id, by)
+			if err != nil {
+				captureError(r, "(error) redis incrbyfloat failed, falling back to memory: %v", err)
+			} else {
+				cachePut(id, core.Float(newVal))
+			}
+			changes.record(id)
+			web.WriteCounter(w, r, web.Counter{ID: id, Hits: display(id, core.Float(newVal)), Environment: environment})
+			return
+		}
+		by, err := web.ParseHitBy(r, maxHitBy) // ?by=N records N hits at once (batch clients)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		ttl, err := web.ParseTTL(r) // ?ttl=24h: a counter created by this hit expires after 24h
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if ttl > 0 {
+			if id == "" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ttl requires an id"})
+				return
+			}
+			if err := store.Supports(counters, store.FeatureExpiring); err != nil {
+				writeJSON(w, http.StatusNotImplemented, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		ifBelow, err := web.ParseIfBelow(r) // ?if_below=100: count only while the counter is below 100
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if ifBelow > 0 {
+			if id == "" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "if_below requires an id"})
+				return
+			}
+			if err := store.Supports(counters, store.FeatureTx); err != nil {
+				writeJSON(w, http.StatusNotImplemented, map[string]string{"error": fmt.Sprintf("if_below: %v", err)})
+				return
+			}
+		}
+		if isDryRun(r) { // validated and authorized; report the would-be value without writing
+			cur := publicCount(r, id)
+			next := cur.Add(by)
+			if stored := readCount(r, id).Uint64(); ifBelow > 0 && stored >= ifBelow {
+				writeJSON(w, http.StatusPreconditionFailed, map[string]any{"error": web.IfBelowError(id, ifBelow), "id": id, "hits": cur, "if_below": ifBelow, "dryRun": true})
+				return
+			}
+			if c, ok := core.CapFor(caps, id); ok {
+				stored := readCount(r, id).Uint64()
+				h := c.Hit(stored+by, by)
+				if h.Rejected {
+					writeJSON(w, http.StatusConflict, map[string]any{"error": (&core.OverflowError{ID: id, Max: c.Max}).Error(), "id": id, "hits": cur, "max": c.Max, "dryRun": true})
+					return
+				}
+				next = display(id, core.Uint(h.To))
+			}
+			web.WriteCounter(w, r, web.Counter{ID: id, Hits: next, Previous: &cur, DryRun: true})
+			return
+		}
+		if replayed(w, r, id, idemKey) {
+			return
+		}
+		// repeat visitor within DEDUPE_WINDOW (per the counter's DEDUPE identity)
+		if first, err := dedupe.first(r.Context(), w, r, id); err != nil {
+			captureError(r, "(warn) dedupe check failed, counting the hit: %v", err)
+		} else if !first {
+			web.WriteCounter(w, r, web.Counter{ID: id, Hits: publicCount(r, id), Duplicate: true, Environment: environment})
+			return
+		}
+		// NAMESPACE_QUOTAS: refuse hits past a namespace's counters or daily
+		// hits, and warn as it nears them
+		usage, err := quotas.take(r.Context(), id, by)
+		var overQuota *core.QuotaError
+		switch {
+		case errors.As(err, &overQuota):
+			if err := idempotency.release(r.Context(), id, idemKey); err != nil {
+				captureError(r, "(warn) idempotency key release failed: %v", err)
+			}
+			web.WriteQuotaExceeded(w, overQuota)
+			return
+		case err != nil:
+			captureError(r, "(warn) namespace quota check failed, counting the hit: %v", err)
+		}
+		warnings := web.QuotaWarnings(w.Header(), usage, quotas.warnAt)
+		newVal, err := incrementBy(r, id, by, ifBelow)
+		if err != nil {
+			if err := idempotency.release(r.Context(), id, idemKey); err != nil {
+				captureError(r, "(warn) idempotency key release failed: %v", err)
+			}
+			var over *core.OverflowError
+			var unsupported *store.UnsupportedError
+			var mismatch *store.MismatchError
+			switch {
+			case errors.As(err, &over):
+				writeJSON(w, http.StatusConflict, map[string]any{"error": err.Error(), "id": id, "hits": display(id, core.Uint(over.Hits)), "max": over.Max})
+			case errors.As(err, &mismatch):
+				writeJSON(w, http.StatusPreconditionFailed, map[string]any{"error": web.IfBelowError(id, ifBelow), "id": id, "hits": display(id, core.Uint(mismatch.Current)), "if_below": ifBelow})
+			case errors.Is(err, store.ErrNotInteger):
+				writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			case errors.As(err, &unsupported):
+				writeJSON(w, http.StatusNotImplemented, map[string]string{"error": err.Error()})
+			case !errors.Is(err, store.ErrUnsupported): // a capped hit's transaction failed
+				captureError(r, "(error) capped increment failed: %v", err)
+				unavailable(w, nil)
+			default:
+				writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "by=N is not supported by this storage backend"})
+			}
+			return
+		}
+		resp := web.Counter{ID: id, Hits: display(id, core.Uint(newVal)), Environment: environment, Test: isTestID(id), Offset: offsets.offset(id), Warnings: warnings}
+		var expires time.Duration
+		if ttl > 0 && newVal == by { // this hit created the counter
+			if err := counters.(store.Expirer).Expire(r.Context(), id, ttl); err != nil {
+				captureError(r, "(error) counter expiry failed, it will not expire: %v", err)
+			} else {
+				at := core.Now().Add(ttl).UTC().Truncate(time.Second)
+				resp.ExpiresAt = &at
+				expires = ttl
+			}
+		}
+		uniques.hit(r, id, expires)
+		if step := rounding.step(id); step > 1 {
+			resp.Rounded = step
+		}
+		web.WriteCounter(w, r, resp)
+	})
+
+	// POST /hits records hits on several counters at once, all or nothing, e.g. a
+	// static site generator flushing buffered events: {"increments":{"home":3,"blog":1}}
+	mux.HandleFunc("/hits", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		if err := store.Supports(counters, store.FeatureTx); err != nil {
+			writeJSON(w, http.StatusNotImplemented, map[string]string{"error": err.Error()})
+			return
+		}
+		incs, err := web.ParseIncrements(http.MaxBytesReader(w, r.Body, 1<<16), maxHitBy)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		for _, inc := range incs {
+			if !authorizeID(r, inc.ID) {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+				return
+			}
+		}
+		hits := make(map[string]core.Value, len(incs))
+		resp := map[string]any{"hits": hits, "environment": environment}
+		if web.Excluded(r, excludeToken) || web.FromDevHost(r, devHosts) { // nothing is counted
+			for _, inc := range incs {
+				hits[inc.ID] = publicCount(r, inc.ID)
+			}
+			resp["excluded"] = true
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+		var ops []store.Op
+		var frozenIDs []string
+		for _, inc := range incs {
+			if frozen.has(inc.ID) { // acknowledged but not recorded, as on /hit
+				frozenIDs = append(frozenIDs, inc.ID)
+				hits[inc.ID] = publicCount(r, inc.ID)
+				continue
+			}
+			ops = append(ops, store.Op{Kind: store.OpInc, ID: inc.ID, N: inc.N})
+		}
+		if len(frozenIDs) > 0 {
+			resp["frozen"] = frozenIDs
+		}
+		if isDryRun(r) {
+			for _, op := range ops {
+				hits[op.ID] = publicCount(r, op.ID).Add(op.N)
+			}
+			resp["dryRun"] = true
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+		if len(ops) > 0 {
+			capped, err := store.ApplyCapped(r.Context(), counters.(store.Transactor), nil, ops, func(id string) (core.Cap, bool) { return core.CapFor(caps, id) })
+			switch {
+			case errors.Is(err, store.ErrNotInteger), errors.Is(err, store.ErrCrossSlot):
+				writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+				return
+			case err != nil:
+				captureError(r, "(error) bulk increment failed: %v", err)
+				unavailable(w, web.StaleBatch(lastPublic, store.OpIDs(ops)))
+				return
+			}
+			var refused []string
+			for i, op := range ops {
+				if capped[i].Rejected {
+					refused = append(refused, op.ID)
+				}
+			}
+			if len(refused) > 0 { // all or nothing: nothing in the batch was written
+				writeJSON(w, http.StatusConflict, map[string]any{"error": "hits would take counters past their max", "capped": refused})
+				return
+			}
+			for i, op := range ops {
+				h := capped[i]
+				hits[op.ID] = display(op.ID, core.Uint(h.To))
+				cachePut(op.ID, core.Uint(h.To))
+				milestones.record(op.ID, h.From, h.To)
+				webhooks.onHit(op.ID, h.From, h.To)
+				changes.record(op.ID)
+				if h.Counted > 0 {
+					meta.hit(op.ID, h.From, h.Counted)
+					bucketHit(r, op.ID, h.Counted)
+				}
+			}
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+
+	// POST /tx (or /transact) applies a list of inc/dec/set/expect operations atomically, e.g. to move
+	// hits between aliases: {"ops":[{"op":"dec","id":"old","by":10},{"op":"inc","id":"new","by":10}]}
+	tx := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		if err := store.Supports(counters, store.FeatureTx); err != nil {
+			writeJSON(w, http.StatusNotImplemented, map[string]string{"error": err.Error()})
+			return
+		}
+		ops, err := web.ParseTx(http.MaxBytesReader(w, r.Body, 1<<16))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		for _, op := range ops {
+			if !authorizeID(r, op.ID) {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+				return
+			}
+		}
+		for i, op := range ops {
+			if op.Kind != store.OpExpect && op.Kind != store.OpBelow && frozen.has(op.ID) {
+				writeJSON(w, http.StatusLocked, map[string]string{"error": fmt.Sprintf("ops[%d]: counter %s is frozen", i, op.ID)})
+				return
+			}
+		}
+		if isDryRun(r) {
+			writeJSON(w, http.StatusOK, map[string]any{"ops": len(ops), "dryRun": true})
+			return
+		}
+		results, err := counters.(store.Transactor).Apply(r.Context(), ops)
+		var mismatch *store.MismatchError
+		switch {
+		case errors.As(err, &mismatch):
+			writeJSON(w, http.StatusPreconditionFailed, map[string]any{"error": err.Error(), "id": mismatch.ID, "hits": mismatch.Current})
+			return
+		case errors.Is(err, store.ErrUnderflow), errors.Is(err, store.ErrOverflow), errors.Is(err, store.ErrNotInteger), errors.Is(err, store.ErrCrossSlot):
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		case err != nil:
+			captureError(r, "(error) transaction failed: %v", err)
+			unavailable(w, web.StaleBatch(lastStored, store.OpIDs(ops)))
+			return
+		}
+		type result struct {
+			ID   string `json:"id"`
+			Hits uint64 `json:"hits"`
+		}
+		out := make([]result, len(ops))
+		for i, op := range ops {
+			out[i] = result{ID: op.ID, Hits: results[i]}
+			cachePut(op.ID, core.Uint(results[i]))
+			if op.Kind == store.OpInc {
+				milestones.record(op.ID, results[i]-op.N, results[i])
+				meta.hit(op.ID, results[i]-op.N, op.N)
+			}
+			changes.record(op.ID)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"results": out})
+	}
+	mux.HandleFunc("/tx", tx)
+	mux.HandleFunc("/transact", tx)
+
+	// listCounters returns every counter in namespace ns ("" for all of
+	// them) but playground ids and day buckets; ok is false when the store
+	// cannot list counters
+	listCounters := func(ctx context.Context, ns string) (all map[string]core.Value, ok bool, err error) {
+		lister, ok := counters.(store.Lister)
+		if !ok {
+			return nil, false, nil
+		}
+		all = make(map[string]core.Value)
+		err = lister.Each(ctx, func(id string, v core.Value) error {
+			if !isTestID(id) && !core.IsDayBucketID(id) && (ns == "" || core.InNamespace(id, ns)) {
+				all[id] = v
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, true, err
+		}
+		if _, ok := all["default"]; !ok && ns == "" && durable == nil && singleCounter.Get() > 0 {
+			all["default"] = core.Uint(singleCounter.Get())
+		}
+		return all, true, nil
+	}
+
+	// groups are the GROUPS that /count?group= and /badge?group= add up
+	groups, err := web.GroupsFromEnv()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	// groupTotal adds up the public counts of a group's members, each
+	// counter once; ok is false when a namespace member needs a listing the
+	// store cannot do
+	groupTotal := func(r *http.Request, members []string) (total core.Aggregate, ok bool, err error) {
+		ids, namespaces := core.GroupMembers(members)
+		seen := make(map[string]bool)
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				total.Add(publicCount(r, id))
+			}
+		}
+		for _, ns := range namespaces {
+			all, ok, err := listCounters(r.Context(), ns)
+			if !ok || err != nil {
+				return total, ok, err
+			}
+			for id, v := range all {
+				if !seen[id] {
+					seen[id] = true
+					total.Add(display(id, v))
+				}
+			}
+		}
+		return total, true, nil
+	}
+
+	// readGroup answers with an error, and done true, when r's group is
+	// unknown, not authorized or cannot be read; otherwise it returns the
+	// group's total
+	readGroup := func(w http.ResponseWriter, r *http.Request, name string) (total core.Aggregate, done bool) {
+		members, known := groups[name]
+		switch {
+		case !authorize(secretToken, r) && !(known && web.GroupAuthorized(nsTokens, r, members)):
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return total, true
+		case !known:
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown group; define it in GROUPS"})
+			return total, true
+		}
+		total, ok, err := groupTotal(r, members)
+		switch {
+		case !ok:
+			writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "this store cannot list counters for a namespace member"})
+			return total, true
+		case err != nil:
+			captureError(r, "(error) group listing failed: %v", err)
+			unavailable(w, nil)
+			return total, true
+		}
+		return total, false
+	}
+
+	// GET /count just returns current value without incrementing
+	mux.HandleFunc("/count", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		if name, err := web.ParseGroup(r); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		} else if name != "" { // the total of a GROUPS entry
+			if total, done := readGroup(w, r, name); !done {
+				web.WriteGroup(w, r, name, total, environment)
+			}
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if !authorizeID(r, id) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		lp, err := web.ParseLongPoll(r, maxLongPoll)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		metric, err := web.ParseMetric(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		period, err := web.ParsePeriod(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if period != "" { // hits today, this week or this month, summed from day buckets
+			switch {
+			case metric == "uniques":
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "period is not supported with metric=uniques"})
+				return
+			case lp.Wait > 0:
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "wait is not supported with period"})
+				return
+			}
+			val, err := periodCount(r, id, period)
+			if err != nil {
+				captureError(r, "(error) day bucket read failed: %v", err)
+				unavailable(w, nil)
+				return
+			}
+			switch r.URL.Query().Get("format") {
+			case "txt", "text":
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				_, _ = w.Write([]byte(val.String()))
+				return
+			case "github-output":
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				_, _ = w.Write([]byte(core.GitHubOutput([2]string{"hits", val.String()}, [2]string{"id", id}, [2]string{"period", period})))
+				return
+			}
+			resp := web.Counter{ID: id, Hits: val, Period: period, Environment: environment, Frozen: frozen.has(id)}
+			if step := rounding.step(id); step > 1 {
+				resp.Rounded = step
+			}
+			addTimes(r, id, &resp)
+			addVelocity(r, id, &resp)
+			web.WriteCounter(w, r, resp)
+			return
+		}
+		if metric == "uniques" { // estimated unique visitors (UNIQUES, Redis only)
+			switch {
+			case redisCounter == nil:
+				writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "unique visitors require redis"})
+				return
+			case !uniques.tracked(id):
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "unique visitors are not counted for this id; add it to UNIQUES"})
+				return
+			case lp.Wait > 0:
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "wait is not supported with metric=uniques"})
+				return
+			}
+			n, err := uniques.count(r.Context(), id)
+			if err != nil {
+				captureError(r, "(error) redis unique visitors read failed: %v", err)
+				unavailable(w, nil)
+				return
+			}
+			switch f := r.URL.Query().Get("format"); f {
+			case "txt", "text":
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				_, _ = w.Write([]byte(strconv.FormatUint(n, 10)))
+				return
+			case "github-output":
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				_, _ = w.Write([]byte(core.GitHubOutput([2]string{"uniques", strconv.FormatUint(n, 10)}, [2]string{"id", id})))
+				return
+			}
+			resp := web.Counter{ID: id, Hits: publicCount(r, id), Uniques: &n, Environment: environment, Frozen: frozen.has(id), Offset: offsets.offset(id)}
+			if step := rounding.step(id); step > 1 {
+				resp.Rounded = step
+			}
+			addTimes(r, id, &resp)
+			addVelocity(r, id, &resp)
+			web.WriteCounter(w, r, resp)
+			return
+		}
+		// wait=30s&ifChangedFrom=N holds the request until the count differs
+		// from N; local hits wake it at once, other instances' within a second
+		ctx := r.Context()
+		if lp.Wait > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = contextUntil(ctx, stopping)
+			defer cancel()
+		}
+		val, done := conditionalRead(w, r, id, func() core.Value {
+			return lp.Await(ctx, time.Second, changes.wake, func() core.Value { return publicCount(r, id) })
+		})
+		if done {
+			return
+		}
+		// Support plain text output via format=txt
+		if f := r.URL.Query().Get("format"); f == "txt" || f == "text" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte(val.String()))
+			return
+		}
+		// format=github-output emits GITHUB_OUTPUT lines (hits=<n>) for Actions workflows
+		if r.URL.Query().Get("format") == "github-output" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte(core.GitHubOutput([2]string{"hits", val.String()}, [2]string{"id", id})))
+			return
+		}
+		resp := web.Counter{ID: id, Hits: val, Environment: environment, Frozen: frozen.has(id), Offset: offsets.offset(id)}
+		if step := rounding.step(id); step > 1 {
+			resp.Rounded = step
+		}
+		addTimes(r, id, &resp)
+		addVelocity(r, id, &resp)
+		web.WriteCounter(w, r, resp)
+	})
+
+	// GET /counts?ids=home,blog returns several counters in one request, e.g.
+	// for a profile page showing a badge per project
+	mux.HandleFunc("/counts", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		if !authorize(secretToken, r) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		ids, err := web.ParseCountIDs(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		hits := make(map[string]core.Value, len(ids))
+		for _, id := range ids {
+			hits[id] = publicCount(r, id)
+		}
+		web.WriteCounts(w, r, hits, environment)
+	})
+
+	// GET /count.txt returns just the numeric count (no JSON) for easy custom badges
+	mux.HandleFunc("/count.txt", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if !authorizeID(r, id) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("unauthorized"))
+			return
+		}
+		val, done := conditionalRead(w, r, id, func() core.Value { return publicCount(r, id) })
+		if done {
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		_, _ = w.Write([]byte(val.String()))
+	})
+
+	// GET /badge produces an SVG badge for the given id (no increment)
+	mux.HandleFunc("/badge", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if name, err := web.ParseGroup(r); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		} else if name != "" { // the total of a GROUPS entry
+			total, done := readGroup(w, r, name)
+			if done {
+				return
+			}
+			badgeUsage.Record("badge", r.URL.Query())
+			w.Header().Set("Content-Type", "image/svg+xml;charset=utf-8")
+			w.Header().Set("Cache-Control", "no-cache")
+			_, _ = w.Write([]byte(groupBadge(r, name, core.Uint(total.TotalHits))))
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if !authorizeID(r, id) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("unauthorized"))
+			return
+		}
+		if id == "" {
+			id = "default"
+		}
+		badgeUsage.Record("badge", r.URL.Query())
+		svg, done := badgeSVG(w, r, id)
+		if done {
+			return
+		}
+		w.Header().Set("Content-Type", "image/svg+xml;charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		_, _ = w.Write([]byte(svg))
+	})
+
+	// GET /chart?id=a&id=b&days=30 draws the daily hits of a few counters as one SVG line chart
+	mux.HandleFunc("/chart", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		ids, n, err := web.ParseChart(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+		for _, id := range ids {
+			if !authorizeID(r, id) {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte("unauthorized"))
+				return
+			}
+		}
+		days := core.LastDays(n, core.Now())
+		series := make([]core.ChartSeries, len(ids))
+		for i, id := range ids {
+			counts, err := bucketCounts(r, id, days)
+			if err != nil {
+				captureError(r, "(error) day bucket read failed: %v", err)
+				web.SetRetryAfter(w.Header(), retryAfter())
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write([]byte("store unavailable"))
+				return
+			}
+			for j, c := range counts { // rounded as periodCount rounds sums
+				counts[j] = rounding.public(id, core.Uint(c)).Uint64()
+			}
+			series[i] = core.ChartSeries{Label: id, Points: counts}
+		}
+		w.Header().Set("Content-Type", "image/svg+xml;charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		_, _ = w.Write([]byte(core.ChartSVG(series, days, core.BadgeFont)))
+	})
+
+	// GET /history?id=home&from=&to= returns the counter's value snapshots
+	mux.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		id, from, to, err := web.ParseHistory(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if !authorizeID(r, id) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		if history.interval == 0 {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "history is off (HISTORY_INTERVAL=0)"})
+			return
+		}
+		points, err := history.list(r.Context(), id, from, to)
+		if err != nil {
+			captureError(r, "(error) history read failed: %v", err)
+			unavailable(w, nil)
+			return
+		}
+		for i := range points {
+			points[i].Hits = display(id, points[i].Hits)
+		}
+		web.WriteHistory(w, id, history.interval, from, to, points)
+	})
+
+	// GET /badge.datauri returns the badge as a data: URI (format=json wraps it)
+	mux.HandleFunc("/badge.datauri", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if !authorizeID(r, id) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("unauthorized"))
+			return
+		}
+		if id == "" {
+			id = "default"
+		}
+		badgeUsage.Record("badge.datauri", r.URL.Query())
+		svg, done := badgeSVG(w, r, id)
+		if done {
+			return
+		}
+		uri := "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(svg))
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.URL.Query().Get("format") == "json" {
+			writeJSON(w, http.StatusOK, map[string]string{"id": id, "dataUri": uri})
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(uri))
+	})
+
+	// GET /debug/badge-matrix draws every badge style and parameter case
+	// (core.BadgeMatrix), the ones cmd/badge-golden checks
+	mux.HandleFunc("/debug/badge-matrix", func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(secretToken, r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("unauthorized"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		_, _ = w.Write([]byte(web.BadgeMatrixPage()))
+	})
+
+	// GET /feed returns milestone events for an id as RSS (default) or Atom (format=atom)
+	mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if !authorizeID(r, id) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		if id == "" {
+			id = "default"
+		}
+		link := snippets.BaseURL(r, os.Getenv("PUBLIC_URL")) + "/badge?" + url.Values{"id": {id}}.Encode()
+		events := milestones.list(id)
+		var body []byte
+		var err error
+		if r.URL.Query().Get("format") == "atom" {
+			w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+			body, err = core.MilestoneAtom(id, link, events)
+		} else {
+			w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+			body, err = core.MilestoneRSS(id, link, events)
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "feed rendering failed"})
+			return
+		}
+		_, _ = w.Write(body)
+	})
+
+	// GET /milestones.ics serves past and projected milestone dates as an iCalendar feed
+	mux.HandleFunc("/milestones.ics", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if !authorizeID(r, id) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		if id == "" {
+			id = "default"
+		}
+		now := core.Now()
+		events := milestones.list(id)
+		projected := core.ProjectMilestones(events, readCount(r, id).Uint64(), now, 3)
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		_, _ = w.Write(core.MilestoneICal(id, events, projected, now))
+	})
+
+	// GET /snippets returns copy-paste client examples for an id (JSON, one entry per language tab)
+	mux.HandleFunc("/snippets", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			id = "default"
+		}
+		base := snippets.BaseURL(r, os.Getenv("PUBLIC_URL"))
+		writeJSON(w, http.StatusOK, map[string]any{"id": id, "baseUrl": base, "snippets": snippets.Generate(base, id)})
+	})
+
+	// GET /verify returns a signed attestation of the current count so third
+	// parties can check a claimed number against the key published below.
+	// Both routes are public and only enabled when VERIFY_SIGNING_KEY is set.
+	if signingKey != nil {
+		mux.HandleFunc("/verify", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.Header().Set("Allow", "GET")
+				writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+				return
+			}
+			id := r.URL.Query().Get("id")
+			if rounding.step(id) > 1 { // an attestation of the exact count would defeat the rounding
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "counter is shown rounded; attestations are disabled for it"})
+				return
+			}
+			var hits core.Value
+			var err error
+			if id == "" && durable == nil {
+				hits = core.Uint(singleCounter.Get())
+			} else if hits, err = counters.Get(r.Context(), id); err != nil { // never sign a value that isn't the counter's
+				captureError(r, "(error) verify read failed: %v", err)
+				unavailable(w, nil)
+				return
+			}
+			signed, err := core.Sign(signingKey, core.Attestation{
+				ID:       id,
+				Hits:     hits,
+				IssuedAt: core.Now().UTC().Truncate(time.Second),
+				Issuer:   strings.TrimRight(os.Getenv("PUBLIC_URL"), "/"),
+			})
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "signing failed"})
+				return
+			}
+			writeJSON(w, http.StatusOK, signed)
+		})
+		mux.HandleFunc("/.well-known/nums-verify-key", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "public, max-age=3600")
+			writeJSON(w, http.StatusOK, core.NewPublicKeyDocument(signingKey.Public().(ed25519.PublicKey)))
+		})
+	}
+
+	// GET /changes?since=<cursor> lists counters changed after the cursor, newest
+	// first, as a flat JSON array (the shape Zapier/IFTTT polling triggers expect).
+	// Each item's "id" is unique per change; pass the largest "cursor" seen (also
+	// returned in X-Next-Cursor) as the next since.
+	mux.HandleFunc("/changes", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		if !authorize(secretToken, r) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		var since int64
+		if s := r.URL.Query().Get("since"); s != "" {
+			v, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || v < 0 {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "since must be a cursor returned by a previous call"})
+				return
+			}
+			since = v
+		}
+		limit := 100
+		if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 500 {
+			limit = l
+		}
+		type change struct {
+			ID        string     `json:"id"`
+			Counter   string     `json:"counter"`
+			Hits      core.Value `json:"hits"`
+			ChangedAt time.Time  `json:"changed_at"`
+			Cursor    int64      `json:"cursor"`
+		}
+		next := since
+		out := []change{}
+		for _, c := range changes.since(since, limit) {
+			out = append(out, change{
+				ID:        c.ID + "@" + strconv.FormatInt(c.Cursor, 10),
+				Counter:   c.ID,
+				Hits:      badgeCount(c.ID),
+				ChangedAt: time.UnixMicro(c.Cursor).UTC(),
+				Cursor:    c.Cursor,
+			})
+			next = c.Cursor // oldest first: the last is the next page's start
+		}
+		w.Header().Set("X-Next-Cursor", strconv.FormatInt(next, 10))
+		writeJSON(w, http.StatusOK, out)
+	})
+
+	// GET /public/aggregate publishes anonymized deployment-wide totals (opt-in via PUBLIC_AGGREGATE=1)
+	if os.Getenv("PUBLIC_AGGREGATE") == "1" {
+		agg := &aggregateCache{compute: func() core.Aggregate {
+			var a core.Aggregate
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			err := counters.(store.Lister).Each(ctx, func(id string, v core.Value) error {
+				if !isTestID(id) && !core.IsDayBucketID(id) {
+					a.Add(v)
+				}
+				return nil
+			})
+			if err != nil {
+				log.Printf("(warn) aggregate listing failed: %v", err)
+			}
+			if n := singleCounter.Get(); n > 0 && durable == nil {
+				a.Add(core.Uint(n))
+			}
+			a.GeneratedAt = time.Now().UTC()
+			return a
+		}}
+		mux.HandleFunc("/public/aggregate", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.Header().Set("Allow", "GET")
+				writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+				return
+			}
+			w.Header().Set("Cache-Control", "public, max-age=60")
+			writeJSON(w, http.StatusOK, agg.get())
+		})
+	}
+
+	// POST /mcp exposes get_count/increment/get_stats as Model Context Protocol tools
+	mcp := &mcpServer{readCount: readCount, increment: increment, milestones: milestones, frozen: frozen}
+	mux.HandleFunc("/mcp", func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(secretToken, r) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		mcp.ServeHTTP(w, r)
+	})
+
+	// resetCounter sets id back to zero, which needs a store with
+	// transactions, and returns the hits it held, read in the same
+	// transaction. The change log, metadata, unique visitors and read
+	// cache follow.
+	resetCounter := func(r *http.Request, id string) (uint64, error) {
+		res, err := counters.(store.Transactor).Apply(r.Context(), []store.Op{{Kind: store.OpInc, ID: id}, {Kind: store.OpSet, ID: id}})
+		if err != nil {
+			return 0, err
+		}
+		changes.record(id)
+		meta.reset(id, res[0])
+		uniques.reset(r, id)
+		cachePut(id, core.Uint(0))
+		return res[0], nil
+	}
+	if err := store.Supports(counters, store.FeatureTx); err != nil {
+		if len(resets.schedules()) > 0 {
+			log.Printf("(warn) RESET_SCHEDULE is ignored: %v", err)
+		}
+	} else {
+		go resets.run(resetCheck, leader, func(ctx context.Context, id string) (uint64, error) {
+			if frozen.has(id) {
+				return 0, fmt.Errorf("counter %s is frozen", id)
+			}
+			// a scheduled reset has no request of its own; it runs as a POST /reset
+			r, err := http.NewRequestWithContext(ctx, http.MethodPost, "/reset", nil)
+			if err != nil {
+				return 0, err
+			}
+			return resetCounter(r, id)
+		})
+	}
+
+	// POST /reset?id=foo sets a counter back to zero.
+	mux.HandleFunc("/reset", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if !authorizeID(r, id) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		if id == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "id is required"})
+			return
+		}
+		if frozen.has(id) {
+			writeJSON(w, http.StatusLocked, map[string]string{"error": "counter is frozen; unfreeze it with DELETE /admin/freeze first"})
+			return
+		}
+		if err := store.Supports(counters, store.FeatureTx); err != nil {
+			writeJSON(w, http.StatusNotImplemented, map[string]string{"error": err.Error()})
+			return
+		}
+		if isDryRun(r) {
+			writeJSON(w, http.StatusOK, map[string]any{"id": id, "hits": 0, "reset": true, "dryRun": true})
+			return
+		}
+		_, err := resetCounter(r, id)
+		switch {
+		case errors.Is(err, store.ErrNotInteger):
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		case err != nil:
+			captureError(r, "(error) reset failed: %v", err)
+			unavailable(w, web.Stale(lastStored, id))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"id": id, "hits": 0, "reset": true})
+	})
+
+	// DELETE /counter?id=foo soft-deletes a counter: it goes back to zero, and
+	// its hits are kept for DELETE_RETENTION so /counter/restore can undo it.
+	mux.HandleFunc("/counter", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			w.Header().Set("Allow", http.MethodDelete)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if !authorizeID(r, id) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		if id == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "id is required"})
+			return
+		}
+		if frozen.has(id) {
+			writeJSON(w, http.StatusLocked, map[string]string{"error": "counter is frozen; unfreeze it with DELETE /admin/freeze first"})
+			return
+		}
+		if err := store.Supports(counters, store.FeatureTx); err != nil {
+			writeJSON(w, http.StatusNotImplemented, map[string]string{"error": err.Error()})
+			return
+		}
+		if isDryRun(r) {
+			writeJSON(w, http.StatusOK, map[string]any{"id": id, "hits": 0, "deleted": true, "dryRun": true})
+			return
+		}
+		// zero it only if no hit came in since reading it, so every hit is kept
+		var prev uint64
+		var err error
+		var mismatch *store.MismatchError
+		for attempt := 0; attempt < 3; attempt++ {
+			var v core.Value
+			if v, err = counters.Get(r.Context(), id); err != nil {
+				break
+			}
+			if v.IsFloat() {
+				err = store.ErrNotInteger
+				break
+			}
+			prev = v.Uint64()
+			_, err = counters.(store.Transactor).Apply(r.Context(), []store.Op{{Kind: store.OpExpect, ID: id, N: prev}, {Kind: store.OpSet, ID: id}})
+			if !errors.As(err, &mismatch) {
+				break
+			}
+		}
+		switch {
+		case errors.Is(err, store.ErrNotInteger), errors.As(err, &mismatch):
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		case err != nil:
+			captureError(r, "(error) delete failed: %v", err)
+			unavailable(w, web.Stale(lastStored, id))
+			return
+		}
+		tomb, err := tombstones.add(r.Context(), id, prev)
+		if err != nil { // put the hits back rather than lose them
+			captureError(r, "(error) saving deleted counter failed: %v", err)
+			if _, err := counters.(store.Transactor).Apply(r.Context(), []store.Op{{Kind: store.OpInc, ID: id, N: prev}}); err != nil {
+				captureError(r, "(error) undoing delete failed: %v", fmt.Errorf("%s lost %d hits: %w", id, prev, err))
+			}
+			unavailable(w, web.Stale(lastStored, id))
+			return
+		}
+		changes.record(id)
+		meta.reset(id, prev)
+		uniques.reset(r, id)
+		cachePut(id, core.Uint(0))
+		writeJSON(w, http.StatusOK, map[string]any{"id": id, "hits": 0, "deleted": true, "restorable_until": tomb.RestorableUntil(tombstones.retention)})
+	})
+
+	// POST /counter/restore?id=foo undoes DELETE /counter within DELETE_RETENTION,
+	// adding the hits it held to any counted since.
+	mux.HandleFunc("/counter/restore", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if !authorizeID(r, id) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		if id == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "id is required"})
+			return
+		}
+		if frozen.has(id) {
+			writeJSON(w, http.StatusLocked, map[string]string{"error": "counter is frozen; unfreeze it with DELETE /admin/freeze first"})
+			return
+		}
+		lookup := tombstones.take
+		if isDryRun(r) {
+			lookup = tombstones.get
+		}
+		tomb, ok, err := lookup(r.Context(), id)
+		switch {
+		case err != nil:
+			captureError(r, "(error) reading deleted counter failed: %v", err)
+			unavailable(w, web.Stale(lastStored, id))
+			return
+		case !ok:
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "no deleted counter " + id + " to restore"})
+			return
+		}
+		if isDryRun(r) {
+			cur := readCount(r, id)
+			writeJSON(w, http.StatusOK, map[string]any{"id": id, "hits": cur.Add(tomb.Hits), "restored": true, "dryRun": true})
+			return
+		}
+		results, err := counters.(store.Transactor).Apply(r.Context(), []store.Op{{Kind: store.OpInc, ID: id, N: tomb.Hits}})
+		if err != nil {
+			captureError(r, "(error) restore failed: %v", err)
+			if err := tombstones.put(r.Context(), tomb); err != nil {
+				captureError(r, "(error) saving deleted counter failed: %v", fmt.Errorf("%s lost %d hits: %w", id, tomb.Hits, err))
+			}
+			unavailable(w, web.Stale(lastStored, id))
+			return
+		}
+		changes.record(id)
+		cachePut(id, core.Uint(results[0]))
+		writeJSON(w, http.StatusOK, map[string]any{"id": id, "hits": display(id, core.Uint(results[0])), "restored": true})
+	})
+
+	// resetNamespace sets the listed counters of namespace ns back to zero,
+	// 100 per transaction. Frozen and float counters are left as they are
+	// and listed in the response.
+	resetNamespace := func(w http.ResponseWriter, r *http.Request, ns string, hits map[string]core.Value, ids []string) {
+		if err := store.Supports(counters, store.FeatureTx); err != nil {
+			writeJSON(w, http.StatusNotImplemented, map[string]string{"error": err.Error()})
+			return
+		}
+		resetIDs := []string{}
+		var frozenIDs, floatIDs []string
+		for _, id := range ids {
+			switch {
+			case frozen.has(id):
+				frozenIDs = append(frozenIDs, id)
+			case hits[id].IsFloat():
+				floatIDs = append(floatIDs, id)
+			default:
+				resetIDs = append(resetIDs, id)
+			}
+		}
+		resp := map[string]any{"namespace": ns, "reset": resetIDs}
+		if len(frozenIDs) > 0 {
+			resp["frozen"] = frozenIDs
+		}
+		if len(floatIDs) > 0 {
+			resp["float"] = floatIDs
+		}
+		if isDryRun(r) {
+			resp["dryRun"] = true
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+		for start := 0; start < len(resetIDs); start += 100 {
+			batch := resetIDs[start:min(start+100, len(resetIDs))]
+			ops := make([]store.Op, len(batch))
+			for i, id := range batch {
+				ops[i] = store.Op{Kind: store.OpSet, ID: id}
+			}
+			if _, err := counters.(store.Transactor).Apply(r.Context(), ops); err != nil {
+				captureError(r, "(error) namespace reset failed: %v", err)
+				unavailable(w, map[string]any{"reset": resetIDs[:start]})
+				return
+			}
+			for _, id := range batch {
+				changes.record(id)
+				meta.reset(id, hits[id].Uint64())
+				uniques.reset(r, id)
+				cachePut(id, core.Uint(0))
+			}
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+
+	// GET /counter/meta?id=foo returns when the counter was created, last hit
+	// and last reset, and its lifetime hits next to the stored value
+	mux.HandleFunc("/counter/meta", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if !authorizeID(r, id) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		m := meta.get(id)
+		m.Hits = readCount(r, id)
+		writeJSON(w, http.StatusOK, m)
+	})
+
+	// /admin/set (or /set) corrects a counter. GET returns the value with an ETag; POST
+	// ?id=foo&value=N sets it, optionally only if it still matches If-Match
+	// (the ETag) or ?expected=N, answering 412 with the current value otherwise.
+	adminSet := func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+		if !authorizeID(r, id) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		if id == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "id is required"})
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			val := readCount(r, id)
+			w.Header().Set("ETag", strconv.Quote(val.String()))
+			writeJSON(w, http.StatusOK, map[string]any{"id": id, "hits": val})
+			return
+		case http.MethodPost, http.MethodPut:
+		default:
+			w.Header().Set("Allow", "GET, POST, PUT")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		if frozen.has(id) {
+			writeJSON(w, http.StatusLocked, map[string]string{"error": "counter is frozen; unfreeze it with DELETE /admin/freeze first"})
+			return
 		}
-	}
-
-	failFastRedis := os.Getenv("FAIL_FAST_REDIS") == "1"
-
-	singleCounter := &HitCounter{}
-	multi := NewMultiCounter()
-	var redisCounter *RedisCounter
-	if redisURL != "" {
-		rc, err := NewRedisCounter(redisURL, redisPrefix)
+		value, err := strconv.ParseUint(r.URL.Query().Get("value"), 10, 64)
 		if err != nil {
-			if failFastRedis {
-				log.Fatalf("redis init failed (FAIL_FAST_REDIS=1): %v", err)
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "value must be a non-negative integer"})
+			return
+		}
+		ops := []store.Op{{Kind: store.OpSet, ID: id, N: value}}
+		expected := r.URL.Query().Get("expected")
+		if m := strings.TrimSpace(r.Header.Get("If-Match")); m != "" && m != "*" {
+			expected = strings.Trim(strings.TrimPrefix(m, "W/"), `"`)
+		}
+		if expected != "" {
+			n, err := strconv.ParseUint(expected, 10, 64)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "If-Match/expected must be a counter value"})
+				return
 			}
-			log.Printf("(warn) redis disabled (init failed): %v", err)
-		} else {
-			redisCounter = rc
-			log.Printf("redis persistence enabled (prefix=%s, addr=%s)", rc.prefix, rc.client.Options().Addr)
+			ops = append([]store.Op{{Kind: store.OpExpect, ID: id, N: n}}, ops...)
 		}
-	}
-
-	// Load persisted value if configured
-	if persistFile != "" {
-		if v, err := loadCountFromFile(persistFile); err != nil {
-			log.Printf("(warn) could not load persisted count: %v", err)
-		} else {
-			atomic.StoreUint64(&singleCounter.count, v)
-			log.Printf("loaded count=%d from %s", v, persistFile)
+		if err := store.Supports(counters, store.FeatureTx); err != nil {
+			writeJSON(w, http.StatusNotImplemented, map[string]string{"error": err.Error()})
+			return
+		}
+		if isDryRun(r) {
+			writeJSON(w, http.StatusOK, map[string]any{"id": id, "hits": value, "dryRun": true})
+			return
+		}
+		prev := readCount(r, id)
+		_, err = counters.(store.Transactor).Apply(r.Context(), ops)
+		var mismatch *store.MismatchError
+		switch {
+		case errors.As(err, &mismatch):
+			w.Header().Set("ETag", strconv.Quote(strconv.FormatUint(mismatch.Current, 10)))
+			writeJSON(w, http.StatusPreconditionFailed, map[string]any{"error": "counter changed", "id": id, "hits": mismatch.Current})
+			return
+		case errors.Is(err, store.ErrNotInteger):
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		case err != nil:
+			captureError(r, "(error) admin set failed: %v", err)
+			unavailable(w, web.Stale(lastStored, id))
+			return
 		}
+		changes.record(id)
+		meta.reset(id, prev.Uint64())
+		cachePut(id, core.Uint(value))
+		w.Header().Set("ETag", strconv.Quote(strconv.FormatUint(value, 10)))
+		writeJSON(w, http.StatusOK, map[string]any{"id": id, "hits": value})
 	}
+	mux.HandleFunc("/admin/set", adminSet)
+	// POST /set seeds a counter, e.g. when migrating from another hit counter service
+	mux.HandleFunc("/set", adminSet)
 
-	mux := http.NewServeMux()
-
-	// POST /hit (or GET) increments the counter for given id and returns the new value
-	mux.HandleFunc("/hit", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost && r.Method != http.MethodGet {
-			w.Header().Set("Allow", "GET, POST")
+	// /admin/freeze lists (GET), freezes (POST ?id=) or unfreezes (DELETE ?id=)
+	// counters; frozen counters ignore hits and refuse /tx and /admin/set.
+	mux.HandleFunc("/admin/freeze", func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+		if !authorizeID(r, id) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if id != "" {
+				writeJSON(w, http.StatusOK, map[string]any{"id": id, "frozen": frozen.has(id)})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"frozen": frozen.list()})
+			return
+		case http.MethodPost, http.MethodDelete:
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
 			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
 			return
 		}
-		if !authorize(secretToken, r) {
-			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		if id == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "id is required"})
 			return
 		}
+		on := r.Method == http.MethodPost
+		if isDryRun(r) {
+			writeJSON(w, http.StatusOK, map[string]any{"id": id, "frozen": on, "dryRun": true})
+			return
+		}
+		if err := frozen.set(r.Context(), id, on); errors.Is(err, errFrozenByEnv) {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		} else if err != nil {
+			captureError(r, "(error) freeze failed: %v", err)
+			unavailable(w, nil)
+			return
+		}
+		settingChanged(id)
+		writeJSON(w, http.StatusOK, map[string]any{"id": id, "frozen": on, "hits": readCount(r, id)})
+	})
+
+	// /admin/round lists (GET) public rounding steps, sets one (POST ?id=&step=,
+	// step=0 shows the counter exactly) or removes an admin step (DELETE ?id=).
+	mux.HandleFunc("/admin/round", func(w http.ResponseWriter, r *http.Request) {
 		id := r.URL.Query().Get("id")
-		var newVal uint64
-		if redisCounter != nil { // persistent path
-			v, err := redisCounter.Inc(id)
-			if err != nil {
-				log.Printf("(error) redis incr failed, falling back to memory: %v", err)
-			} else {
-				newVal = v
+		if !authorizeID(r, id) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if id != "" {
+				val := readCount(r, id)
+				writeJSON(w, http.StatusOK, map[string]any{"id": id, "step": rounding.step(id), "hits": val, "public": display(id, val)})
+				return
 			}
+			writeJSON(w, http.StatusOK, map[string]any{"steps": rounding.list()})
+			return
+		case http.MethodPost, http.MethodDelete:
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
 		}
-		if newVal == 0 { // fallback / memory path
-			if id == "" { // legacy single counter path
-				newVal = singleCounter.Inc()
-				if persistFile != "" && redisCounter == nil { // only persist to file when not using redis
-					if err := saveCountToFile(persistFile, newVal); err != nil {
-						log.Printf("(warn) persist failed: %v", err)
-					}
-				}
-			} else {
-				newVal = multi.Inc(id)
+		if id == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "id is required"})
+			return
+		}
+		var step uint64
+		clear := r.Method == http.MethodDelete
+		if !clear {
+			var err error
+			if step, err = core.ParseRoundingStep(r.URL.Query().Get("step")); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
 			}
 		}
-		writeJSON(w, http.StatusOK, map[string]any{"id": id, "hits": newVal})
+		if isDryRun(r) {
+			writeJSON(w, http.StatusOK, map[string]any{"id": id, "step": step, "dryRun": true})
+			return
+		}
+		if err := rounding.set(r.Context(), id, step, clear); err != nil {
+			captureError(r, "(error) rounding update failed: %v", err)
+			unavailable(w, nil)
+			return
+		}
+		settingChanged(id)
+		val := readCount(r, id)
+		writeJSON(w, http.StatusOK, map[string]any{"id": id, "step": rounding.step(id), "hits": val, "public": display(id, val)})
 	})
 
-	// GET /count just returns current value without incrementing
-	mux.HandleFunc("/count", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			w.Header().Set("Allow", "GET")
+	// /admin/schedule lists (GET) scheduled resets, or one counter's with its
+	// archived resets, sets one (POST ?id=&every=daily, weekly, monthly or
+	// none) or removes an admin schedule (DELETE ?id=).
+	mux.HandleFunc("/admin/schedule", func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+		if !authorizeID(r, id) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		schedule := func(id string) map[string]any {
+			out := map[string]any{"id": id, "every": resets.every(id)}
+			if every := resets.every(id); every != "" {
+				out["next_reset"] = core.NextReset(every, core.Now()).UTC()
+			}
+			return out
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if id == "" {
+				writeJSON(w, http.StatusOK, map[string]any{"schedules": resets.schedules()})
+				return
+			}
+			history, err := resets.records(r.Context(), id)
+			if err != nil {
+				captureError(r, "(error) reset archive read failed: %v", err)
+				unavailable(w, nil)
+				return
+			}
+			resp := schedule(id)
+			resp["history"] = history
+			writeJSON(w, http.StatusOK, resp)
+			return
+		case http.MethodPost, http.MethodDelete:
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
 			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
 			return
 		}
-		if !authorize(secretToken, r) {
-			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		if id == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "id is required"})
+			return
+		}
+		if err := store.Supports(counters, store.FeatureTx); err != nil {
+			writeJSON(w, http.StatusNotImplemented, map[string]string{"error": err.Error()})
+			return
+		}
+		var code uint64
+		clear := r.Method == http.MethodDelete
+		if !clear {
+			var err error
+			if code, err = core.ResetCode(r.URL.Query().Get("every")); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		if isDryRun(r) {
+			writeJSON(w, http.StatusOK, map[string]any{"id": id, "every": core.ResetSchedule(code), "dryRun": true})
+			return
+		}
+		if err := resets.set(r.Context(), id, code, clear); err != nil {
+			captureError(r, "(error) reset schedule update failed: %v", err)
+			unavailable(w, nil)
 			return
 		}
+		writeJSON(w, http.StatusOK, schedule(id))
+	})
+
+	// /admin/offset lists (GET) display offsets, sets one (POST ?id=&offset=,
+	// e.g. hits carried over from an old counter) or removes one (DELETE ?id=).
+	// The stored count is never changed; only public reads add the offset.
+	mux.HandleFunc("/admin/offset", func(w http.ResponseWriter, r *http.Request) {
 		id := r.URL.Query().Get("id")
-		var val uint64
-		var err error
-		if redisCounter != nil {
-			val, err = redisCounter.Get(id)
-			if err != nil {
-				log.Printf("(error) redis get failed, falling back to memory: %v", err)
+		if !authorizeID(r, id) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if id != "" {
+				val := readCount(r, id)
+				writeJSON(w, http.StatusOK, map[string]any{"id": id, "offset": offsets.offset(id), "hits": val, "public": display(id, val)})
+				return
 			}
+			writeJSON(w, http.StatusOK, map[string]any{"offsets": offsets.list()})
+			return
+		case http.MethodPost, http.MethodDelete:
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
 		}
-		if redisCounter == nil || err != nil {
-			if id == "" {
-				val = singleCounter.Get()
-			} else {
-				val = multi.Get(id)
+		if id == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "id is required"})
+			return
+		}
+		var off uint64
+		clear := r.Method == http.MethodDelete
+		if !clear {
+			var err error
+			if off, err = core.ParseOffset(r.URL.Query().Get("offset")); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
 			}
 		}
-		// Support plain text output via format=txt
-		if f := r.URL.Query().Get("format"); f == "txt" || f == "text" {
-			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-			_, _ = w.Write([]byte(strconv.FormatUint(val, 10)))
+		if isDryRun(r) {
+			writeJSON(w, http.StatusOK, map[string]any{"id": id, "offset": off, "dryRun": true})
+			return
+		}
+		if err := offsets.set(r.Context(), id, off, clear); err != nil {
+			captureError(r, "(error) offset update failed: %v", err)
+			unavailable(w, nil)
 			return
 		}
-		writeJSON(w, http.StatusOK, map[string]any{"id": id, "hits": val})
+		settingChanged(id)
+		val := readCount(r, id)
+		writeJSON(w, http.StatusOK, map[string]any{"id": id, "offset": offsets.offset(id), "hits": val, "public": display(id, val)})
 	})
 
-	// GET /count.txt returns just the numeric count (no JSON) for easy custom badges
-	mux.HandleFunc("/count.txt", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			w.Header().Set("Allow", "GET")
-			w.WriteHeader(http.StatusMethodNotAllowed)
+	// /admin/webhooks manages per-counter webhook subscriptions (write token required)
+	mux.HandleFunc("/admin/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(secretToken, r) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
 			return
 		}
+		webhooks.ServeHTTP(w, r)
+	})
+
+	// /admin/clock shows (GET), moves (POST ?by=72h, or ?at=<RFC 3339> to jump)
+	// or resets (DELETE) the server clock; only with TIME_TRAVEL=1
+	mux.HandleFunc("/admin/clock", func(w http.ResponseWriter, r *http.Request) {
 		if !authorize(secretToken, r) {
-			w.WriteHeader(http.StatusUnauthorized)
-			_, _ = w.Write([]byte("unauthorized"))
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
 			return
 		}
-		id := r.URL.Query().Get("id")
-		var val uint64
-		var err error
-		if redisCounter != nil {
-			val, err = redisCounter.Get(id)
-			if err != nil {
-				log.Printf("(error) redis get failed, falling back to memory: %v", err)
-			}
+		if travel == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "time travel is off; start the server with TIME_TRAVEL=1"})
+			return
 		}
-		if redisCounter == nil || err != nil {
-			if id == "" {
-				val = singleCounter.Get()
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			if at := r.URL.Query().Get("at"); at != "" {
+				t, err := time.Parse(time.RFC3339, at)
+				if err != nil {
+					writeJSON(w, http.StatusBadRequest, map[string]string{"error": "at must be an RFC 3339 time, e.g. 2030-01-01T00:00:00Z"})
+					return
+				}
+				travel.Set(t)
 			} else {
-				val = multi.Get(id)
+				d, err := time.ParseDuration(r.URL.Query().Get("by"))
+				if err != nil {
+					writeJSON(w, http.StatusBadRequest, map[string]string{"error": "by must be a duration such as 72h or -30m"})
+					return
+				}
+				travel.Travel(d)
 			}
+		case http.MethodDelete:
+			travel.Reset()
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
 		}
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.Header().Set("Cache-Control", "no-cache")
-		_, _ = w.Write([]byte(strconv.FormatUint(val, 10)))
+		writeJSON(w, http.StatusOK, map[string]any{"now": core.Now().UTC().Truncate(time.Second), "offset": travel.Offset().Round(time.Second).String()})
 	})
 
-	// GET /badge produces an SVG badge for the given id (no increment)
-	mux.HandleFunc("/badge", func(w http.ResponseWriter, r *http.Request) {
+	// GET /admin/backend reports the durable store's circuit state (up, down
+	// or probing) and how many counters wait for replay
+	mux.HandleFunc("/admin/backend", func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(secretToken, r) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		if failover == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "failover is off (no durable store, or SECONDARY_STORAGE is set)"})
+			return
+		}
+		writeJSON(w, http.StatusOK, failover.Status())
+	})
+
+	// GET /admin/stats reports which badge styles and parameters this process
+	// has served since it started
+	mux.HandleFunc("/admin/stats", func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(secretToken, r) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"since": started, "badges": web.NewBadgeUsageReport(badgeUsage.Counts())})
+	})
+
+	// GET /metrics exposes the same badge usage counters to Prometheus
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			w.Header().Set("Allow", "GET")
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -297,44 +2391,148 @@ func main() {
 			_, _ = w.Write([]byte("unauthorized"))
 			return
 		}
-		id := r.URL.Query().Get("id")
-		if id == "" {
-			id = "default"
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = web.NewBadgeUsageReport(badgeUsage.Counts()).WriteMetrics(w)
+	})
+
+	// GET /counters lists every counter (or those in ?namespace=) with its
+	// metadata (first seen, last hit, lifetime hits), least recently hit
+	// first so stale counters stand out; DELETE /counters?namespace=blog
+	// resets every counter in a namespace, as DELETE /counter does for one
+	mux.HandleFunc("/counters", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+			w.Header().Set("Allow", "GET, DELETE")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
 		}
-		var count uint64
-		if redisCounter != nil {
-			if v, err := redisCounter.Get(id); err == nil {
-				count = v
-			}
+		ns, err := web.ParseNamespace(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
 		}
-		if count == 0 { // fallback to memory
-			count = multi.Get(id)
-			if id == "default" {
-				count = singleCounter.Get()
-			}
+		if !authorize(secretToken, r) && (ns == "" || !web.NamespaceAuthorized(nsTokens, r, ns)) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
 		}
-		label := r.URL.Query().Get("label")
-		if label == "" {
-			label = "hits"
+		if r.Method == http.MethodDelete && ns == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "namespace is required"})
+			return
 		}
-		color := r.URL.Query().Get("color")
-		if color == "" {
-			color = "blue"
+		hits, ok, err := listCounters(r.Context(), ns)
+		switch {
+		case !ok:
+			writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "this store cannot list counters"})
+			return
+		case err != nil:
+			captureError(r, "(error) counter listing failed: %v", err)
+			web.SetRetryAfter(w.Header(), retryAfter())
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+			return
 		}
-		style := r.URL.Query().Get("style") // reserved for future (e.g., flat, flat-square)
-		_ = style
-		svg := buildBadgeSVG(label, count, color)
-		w.Header().Set("Content-Type", "image/svg+xml;charset=utf-8")
-		w.Header().Set("Cache-Control", "no-cache")
-		_, _ = w.Write([]byte(svg))
+		ids := make([]string, 0, len(hits))
+		for id := range hits {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		if r.Method == http.MethodDelete {
+			resetNamespace(w, r, ns, hits, ids)
+			return
+		}
+		list := meta.getMany(ids)
+		for i := range list {
+			list[i].Hits = hits[list[i].ID]
+		}
+		core.SortByLastHit(list)
+		writeJSON(w, http.StatusOK, map[string]any{"counters": list})
+	})
+
+	// GET /admin/export lists every counter (or those in ?namespace=) as
+	// JSON ({"id": hits}) or as CSV (format=csv), without playground ids
+	mux.HandleFunc("/admin/export", func(w http.ResponseWriter, r *http.Request) {
+		ns, err := web.ParseNamespace(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if !authorize(secretToken, r) && (ns == "" || !web.NamespaceAuthorized(nsTokens, r, ns)) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		all, ok, err := listCounters(r.Context(), ns)
+		switch {
+		case !ok:
+			writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "this store cannot list counters"})
+			return
+		case err != nil:
+			captureError(r, "(error) export listing failed: %v", err)
+			web.SetRetryAfter(w.Header(), retryAfter())
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+			return
+		}
+		if r.URL.Query().Get("format") != "csv" {
+			writeJSON(w, http.StatusOK, all)
+			return
+		}
+		ids := make([]string, 0, len(all))
+		for id := range all {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"id", "hits"})
+		for _, id := range ids {
+			_ = cw.Write([]string{id, all[id].String()})
+		}
+		cw.Flush()
 	})
 
-	// Simple health endpoint
+	// Simple health endpoint. Nums-Leader tells whether this instance runs
+	// the background jobs; ?verbose=1 describes the election as JSON.
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Nums-Leader", strconv.FormatBool(leader.leading()))
+		if verbose, _ := strconv.ParseBool(r.URL.Query().Get("verbose")); verbose {
+			writeJSON(w, http.StatusOK, map[string]any{"ok": true, "leader": leader.status()})
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 	})
 
+	// GET /optout sets the cookie that stops /hit counting this browser (off=1 clears it)
+	mux.HandleFunc("/optout", func(w http.ResponseWriter, r *http.Request) {
+		on := r.URL.Query().Get("off") == ""
+		http.SetCookie(w, web.OptOutCookieFor(r, on))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write([]byte(web.OptOutPage(on)))
+	})
+
+	// GET /warm touches the durable store without counting a hit, for uptime
+	// pingers and crons (see KEEPALIVE_URL for a built-in one).
+	mux.HandleFunc("/warm", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		start := time.Now()
+		if durable != nil {
+			ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+			defer cancel()
+			if _, err := durable.Get(ctx, "default"); err != nil {
+				captureError(r, "(warn) warm failed: %v", err)
+				writeJSON(w, http.StatusServiceUnavailable, map[string]any{"ok": false, "error": err.Error()})
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "ms": time.Since(start).Milliseconds()})
+	})
+	if keepaliveURL := os.Getenv("KEEPALIVE_URL"); keepaliveURL != "" {
+		every, err := parseDurationEnv("KEEPALIVE_INTERVAL", 10*time.Minute)
+		if err != nil {
+			log.Fatalf("KEEPALIVE_INTERVAL: %v", err)
+		}
+		go keepAlive(keepaliveURL, every)
+		log.Printf("keep-alive pinging %s every %s", keepaliveURL, every)
+	}
+
 	// Determine allowed origins
 	var allowedOrigins []string
 	if allowedOriginsEnv == "" {
@@ -352,29 +2550,65 @@ func main() {
 	// Middleware chain: CORS + basic security headers
 	c := cors.New(cors.Options{
 		AllowedOrigins:   allowedOrigins,
-		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
-		AllowCredentials: false,
+		AllowCredentials: allowedOriginsEnv != "", // only the opt-out cookie; needs explicit origins, not "*"
+		ExposedHeaders:   append([]string{web.QuotaWarningHeader}, web.RateLimitHeaders...),
 		MaxAge:           300,
 	})
 
-	baseHandler := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	var app http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Security headers (lightweight)
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 		w.Header().Set("X-Frame-Options", "DENY")
 		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Nums-Environment", environment)
+		r, _ = web.PathID(r) // /hit/{id...} and /badge/{id...}
+		r, _ = web.NormalizeIDs(r)
+		if err := web.CheckIDs(r); err != nil { // only bucketHit writes day buckets
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if route, ok := web.ParseCompatRoute(r, compatRoutes); ok {
+			web.ServeCompatRoute(w, r, route, mux)
+			return
+		}
 		mux.ServeHTTP(w, r)
-	}))
+	})
+	// RATE_LIMIT (e.g. 120/m) caps requests per client; inside CORS so
+	// browsers can read the 429 and the headers
+	rateLimit, err := web.RateLimitFromEnv()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if rateLimit != nil {
+		app = (&rateLimiter{RateLimit: rateLimit, redis: redisCounter}).Middleware(app)
+		log.Printf("rate limit %d requests per %s per client", rateLimit.Limit, rateLimit.Window)
+	}
+	baseHandler := c.Handler(app)
+
+	handler := recoverer(baseHandler)
+	if sentryMiddleware := initSentry(); sentryMiddleware != nil {
+		handler = sentryMiddleware(handler)
+	}
+	smp, err := newSamplerFromEnv()
+	if err != nil {
+		log.Printf("(warn) request sampling disabled: %v", err)
+	} else if smp != nil {
+		handler = smp.Middleware(handler)
+		go smp.run()
+		log.Printf("request sampling enabled (rate=%.2f%%)", smp.rate*100)
+	}
 
 	srv := &http.Server{
 		Addr:              ":" + port,
-		Handler:           requestLogger(baseHandler),
+		Handler:           requestLogger(handler),
 		ReadHeaderTimeout: 5 * time.Second,
 		IdleTimeout:       60 * time.Second,
 	}
 
 	go func() {
-		log.Printf("hit counter server listening on :%s", port)
+		log.Printf("hit counter server listening on :%s (%s)", port, version)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("server error: %v", err)
 		}
@@ -385,36 +2619,37 @@ func main() {
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
 	log.Println("shutting down...")
+	close(stopping) // answer long polls now rather than after their wait
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Printf("graceful shutdown failed: %v", err)
 	}
+	if smp != nil {
+		smp.flush()
+	}
+	if history.redis != nil {
+		history.flush()
+	}
+	leader.resign()
+	if tiered != nil {
+		tiered.Close() // final write-behind flush
+	}
+	if snapshots != nil {
+		if err := snapshots.flush(); err != nil {
+			log.Printf("(warn) persist failed: %v", err)
+		}
+	}
+	if wal != nil {
+		if err := wal.Close(); err != nil {
+			log.Printf("(warn) close write-ahead log: %v", err)
+		}
+	}
+	flushSentry()
 	log.Println("bye")
 }
 
-// requestLogger logs minimal info about each request
-func requestLogger(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		lrw := &loggingResponseWriter{ResponseWriter: w, status: 200}
-		next.ServeHTTP(lrw, r)
-		dur := time.Since(start)
-		log.Printf("%s %s %d %s", r.Method, r.URL.Path, lrw.status, dur)
-	})
-}
-
-type loggingResponseWriter struct {
-	http.ResponseWriter
-	status int
-}
-
-func (l *loggingResponseWriter) WriteHeader(code int) {
-	l.status = code
-	l.ResponseWriter.WriteHeader(code)
-}
-
 // buildUpstashRedisURL normalizes various Upstash env var formats into a redis:// URL expected by go-redis
 // Accepts inputs like:
 //
@@ -443,93 +2678,45 @@ func buildUpstashRedisURL(rawHost, password string) string {
 	return u.String()
 }
 
-// getenv returns env var or fallback
-func getenv(k, def string) string {
-	if v, ok := os.LookupEnv(k); ok && v != "" {
-		return v
-	}
-	return def
-}
-
-// authorize checks secret token if configured. If secretToken is empty, always true.
-func authorize(secretToken string, r *http.Request) bool {
-	if secretToken == "" {
-		return true
-	}
-	// Header first
-	if h := r.Header.Get("X-Auth-Token"); h != "" && h == secretToken {
-		return true
-	}
-	// Query param fallback (?token=...)
-	if q := r.URL.Query().Get("token"); q != "" && q == secretToken {
-		return true
-	}
-	return false
-}
-
-// loadCountFromFile reads a uint64 from a file.
-func loadCountFromFile(path string) (uint64, error) {
-	b, err := os.ReadFile(path)
+// newArchive wraps the Redis store in an idle-counter archive: ARCHIVE_URL
+// (file:///dir or s3://bucket/prefix), ARCHIVE_IDLE_MONTHS (default 6, a
+// month being 30 days) and ARCHIVE_SWEEP_INTERVAL (default 24h). Only the
+// leader sweeps.
+func newArchive(rc *store.RedisCounter, archiveURL string, leader *leaderElection) *store.Archive {
+	cold, err := store.NewColdStore(archiveURL)
 	if err != nil {
-		return 0, err
+		log.Fatalf("ARCHIVE_URL: %v", err)
 	}
-	if len(b) == 0 {
-		return 0, nil
+	months, err := strconv.Atoi(getenv("ARCHIVE_IDLE_MONTHS", "6"))
+	if err != nil || months < 1 {
+		log.Fatalf("ARCHIVE_IDLE_MONTHS must be a positive integer")
 	}
-	v, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	every, err := parseDurationEnv("ARCHIVE_SWEEP_INTERVAL", 24*time.Hour)
 	if err != nil {
-		return 0, fmt.Errorf("parse persisted count: %w", err)
-	}
-	return v, nil
-}
-
-// saveCountToFile writes the count to file atomically (best-effort).
-func saveCountToFile(path string, val uint64) error {
-	tmp := path + ".tmp"
-	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(val, 10)), 0o600); err != nil {
-		return err
+		log.Fatalf("ARCHIVE_SWEEP_INTERVAL: %v", err)
 	}
-	return os.Rename(tmp, path)
+	a := store.NewArchive(rc, cold, time.Duration(months)*30*24*time.Hour)
+	go a.Run(every, leader.leading)
+	log.Printf("archiving counters idle for %d months to %s (sweep every %s)", months, archiveURL, every)
+	return a
 }
 
-// buildBadgeSVG generates a minimal static-width SVG badge (simple style)
-func buildBadgeSVG(label string, count uint64, color string) string {
-	// Basic size heuristics
-	textVal := strconv.FormatUint(count, 10)
-	labelWidth := 6*len(label) + 10
-	valWidth := 6*len(textVal) + 10
-	total := labelWidth + valWidth
-	// Very lightweight; no external fonts
-	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
-<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">
-<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
-<rect rx="3" width="%d" height="20" fill="#555"/>
-<rect rx="3" x="%d" width="%d" height="20" fill="%s"/>
-<rect rx="3" width="%d" height="20" fill="url(#s)"/>
-<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
-<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text>
-<text x="%d" y="15">%s</text>
-<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text>
-<text x="%d" y="15">%s</text>
-</g>
-</svg>`,
-		total, label, textVal,
-		total, labelWidth, valWidth, color,
-		total,
-		labelWidth/2, label,
-		labelWidth/2, label,
-		labelWidth+valWidth/2, textVal,
-		labelWidth+valWidth/2, textVal,
-	)
-}
-
-// Example of how you might parse a seed initial value from env
-func init() {
-	if seedStr := os.Getenv("INITIAL_HIT_COUNT"); seedStr != "" {
-		if seed, err := strconv.ParseUint(seedStr, 10, 64); err == nil {
-			// Use unsafe pointer; easier: just store globally and set after main constructs counter
-			// Simplicity: let main ignore seed; advanced: redesign HitCounter to accept seed.
-			log.Printf("(info) seed %d provided but not applied (extend HitCounter for persistence)", seed)
+// keepAlive GETs url every interval so hosts that idle out quiet instances
+// (and the serverless deployment, if url points there) stay warm. Point it
+// at a /warm route so pings are never counted as hits.
+func keepAlive(url string, every time.Duration) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for range t.C {
+		resp, err := client.Get(url)
+		if err != nil {
+			log.Printf("(warn) keep-alive ping failed: %v", err)
+			continue
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("(warn) keep-alive ping: %s", resp.Status)
 		}
 	}
 }
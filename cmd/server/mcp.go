@@ -0,0 +1,180 @@
+//go:build !minimal
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/web"
+)
+
+// mcpProtocolVersion is the Model Context Protocol revision implemented by /mcp.
+const mcpProtocolVersion = "2025-06-18"
+
+// mcpServer exposes counter operations as MCP tools over the streamable HTTP
+// transport (JSON-RPC 2.0 requests POSTed to /mcp, plain JSON responses, no
+// server-initiated streams), so agents and chat-ops bots can query and update
+// counters through a standard tool interface.
+type mcpServer struct {
+	readCount  func(r *http.Request, id string) core.Value
+	increment  func(r *http.Request, id string) uint64
+	milestones *milestoneLog
+	frozen     *frozenSet
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// JSON-RPC error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+func idSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id": map[string]any{"type": "string", "description": "Counter id, e.g. \"home\" or \"blog/post-1\""},
+		},
+		"required": []string{"id"},
+	}
+}
+
+var mcpTools = []mcpTool{
+	{Name: "get_count", Description: "Read the current value of a counter without changing it.", InputSchema: idSchema()},
+	{Name: "increment", Description: "Record one hit on a counter and return the new value.", InputSchema: idSchema()},
+	{Name: "get_stats", Description: "Current value, milestones reached so far and projected upcoming milestones for a counter.", InputSchema: idSchema()},
+}
+
+func (m *mcpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		// No server-initiated SSE stream is offered.
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	var req rpcRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{rpcParseError, "parse error"}})
+		return
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		writeJSON(w, http.StatusBadRequest, rpcResponse{JSONRPC: "2.0", ID: nullIfEmpty(req.ID), Error: &rpcError{rpcInvalidRequest, "invalid request"}})
+		return
+	}
+	if len(req.ID) == 0 { // notification (e.g. notifications/initialized): nothing to answer
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	result, rerr := m.dispatch(r, req)
+	writeJSON(w, http.StatusOK, rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rerr})
+}
+
+func nullIfEmpty(id json.RawMessage) json.RawMessage {
+	if len(id) == 0 {
+		return json.RawMessage("null")
+	}
+	return id
+}
+
+func (m *mcpServer) dispatch(r *http.Request, req rpcRequest) (any, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		return map[string]any{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]string{"name": "nums", "version": "1.0.0"},
+			"instructions":    "Hit counter service. Use get_count to read, increment to record a view, get_stats for milestones.",
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return map[string]any{"tools": mcpTools}, nil
+	case "tools/call":
+		var p struct {
+			Name      string `json:"name"`
+			Arguments struct {
+				ID string `json:"id"`
+			} `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, &rpcError{rpcInvalidParams, "invalid params"}
+		}
+		return m.callTool(r, p.Name, web.NormalizeID(p.Arguments.ID))
+	}
+	return nil, &rpcError{rpcMethodNotFound, "method not found: " + req.Method}
+}
+
+// callTool runs a tool. Tool-level failures are reported in the result
+// (isError) as the protocol expects, not as JSON-RPC errors.
+func (m *mcpServer) callTool(r *http.Request, name, id string) (any, *rpcError) {
+	if id == "" {
+		return toolResult(map[string]string{"error": "id is required"}, true), nil
+	}
+	if err := web.CheckID(id); err != nil {
+		return toolResult(map[string]string{"error": err.Error()}, true), nil
+	}
+	switch name {
+	case "get_count":
+		return toolResult(map[string]any{"id": id, "hits": m.readCount(r, id)}, false), nil
+	case "increment":
+		if m.frozen.has(id) {
+			return toolResult(map[string]any{"error": "counter is frozen", "id": id, "hits": m.readCount(r, id)}, true), nil
+		}
+		return toolResult(map[string]any{"id": id, "hits": m.increment(r, id)}, false), nil
+	case "get_stats":
+		cur := m.readCount(r, id)
+		events := m.milestones.list(id)
+		if events == nil {
+			events = []core.MilestoneEvent{}
+		}
+		type projection struct {
+			Milestone uint64    `json:"milestone"`
+			ETA       time.Time `json:"eta"`
+		}
+		projected := []projection{}
+		for _, p := range core.ProjectMilestones(events, cur.Uint64(), core.Now(), 3) {
+			projected = append(projected, projection{p.Milestone, p.At.UTC().Truncate(time.Second)})
+		}
+		return toolResult(map[string]any{"id": id, "hits": cur, "milestones": events, "projected": projected}, false), nil
+	}
+	return nil, &rpcError{rpcInvalidParams, fmt.Sprintf("unknown tool %q", name)}
+}
+
+func toolResult(v any, isError bool) map[string]any {
+	text, _ := json.Marshal(v)
+	return map[string]any{
+		"content":           []map[string]string{{"type": "text", "text": string(text)}},
+		"structuredContent": v,
+		"isError":           isError,
+	}
+}
@@ -0,0 +1,113 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+)
+
+// metaLog tracks when each counter was created, last hit and reset, and its
+// lifetime hits, in Redis when available (hash "meta:<prefix><id>") and in
+// memory otherwise. Playground counters are not tracked.
+type metaLog struct {
+	redis *store.RedisCounter // nil when Redis is not configured
+
+	mu sync.Mutex
+	m  map[string]core.CounterMeta
+}
+
+func newMetaLog(rc *store.RedisCounter) *metaLog {
+	return &metaLog{redis: rc, m: make(map[string]core.CounterMeta)}
+}
+
+// hit records n hits that took id from prev to prev+n.
+func (l *metaLog) hit(id string, prev, n uint64) {
+	l.record(id, func(ctx context.Context, at time.Time) error {
+		return l.redis.RecordHit(ctx, id, prev, n, at)
+	}, func(m *core.CounterMeta, at time.Time) { m.Hit(prev, n, at) })
+}
+
+// reset records that id was reset or overwritten while holding prev.
+func (l *metaLog) reset(id string, prev uint64) {
+	l.record(id, func(ctx context.Context, at time.Time) error {
+		return l.redis.RecordReset(ctx, id, prev, at)
+	}, func(m *core.CounterMeta, at time.Time) { m.Reset(prev, at) })
+}
+
+func (l *metaLog) record(id string, remote func(context.Context, time.Time) error, local func(*core.CounterMeta, time.Time)) {
+	if isTestID(id) {
+		return
+	}
+	if id == "" {
+		id = "default"
+	}
+	at := core.Now().UTC()
+	if l.redis != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err := remote(ctx, at)
+		cancel()
+		if err == nil {
+			return
+		}
+		log.Printf("(warn) redis counter metadata failed, keeping in memory: %v", err)
+	}
+	l.mu.Lock()
+	m := l.m[id]
+	local(&m, at)
+	l.m[id] = m
+	l.mu.Unlock()
+}
+
+// get returns the recorded metadata for id, without Hits.
+func (l *metaLog) get(id string) core.CounterMeta {
+	if id == "" {
+		id = "default"
+	}
+	if l.redis != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		m, err := l.redis.Meta(ctx, id)
+		if err == nil {
+			return m
+		}
+		log.Printf("(warn) redis counter metadata read failed, using memory: %v", err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	m := l.m[id]
+	m.ID = id
+	return m
+}
+
+// getMany returns the recorded metadata of several counters, like get.
+func (l *metaLog) getMany(ids []string) []core.CounterMeta {
+	if l.redis != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		out := make([]core.CounterMeta, 0, len(ids))
+		var err error
+		for start := 0; start < len(ids) && err == nil; start += 500 {
+			var ms []core.CounterMeta
+			ms, err = l.redis.MetaMany(ctx, ids[start:min(start+500, len(ids))])
+			out = append(out, ms...)
+		}
+		if err == nil {
+			return out
+		}
+		log.Printf("(warn) redis counter metadata read failed, using memory: %v", err)
+	}
+	out := make([]core.CounterMeta, len(ids))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, id := range ids {
+		out[i] = l.m[id]
+		out[i].ID = id
+	}
+	return out
+}
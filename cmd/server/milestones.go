@@ -0,0 +1,96 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+)
+
+// maxMilestones bounds the events kept per counter.
+const maxMilestones = 50
+
+// milestoneLog records milestone crossings per id, in Redis when available
+// (list "milestones:<prefix><id>", newest first) and in memory otherwise.
+type milestoneLog struct {
+	redis *store.RedisCounter // nil when Redis is not configured
+
+	mu sync.Mutex
+	m  map[string][]core.MilestoneEvent // newest first
+}
+
+func newMilestoneLog(rc *store.RedisCounter) *milestoneLog {
+	return &milestoneLog{redis: rc, m: make(map[string][]core.MilestoneEvent)}
+}
+
+func (l *milestoneLog) redisKey(id string) string {
+	return "milestones:" + l.redis.Key(id)
+}
+
+// record stores an event for each milestone crossed going from prev to next.
+// Playground counters are skipped.
+func (l *milestoneLog) record(id string, prev, next uint64) {
+	if isTestID(id) {
+		return
+	}
+	if id == "" {
+		id = "default"
+	}
+	crossed := core.MilestonesCrossed(prev, next)
+	if len(crossed) == 0 {
+		return
+	}
+	now := core.Now().UTC()
+	for _, m := range crossed {
+		e := core.MilestoneEvent{ID: id, Milestone: m, At: now}
+		if l.redis != nil {
+			b, _ := json.Marshal(e)
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			pipe := l.redis.Client().TxPipeline()
+			pipe.LPush(ctx, l.redisKey(id), b)
+			pipe.LTrim(ctx, l.redisKey(id), 0, maxMilestones-1)
+			_, err := pipe.Exec(ctx)
+			cancel()
+			if err == nil {
+				continue
+			}
+			log.Printf("(warn) redis milestone record failed, keeping in memory: %v", err)
+		}
+		l.mu.Lock()
+		events := append([]core.MilestoneEvent{e}, l.m[id]...)
+		if len(events) > maxMilestones {
+			events = events[:maxMilestones]
+		}
+		l.m[id] = events
+		l.mu.Unlock()
+	}
+}
+
+// list returns recorded events for id, newest first.
+func (l *milestoneLog) list(id string) []core.MilestoneEvent {
+	if l.redis != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		raw, err := l.redis.Client().LRange(ctx, l.redisKey(id), 0, -1).Result()
+		if err == nil {
+			events := make([]core.MilestoneEvent, 0, len(raw))
+			for _, s := range raw {
+				var e core.MilestoneEvent
+				if json.Unmarshal([]byte(s), &e) == nil {
+					events = append(events, e)
+				}
+			}
+			return events
+		}
+		log.Printf("(warn) redis milestone list failed, using memory: %v", err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]core.MilestoneEvent(nil), l.m[id]...)
+}
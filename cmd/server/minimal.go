@@ -0,0 +1,265 @@
+//go:build minimal
+
+// The minimal build (go build -tags minimal ./cmd/server) is for TinyGo and
+// embedded targets where only memory counters, optionally kept in WAL_PATH or
+// PERSIST_FILE, are needed. Redis and the other databases, webhooks, Sentry,
+// request sampling, CORS and the admin and MCP routes are left out, so the
+// binary depends on nothing beyond the standard library.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+	"github.com/advayc/nums/web"
+)
+
+// settings are the flags of the minimal build; see config.go.
+var settings = commonSettings
+
+// durableChoices is empty: nums init only offers memory counters here.
+var durableChoices []storageChoice
+
+func checkStorage(name string) error { return nil }
+
+func runMigrateKeys([]string) { log.Fatal("migrate-keys: the minimal build has no Redis") }
+
+func main() {
+	runSubcommand(os.Args[1:])
+	loadConfig(os.Args[1:], settings)
+	port := getenv("PORT", "8080")
+	secretToken := os.Getenv("SECRET_TOKEN")
+	excludeToken := os.Getenv("EXCLUDE_TOKEN")
+	devHosts := web.DevHostsFromEnv()
+	persistFile := dataPath("PERSIST_FILE", "")
+	frozen := web.FrozenIDsFromEnv()
+	rounding, err := web.RoundingFromEnv()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	offsets, err := web.DisplayOffsetsFromEnv()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	badgeMins, err := web.BadgeMinFromEnv()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	maxHitBy, err := web.MaxHitByFromEnv()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := web.CompatFromEnv(); err != nil { // COMPAT: another hit counter's response keys
+		log.Fatalf("%v", err)
+	}
+	if _, err := web.IDNormFromEnv(); err != nil { // ID_NORMALIZE: NFC and case-folded ids
+		log.Fatalf("%v", err)
+	}
+	if _, err := web.TrustProxyFromEnv(0); err != nil { // TRUST_PROXY: take client IPs from X-Forwarded-For
+		log.Fatalf("%v", err)
+	}
+
+	multi := store.NewMultiCounter()
+	var counters store.Store = multi
+	var wal *store.WAL
+	if walPath := dataPath("WAL_PATH", ""); walPath != "" {
+		wal = openWAL(multi, walPath)
+		counters = wal
+		go wal.Janitor(time.Minute)
+	} else {
+		go multi.Janitor(time.Minute)
+	}
+	gauges := newGaugeTypes(nil) // type of each gauge, fixed at its first write
+	var snapshots *snapshotWriter
+	if persistFile != "" {
+		snap, err := loadSnapshot(persistFile)
+		if err != nil {
+			log.Fatalf("PERSIST_FILE: %v", err)
+		}
+		restoreSnapshot(counters, snap)
+		log.Printf("loaded %d counters from %s", len(snap), persistFile)
+		snapshots = startSnapshots(persistFile, func() map[string]core.Value { return snapshotOf(counters) })
+	}
+
+	// display offsets (DISPLAY_OFFSETS) and rounds (ROUND_COUNTS) a stored
+	// value for public reads
+	display := func(id string, v core.Value) core.Value {
+		step, ok := rounding[id]
+		if !ok {
+			step = rounding[core.RoundingDefault]
+		}
+		return v.Offset(offsets[id]).Round(step)
+	}
+	publicCount := func(r *http.Request, id string) core.Value {
+		if id == "" {
+			id = "default"
+		}
+		v, _ := counters.Get(r.Context(), id)
+		return display(id, v)
+	}
+
+	mux := http.NewServeMux()
+
+	// POST /hit (or GET) increments the counter for given id and returns the new value
+	mux.HandleFunc("/hit", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET, POST")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		if !authorize(secretToken, r) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			id = "default"
+		}
+		if frozen[id] {
+			web.WriteCounter(w, r, web.Counter{ID: id, Hits: publicCount(r, id), Frozen: true})
+			return
+		}
+		if web.Excluded(r, excludeToken) || web.FromDevHost(r, devHosts) {
+			web.WriteCounter(w, r, web.Counter{ID: id, Hits: publicCount(r, id), Excluded: true})
+			return
+		}
+		if kind, by, err := web.ParseGauge(r); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		} else if kind != "" {
+			if err := gauges.claim(r.Context(), id, kind); err != nil {
+				writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+				return
+			}
+			n, err := counters.(store.FloatIncrementer).IncFloat(r.Context(), id, by)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+			web.WriteCounter(w, r, web.Counter{ID: id, Hits: display(id, core.Float(n))})
+			return
+		}
+		by, err := web.ParseHitBy(r, maxHitBy)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		ttl, err := web.ParseTTL(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		n, err := counters.(store.Adder).IncBy(r.Context(), id, by)
+		if errors.Is(err, store.ErrNotInteger) { // a gauge or float counter
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		resp := web.Counter{ID: id, Hits: display(id, core.Uint(n)), Test: isTestID(id)}
+		if ttl > 0 && n == by && counters.(store.Expirer).Expire(r.Context(), id, ttl) == nil {
+			at := core.Now().Add(ttl).UTC().Truncate(time.Second)
+			resp.ExpiresAt = &at
+		}
+		web.WriteCounter(w, r, resp)
+	})
+
+	// GET /count returns the current value as JSON (format=txt for plain text)
+	mux.HandleFunc("/count", func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(secretToken, r) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		id := r.URL.Query().Get("id")
+		val := publicCount(r, id)
+		if f := r.URL.Query().Get("format"); f == "txt" || f == "text" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte(val.String()))
+			return
+		}
+		web.WriteCounter(w, r, web.Counter{ID: id, Hits: val})
+	})
+
+	// GET /count.txt returns just the numeric count
+	mux.HandleFunc("/count.txt", func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(secretToken, r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("unauthorized"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(publicCount(r, r.URL.Query().Get("id")).String()))
+	})
+
+	// GET /badge produces an SVG badge for the given id (no increment)
+	mux.HandleFunc("/badge", func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(secretToken, r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("unauthorized"))
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			id = "default"
+		}
+		w.Header().Set("Content-Type", "image/svg+xml;charset=utf-8")
+		_, _ = w.Write([]byte(renderBadge(r, formatBadgeValue(r, publicCount(r, id), badgeMin(r, badgeMins, id)))))
+	})
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	srv := &http.Server{
+		Addr: ":" + port,
+		Handler: requestLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.Header().Set("Cache-Control", "no-cache")
+			r, _ = web.PathID(r) // /hit/{id...} and /badge/{id...}
+			r, _ = web.NormalizeIDs(r)
+			if err := web.CheckIDs(r); err != nil { // reserved for day buckets
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			mux.ServeHTTP(w, r)
+		})),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		log.Printf("hit counter server (minimal build) listening on :%s (%s)", port, version)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+	log.Println("shutting down...")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = srv.Shutdown(ctx)
+	if snapshots != nil {
+		if err := snapshots.flush(); err != nil {
+			log.Printf("(warn) persist failed: %v", err)
+		}
+	}
+	if wal != nil {
+		if err := wal.Close(); err != nil {
+			log.Printf("(warn) close write-ahead log: %v", err)
+		}
+	}
+	log.Println("bye")
+}
@@ -0,0 +1,18 @@
+//go:build !chaos && !minimal
+
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/advayc/nums/store"
+)
+
+// withChaos returns s: fault injection is only built with -tags chaos.
+func withChaos(s store.Store) store.Store {
+	if os.Getenv("CHAOS_ERROR_RATE") != "" || os.Getenv("CHAOS_LATENCY") != "" {
+		log.Printf("(warn) CHAOS_* ignored: this build has no fault injection (build with -tags chaos)")
+	}
+	return s
+}
@@ -0,0 +1,31 @@
+//go:build !minimal
+
+package main
+
+import (
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+	"github.com/advayc/nums/web"
+)
+
+// offsetTable holds each counter's display offset: hits carried over from an
+// older counter that are added to public reads while the stored count stays
+// as recorded. Offsets come from DISPLAY_OFFSETS and /admin/offset; admin
+// entries are kept in the "offsets" settings table.
+type offsetTable struct{ *idTable }
+
+func newOffsetTable(settings store.Settings) (*offsetTable, error) {
+	fixed, err := web.DisplayOffsetsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return &offsetTable{newIDTable("offsets", settings, fixed, false)}, nil
+}
+
+// offset returns id's display offset (0 for none).
+func (t *offsetTable) offset(id string) uint64 { return t.get(id) }
+
+// apply returns v with id's display offset added.
+func (t *offsetTable) apply(id string, v core.Value) core.Value {
+	return v.Offset(t.offset(id))
+}
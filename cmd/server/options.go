@@ -0,0 +1,83 @@
+//go:build !minimal
+
+package main
+
+// settings are the flags of the full server; see config.go.
+var settings = append(commonSettings[:len(commonSettings):len(commonSettings)],
+	setting{env: "ALLOWED_ORIGINS", usage: "comma-separated CORS origins (default *)"},
+	setting{env: "ENVIRONMENT", usage: "environment name; non-production ones get their own keyspace (default production)"},
+	setting{env: "NAMESPACE_TOKENS", usage: "tokens scoped to id namespaces, e.g. blog=s3cret,acme/docs=t0ken"},
+	setting{env: "NAMESPACE_QUOTAS", usage: "counters and daily hits per namespace, e.g. blog=counters:100+hits:10000"},
+	setting{env: "QUOTA_WARN_AT", usage: "percent of a namespace quota at which hits carry warnings (default 80)"},
+	setting{env: "REDIS_URL", usage: "Redis URL (redis:// or rediss://)"},
+	setting{env: "REDIS_PREFIX", usage: "Redis key prefix (default hits:)"},
+	setting{env: "REDIS_KEY_LAYOUT", usage: "Redis key layout: v1 (default) or v2, which versions every key and migrates v1 keys"},
+	setting{env: "REDIS_USERNAME", usage: "Redis ACL username"},
+	setting{env: "REDIS_PASSWORD", usage: "Redis password"},
+	setting{env: "REDIS_TLS", usage: "connect to Redis over TLS", toggle: true},
+	setting{env: "REDIS_MAX_RETRIES", usage: "Redis command retries (default 5)"},
+	setting{env: "REDIS_SENTINEL_ADDRS", usage: "comma-separated Redis Sentinel addresses"},
+	setting{env: "REDIS_SENTINEL_MASTER", usage: "Redis Sentinel master name"},
+	setting{env: "REDIS_SENTINEL_PASSWORD", usage: "Redis Sentinel password"},
+	setting{env: "REDIS_CLUSTER_ADDRS", usage: "comma-separated Redis Cluster addresses"},
+	setting{env: "UPSTASH_REDIS_URL", usage: "Upstash Redis host:port"},
+	setting{env: "UPSTASH_REDIS_PASSWORD", usage: "Upstash Redis password"},
+	setting{env: "FAIL_FAST_REDIS", usage: "exit at startup if Redis is unreachable", toggle: true},
+	setting{env: "LEADER_TTL", usage: "lease of the instance that runs scheduled resets, purges and archive sweeps (default 15s)"},
+	setting{env: "INSTANCE_ID", usage: "this instance's name in leader election (default hostname and a random suffix)"},
+	setting{env: "STORAGE", usage: "durable store without Redis: sqlite, bolt, firestore, etcd or postgres"},
+	setting{env: "SQLITE_DSN", usage: "SQLite database file for STORAGE=sqlite"},
+	setting{env: "BOLT_PATH", usage: "bbolt file for STORAGE=bolt (default nums.db)"},
+	setting{env: "SETTINGS_FILE", usage: "JSON file admin settings are kept in when the store has no place for them"},
+	setting{env: "DATABASE_URL", usage: "PostgreSQL URL"},
+	setting{env: "ETCD_ENDPOINTS", usage: "comma-separated etcd endpoints for STORAGE=etcd"},
+	setting{env: "ETCD_PREFIX", usage: "etcd key prefix (default nums/)"},
+	setting{env: "ETCD_USERNAME", usage: "etcd username"},
+	setting{env: "ETCD_PASSWORD", usage: "etcd password"},
+	setting{env: "ETCD_CACERT", usage: "etcd CA certificate file"},
+	setting{env: "ETCD_CERT", usage: "etcd client certificate file"},
+	setting{env: "ETCD_KEY", usage: "etcd client key file"},
+	setting{env: "FIRESTORE_PROJECT", usage: "Google Cloud project for STORAGE=firestore (default detected)"},
+	setting{env: "FIRESTORE_DATABASE", usage: "named Firestore database"},
+	setting{env: "FIRESTORE_COLLECTION", usage: "Firestore collection (default nums)"},
+	setting{env: "SECONDARY_STORAGE", usage: "second store every change is also written to (a STORAGE value)"},
+	setting{env: "REPLICA_RECONCILE_INTERVAL", usage: "how often the two stores are compared (default 5m)"},
+	setting{env: "TIER_MODE", usage: "write-through or write-behind (default write-through)"},
+	setting{env: "TIER_CACHE_TTL", usage: "serve reads from memory for this long (default 0)"},
+	setting{env: "TIER_FLUSH_INTERVAL", usage: "write-behind flush period (default 1s)"},
+	setting{env: "READ_CACHE_TTL", usage: "serve public reads from an in-memory LRU for this long (default 0, off)"},
+	setting{env: "READ_CACHE_SIZE", usage: "counters kept in the read cache (default 10000)"},
+	setting{env: "FAILOVER_THRESHOLD", usage: "failed calls in a row before the store is considered down (default 3)"},
+	setting{env: "FAILOVER_COOLDOWN", usage: "how often a down store is retried (default 5s)"},
+	setting{env: "TIME_TRAVEL", usage: "let /admin/clock move the server clock (testing only)", toggle: true},
+	setting{env: "ARCHIVE_URL", usage: "object storage URL idle Redis counters are archived to"},
+	setting{env: "ARCHIVE_IDLE_MONTHS", usage: "months without hits before a counter is archived (default 6)"},
+	setting{env: "ARCHIVE_SWEEP_INTERVAL", usage: "how often idle counters are archived (default 24h)"},
+	setting{env: "DEDUPE", usage: "visitor identity per counter, e.g. home=ipua,*=cookie"},
+	setting{env: "DEDUPE_WINDOW", usage: "count a visitor once per window, then per-identity windows, e.g. 24h,anon=30m (default 24h)"},
+	setting{env: "DEDUPE_SECRET", usage: "key that signs the signed identity's cookie (default SECRET_TOKEN)"},
+	setting{env: "IDEMPOTENCY_WINDOW", usage: "how long /hit Idempotency-Key deliveries are remembered (default 24h)"},
+	setting{env: "DELETE_RETENTION", usage: "how long DELETE /counter can be undone (default 30d)"},
+	setting{env: "UNIQUES", usage: "counters whose unique visitors are counted in Redis, e.g. home,blog or *"},
+	setting{env: "DAY_BUCKETS", usage: "also count hits per UTC day for period reads; 0 turns it off (default 1)"},
+	setting{env: "COMPAT_ROUTES", usage: "badge URLs of other hit counters to answer: hitsdotsh, seeyoufarm, visitorbadge or *"},
+	setting{env: "GROUPS", usage: "counter groups that /count?group= adds up, e.g. blog=blog/*,landing=home+pricing"},
+	setting{env: "MAX_VALUES", usage: "counter maximums and overflow policies, e.g. quota=1000,api=500:clamp"},
+	setting{env: "RESET_SCHEDULE", usage: "counters reset every UTC day, week or month, e.g. today=daily,week=weekly"},
+	setting{env: "RATE_LIMIT", usage: "requests per client and window, e.g. 120/m (default unlimited)"},
+	setting{env: "PUBLIC_URL", usage: "base URL used in /snippets and as the /verify issuer"},
+	setting{env: "PUBLIC_AGGREGATE", usage: "serve anonymized stats at /public/aggregate", toggle: true},
+	setting{env: "VERIFY_SIGNING_KEY", usage: "base64 Ed25519 seed for /verify"},
+	setting{env: "KEEPALIVE_URL", usage: "URL to ping so the host keeps the instance warm"},
+	setting{env: "KEEPALIVE_INTERVAL", usage: "keep-alive period (default 10m)"},
+	setting{env: "HISTORY_INTERVAL", usage: "how often counter values are snapshotted for /history (default 1h, 0 for off)"},
+	setting{env: "HISTORY_RETENTION", usage: "how long /history snapshots are kept (default 90d)"},
+	setting{env: "WEBHOOKS", usage: "JSON array of webhook subscriptions"},
+	setting{env: "WEBHOOK_SECRET", usage: "HMAC secret for webhook signatures"},
+	setting{env: "PANIC_WEBHOOK_URL", usage: "URL recovered panics are POSTed to"},
+	setting{env: "SENTRY_DSN", usage: "report errors and panics to Sentry"},
+	setting{env: "SENTRY_ENVIRONMENT", usage: "Sentry environment (default production)"},
+	setting{env: "SENTRY_TRACES_SAMPLE_RATE", usage: "Sentry performance sample rate, 0 to 1 (default 0)"},
+	setting{env: "SAMPLE_RATE", usage: "percent of requests to record for traffic analysis"},
+	setting{env: "SAMPLE_SINK", usage: "where samples go: file://, https:// or s3://"},
+)
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+)
+
+// PERSIST_FILE holds a JSON object of every in-memory counter by id, with the
+// legacy single counter under "default":
+//
+//	{"default": 1234, "blog": 56, "downloads-mb": 7.5}
+//
+// Files written by older versions hold just the single counter's number;
+// loadSnapshot reads both.
+
+// loadSnapshot reads PERSIST_FILE. A missing or empty file is an empty snapshot.
+func loadSnapshot(path string) (map[string]core.Value, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]core.Value{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return map[string]core.Value{}, nil
+	}
+	if b[0] != '{' { // legacy format: the single counter only
+		v, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse persisted count: %w", err)
+		}
+		return map[string]core.Value{"default": core.Uint(v)}, nil
+	}
+	var snap map[string]core.Value
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return nil, fmt.Errorf("parse persisted counters: %w", err)
+	}
+	return snap, nil
+}
+
+// snapshotWriter writes PERSIST_FILE every interval when the counters changed,
+// so bursts of hits cost one write.
+type snapshotWriter struct {
+	path    string
+	collect func() map[string]core.Value
+
+	mu   sync.Mutex
+	last []byte // contents of the last successful write
+}
+
+// flush writes the snapshot if it differs from the last one written.
+func (s *snapshotWriter) flush() error {
+	b, err := json.Marshal(s.collect())
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if bytes.Equal(b, s.last) {
+		return nil
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.last = b
+	return nil
+}
+
+// run flushes every interval (runs for the process lifetime).
+func (s *snapshotWriter) run(every time.Duration) {
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for range tick.C {
+		if err := s.flush(); err != nil {
+			log.Printf("(warn) persist failed: %v", err)
+		}
+	}
+}
+
+// startSnapshots writes collect's counters to path every PERSIST_DEBOUNCE
+// (default 1s) when they changed.
+func startSnapshots(path string, collect func() map[string]core.Value) *snapshotWriter {
+	every, err := parseDurationEnv("PERSIST_DEBOUNCE", time.Second)
+	if err != nil {
+		log.Fatalf("PERSIST_DEBOUNCE: %v", err)
+	}
+	s := &snapshotWriter{path: path, collect: collect}
+	go s.run(every)
+	return s
+}
+
+// restoreSnapshot fills the counters in s that are still empty from snap, so
+// newer WAL_PATH values win.
+func restoreSnapshot(s store.Store, snap map[string]core.Value) {
+	setter := s.(interface {
+		Set(ctx context.Context, id string, v core.Value) error
+	})
+	ctx := context.Background()
+	for id, v := range snap {
+		if cur, _ := s.Get(ctx, id); cur.IsZero() {
+			_ = setter.Set(ctx, id, v)
+		}
+	}
+}
+
+// snapshotOf lists every counter in s except playground ones.
+func snapshotOf(s store.Store) map[string]core.Value {
+	snap := make(map[string]core.Value)
+	_ = s.(store.Lister).Each(context.Background(), func(id string, v core.Value) error {
+		if !isTestID(id) {
+			snap[id] = v
+		}
+		return nil
+	})
+	return snap
+}
+
+// openWAL replays and keeps appending to the write-ahead log at path
+// (WAL_FSYNC=1 also fsyncs every record), compacting it hourly.
+func openWAL(multi *store.MultiCounter, path string) *store.WAL {
+	fsync, _ := strconv.ParseBool(os.Getenv("WAL_FSYNC"))
+	wal, err := store.OpenWAL(multi, path, fsync)
+	if err != nil {
+		log.Fatalf("WAL_PATH: %v", err)
+	}
+	go wal.Compactor(time.Hour)
+	log.Printf("write-ahead log enabled (%s)", path)
+	return wal
+}
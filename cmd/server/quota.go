@@ -0,0 +1,95 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+	"github.com/advayc/nums/web"
+)
+
+// namespaceQuotas enforces NAMESPACE_QUOTAS on /hit: how many counters each
+// namespace may have and how many hits it may get per UTC day. With Redis
+// the usage is shared by every instance (see store.RedisCounter.TakeQuota);
+// otherwise it is kept in memory, where a restart starts it over.
+type namespaceQuotas struct {
+	quotas map[string]core.Quota
+	warnAt uint64 // QUOTA_WARN_AT
+	redis  *store.RedisCounter
+
+	mu       sync.Mutex
+	counters map[string]map[string]bool // namespace -> its counters
+	hits     map[string]uint64          // namespace + day -> hits
+}
+
+func newNamespaceQuotas(rc *store.RedisCounter) (*namespaceQuotas, error) {
+	quotas, warnAt, err := web.NamespaceQuotasFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return &namespaceQuotas{
+		quotas:   quotas,
+		warnAt:   warnAt,
+		redis:    rc,
+		counters: make(map[string]map[string]bool),
+		hits:     make(map[string]uint64),
+	}, nil
+}
+
+// take records n hits on id against the quotas of the namespaces it is in,
+// returning their usage after the hit or a *core.QuotaError for the first
+// quota that refuses it. Namespaces taken before the refusing one keep the
+// hit.
+func (q *namespaceQuotas) take(ctx context.Context, id string, n uint64) ([]core.QuotaUsage, error) {
+	var usage []core.QuotaUsage
+	day := core.Now().UTC().Format("20060102")
+	for _, ns := range core.QuotaNamespaces(q.quotas, id) {
+		u, err := q.takeOne(ctx, ns, id, day, n)
+		if err != nil {
+			return nil, err
+		}
+		usage = append(usage, u...)
+	}
+	return usage, nil
+}
+
+func (q *namespaceQuotas) takeOne(ctx context.Context, ns, id, day string, n uint64) ([]core.QuotaUsage, error) {
+	quota := q.quotas[ns]
+	if q.redis != nil {
+		return q.redis.TakeQuota(ctx, ns, id, day, n, quota)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ids := q.counters[ns]
+	if ids == nil {
+		ids = make(map[string]bool)
+		q.counters[ns] = ids
+	}
+	for key := range q.hits { // only today's hits count
+		if !strings.HasSuffix(key, day) {
+			delete(q.hits, key)
+		}
+	}
+	counters, hits := uint64(len(ids)), q.hits[ns+":"+day]
+	if quota.Counters > 0 && !ids[id] {
+		if counters >= quota.Counters {
+			return quota.Take(ns, 1, counters, hits)
+		}
+		counters++
+	}
+	if quota.Hits > 0 && hits+n > quota.Hits {
+		return quota.Take(ns, 2, counters, hits)
+	}
+	if quota.Counters > 0 {
+		ids[id] = true
+	}
+	if quota.Hits > 0 {
+		hits += n
+		q.hits[ns+":"+day] = hits
+	}
+	return quota.Take(ns, 0, counters, hits)
+}
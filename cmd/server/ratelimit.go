@@ -0,0 +1,50 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+	"github.com/advayc/nums/web"
+)
+
+// rateLimiter applies web.RateLimit to every request except CORS preflights
+// and /healthz. With Redis each client's window is shared by every instance
+// (store.RedisCounter.RateWindow); otherwise it is counted in memory.
+type rateLimiter struct {
+	*web.RateLimit
+	redis *store.RedisCounter // nil when Redis is not configured
+}
+
+// used counts r and returns how many requests its client made this window.
+func (l *rateLimiter) used(r *http.Request, reset time.Time) int64 {
+	client := web.ClientIP(r)
+	if l.redis != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+		defer cancel()
+		n, err := l.redis.RateWindow(ctx, client, reset, l.Window)
+		if err == nil {
+			return n
+		}
+		log.Printf("(warn) redis rate limit failed, counting in memory: %v", err)
+	}
+	return l.Take(client, core.Now())
+}
+
+func (l *rateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || r.URL.Path == "/healthz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		reset := l.Reset(core.Now())
+		if l.Allow(w, l.used(r, reset), reset) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// PanicReport describes a recovered handler panic handed to the reporting hook.
+type PanicReport struct {
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Error  string    `json:"error"`
+	Stack  string    `json:"stack"`
+	Time   time.Time `json:"time"`
+
+	Request   *http.Request `json:"-"`
+	Recovered any           `json:"-"` // the value passed to panic
+}
+
+// panicHook is called (if non-nil) for every recovered panic. It defaults to a
+// JSON webhook when PANIC_WEBHOOK_URL is set; other reporters (Sentry, Rollbar)
+// can replace it at startup.
+var panicHook func(PanicReport)
+
+func init() {
+	if u := os.Getenv("PANIC_WEBHOOK_URL"); u != "" {
+		panicHook = webhookPanicReporter(u)
+	}
+}
+
+// webhookPanicReporter posts each report as JSON to url (best-effort, async)
+func webhookPanicReporter(url string) func(PanicReport) {
+	client := &http.Client{Timeout: 3 * time.Second}
+	return func(p PanicReport) {
+		body, err := json.Marshal(p)
+		if err != nil {
+			return
+		}
+		go func() {
+			resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+			if err != nil {
+				log.Printf("(warn) panic webhook failed: %v", err)
+				return
+			}
+			_ = resp.Body.Close()
+		}()
+	}
+}
+
+// recoverer turns handler panics into a logged stack trace and a JSON 500
+// instead of dropping the connection.
+func recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler { // deliberate abort; let net/http handle it
+				panic(rec)
+			}
+			stack := debug.Stack()
+			log.Printf("(error) panic serving %s %s: %v\n%s", r.Method, r.URL.Path, rec, stack)
+			if panicHook != nil {
+				panicHook(PanicReport{
+					Method: r.Method,
+					Path:   r.URL.Path,
+					Error:  fmt.Sprint(rec),
+					Stack:  string(stack),
+					Time:   time.Now().UTC(),
+
+					Request:   r,
+					Recovered: rec,
+				})
+			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
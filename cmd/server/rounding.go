@@ -0,0 +1,30 @@
+//go:build !minimal
+
+package main
+
+import (
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+	"github.com/advayc/nums/web"
+)
+
+// roundingTable holds each counter's public rounding step. Steps come from
+// ROUND_COUNTS and /admin/round; an admin entry (0 meaning exact) overrides
+// ROUND_COUNTS for its id and is kept in the "rounding" settings table.
+type roundingTable struct{ *idTable }
+
+func newRoundingTable(settings store.Settings) (*roundingTable, error) {
+	fixed, err := web.RoundingFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return &roundingTable{newIDTable("rounding", settings, fixed, true)}, nil
+}
+
+// step returns id's public rounding step (0 for exact).
+func (t *roundingTable) step(id string) uint64 { return t.get(id) }
+
+// public returns v as it may be shown publicly for id.
+func (t *roundingTable) public(id string, v core.Value) core.Value {
+	return v.Round(t.step(id))
+}
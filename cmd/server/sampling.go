@@ -0,0 +1,246 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/web"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// sampleRecord is one sampled request. It deliberately carries no client IP,
+// cookies, auth token or full referrer URL (only the referrer host).
+type sampleRecord struct {
+	Time        time.Time         `json:"time"`
+	Method      string            `json:"method"`
+	Path        string            `json:"path"`
+	Query       map[string]string `json:"query,omitempty"`
+	Status      int               `json:"status"`
+	DurationMs  float64           `json:"duration_ms"`
+	RefererHost string            `json:"referer_host,omitempty"`
+	UserAgent   string            `json:"user_agent,omitempty"`
+}
+
+// sampleSink receives batches of sampled records.
+type sampleSink interface {
+	Write(ctx context.Context, batch []sampleRecord) error
+}
+
+// sampler buffers sampled records and flushes them to the sink in batches.
+type sampler struct {
+	rate float64 // 0..1
+	sink sampleSink
+
+	mu  sync.Mutex
+	buf []sampleRecord
+}
+
+const (
+	sampleBatchSize     = 100
+	sampleFlushInterval = 30 * time.Second
+)
+
+// newSamplerFromEnv builds a sampler from SAMPLE_RATE (percent of requests,
+// 0-100) and SAMPLE_SINK. Supported sinks:
+//
+//	file:///var/log/nums-samples.jsonl   append JSON lines to a local file
+//	https://example.com/ingest            POST each batch as a JSON array
+//	s3://bucket/prefix                    one JSON-lines object per batch (standard AWS credentials)
+//
+// Returns nil when sampling is disabled.
+func newSamplerFromEnv() (*sampler, error) {
+	rateStr := os.Getenv("SAMPLE_RATE")
+	sinkURL := os.Getenv("SAMPLE_SINK")
+	if rateStr == "" || sinkURL == "" {
+		return nil, nil
+	}
+	pct, err := strconv.ParseFloat(strings.TrimSuffix(rateStr, "%"), 64)
+	if err != nil || pct <= 0 || pct > 100 {
+		return nil, fmt.Errorf("SAMPLE_RATE must be a percentage in (0,100], got %q", rateStr)
+	}
+	sink, err := newSampleSink(sinkURL)
+	if err != nil {
+		return nil, err
+	}
+	return &sampler{rate: pct / 100, sink: sink}, nil
+}
+
+func newSampleSink(raw string) (sampleSink, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse SAMPLE_SINK: %w", err)
+	}
+	switch u.Scheme {
+	case "file":
+		return &fileSink{path: u.Path}, nil
+	case "http", "https":
+		return &webhookSink{url: raw, client: &http.Client{Timeout: 5 * time.Second}}, nil
+	case "s3":
+		cfg, err := awsconfig.LoadDefaultConfig(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("load aws config: %w", err)
+		}
+		prefix := strings.Trim(u.Path, "/")
+		if prefix != "" {
+			prefix += "/"
+		}
+		return &s3Sink{client: s3.NewFromConfig(cfg), bucket: u.Host, prefix: prefix}, nil
+	}
+	return nil, fmt.Errorf("unsupported SAMPLE_SINK scheme %q", u.Scheme)
+}
+
+// Middleware records a sample of requests after they are served.
+func (s *sampler) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rand.Float64() >= s.rate {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		lrw := &loggingResponseWriter{ResponseWriter: w, status: 200}
+		next.ServeHTTP(lrw, r)
+		rec := sampleRecord{
+			Time:       start.UTC(),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Status:     lrw.status,
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+			UserAgent:  r.UserAgent(),
+		}
+		for k, v := range r.URL.Query() {
+			if web.SecretParam(k) || len(v) == 0 {
+				continue
+			}
+			if rec.Query == nil {
+				rec.Query = make(map[string]string)
+			}
+			rec.Query[k] = v[0]
+		}
+		if ref, err := url.Parse(r.Referer()); err == nil {
+			rec.RefererHost = ref.Host
+		}
+		s.add(rec)
+	})
+}
+
+func (s *sampler) add(rec sampleRecord) {
+	s.mu.Lock()
+	s.buf = append(s.buf, rec)
+	full := len(s.buf) >= sampleBatchSize
+	s.mu.Unlock()
+	if full {
+		go s.flush()
+	}
+}
+
+// flush writes buffered records to the sink (best-effort; failures are logged and dropped).
+func (s *sampler) flush() {
+	s.mu.Lock()
+	batch := s.buf
+	s.buf = nil
+	s.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.sink.Write(ctx, batch); err != nil {
+		log.Printf("(warn) sample sink write failed (%d records dropped): %v", len(batch), err)
+	}
+}
+
+// run flushes periodically; call flush once more at shutdown.
+func (s *sampler) run() {
+	t := time.NewTicker(sampleFlushInterval)
+	defer t.Stop()
+	for range t.C {
+		s.flush()
+	}
+}
+
+func encodeJSONLines(batch []sampleRecord) []byte {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, rec := range batch {
+		_ = enc.Encode(rec)
+	}
+	return b.Bytes()
+}
+
+type fileSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (f *fileSink) Write(_ context.Context, batch []sampleRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fh, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fh.Write(encodeJSONLines(batch)); err != nil {
+		_ = fh.Close()
+		return err
+	}
+	return fh.Close()
+}
+
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (h *webhookSink) Write(ctx context.Context, batch []sampleRecord) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+type s3Sink struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func (s *s3Sink) Write(ctx context.Context, batch []sampleRecord) error {
+	now := time.Now().UTC()
+	key := fmt.Sprintf("%s%s/%d.jsonl", s.prefix, now.Format("2006/01/02"), now.UnixNano())
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(encodeJSONLines(batch)),
+		ContentType: aws.String("application/x-ndjson"),
+	})
+	return err
+}
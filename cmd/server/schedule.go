@@ -0,0 +1,144 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+)
+
+// resetScheduler resets counters such as "views today" at the start of
+// every UTC day, week or month and archives the hits they held. Schedules
+// come from RESET_SCHEDULE and /admin/schedule (kept like rounding steps, as
+// core reset codes, in the "resetschedule" settings table). With Redis, the period each counter was last reset for
+// (hash "resetperiods:<prefix>") and its archive (list
+// "resets:<prefix><id>") are shared, so one instance resets it; otherwise
+// both live in memory until restart.
+type resetScheduler struct {
+	*idTable
+	redis *store.RedisCounter // nil when Redis is not configured
+
+	mu      sync.Mutex
+	last    map[string]time.Time          // without Redis
+	archive map[string][]core.ResetRecord // likewise, newest first
+}
+
+// resetCheck is how often schedules are checked, which bounds how late
+// after midnight UTC a counter is reset.
+const resetCheck = time.Minute
+
+func newResetScheduler(rc *store.RedisCounter, settings store.Settings) (*resetScheduler, error) {
+	fixed, err := core.ParseResetSchedules(os.Getenv("RESET_SCHEDULE"))
+	if err != nil {
+		return nil, fmt.Errorf("RESET_SCHEDULE: %w", err)
+	}
+	return &resetScheduler{
+		idTable: newIDTable("resetschedule", settings, fixed, false),
+		redis:   rc,
+		last:    make(map[string]time.Time),
+		archive: make(map[string][]core.ResetRecord),
+	}, nil
+}
+
+// every returns id's schedule, or "" for none.
+func (s *resetScheduler) every(id string) string { return core.ResetSchedule(s.get(id)) }
+
+// schedules returns every scheduled counter's schedule.
+func (s *resetScheduler) schedules() map[string]string {
+	out := make(map[string]string)
+	for id, code := range s.list() {
+		if every := core.ResetSchedule(code); every != "" {
+			out[id] = every
+		}
+	}
+	return out
+}
+
+// claim reports whether id is due for the reset of the period that began
+// at start; see store.RedisCounter.ClaimReset.
+func (s *resetScheduler) claim(ctx context.Context, id string, start time.Time) (bool, error) {
+	if s.redis != nil {
+		return s.redis.ClaimReset(ctx, id, start)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last, ok := s.last[id]
+	if ok && !last.Before(start) {
+		return false, nil
+	}
+	s.last[id] = start
+	return ok, nil
+}
+
+// record archives a reset.
+func (s *resetScheduler) record(ctx context.Context, rec core.ResetRecord) error {
+	if s.redis != nil {
+		return s.redis.ArchiveReset(ctx, rec)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	recs := append([]core.ResetRecord{rec}, s.archive[rec.ID]...)
+	s.archive[rec.ID] = recs[:min(len(recs), store.ResetHistoryMax)]
+	return nil
+}
+
+// records returns id's archived resets, newest first.
+func (s *resetScheduler) records(ctx context.Context, id string) ([]core.ResetRecord, error) {
+	if s.redis != nil {
+		return s.redis.ResetRecords(ctx, id)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]core.ResetRecord{}, s.archive[id]...), nil
+}
+
+// run resets each scheduled counter once its period has begun, every
+// interval, while this instance is the leader. reset sets a counter to zero
+// and returns the hits it held.
+func (s *resetScheduler) run(every time.Duration, leader *leaderElection, reset func(ctx context.Context, id string) (uint64, error)) {
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for {
+		if leader.leading() {
+			s.due(context.Background(), reset)
+		}
+		<-tick.C
+	}
+}
+
+func (s *resetScheduler) due(ctx context.Context, reset func(ctx context.Context, id string) (uint64, error)) {
+	scheduled := s.schedules()
+	ids := make([]string, 0, len(scheduled))
+	for id := range scheduled {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		now := core.Now().UTC()
+		start := core.ResetPeriodStart(scheduled[id], now)
+		ok, err := s.claim(ctx, id, start)
+		if err != nil {
+			log.Printf("(warn) scheduled reset of %s: %v", id, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		hits, err := reset(ctx, id)
+		if err != nil {
+			log.Printf("(error) scheduled reset of %s failed, it waits for the next period: %v", id, err)
+			continue
+		}
+		if err := s.record(ctx, core.ResetRecord{ID: id, Hits: hits, Every: scheduled[id], ResetAt: now}); err != nil {
+			log.Printf("(warn) archiving the %d hits of %s before its scheduled reset failed: %v", hits, id, err)
+		}
+	}
+}
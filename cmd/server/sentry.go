@@ -0,0 +1,121 @@
+//go:build !minimal
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/advayc/nums/store"
+	"github.com/advayc/nums/web"
+	"github.com/getsentry/sentry-go"
+	sentryhttp "github.com/getsentry/sentry-go/http"
+)
+
+// sentryEnabled is true once initSentry succeeded (SENTRY_DSN set and valid)
+var sentryEnabled bool
+
+// initSentry configures the Sentry SDK from env and returns a middleware that
+// opens a hub (and, when tracing is on, a transaction) per request. Returns
+// nil when SENTRY_DSN is not set.
+//
+//	SENTRY_DSN                 project DSN (required to enable)
+//	SENTRY_ENVIRONMENT         environment tag (default "production")
+//	SENTRY_TRACES_SAMPLE_RATE  0..1 fraction of requests traced (default 0)
+func initSentry() func(http.Handler) http.Handler {
+	dsn := os.Getenv("SENTRY_DSN")
+	if dsn == "" {
+		return nil
+	}
+	rate, _ := strconv.ParseFloat(os.Getenv("SENTRY_TRACES_SAMPLE_RATE"), 64)
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:              dsn,
+		Environment:      getenv("SENTRY_ENVIRONMENT", "production"),
+		EnableTracing:    rate > 0,
+		TracesSampleRate: rate,
+		BeforeSend: func(e *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+			return scrubSentryEvent(e)
+		},
+		BeforeSendTransaction: func(e *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+			return scrubSentryEvent(e)
+		},
+	})
+	if err != nil {
+		log.Printf("(warn) sentry disabled (init failed): %v", err)
+		return nil
+	}
+	sentryEnabled = true
+	log.Printf("sentry enabled (environment=%s, traces=%.2f)", getenv("SENTRY_ENVIRONMENT", "production"), rate)
+
+	// Panics are recovered by recoverer; forward them to Sentry alongside any existing hook.
+	prev := panicHook
+	panicHook = func(p PanicReport) {
+		if prev != nil {
+			prev(p)
+		}
+		hub := sentry.CurrentHub()
+		if p.Request != nil {
+			if h := sentry.GetHubFromContext(p.Request.Context()); h != nil {
+				hub = h
+			}
+		}
+		err, ok := p.Recovered.(error)
+		if !ok {
+			err = fmt.Errorf("panic: %v", p.Recovered)
+		}
+		hub.WithScope(func(scope *sentry.Scope) {
+			scope.SetContext("panic", sentry.Context{"stack": p.Stack})
+			hub.Recover(err)
+		})
+	}
+
+	h := sentryhttp.New(sentryhttp.Options{Repanic: true})
+	return h.Handle
+}
+
+// captureError logs err and reports it to Sentry (if enabled) using the
+// request-scoped hub so the event carries the request context.
+func captureError(r *http.Request, format string, err error) {
+	if errors.Is(err, store.ErrBackendDown) {
+		return // the failover logged the outage once when it began
+	}
+	log.Printf(format, err)
+	if !sentryEnabled {
+		return
+	}
+	hub := sentry.CurrentHub()
+	if r != nil {
+		if h := sentry.GetHubFromContext(r.Context()); h != nil {
+			hub = h
+		}
+	}
+	hub.CaptureException(fmt.Errorf(strings.TrimPrefix(format, "(error) "), err))
+}
+
+// flushSentry waits (bounded) for buffered events before exit.
+func flushSentry() {
+	if sentryEnabled {
+		sentry.Flush(2 * time.Second)
+	}
+}
+
+// scrubSentryEvent removes the tokens (web.SecretHeaders and
+// web.SecretParams) from captured request data.
+func scrubSentryEvent(e *sentry.Event) *sentry.Event {
+	if e == nil || e.Request == nil {
+		return e
+	}
+	for k := range e.Request.Headers {
+		if web.SecretHeader(k) {
+			e.Request.Headers[k] = "[Filtered]"
+		}
+	}
+	e.Request.QueryString = web.ScrubQuery(e.Request.QueryString)
+	return e
+}
@@ -0,0 +1,177 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+)
+
+// openSettings returns where admin changes to runtime settings are kept:
+// Redis (hashes "<table>:<prefix>"), else the durable store when it has a
+// settings table (SQLite, PostgreSQL, bbolt), else the JSON file
+// SETTINGS_FILE. It is nil when there is none, and admin changes last until
+// restart. Outside Redis, tables of a non-production environment are
+// prefixed like its counters.
+func openSettings(rc *store.RedisCounter, durable store.Store, envPrefix string) store.Settings {
+	if rc != nil {
+		return rc
+	}
+	var s store.Settings
+	if ds, ok := durable.(store.Settings); ok {
+		s = ds
+	} else if path := dataPath("SETTINGS_FILE", ""); path != "" {
+		fs, err := store.OpenFileSettings(path)
+		if err != nil {
+			log.Fatalf("SETTINGS_FILE: %v", err)
+		}
+		log.Printf("settings kept in %s", path)
+		s = fs
+	} else {
+		return nil
+	}
+	if envPrefix != "" {
+		return prefixedSettings{s, envPrefix}
+	}
+	return s
+}
+
+// prefixedSettings prefixes every table name.
+type prefixedSettings struct {
+	store.Settings
+	prefix string
+}
+
+func (p prefixedSettings) LoadSettings(ctx context.Context, table string) (map[string]string, error) {
+	return p.Settings.LoadSettings(ctx, p.prefix+table)
+}
+
+func (p prefixedSettings) PutSetting(ctx context.Context, table, key, value string) error {
+	return p.Settings.PutSetting(ctx, p.prefix+table, key, value)
+}
+
+func (p prefixedSettings) DeleteSetting(ctx context.Context, table, key string) error {
+	return p.Settings.DeleteSetting(ctx, p.prefix+table, key)
+}
+
+// idTable holds a per-counter number configured from the environment and
+// overridden by admin routes. The admin entries are kept in the settings
+// table name (id -> number; see openSettings), reloaded every idTableReload
+// so changes made on other instances apply; without a settings store they
+// live in memory until restart.
+type idTable struct {
+	name     string
+	settings store.Settings    // nil keeps admin entries in memory only
+	fixed    map[string]uint64 // from the environment
+	wildcard bool              // fixed[core.RoundingDefault] applies to ids without an entry
+
+	mu      sync.RWMutex
+	entries map[string]uint64
+}
+
+const idTableReload = 30 * time.Second
+
+func newIDTable(name string, settings store.Settings, fixed map[string]uint64, wildcard bool) *idTable {
+	t := &idTable{name: name, settings: settings, fixed: fixed, wildcard: wildcard, entries: make(map[string]uint64)}
+	if settings != nil {
+		if err := t.reload(context.Background()); err != nil {
+			log.Printf("(warn) load %s: %v", t.name, err)
+		}
+		go t.run(idTableReload)
+	}
+	return t
+}
+
+// get returns id's number: the admin entry, else the environment's.
+func (t *idTable) get(id string) uint64 {
+	if id == "" {
+		id = "default"
+	}
+	t.mu.RLock()
+	n, ok := t.entries[id]
+	t.mu.RUnlock()
+	if ok {
+		return n
+	}
+	if n, ok := t.fixed[id]; ok || !t.wildcard {
+		return n
+	}
+	return t.fixed[core.RoundingDefault]
+}
+
+// set stores an admin entry for id; clear removes it.
+func (t *idTable) set(ctx context.Context, id string, n uint64, clear bool) error {
+	if id == "" {
+		id = "default"
+	}
+	if t.settings != nil {
+		var err error
+		if clear {
+			err = t.settings.DeleteSetting(ctx, t.name, id)
+		} else {
+			err = t.settings.PutSetting(ctx, t.name, id, strconv.FormatUint(n, 10))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if clear {
+		delete(t.entries, id)
+	} else {
+		t.entries[id] = n
+	}
+	return nil
+}
+
+// list returns the effective number of every configured id.
+func (t *idTable) list() map[string]uint64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	out := make(map[string]uint64, len(t.fixed)+len(t.entries))
+	for id, n := range t.fixed {
+		out[id] = n
+	}
+	for id, n := range t.entries {
+		out[id] = n
+	}
+	return out
+}
+
+// reload replaces the admin entries with the stored ones.
+func (t *idTable) reload(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	raw, err := t.settings.LoadSettings(ctx, t.name)
+	if err != nil {
+		return err
+	}
+	entries := make(map[string]uint64, len(raw))
+	for id, s := range raw {
+		if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+			entries[id] = n
+		}
+	}
+	t.mu.Lock()
+	t.entries = entries
+	t.mu.Unlock()
+	return nil
+}
+
+// run reloads the table every interval so changes made on other instances apply.
+func (t *idTable) run(every time.Duration) {
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for range tick.C {
+		if err := t.reload(context.Background()); err != nil {
+			log.Printf("(warn) reload %s: %v", t.name, err)
+		}
+	}
+}
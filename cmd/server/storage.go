@@ -0,0 +1,140 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/advayc/nums/store"
+	"github.com/advayc/nums/store/bolt"
+	"github.com/advayc/nums/store/etcd"
+	"github.com/advayc/nums/store/firestore"
+	"github.com/advayc/nums/store/postgres"
+	"github.com/advayc/nums/store/sqlite"
+)
+
+// openStorage opens the durable backend called name (a STORAGE value, or
+// "postgres" for DATABASE_URL); setting names the environment variable in
+// errors. Startup fails if it cannot be opened.
+func openStorage(setting, name string) store.Store {
+	s, err := dialStorage(name)
+	if err != nil {
+		log.Fatalf("%s: %v", setting, err)
+	}
+	if j, ok := s.(interface{ Janitor(time.Duration) }); ok {
+		go j.Janitor(time.Minute)
+	}
+	switch name {
+	case "sqlite":
+		log.Printf("sqlite persistence enabled (%s)", os.Getenv("SQLITE_DSN"))
+	case "bolt":
+		log.Printf("bolt persistence enabled (%s)", dataPath("BOLT_PATH", "nums.db"))
+	case "firestore":
+		log.Printf("firestore persistence enabled (collection %s)", getenv("FIRESTORE_COLLECTION", "nums"))
+	case "etcd":
+		log.Printf("etcd persistence enabled (%s, prefix %s)", os.Getenv("ETCD_ENDPOINTS"), getenv("ETCD_PREFIX", "nums/"))
+	case "postgres":
+		log.Printf("postgres persistence enabled")
+	}
+	return s
+}
+
+// dialStorage connects to backend name using its environment settings.
+func dialStorage(name string) (store.Store, error) {
+	switch name {
+	case "sqlite":
+		db, err := sqlite.NewFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case "bolt":
+		db, err := bolt.Open(dataPath("BOLT_PATH", "nums.db"))
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case "firestore":
+		db, err := firestore.NewFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case "etcd":
+		db, err := etcd.OpenFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case "postgres":
+		databaseURL := os.Getenv("DATABASE_URL")
+		if databaseURL == "" {
+			return nil, fmt.Errorf("DATABASE_URL is not set")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		pg, err := postgres.Open(ctx, databaseURL)
+		if err != nil {
+			return nil, err
+		}
+		return pg, nil
+	}
+	return nil, fmt.Errorf("unknown storage %q (want sqlite, bolt, firestore, etcd or postgres)", name)
+}
+
+// durableChoices are the stores nums init offers besides memory.
+var durableChoices = []storageChoice{
+	{name: "redis", about: "Redis or Upstash; fastest, shared by every instance", ask: []question{
+		{env: "REDIS_URL", prompt: "Redis URL", def: "redis://127.0.0.1:6379"},
+	}},
+	{name: "sqlite", about: "a local SQLite file, no server needed", ask: []question{
+		{env: "SQLITE_DSN", prompt: "SQLite file", def: "nums.sqlite"},
+	}},
+	{name: "bolt", about: "a local bbolt file, single process only", ask: []question{
+		{env: "BOLT_PATH", prompt: "bbolt file", def: "nums.db"},
+	}},
+	{name: "postgres", about: "PostgreSQL", ask: []question{
+		{env: "DATABASE_URL", prompt: "PostgreSQL URL", def: "postgres://localhost/nums"},
+	}},
+	{name: "etcd", about: "an existing etcd cluster", ask: []question{
+		{env: "ETCD_ENDPOINTS", prompt: "etcd endpoints", def: "127.0.0.1:2379"},
+	}},
+	{name: "firestore", about: "Google Cloud Firestore (Application Default Credentials)", ask: []question{
+		{env: "FIRESTORE_PROJECT", prompt: "Google Cloud project (empty to detect)"},
+	}},
+}
+
+// checkStorage connects to the store nums init configured (its settings are
+// in the environment) and reads one counter.
+func checkStorage(name string) error {
+	var s store.Store
+	var err error
+	if name == "redis" {
+		cfg, cerr := store.RedisConfigFromEnv(os.Getenv("REDIS_URL"))
+		if cerr != nil {
+			return cerr
+		}
+		layout, lerr := store.RedisLayoutFromEnv()
+		if lerr != nil {
+			return lerr
+		}
+		s, err = store.NewRedisCounterFromConfig(cfg, store.LayoutPrefix(layout, getenv("REDIS_PREFIX", "hits:")))
+	} else {
+		s, err = dialStorage(name)
+	}
+	if err != nil {
+		return err
+	}
+	if c, ok := s.(io.Closer); ok {
+		defer c.Close()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = s.Get(ctx, "default")
+	return err
+}
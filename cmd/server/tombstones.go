@@ -0,0 +1,243 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+	"github.com/advayc/nums/web"
+)
+
+// tombstoneTable keeps the counters soft-deleted by DELETE /counter until
+// DELETE_RETENTION passes, so POST /counter/restore can bring them back.
+// With Redis they are the hash "deleted:<prefix>", shared by every
+// instance. Otherwise they are the settings table "deleted" (each a JSON
+// core.Tombstone), kept next to the counts by sqlite, bolt and postgres or in
+// SETTINGS_FILE, and only without either in memory until restart. A janitor
+// deletes expired ones for good.
+type tombstoneTable struct {
+	redis     *store.RedisCounter // nil when Redis is not configured
+	settings  store.Settings      // without Redis; nil keeps tombstones in memory
+	durable   store.Store         // without Redis, where purged counters are deleted
+	leader    *leaderElection
+	retention time.Duration
+
+	mu sync.Mutex // serializes changes to the settings table or m
+	m  map[string]core.Tombstone
+}
+
+// tombstoneJanitor is how often expired tombstones are purged.
+const tombstoneJanitor = time.Hour
+
+func newTombstoneTable(rc *store.RedisCounter, settings store.Settings, durable store.Store, leader *leaderElection) (*tombstoneTable, error) {
+	retention, err := web.DeleteRetentionFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	t := &tombstoneTable{redis: rc, leader: leader, retention: retention, m: make(map[string]core.Tombstone)}
+	if rc == nil {
+		t.settings, t.durable = settings, durable
+	}
+	go t.janitor(tombstoneJanitor)
+	return t, nil
+}
+
+// add records that id was deleted holding hits. Deleting a counter again
+// before it is restored adds to the hits kept and restarts the window.
+func (t *tombstoneTable) add(ctx context.Context, id string, hits uint64) (core.Tombstone, error) {
+	tomb := core.Tombstone{ID: id, Hits: hits, DeletedAt: core.Now().UTC()}
+	if t.redis != nil {
+		return t.redis.AddTombstone(ctx, tomb)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	prev, ok, err := t.load(ctx, id)
+	if err != nil {
+		return core.Tombstone{}, err
+	}
+	if ok {
+		tomb.Hits += prev.Hits
+	}
+	return tomb, t.save(ctx, tomb)
+}
+
+// put saves tomb back, e.g. after a restore failed to apply.
+func (t *tombstoneTable) put(ctx context.Context, tomb core.Tombstone) error {
+	if t.redis != nil {
+		return t.redis.SetTombstone(ctx, tomb)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.save(ctx, tomb)
+}
+
+// get returns id's tombstone; ok is false when id has none within the
+// retention window.
+func (t *tombstoneTable) get(ctx context.Context, id string) (tomb core.Tombstone, ok bool, err error) {
+	return t.lookup(ctx, id, false)
+}
+
+// take removes id's tombstone for a restore and returns it, as get does.
+func (t *tombstoneTable) take(ctx context.Context, id string) (tomb core.Tombstone, ok bool, err error) {
+	return t.lookup(ctx, id, true)
+}
+
+func (t *tombstoneTable) lookup(ctx context.Context, id string, remove bool) (tomb core.Tombstone, ok bool, err error) {
+	switch {
+	case t.redis != nil && remove:
+		tomb, ok, err = t.redis.TakeTombstone(ctx, id)
+	case t.redis != nil:
+		tomb, ok, err = t.redis.GetTombstone(ctx, id)
+	default:
+		t.mu.Lock()
+		tomb, ok, err = t.load(ctx, id)
+		if ok && err == nil && remove {
+			err = t.drop(ctx, id)
+		}
+		t.mu.Unlock()
+	}
+	if err != nil {
+		return core.Tombstone{}, false, err
+	}
+	if ok && tomb.Expired(t.retention, core.Now()) { // the janitor hasn't got to it yet
+		return core.Tombstone{}, false, nil
+	}
+	return tomb, ok, nil
+}
+
+// load, save, drop and all work on the tombstones kept without Redis, with
+// t.mu held.
+
+func (t *tombstoneTable) load(ctx context.Context, id string) (core.Tombstone, bool, error) {
+	if t.settings == nil {
+		tomb, ok := t.m[id]
+		return tomb, ok, nil
+	}
+	stored, err := t.settings.LoadSettings(ctx, "deleted")
+	if err != nil {
+		return core.Tombstone{}, false, err
+	}
+	s, ok := stored[id]
+	if !ok {
+		return core.Tombstone{}, false, nil
+	}
+	var tomb core.Tombstone
+	return tomb, true, json.Unmarshal([]byte(s), &tomb)
+}
+
+func (t *tombstoneTable) save(ctx context.Context, tomb core.Tombstone) error {
+	if t.settings == nil {
+		t.m[tomb.ID] = tomb
+		return nil
+	}
+	b, err := json.Marshal(tomb)
+	if err != nil {
+		return err
+	}
+	return t.settings.PutSetting(ctx, "deleted", tomb.ID, string(b))
+}
+
+func (t *tombstoneTable) drop(ctx context.Context, id string) error {
+	if t.settings == nil {
+		delete(t.m, id)
+		return nil
+	}
+	return t.settings.DeleteSetting(ctx, "deleted", id)
+}
+
+func (t *tombstoneTable) all(ctx context.Context) ([]core.Tombstone, error) {
+	if t.settings == nil {
+		out := make([]core.Tombstone, 0, len(t.m))
+		for _, tomb := range t.m {
+			out = append(out, tomb)
+		}
+		return out, nil
+	}
+	stored, err := t.settings.LoadSettings(ctx, "deleted")
+	if err != nil {
+		return nil, err
+	}
+	out := make([]core.Tombstone, 0, len(stored))
+	for _, s := range stored {
+		var tomb core.Tombstone
+		if json.Unmarshal([]byte(s), &tomb) == nil {
+			out = append(out, tomb)
+		}
+	}
+	return out, nil
+}
+
+// purge deletes the counters whose retention window has passed for good,
+// unless they were hit again since. Without Redis the counter is deleted
+// from the durable store when it supports that (store.ZeroDeleter) and
+// otherwise stays at 0.
+func (t *tombstoneTable) purge(ctx context.Context) (int, error) {
+	now := core.Now()
+	if t.redis == nil {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		tombs, err := t.all(ctx)
+		if err != nil {
+			return 0, err
+		}
+		deleter, _ := t.durable.(store.ZeroDeleter)
+		n := 0
+		for _, tomb := range tombs {
+			if !tomb.Expired(t.retention, now) {
+				continue
+			}
+			if deleter != nil {
+				if _, err := deleter.DeleteIfZero(ctx, tomb.ID); err != nil {
+					return n, err
+				}
+			}
+			if err := t.drop(ctx, tomb.ID); err != nil {
+				return n, err
+			}
+			n++
+		}
+		return n, nil
+	}
+	tombs, err := t.redis.Tombstones(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, tomb := range tombs {
+		if !tomb.Expired(t.retention, now) {
+			continue
+		}
+		if err := t.redis.PurgeTombstone(ctx, tomb.ID); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// janitor purges expired tombstones every interval (runs for the process
+// lifetime). With Redis only the leader purges.
+func (t *tombstoneTable) janitor(every time.Duration) {
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for range tick.C {
+		if !t.leader.leading() {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		n, err := t.purge(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("(warn) purge deleted counters: %v", err)
+		}
+		if n > 0 {
+			log.Printf("purged %d deleted counters past DELETE_RETENTION", n)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/advayc/nums/store"
+	"github.com/advayc/nums/web"
+)
+
+// uniqueLog counts the unique visitors (hashed IP and User-Agent) of the
+// counters listed in UNIQUES, in a Redis HyperLogLog per counter. Without
+// Redis nothing is counted.
+type uniqueLog struct {
+	redis *store.RedisCounter // nil when Redis is not configured
+	ids   map[string]bool
+}
+
+func newUniqueLog(rc *store.RedisCounter) *uniqueLog {
+	u := &uniqueLog{redis: rc, ids: web.UniquesFromEnv()}
+	if rc == nil && len(u.ids) > 0 {
+		log.Printf("(warn) UNIQUES needs Redis; unique visitors are not counted")
+	}
+	return u
+}
+
+// tracked reports whether id's unique visitors are counted.
+func (u *uniqueLog) tracked(id string) bool {
+	return u.redis != nil && web.TracksUniques(u.ids, id)
+}
+
+// hit adds the visitor sending r to id's unique visitors; a ttl > 0 expires
+// them with the counter the hit created.
+func (u *uniqueLog) hit(r *http.Request, id string, ttl time.Duration) {
+	if !u.tracked(id) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	if err := u.redis.AddUnique(ctx, id, web.UniqueVisitor(r), ttl); err != nil {
+		captureError(r, "(warn) redis unique visitors failed: %v", err)
+	}
+}
+
+// count estimates id's unique visitors.
+func (u *uniqueLog) count(ctx context.Context, id string) (uint64, error) {
+	return u.redis.Uniques(ctx, id)
+}
+
+// reset forgets id's unique visitors, with its hits.
+func (u *uniqueLog) reset(r *http.Request, id string) {
+	if !u.tracked(id) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	if err := u.redis.ResetUniques(ctx, id); err != nil {
+		captureError(r, "(warn) redis unique visitors reset failed: %v", err)
+	}
+}
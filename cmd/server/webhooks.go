@@ -0,0 +1,378 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+	"github.com/advayc/nums/web"
+)
+
+// Webhook triggers
+const (
+	triggerMilestone = "milestone"   // crossing 10, 25, 50, 100, ... (see core.MilestonesCrossed)
+	triggerEvery     = "every"       // every N hits (Every field)
+	triggerDailyHit  = "daily_first" // first hit of each UTC day
+)
+
+// webhook is one subscription. ID "*" matches every counter.
+type webhook struct {
+	ID      string `json:"id"`
+	URL     string `json:"url"`
+	Trigger string `json:"trigger"`
+	Every   uint64 `json:"every,omitempty"`
+}
+
+func (h webhook) validate() error {
+	if h.ID == "" {
+		return fmt.Errorf("id is required (use \"*\" for all counters)")
+	}
+	if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http(s) URL")
+	}
+	switch h.Trigger {
+	case triggerMilestone, triggerDailyHit:
+	case triggerEvery:
+		if h.Every == 0 {
+			return fmt.Errorf("trigger %q requires every > 0", triggerEvery)
+		}
+	default:
+		return fmt.Errorf("trigger must be one of %q, %q, %q", triggerMilestone, triggerEvery, triggerDailyHit)
+	}
+	return nil
+}
+
+// webhookEvent is the JSON body POSTed to subscribers.
+type webhookEvent struct {
+	Event     string    `json:"event"`
+	ID        string    `json:"id"`
+	Hits      uint64    `json:"hits"`
+	Milestone uint64    `json:"milestone,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// webhookRegistry holds subscriptions (seeded from the WEBHOOKS env var as a
+// JSON array, editable via /admin/webhooks) and fires them after hits.
+// Deliveries are signed with HMAC-SHA256 of the body in X-Nums-Signature when
+// WEBHOOK_SECRET is set.
+//
+// Admin changes are kept in the "webhooks" settings table (see openSettings)
+// and reloaded every idTableReload: a subscription added there maps its key
+// to its JSON, and one of WEBHOOKS removed there maps to webhookRemoved.
+type webhookRegistry struct {
+	client   *http.Client
+	secret   string
+	settings store.Settings // nil keeps admin changes in memory only
+	fixed    []webhook      // WEBHOOKS
+	days     *seenKeys      // "<id>:<YYYY-MM-DD>" once its daily_first fired
+
+	mu    sync.RWMutex
+	hooks []webhook
+}
+
+// webhookRemoved marks a WEBHOOKS subscription removed at runtime.
+const webhookRemoved = "removed"
+
+// key identifies h in the settings table.
+func (h webhook) key() string {
+	return fmt.Sprintf("%s %s %s %d", h.ID, h.URL, h.Trigger, h.Every)
+}
+
+// dailyFirstWindow is how long a day's daily_first is remembered, past the
+// end of that day.
+const dailyFirstWindow = 48 * time.Hour
+
+func newWebhookRegistryFromEnv(settings store.Settings, rc *store.RedisCounter) (*webhookRegistry, error) {
+	wr := &webhookRegistry{
+		client:   &http.Client{Timeout: 5 * time.Second},
+		secret:   os.Getenv("WEBHOOK_SECRET"),
+		settings: settings,
+		days:     newSeenKeys("dailyfirst", dailyFirstWindow, rc),
+	}
+	if rc == nil {
+		go wr.days.janitor(time.Hour)
+	}
+	if raw := os.Getenv("WEBHOOKS"); raw != "" {
+		var hooks []webhook
+		if err := json.Unmarshal([]byte(raw), &hooks); err != nil {
+			return nil, fmt.Errorf("parse WEBHOOKS: %w", err)
+		}
+		for _, h := range hooks {
+			if err := h.validate(); err != nil {
+				return nil, fmt.Errorf("WEBHOOKS entry %q: %w", h.URL, err)
+			}
+		}
+		wr.fixed = hooks
+	}
+	wr.hooks = append([]webhook(nil), wr.fixed...)
+	if settings != nil {
+		if err := wr.reload(context.Background()); err != nil {
+			log.Printf("(warn) load webhooks: %v", err)
+		}
+		go wr.run(idTableReload)
+	}
+	return wr, nil
+}
+
+// reload rebuilds the subscriptions from WEBHOOKS and the stored changes.
+func (wr *webhookRegistry) reload(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	stored, err := wr.settings.LoadSettings(ctx, "webhooks")
+	if err != nil {
+		return err
+	}
+	var hooks []webhook
+	seen := make(map[string]bool)
+	for _, h := range wr.fixed {
+		if stored[h.key()] != webhookRemoved && !seen[h.key()] {
+			seen[h.key()] = true
+			hooks = append(hooks, h)
+		}
+	}
+	for k, raw := range stored {
+		var h webhook
+		if raw == webhookRemoved || seen[k] || json.Unmarshal([]byte(raw), &h) != nil || h.validate() != nil {
+			continue
+		}
+		seen[k] = true
+		hooks = append(hooks, h)
+	}
+	wr.mu.Lock()
+	wr.hooks = hooks
+	wr.mu.Unlock()
+	return nil
+}
+
+// run reloads the subscriptions every interval so changes made on other
+// instances apply.
+func (wr *webhookRegistry) run(every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for range t.C {
+		if err := wr.reload(context.Background()); err != nil {
+			log.Printf("(warn) reload webhooks: %v", err)
+		}
+	}
+}
+
+func (wr *webhookRegistry) isFixed(h webhook) bool {
+	for _, f := range wr.fixed {
+		if f == h {
+			return true
+		}
+	}
+	return false
+}
+
+func (wr *webhookRegistry) list(id string) []webhook {
+	wr.mu.RLock()
+	defer wr.mu.RUnlock()
+	out := []webhook{}
+	for _, h := range wr.hooks {
+		if id == "" || h.ID == id {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// add subscribes h. Only errors from the settings store are not
+// *webhookInvalid.
+func (wr *webhookRegistry) add(ctx context.Context, h webhook) error {
+	if err := h.validate(); err != nil {
+		return &webhookInvalid{err}
+	}
+	if wr.settings != nil {
+		b, err := json.Marshal(h)
+		if err != nil {
+			return err
+		}
+		if err := wr.settings.PutSetting(ctx, "webhooks", h.key(), string(b)); err != nil {
+			return err
+		}
+	}
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	for _, existing := range wr.hooks {
+		if existing == h {
+			return nil
+		}
+	}
+	wr.hooks = append(wr.hooks, h)
+	return nil
+}
+
+// webhookInvalid is a subscription that fails validation.
+type webhookInvalid struct{ error }
+
+// remove deletes subscriptions for id matching url (all of id's hooks when url is empty).
+func (wr *webhookRegistry) remove(ctx context.Context, id, hookURL string) (int, error) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	kept := wr.hooks[:0]
+	removed := 0
+	for _, h := range wr.hooks {
+		if h.ID != id || (hookURL != "" && h.URL != hookURL) {
+			kept = append(kept, h)
+			continue
+		}
+		if wr.settings != nil {
+			var err error
+			if wr.isFixed(h) {
+				err = wr.settings.PutSetting(ctx, "webhooks", h.key(), webhookRemoved)
+			} else {
+				err = wr.settings.DeleteSetting(ctx, "webhooks", h.key())
+			}
+			if err != nil {
+				wr.hooks = append(kept, wr.hooks[len(kept)+removed:]...)
+				return removed, err
+			}
+		}
+		removed++
+	}
+	wr.hooks = kept
+	return removed, nil
+}
+
+// onHit fires matching webhooks for a counter that moved from prev to next.
+// Playground counters never fire.
+func (wr *webhookRegistry) onHit(id string, prev, next uint64) {
+	if isTestID(id) {
+		return
+	}
+	now := core.Now().UTC()
+	var hooks []webhook
+	daily := false
+	wr.mu.RLock()
+	for _, h := range wr.hooks {
+		if h.ID == "*" || h.ID == id {
+			hooks = append(hooks, h)
+			daily = daily || h.Trigger == triggerDailyHit
+		}
+	}
+	wr.mu.RUnlock()
+	firstToday := false
+	if daily {
+		firstToday = wr.firstToday(id, now)
+	}
+
+	for _, h := range hooks {
+		switch h.Trigger {
+		case triggerMilestone:
+			for _, m := range core.MilestonesCrossed(prev, next) {
+				wr.deliver(h, webhookEvent{Event: triggerMilestone, ID: id, Hits: next, Milestone: m, At: now})
+			}
+		case triggerEvery:
+			if next/h.Every > prev/h.Every {
+				wr.deliver(h, webhookEvent{Event: triggerEvery, ID: id, Hits: next, At: now})
+			}
+		case triggerDailyHit:
+			if firstToday {
+				wr.deliver(h, webhookEvent{Event: triggerDailyHit, ID: id, Hits: next, At: now})
+			}
+		}
+	}
+}
+
+// firstToday reports whether this is id's first hit of now's UTC day, which
+// with Redis is decided once across every instance and restart.
+func (wr *webhookRegistry) firstToday(id string, now time.Time) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	first, err := wr.days.add(ctx, id+":"+now.Format("2006-01-02"))
+	if err != nil {
+		log.Printf("(warn) daily_first webhooks for %s skipped: %v", id, err)
+		return false
+	}
+	return first
+}
+
+// deliver POSTs the event asynchronously (best-effort, no retries).
+func (wr *webhookRegistry) deliver(h webhook, ev webhookEvent) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	go func() {
+		req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Nums-Event", ev.Event)
+		if wr.secret != "" {
+			mac := hmac.New(sha256.New, []byte(wr.secret))
+			mac.Write(body)
+			req.Header.Set("X-Nums-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		}
+		resp, err := wr.client.Do(req)
+		if err != nil {
+			log.Printf("(warn) webhook %s for %s failed: %v", ev.Event, ev.ID, err)
+			return
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("(warn) webhook %s for %s returned %s", ev.Event, ev.ID, resp.Status)
+		}
+	}()
+}
+
+// ServeHTTP implements /admin/webhooks:
+//
+//	GET    /admin/webhooks[?id=foo]          list subscriptions
+//	POST   /admin/webhooks                   add {"id","url","trigger","every"}
+//	DELETE /admin/webhooks?id=foo[&url=...]  remove subscriptions
+func (wr *webhookRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]any{"webhooks": wr.list(r.URL.Query().Get("id"))})
+	case http.MethodPost:
+		var h webhook
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&h); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON body"})
+			return
+		}
+		var invalid *webhookInvalid
+		if err := wr.add(r.Context(), h); errors.As(err, &invalid) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		} else if err != nil {
+			captureError(r, "(error) webhook update failed: %v", err)
+			web.WriteUnavailable(w, web.StoreRetryAfter, nil)
+			return
+		}
+		writeJSON(w, http.StatusCreated, h)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "id is required"})
+			return
+		}
+		removed, err := wr.remove(r.Context(), id, r.URL.Query().Get("url"))
+		if err != nil {
+			captureError(r, "(error) webhook update failed: %v", err)
+			web.WriteUnavailable(w, web.StoreRetryAfter, nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"removed": removed})
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/advayc/nums/snippets"
+)
+
+// storageChoice is one answer to "where should counts be kept?" in nums init.
+type storageChoice struct {
+	name  string // STORAGE value; "redis" and "memory" are set up without it
+	about string
+	ask   []question
+}
+
+// question asks for one setting; an empty answer keeps def.
+type question struct {
+	env    string
+	prompt string
+	def    string
+}
+
+var memoryChoice = storageChoice{name: "memory", about: "in memory, kept in a local write-ahead log", ask: []question{
+	{env: "WAL_PATH", prompt: "write-ahead log file (empty to lose counts on restart)", def: "nums.wal"},
+}}
+
+// wizard reads answers from in and prints to out.
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (w *wizard) ask(prompt, def string) string {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", prompt, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", prompt)
+	}
+	line, err := w.in.ReadString('\n')
+	line = strings.TrimSpace(line)
+	if err != nil && line == "" { // end of input: take the defaults
+		fmt.Fprintln(w.out)
+	}
+	if line == "" {
+		return def
+	}
+	return line
+}
+
+func (w *wizard) confirm(prompt string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		a := strings.ToLower(w.ask(prompt+" ("+hint+")", ""))
+		switch a {
+		case "":
+			return def
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+	}
+}
+
+// runInit is "nums init": it asks for the storage, token, port and public
+// URL, checks that the store answers and the port is free, writes the
+// settings to a config file the server reads on startup and prints embed
+// examples.
+func runInit(args []string) {
+	fset := flag.NewFlagSet("nums init", flag.ExitOnError)
+	out := fset.String("o", ".env", "config file to write")
+	force := fset.Bool("force", false, "overwrite the config file without asking")
+	_ = fset.Parse(args)
+
+	w := &wizard{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+	fmt.Fprintf(w.out, "Setting up nums. Press enter to keep the value in brackets.\n\n")
+	if _, err := os.Stat(*out); err == nil && !*force && !w.confirm(*out+" exists. Overwrite it?", false) {
+		fmt.Fprintln(w.out, "Nothing written.")
+		return
+	}
+
+	var env []string // KEY=VALUE lines in the order they were asked
+	set := func(k, v string) {
+		env = append(env, k+"="+v)
+		_ = os.Setenv(k, v) // so checkStorage sees it
+	}
+
+	choices := append([]storageChoice{memoryChoice}, durableChoices...)
+	fmt.Fprintln(w.out, "Where should counts be kept?")
+	for i, c := range choices {
+		fmt.Fprintf(w.out, "  %d) %-9s %s\n", i+1, c.name, c.about)
+	}
+	var choice storageChoice
+	for {
+		a := w.ask("Storage", "1")
+		n, err := strconv.Atoi(a)
+		if err == nil && n >= 1 && n <= len(choices) {
+			choice = choices[n-1]
+			break
+		}
+		for _, c := range choices {
+			if c.name == a {
+				choice = c
+			}
+		}
+		if choice.name != "" {
+			break
+		}
+	}
+	for {
+		for _, q := range choice.ask {
+			if v := w.ask(q.prompt, q.def); v != "" {
+				_ = os.Setenv(q.env, v)
+			} else {
+				_ = os.Unsetenv(q.env)
+			}
+		}
+		if choice.name == "memory" {
+			break
+		}
+		if choice.name != "redis" {
+			_ = os.Setenv("STORAGE", choice.name)
+		}
+		fmt.Fprintf(w.out, "Connecting to %s... ", choice.name)
+		err := checkStorage(choice.name)
+		if err == nil {
+			fmt.Fprintln(w.out, "ok")
+			break
+		}
+		fmt.Fprintf(w.out, "failed: %v\n", err)
+		if !w.confirm("Try other settings?", true) {
+			break
+		}
+	}
+	if choice.name != "memory" && choice.name != "redis" {
+		set("STORAGE", choice.name)
+	}
+	for _, q := range choice.ask {
+		if v := os.Getenv(q.env); v != "" {
+			set(q.env, v)
+		}
+	}
+
+	fmt.Fprintln(w.out)
+	token := ""
+	if w.confirm("Require a secret token on every request? Badges and counts then need it in their URL too", false) {
+		token = w.ask("Secret token", randomToken())
+		set("SECRET_TOKEN", token)
+	}
+
+	port := ""
+	for {
+		port = w.ask("Port", "8080")
+		err := portFree(port)
+		if err == nil {
+			break
+		}
+		fmt.Fprintf(w.out, "Port %s: %v\n", port, err)
+		if !w.confirm("Choose another port?", true) {
+			break
+		}
+	}
+	set("PORT", port)
+	publicURL := strings.TrimRight(w.ask("Public URL of this server", "http://localhost:"+port), "/")
+	if publicURL != "http://localhost:"+port {
+		set("PUBLIC_URL", publicURL)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# written by nums init on %s; flags and environment variables override it\n", time.Now().Format("2006-01-02"))
+	for _, line := range env {
+		b.WriteString(line + "\n")
+	}
+	if err := os.WriteFile(*out, []byte(b.String()), 0o600); err != nil { // may hold secrets
+		fmt.Fprintf(os.Stderr, "write %s: %v\n", *out, err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(w.out, "\nWrote %s. Start the server from this directory with: nums", *out)
+	if *out != ".env" {
+		fmt.Fprintf(w.out, " -config %s", *out)
+	}
+	fmt.Fprintf(w.out, "\n\nEmbed a counter (the id is any name you like):\n\n")
+	for _, s := range snippets.Generate(publicURL, "home") {
+		fmt.Fprintf(w.out, "%s:\n%s\n\n", s.Label, s.Code)
+	}
+	if token != "" {
+		fmt.Fprintf(w.out, "With SECRET_TOKEN set, add &token=%s to badge and count URLs, and export SECRET_TOKEN for the examples above.\n", token)
+	}
+}
+
+// randomToken is a fresh 32-character hex secret.
+func randomToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// portFree reports an error if nothing can listen on port.
+func portFree(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("not a port number")
+	}
+	l, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) {
+			return opErr.Err
+		}
+		return err
+	}
+	return l.Close()
+}
@@ -0,0 +1,359 @@
+// Command stress hammers the storage backends from many goroutines with a
+// random mix of Inc, IncBy, Get, Set and merge-style transfers, then checks
+// properties every correct store must keep. Run it under the race detector:
+//
+//	go run -race ./cmd/stress
+//	go run -race ./cmd/stress -backends sqlite,write-behind -workers 64 -ops 5000
+//	go run -race ./cmd/stress -backends redis -redis redis://localhost:6379
+//
+// go test -race ./cmd/stress runs the same checks on every backend (redis
+// only with REDIS_URL), with fewer operations under -short.
+//
+// Checked properties: no increment is lost; every Inc on a counter returns a
+// distinct value (1..n on a fresh counter); transfers between two counters
+// (the /tx ops behind nums admin merge) keep their sum; a counter that is only
+// ever set holds one of the values written; and on stores promising
+// read-your-writes a worker never reads a counter lower than it read before.
+// The seed is printed so a failing run can be repeated with -seed. It exits 1
+// if any backend breaks a property or an operation fails. SQLite takes one
+// writer at a time, and the race detector slows it down enough that many
+// workers run into its 5s operation timeout ("context deadline exceeded"),
+// which is load, not a lost update; so the backends on SQLite default to
+// fewer workers than the others.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/advayc/nums/store"
+	"github.com/advayc/nums/store/bolt"
+	"github.com/advayc/nums/store/sqlite"
+)
+
+const (
+	moveStart = 1000 // each transfer counter starts here
+	uniqID    = "stress-uniq"
+	fromID    = "stress-from"
+	toID      = "stress-to"
+	setID     = "stress-set"
+)
+
+// setValues are the only values written to setID.
+var setValues = []uint64{100, 200, 300, 400, 500}
+
+var allBackends = []string{"memory", "wal", "bolt", "sqlite", "write-through", "write-behind", "failover", "replicated", "redis"}
+
+// Default workers per backend; SQLite serializes writers, so more of them
+// only wait on its lock.
+const (
+	defaultWorkers = 8
+	sqliteWorkers  = 2
+)
+
+// workersFor is n, or without one (0) the default for backend name.
+func workersFor(name string, n int) int {
+	switch {
+	case n > 0:
+		return n
+	case name == "sqlite", name == "write-through", name == "write-behind", name == "failover", name == "replicated":
+		return sqliteWorkers
+	}
+	return defaultWorkers
+}
+
+func main() {
+	backends := flag.String("backends", "", "comma-separated backends (default all; redis only with -redis): "+strings.Join(allBackends, ","))
+	workers := flag.Int("workers", 0, fmt.Sprintf("concurrent goroutines per backend (default %d, %d on SQLite)", defaultWorkers, sqliteWorkers))
+	ops := flag.Int("ops", 500, "operations per goroutine")
+	ids := flag.Int("ids", 4, "number of hit counters the workers share")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "random seed")
+	redisURL := flag.String("redis", os.Getenv("REDIS_URL"), "Redis URL for the redis backend (defaults to REDIS_URL)")
+	verbose := flag.Bool("v", false, "show the stores' own warnings (retries, replays)")
+	flag.Parse()
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	names := allBackends
+	if *backends != "" {
+		names = strings.Split(*backends, ",")
+	}
+	dir, err := os.MkdirTemp("", "nums-stress-")
+	if err != nil {
+		fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fmt.Printf("seed %d, %d ops per worker\n", *seed, *ops)
+	failed := false
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "redis" && *redisURL == "" {
+			if *backends != "" {
+				fatalf("the redis backend needs -redis or REDIS_URL")
+			}
+			continue
+		}
+		b, err := open(name, filepath.Join(dir, name), *redisURL)
+		if err != nil {
+			fatalf("%s: %v", name, err)
+		}
+		n := workersFor(name, *workers)
+		r := run(b, n, *ops, *ids, *seed)
+		b.release()
+		status := "ok"
+		if len(r.problems) > 0 {
+			status, failed = "FAIL", true
+		}
+		fmt.Printf("%-14s %-4s %2d workers %8d ops  %v\n", name, status, n, r.ops, r.took.Round(time.Millisecond))
+		for _, p := range r.problems {
+			fmt.Printf("    %s\n", p)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// fatalf reports to stderr, which stays open when the log is discarded.
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(2)
+}
+
+// backend is a fresh store under test.
+type backend struct {
+	store.Store
+	flush   func() // before the final values are read
+	release func() // after
+}
+
+func open(name, path, redisURL string) (backend, error) {
+	noop := func() {}
+	switch name {
+	case "memory":
+		return backend{store.NewMultiCounter(), noop, noop}, nil
+	case "wal":
+		w, err := store.OpenWAL(store.NewMultiCounter(), path+".wal", false)
+		if err != nil {
+			return backend{}, err
+		}
+		return backend{w, noop, func() { _ = w.Close() }}, nil
+	case "bolt":
+		b, err := bolt.Open(path + ".db")
+		if err != nil {
+			return backend{}, err
+		}
+		return backend{b, noop, func() { _ = b.Close() }}, nil
+	case "sqlite":
+		s, err := sqlite.Open(path + ".db")
+		if err != nil {
+			return backend{}, err
+		}
+		return backend{s, noop, func() { _ = s.Close() }}, nil
+	case "write-through", "write-behind":
+		remote, err := sqlite.Open(path + ".db")
+		if err != nil {
+			return backend{}, err
+		}
+		mode := store.WriteThrough
+		if name == "write-behind" {
+			mode = store.WriteBehind
+		}
+		t, err := store.NewTiered(store.NewMultiCounter(), remote, mode, time.Second, 10*time.Millisecond)
+		if err != nil {
+			return backend{}, err
+		}
+		return backend{t, t.Close, func() { _ = remote.Close() }}, nil
+	case "failover":
+		s, err := sqlite.Open(path + ".db")
+		if err != nil {
+			return backend{}, err
+		}
+		f, err := store.NewFailover(s, 0, 0)
+		return backend{f, noop, func() { _ = s.Close() }}, err
+	case "replicated":
+		s, err := sqlite.Open(path + ".db")
+		if err != nil {
+			return backend{}, err
+		}
+		r, err := store.NewReplicated(store.NewMultiCounter(), s)
+		return backend{r, noop, func() { _ = s.Close() }}, err
+	case "redis":
+		return openRedis(redisURL)
+	}
+	return backend{}, fmt.Errorf("unknown backend %q (want %s)", name, strings.Join(allBackends, ", "))
+}
+
+type result struct {
+	ops      int64
+	took     time.Duration
+	problems []string
+}
+
+func run(b backend, workers, opsPer, nIDs int, seed int64) result {
+	st := b.Store
+	ctx := context.Background()
+	adder, _ := st.(store.Adder)
+	tx, _ := st.(store.Transactor)
+	monotonic := st.Capabilities().ReadYourWrites
+
+	var res result
+	var mu sync.Mutex
+	problem := func(format string, args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(res.problems) < 20 {
+			res.problems = append(res.problems, fmt.Sprintf(format, args...))
+		}
+	}
+	if tx != nil {
+		if _, err := tx.Apply(ctx, []store.Op{{Kind: store.OpSet, ID: fromID, N: moveStart}, {Kind: store.OpSet, ID: toID, N: moveStart}}); err != nil {
+			problem("seeding transfer counters: %v", err)
+			tx = nil
+		}
+	}
+
+	ids := make([]string, nIDs)
+	for i := range ids {
+		ids[i] = "stress-hits-" + strconv.Itoa(i)
+	}
+	added := make([]atomic.Uint64, nIDs)
+	uniq := make([][]uint64, workers)
+	var done atomic.Int64
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed + int64(w)))
+			seen := make([]uint64, nIDs) // highest value this worker read or wrote
+			note := func(i int, v uint64, what string) {
+				if monotonic && v < seen[i] {
+					problem("%s went backwards for one worker: %s %d after %d", ids[i], what, v, seen[i])
+				}
+				seen[i] = max(seen[i], v)
+			}
+			for n := 0; n < opsPer; n++ {
+				i := rnd.Intn(nIDs)
+				switch op := rnd.Intn(10); {
+				case op < 4 || (op == 4 && adder == nil):
+					v, err := st.Inc(ctx, ids[i])
+					if err != nil {
+						problem("Inc %s: %v", ids[i], err)
+						continue
+					}
+					added[i].Add(1)
+					note(i, v, "Inc returned")
+				case op == 4:
+					by := uint64(rnd.Intn(5) + 1)
+					v, err := adder.IncBy(ctx, ids[i], by)
+					if err != nil {
+						problem("IncBy %s: %v", ids[i], err)
+						continue
+					}
+					added[i].Add(by)
+					note(i, v, "IncBy returned")
+				case op == 5:
+					v, err := st.Inc(ctx, uniqID)
+					if err != nil {
+						problem("Inc %s: %v", uniqID, err)
+						continue
+					}
+					uniq[w] = append(uniq[w], v)
+				case op < 8 || tx == nil:
+					v, err := st.Get(ctx, ids[i])
+					if err != nil {
+						problem("Get %s: %v", ids[i], err)
+						continue
+					}
+					note(i, v.Uint64(), "Get read")
+				case op == 8:
+					from, to := fromID, toID
+					if rnd.Intn(2) == 0 {
+						from, to = to, from
+					}
+					k := uint64(rnd.Intn(3) + 1)
+					_, err := tx.Apply(ctx, []store.Op{{Kind: store.OpDec, ID: from, N: k}, {Kind: store.OpInc, ID: to, N: k}})
+					if err != nil && !errors.Is(err, store.ErrUnderflow) {
+						problem("transfer %s -> %s: %v", from, to, err)
+					}
+				default:
+					v := setValues[rnd.Intn(len(setValues))]
+					if _, err := tx.Apply(ctx, []store.Op{{Kind: store.OpSet, ID: setID, N: v}}); err != nil {
+						problem("Set %s: %v", setID, err)
+					}
+				}
+				done.Add(1)
+			}
+		}(w)
+	}
+	wg.Wait()
+	res.took = time.Since(start)
+	res.ops = done.Load()
+	b.flush()
+	if t, ok := st.(*store.Tiered); ok {
+		st = t.Remote // the flushed, durable values
+	}
+
+	get := func(id string) uint64 {
+		v, err := st.Get(ctx, id)
+		if err != nil {
+			problem("final Get %s: %v", id, err)
+		}
+		return v.Uint64()
+	}
+	for i, id := range ids {
+		if got, want := get(id), added[i].Load(); got != want {
+			problem("%s = %d, want %d (lost or duplicated increments)", id, got, want)
+		}
+	}
+	var incs []uint64
+	for _, vs := range uniq {
+		incs = append(incs, vs...)
+	}
+	sort.Slice(incs, func(a, b int) bool { return incs[a] < incs[b] })
+	for k, v := range incs {
+		if v != uint64(k+1) {
+			problem("Inc on %s returned %d as its %d. distinct value (duplicated or skipped)", uniqID, v, k+1)
+			break
+		}
+	}
+	if got := get(uniqID); got != uint64(len(incs)) {
+		problem("%s = %d after %d increments", uniqID, got, len(incs))
+	}
+	if tx != nil {
+		if sum := get(fromID) + get(toID); sum != 2*moveStart {
+			problem("transfers changed the total of %s and %s: %d, want %d", fromID, toID, sum, 2*moveStart)
+		}
+		if v := get(setID); v != 0 && !contains(setValues, v) {
+			problem("%s = %d, which was never written", setID, v)
+		}
+	}
+	return res
+}
+
+func contains(vs []uint64, v uint64) bool {
+	for _, x := range vs {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,11 @@
+//go:build minimal
+
+package main
+
+import "errors"
+
+// openRedis refuses the redis backend: -tags minimal leaves out the Redis
+// client.
+func openRedis(string) (backend, error) {
+	return backend{}, errors.New("redis backend not built (built with -tags minimal)")
+}
@@ -0,0 +1,27 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/advayc/nums/store"
+)
+
+// openRedis opens the redis backend under a fresh key prefix, whose keys
+// are deleted when the run is done.
+func openRedis(redisURL string) (backend, error) {
+	rc, err := store.NewRedisCounter(redisURL, "stress:"+strconv.FormatInt(time.Now().UnixNano(), 36)+":")
+	if err != nil {
+		return backend{}, err
+	}
+	return backend{rc, func() {}, func() {
+		ctx := context.Background()
+		if keys, _ := rc.Client().Keys(ctx, rc.Prefix()+"*").Result(); len(keys) > 0 {
+			rc.Client().Del(ctx, keys...)
+		}
+		_ = rc.Client().Close()
+	}}, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestBackends runs the stress checks on every backend, redis only when
+// REDIS_URL is set. Run it with -race.
+func TestBackends(t *testing.T) {
+	log.SetOutput(io.Discard) // the stores' retry and replay warnings
+	defer log.SetOutput(os.Stderr)
+	ops := 500
+	if testing.Short() {
+		ops = 100
+	}
+	seed := time.Now().UnixNano()
+	t.Logf("seed %d (go run -race ./cmd/stress -seed %d repeats it)", seed, seed)
+	redisURL := os.Getenv("REDIS_URL")
+	for _, name := range allBackends {
+		t.Run(name, func(t *testing.T) {
+			if name == "redis" && redisURL == "" {
+				t.Skip("REDIS_URL not set")
+			}
+			b, err := open(name, filepath.Join(t.TempDir(), name), redisURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := run(b, workersFor(name, 0), ops, 4, seed)
+			b.release()
+			for _, p := range r.problems {
+				t.Error(p)
+			}
+		})
+	}
+}
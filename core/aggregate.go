@@ -0,0 +1,23 @@
+package core
+
+import "time"
+
+// Aggregate is the anonymized deployment-wide summary served at
+// /public/aggregate: how many counters exist and how many hits they hold in
+// total. It never carries counter ids.
+type Aggregate struct {
+	Counters    int       `json:"counters"`
+	TotalHits   uint64    `json:"total_hits"`
+	GeneratedAt time.Time `json:"generated_at"`
+	// Approximate is set when the backend is eventually consistent.
+	Approximate bool `json:"approximate,omitempty"`
+}
+
+// Add counts one counter. Float counters (e.g. MB downloaded) are counted but
+// not summed into TotalHits, since their unit is not "hits".
+func (a *Aggregate) Add(v Value) {
+	a.Counters++
+	if !v.IsFloat() {
+		a.TotalHits += v.Uint64()
+	}
+}
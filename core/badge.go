@@ -0,0 +1,86 @@
+package core
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Badge fonts used when the request doesn't pick one.
+const (
+	BadgeFont         = "Verdana,Geneva,DejaVu Sans,sans-serif"
+	TerminalBadgeFont = "SFMono-Regular, SF Mono, Menlo, ui-monospace, monospace"
+)
+
+// NormalizeColor restricts colors to safe values (basic allowlist)
+func NormalizeColor(c string, fallback string) string {
+	if c == "" {
+		return fallback
+	}
+	c = strings.TrimSpace(c)
+	lc := strings.ToLower(c)
+	if strings.HasPrefix(lc, "#") {
+		if len(lc) == 4 || len(lc) == 7 { // #rgb or #rrggbb
+			return lc
+		}
+		return fallback
+	}
+	switch lc {
+	case "blue", "green", "red", "orange", "yellow", "gray", "grey", "purple", "teal":
+		return lc
+	}
+	return fallback
+}
+
+// BadgeSVG creates a small classic style badge. Widths are estimated from the
+// raw text, so no font metrics are needed.
+func BadgeSVG(label, textVal, color, font string) string {
+	labelWidth := 6*len(label) + 10
+	valWidth := 6*len(textVal) + 10
+	total := labelWidth + valWidth
+	// widths use the raw text; the values are escaped for XML (e.g. "<100")
+	label, textVal = html.EscapeString(label), html.EscapeString(textVal)
+	color, font = html.EscapeString(color), html.EscapeString(font)
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">
+<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<rect rx="3" width="%d" height="20" fill="#555"/>
+<rect rx="3" x="%d" width="%d" height="20" fill="%s"/>
+<rect rx="3" width="%d" height="20" fill="url(#s)"/>
+<g fill="#fff" text-anchor="middle" font-family="%s" font-size="11">
+<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text>
+<text x="%d" y="15">%s</text>
+<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text>
+<text x="%d" y="15">%s</text>
+</g>
+</svg>`,
+		total, label, textVal,
+		total, labelWidth, valWidth, color,
+		total, font,
+		labelWidth/2, label,
+		labelWidth/2, label,
+		labelWidth+valWidth/2, textVal,
+		labelWidth+valWidth/2, textVal,
+	)
+}
+
+// TerminalBadgeSVG outputs a terminal-like monospace badge with label:value styling
+func TerminalBadgeSVG(label, textVal, font, bg, labelColor, valueColor string) string {
+	labelText := label + ":"
+	// approximate monospace width ~8px per char + padding
+	labelWidth := 8*len(labelText) + 14
+	valWidth := 8*len(textVal) + 14
+	total := labelWidth + valWidth
+	label, labelText, textVal, font = html.EscapeString(label), html.EscapeString(labelText), html.EscapeString(textVal), html.EscapeString(font)
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="24" role="img" aria-label="%s: %s">
+<rect rx="4" width="%d" height="24" fill="%s" />
+<text x="%d" y="16" font-family="%s" font-size="12" fill="%s">%s</text>
+<text x="%d" y="16" font-family="%s" font-size="12" font-weight="600" fill="%s">%s</text>
+</svg>`,
+		total, label, textVal,
+		total, bg,
+		8, font, labelColor, labelText,
+		labelWidth, font, valueColor, textVal,
+	)
+}
@@ -0,0 +1,46 @@
+package core
+
+// BadgeCase is one style and parameter combination of the badge builders.
+// /debug/badge-matrix draws every case, and cmd/badge-golden compares them
+// with the golden files in core/testdata/badges.
+type BadgeCase struct {
+	Name  string // golden file name without .svg, e.g. "classic-hex-color"
+	Query string // the /badge parameters it stands for
+	SVG   string
+}
+
+// BadgeMatrix renders every case with the defaults the /badge handlers use.
+func BadgeMatrix() []BadgeCase {
+	classic := func(name, query, label, value, color, font string) BadgeCase {
+		return BadgeCase{name, query, BadgeSVG(label, value, color, font)}
+	}
+	terminal := func(name, query, label, value, font, bg, labelColor, valueColor string) BadgeCase {
+		return BadgeCase{name, query, TerminalBadgeSVG(label, value, font, bg, labelColor, valueColor)}
+	}
+	progress := func(name, query, label string, count Value, target uint64, labelColor, color, trackColor string) BadgeCase {
+		text, fraction := Progress(count, target, 0)
+		return BadgeCase{name, query, ProgressBadgeSVG(label, text, BadgeFont, fraction, labelColor, color, trackColor)}
+	}
+	return []BadgeCase{
+		classic("classic", "", "views", "1234", "blue", BadgeFont),
+		classic("classic-named-color", "color=green", "views", "1234", "green", BadgeFont),
+		classic("classic-hex-color", "color=%23e05d44", "views", "1234", "#e05d44", BadgeFont),
+		classic("classic-label", "label=downloads", "downloads", "1234", "blue", BadgeFont),
+		classic("classic-long-label", "label=page%20views%20this%20month", "page views this month", "1234", "blue", BadgeFont),
+		classic("classic-zero", "", "views", "0", "blue", BadgeFont),
+		classic("classic-large", "", "views", Uint(1234567890123).String(), "blue", BadgeFont),
+		classic("classic-min", "min=100", "views", Uint(42).FormatMin(-1, "", 100), "blue", BadgeFont),
+		classic("classic-float-suffix", "precision=1&suffix=%20MB", "downloaded", Float(12.345).Format(1, " MB"), "blue", BadgeFont),
+		classic("classic-escaped", "label=%3Cb%3E%26co", "<b>&co", "1234", "blue", BadgeFont),
+		classic("classic-font", "font=monospace", "views", "1234", "blue", "monospace"),
+		classic("classic-velocity", "style=velocity", "views", Velocity{PerHour: 12.4}.BadgeText(), "blue", BadgeFont),
+		classic("classic-target", "target=10000", "views", TargetText("7842", 10000), "blue", BadgeFont),
+		progress("classic-progress", "style=progress&target=10000&label=raised&color=green", "raised", Uint(7842), 10000, ProgressLabelColor, "green", ProgressTrackColor),
+		progress("classic-progress-done", "style=progress&target=10000&label=raised&color=green", "raised", Uint(12034), 10000, ProgressLabelColor, "green", ProgressTrackColor),
+		progress("classic-progress-colors", "style=progress&target=10000&labelColor=%23333&color=%23e05d44&trackColor=%23ddd", "views", Uint(2500), 10000, "#333", "#e05d44", "#ddd"),
+		terminal("terminal", "style=terminal", "views", "1234", TerminalBadgeFont, "#1e1e1e", "#aaa", "#3cffb3"),
+		terminal("terminal-colors", "style=terminal&bg=%23fff&labelColor=%23555&valueColor=%23e05d44", "views", "1234", TerminalBadgeFont, "#fff", "#555", "#e05d44"),
+		terminal("terminal-min", "style=terminal&min=100", "views", Uint(42).FormatMin(-1, "", 100), TerminalBadgeFont, "#1e1e1e", "#aaa", "#3cffb3"),
+		terminal("terminal-font", "style=mono&font=monospace", "views", "1234", "monospace", "#1e1e1e", "#aaa", "#3cffb3"),
+	}
+}
@@ -0,0 +1,36 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBadgeMatrix compares every case in BadgeMatrix with its golden file in
+// testdata/badges. After an intended change to the SVG output, accept it with
+// go run ./cmd/badge-golden -update.
+func TestBadgeMatrix(t *testing.T) {
+	dir := filepath.Join("testdata", "badges")
+	known := make(map[string]bool)
+	for _, c := range BadgeMatrix() {
+		known[c.Name+".svg"] = true
+		want, err := os.ReadFile(filepath.Join(dir, c.Name+".svg"))
+		if err != nil {
+			t.Errorf("%s: %v (run go run ./cmd/badge-golden -update)", c.Name, err)
+			continue
+		}
+		if got := c.SVG + "\n"; got != string(want) {
+			t.Errorf("%s (%s) differs from its golden file:\nwant %s\ngot  %s", c.Name, c.Query, want, got)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".svg") && !known[e.Name()] {
+			t.Errorf("%s: golden file has no case in BadgeMatrix", e.Name())
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// dayBucketLayout is the date suffix of per-day bucket counters.
+const dayBucketLayout = "20060102"
+
+// DayBucketID returns the id of the per-day bucket of counter id, e.g.
+// "home:20240131" (stored under the usual prefix as "hits:home:20240131").
+func DayBucketID(id string, day time.Time) string {
+	return id + ":" + day.UTC().Format(dayBucketLayout)
+}
+
+// DayBucketTTL is how long a day bucket is kept after its first hit: long
+// enough for the longest chart (MaxChartDays) and period read.
+const DayBucketTTL = (MaxChartDays + 2) * 24 * time.Hour
+
+// IsDayBucketID reports whether id names a day bucket rather than a counter,
+// so listings and aggregates can skip it.
+func IsDayBucketID(id string) bool {
+	if len(id) < 10 || id[len(id)-9] != ':' {
+		return false
+	}
+	_, err := time.Parse(dayBucketLayout, id[len(id)-8:])
+	return err == nil
+}
+
+// PeriodDays returns the UTC days whose buckets make up period as of now:
+// "today", "week" (from Monday) or "month" (from the 1st). ok is false for
+// any other period.
+func PeriodDays(period string, now time.Time) (days []time.Time, ok bool) {
+	today := now.UTC().Truncate(24 * time.Hour)
+	start := today
+	switch period {
+	case "today":
+	case "week":
+		start = today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	case "month":
+		start = today.AddDate(0, 0, 1-today.Day())
+	default:
+		return nil, false
+	}
+	for d := start; !d.After(today); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+	return days, true
+}
+
+// Velocity is a counter's recent hit rate, as shown by /count?fields=velocity
+// and style=velocity badges.
+type Velocity struct {
+	PerHour float64 `json:"perHour"`
+	PerDay  float64 `json:"perDay"`
+}
+
+// NewVelocity estimates the hits of the last 24 hours from the day buckets
+// of today and yesterday as of now: all of today's, plus the share of
+// yesterday's that falls inside the window, taking yesterday's hits as
+// evenly spread. step > 1 rounds the daily rate as ROUND_COUNTS rounds
+// counts, and the hourly rate follows from it. Rates keep one decimal.
+func NewVelocity(today, yesterday uint64, now time.Time, step uint64) Velocity {
+	now = now.UTC()
+	left := 1 - float64(now.Sub(now.Truncate(24*time.Hour)))/float64(24*time.Hour)
+	perDay := float64(today) + float64(yesterday)*left
+	if step > 1 {
+		perDay = float64(Uint(uint64(math.Round(perDay))).Round(step).Uint64())
+	}
+	return Velocity{PerHour: math.Round(perDay/24*10) / 10, PerDay: math.Round(perDay*10) / 10}
+}
+
+// BadgeText formats the hourly rate for a badge, e.g. "12/hr" or "0.4/hr".
+func (v Velocity) BadgeText() string {
+	if v.PerHour >= 10 {
+		return strconv.FormatFloat(math.Round(v.PerHour), 'f', 0, 64) + "/hr"
+	}
+	return strconv.FormatFloat(v.PerHour, 'f', -1, 64) + "/hr"
+}
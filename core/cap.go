@@ -0,0 +1,111 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Value caps: a counter can be given a maximum, e.g. for quota-style
+// counters built on hits, and a policy for hits that would take it past it.
+
+// Overflow policies.
+const (
+	OverflowReject = "reject" // refuse the hit with 409 (the default)
+	OverflowClamp  = "clamp"  // count up to the max and drop the rest
+	OverflowWrap   = "wrap"   // go on from 0 after the max, like an odometer
+)
+
+// Cap is a counter's maximum value and its overflow policy.
+type Cap struct {
+	Max    uint64 `json:"max"`
+	Policy string `json:"policy"`
+}
+
+// ParseCaps parses comma-separated id=max or id=max:policy entries such as
+// "quota=1000,api=500:clamp" ("*=..." caps every other counter).
+func ParseCaps(s string) (map[string]Cap, error) {
+	out := make(map[string]Cap)
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		id, raw, ok := strings.Cut(pair, "=")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" {
+			return nil, fmt.Errorf("%q should be id=max or id=max:policy", pair)
+		}
+		c, err := ParseCap(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", pair, err)
+		}
+		out[id] = c
+	}
+	return out, nil
+}
+
+// ParseCap parses a max with an optional policy, such as "1000" or
+// "1000:clamp".
+func ParseCap(s string) (Cap, error) {
+	raw, policy, _ := strings.Cut(strings.TrimSpace(s), ":")
+	max, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil || max == 0 {
+		return Cap{}, fmt.Errorf("max must be a positive integer")
+	}
+	switch policy {
+	case "":
+		policy = OverflowReject
+	case OverflowReject, OverflowClamp, OverflowWrap:
+	default:
+		return Cap{}, fmt.Errorf("unknown overflow policy %q (want reject, clamp or wrap)", policy)
+	}
+	return Cap{Max: max, Policy: policy}, nil
+}
+
+// CapFor returns id's cap, or the "*" one when id has none.
+func CapFor(caps map[string]Cap, id string) (Cap, bool) {
+	if c, ok := caps[id]; ok {
+		return c, true
+	}
+	c, ok := caps[RoundingDefault]
+	return c, ok
+}
+
+// CappedHit is what a hit on a capped counter comes to.
+type CappedHit struct {
+	Back     uint64 // to take off the stored value again
+	From, To uint64 // the counter's value before and after the hit, as reported
+	Counted  uint64 // hits counted
+	Rejected bool   // refused under OverflowReject; Back is the whole hit
+}
+
+// Hit decides a hit of n that took a capped counter to result, its value
+// right after an atomic add. Each of several concurrent hits takes back only
+// its own overshoot, so together they leave the counter where it belongs.
+func (c Cap) Hit(result, n uint64) CappedHit {
+	if result <= c.Max {
+		return CappedHit{From: result - n, To: result, Counted: n}
+	}
+	switch c.Policy {
+	case OverflowClamp:
+		back := min(n, result-c.Max)
+		return CappedHit{Back: back, From: c.Max - (n - back), To: c.Max, Counted: n - back}
+	case OverflowWrap:
+		m := c.Max + 1 // no overflow: result > Max rules out Max == MaxUint64
+		wraps := result/m - (result-n)/m
+		return CappedHit{Back: wraps * m, From: (result - n) % m, To: result % m, Counted: n}
+	}
+	return CappedHit{Back: n, From: result - n, To: result - n, Rejected: true}
+}
+
+// OverflowError refuses a hit that would take a counter past its max under
+// OverflowReject.
+type OverflowError struct {
+	ID   string
+	Max  uint64
+	Hits uint64 // the counter's value, without the refused hit
+}
+
+func (e *OverflowError) Error() string {
+	return fmt.Sprintf("counter %s is capped at %d", e.ID, e.Max)
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+// Charts (/chart?id=a&id=b&days=30) draw the daily hits of a few counters as
+// lines in one small SVG with a legend, e.g. for a README section comparing
+// pages. The points are the counters' day buckets.
+
+// Chart limits: counters per chart and days per line.
+const (
+	MaxChartSeries = 6
+	MaxChartDays   = 90
+)
+
+// ChartColors are the line colors, in series order.
+var ChartColors = []string{"#4c8bf5", "#e05d44", "#44cc11", "#fe7d37", "#a463f2", "#17a2b8"}
+
+// ChartSeries is one line of a chart: a counter's hits per day.
+type ChartSeries struct {
+	Label  string
+	Points []uint64 // one per chart day, oldest first
+}
+
+// LastDays returns the n UTC days up to and including today as of now,
+// oldest first.
+func LastDays(n int, now time.Time) []time.Time {
+	today := now.UTC().Truncate(24 * time.Hour)
+	days := make([]time.Time, n)
+	for i := range days {
+		days[i] = today.AddDate(0, 0, i-n+1)
+	}
+	return days
+}
+
+// Chart layout, in pixels. Widths are estimated from the raw text as for
+// badges.
+const (
+	chartWidth  = 400
+	chartPad    = 10
+	chartTop    = 20 // room for the max label
+	chartHeight = 80 // plot area
+	chartLegend = 16 // legend line height
+)
+
+// ChartSVG draws series over days (the dates under the x axis) as lines
+// scaled to the highest point, with the peak above the plot and a legend of
+// labels and totals below it.
+func ChartSVG(series []ChartSeries, days []time.Time, font string) string {
+	var peak uint64
+	for _, s := range series {
+		for _, p := range s.Points {
+			peak = max(peak, p)
+		}
+	}
+	plotW := float64(chartWidth - 2*chartPad)
+	baseline := chartTop + chartHeight
+	x := func(i int) float64 {
+		if len(days) < 2 {
+			return chartPad + plotW/2
+		}
+		return chartPad + plotW*float64(i)/float64(len(days)-1)
+	}
+	y := func(v uint64) float64 {
+		if peak == 0 {
+			return float64(baseline)
+		}
+		return float64(baseline) - float64(chartHeight)*float64(v)/float64(peak)
+	}
+
+	// legend items wrap onto further lines when they don't fit
+	type item struct {
+		x, y int
+		text string
+	}
+	items := make([]item, len(series))
+	lx, ly := chartPad, baseline+32
+	for i, s := range series {
+		var total uint64
+		for _, p := range s.Points {
+			total += p
+		}
+		text := s.Label + " (" + CompactNumber(total) + ")"
+		w := 14 + 6*len(text) + 16
+		if lx > chartPad && lx+w > chartWidth-chartPad {
+			lx, ly = chartPad, ly+chartLegend
+		}
+		items[i] = item{lx, ly, text}
+		lx += w
+	}
+	height := ly + 8
+
+	labels := make([]string, len(series))
+	for i, s := range series {
+		labels[i] = s.Label
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" role="img" aria-label="hits per day: %s">
+<g font-family="%s" font-size="11" fill="#777">
+<text x="%d" y="12">max %s/day</text>
+`, chartWidth, height, html.EscapeString(strings.Join(labels, ", ")), html.EscapeString(font), chartPad, CompactNumber(peak))
+	if len(days) > 0 {
+		fmt.Fprintf(&b, "<text x=\"%d\" y=\"%d\">%s</text>\n", chartPad, baseline+14, days[0].Format("Jan 2"))
+		fmt.Fprintf(&b, "<text x=\"%d\" y=\"%d\" text-anchor=\"end\">%s</text>\n", chartWidth-chartPad, baseline+14, days[len(days)-1].Format("Jan 2"))
+	}
+	for i, it := range items {
+		fmt.Fprintf(&b, "<rect x=\"%d\" y=\"%d\" width=\"10\" height=\"10\" rx=\"2\" fill=\"%s\"/>\n", it.x, it.y-9, ChartColors[i%len(ChartColors)])
+		fmt.Fprintf(&b, "<text x=\"%d\" y=\"%d\">%s</text>\n", it.x+14, it.y, html.EscapeString(it.text))
+	}
+	b.WriteString("</g>\n")
+	fmt.Fprintf(&b, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"#ccc\"/>\n", chartPad, baseline, chartWidth-chartPad, baseline)
+	for i, s := range series {
+		points := make([]string, len(s.Points))
+		for j, p := range s.Points {
+			points[j] = fmt.Sprintf("%.1f,%.1f", x(j), y(p))
+		}
+		fmt.Fprintf(&b, "<polyline fill=\"none\" stroke=\"%s\" stroke-width=\"2\" stroke-linejoin=\"round\" points=\"%s\"/>\n", ChartColors[i%len(ChartColors)], strings.Join(points, " "))
+	}
+	b.WriteString("</svg>")
+	return b.String()
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Clock tells the time to everything that depends on it: playground TTLs in
+// the memory, bolt and sqlite stores, dedupe and rate-limit windows, daily
+// webhooks, milestone and change timestamps. Tests and time-travel setups
+// install their own with SetClock; timeouts and caches keep using real time.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to Clock, e.g. a fixed time in a test:
+//
+//	defer core.SetClock(core.ClockFunc(func() time.Time { return t }))()
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time { return f() }
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock is the real time, the default.
+var SystemClock Clock = systemClock{}
+
+var clock atomic.Pointer[Clock]
+
+// Now is the time by the installed clock.
+func Now() time.Time {
+	if c := clock.Load(); c != nil {
+		return (*c).Now()
+	}
+	return time.Now()
+}
+
+// SetClock installs c (nil for SystemClock) and returns a function that
+// puts the previous clock back.
+func SetClock(c Clock) (restore func()) {
+	if c == nil {
+		c = SystemClock
+	}
+	prev := clock.Swap(&c)
+	return func() { clock.Store(prev) }
+}
+
+// TravelClock is the real time shifted by an adjustable offset, for moving
+// a running test server through days and windows (see /admin/clock).
+type TravelClock struct {
+	offset atomic.Int64 // nanoseconds
+}
+
+func (c *TravelClock) Now() time.Time { return time.Now().Add(c.Offset()) }
+
+// Offset is how far the clock is ahead of real time (negative: behind).
+func (c *TravelClock) Offset() time.Duration { return time.Duration(c.offset.Load()) }
+
+// Travel moves the clock by d and returns its new offset.
+func (c *TravelClock) Travel(d time.Duration) time.Duration {
+	return time.Duration(c.offset.Add(int64(d)))
+}
+
+// Set makes the clock read t now; it keeps running from there.
+func (c *TravelClock) Set(t time.Time) { c.offset.Store(int64(time.Until(t))) }
+
+// Reset returns the clock to real time.
+func (c *TravelClock) Reset() { c.offset.Store(0) }
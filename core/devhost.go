@@ -0,0 +1,33 @@
+package core
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// DefaultDevHosts are the hostnames treated as local development. A leading
+// "*." matches any subdomain. Loopback and private IP addresses always count
+// as development too.
+var DefaultDevHosts = []string{"localhost", "*.localhost", "*.local", "*.test"}
+
+// IsDevHost reports whether host (a hostname or IP address, without port) is
+// a development host: a loopback or private address, or a match in devHosts.
+func IsDevHost(host string, devHosts []string) bool {
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if host == "" {
+		return false
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast()
+	}
+	for _, h := range devHosts {
+		if suffix, ok := strings.CutPrefix(h, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == h {
+			return true
+		}
+	}
+	return false
+}
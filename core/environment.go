@@ -0,0 +1,35 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Environment separation: ENVIRONMENT names the deployment's keyspace. The
+// default, "production", keeps the historical unprefixed keys; any other
+// name (e.g. "staging") stores every key under "<name>:", so deployments that
+// share a database can't touch each other's counts.
+const Production = "production"
+
+var envNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// ParseEnvironment normalizes an environment name ("" is production).
+func ParseEnvironment(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return Production, nil
+	}
+	if !envNameRe.MatchString(name) {
+		return "", fmt.Errorf("environment %q: use lowercase letters, digits and dashes", name)
+	}
+	return name, nil
+}
+
+// EnvKeyPrefix is the prefix the environment name adds in front of every key.
+func EnvKeyPrefix(name string) string {
+	if name == "" || name == Production {
+		return ""
+	}
+	return name + ":"
+}
@@ -0,0 +1,30 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// GitHubOutput renders name/value pairs in the GITHUB_OUTPUT file format so a
+// workflow step can append the response with `>> "$GITHUB_OUTPUT"`. Values
+// containing newlines use the heredoc form with a random delimiter.
+func GitHubOutput(pairs ...[2]string) string {
+	var b strings.Builder
+	for _, kv := range pairs {
+		name, value := kv[0], kv[1]
+		if !strings.ContainsAny(value, "\r\n") {
+			b.WriteString(name + "=" + value + "\n")
+			continue
+		}
+		delim := "ghadelimiter_" + randomHex(8)
+		b.WriteString(name + "<<" + delim + "\n" + value + "\n" + delim + "\n")
+	}
+	return b.String()
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
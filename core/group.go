@@ -0,0 +1,61 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Counter groups: a group such as "blog" stands for several counters, e.g.
+// the pages of one site, and reads as the total of their hits.
+
+// GroupNamespaceSuffix marks a group member that is a whole namespace:
+// "blog/*" is every counter in blog.
+const GroupNamespaceSuffix = NamespaceSep + "*"
+
+// ParseGroups parses comma-separated name=members entries whose members are
+// joined with "+", such as "blog=blog/*,landing=home+pricing+signup".
+func ParseGroups(s string) (map[string][]string, error) {
+	out := make(map[string][]string)
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, list, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || name == RoundingDefault {
+			return nil, fmt.Errorf("%q should be name=id+id or name=namespace/*", entry)
+		}
+		if _, dup := out[name]; dup {
+			return nil, fmt.Errorf("group %q is defined twice", name)
+		}
+		var members []string
+		for _, m := range strings.Split(list, "+") {
+			if m = strings.TrimSpace(m); m == "" {
+				continue
+			}
+			if ns, isNS := strings.CutSuffix(m, GroupNamespaceSuffix); isNS {
+				if err := ValidateNamespace(ns); err != nil {
+					return nil, fmt.Errorf("group %q: %w", name, err)
+				}
+			}
+			members = append(members, m)
+		}
+		if len(members) == 0 {
+			return nil, fmt.Errorf("group %q has no members", name)
+		}
+		out[name] = members
+	}
+	return out, nil
+}
+
+// GroupMembers splits a group's members into counter ids and namespaces.
+func GroupMembers(members []string) (ids, namespaces []string) {
+	for _, m := range members {
+		if ns, ok := strings.CutSuffix(m, GroupNamespaceSuffix); ok {
+			namespaces = append(namespaces, ns)
+		} else {
+			ids = append(ids, m)
+		}
+	}
+	return ids, namespaces
+}
@@ -0,0 +1,41 @@
+package core
+
+import "time"
+
+// Value history: every counter's value is snapshotted once per history
+// interval (its last value in the interval), so its growth can be graphed
+// without an analytics stack.
+
+// Default history settings.
+const (
+	DefaultHistoryInterval  = time.Hour
+	DefaultHistoryRetention = 90 * 24 * time.Hour
+	DefaultHistoryRange     = 7 * 24 * time.Hour // read when from is not given
+	MaxHistoryPoints        = 5000               // per read
+)
+
+// HistoryPoint is a counter's value at the start of an interval.
+type HistoryPoint struct {
+	At   time.Time `json:"at"`
+	Hits Value     `json:"hits"`
+}
+
+// HistorySlot returns the start of the interval t is in.
+func HistorySlot(t time.Time, interval time.Duration) time.Time {
+	return t.UTC().Truncate(interval)
+}
+
+// HistoryRange keeps the points from..to (inclusive), oldest first, at most
+// MaxHistoryPoints of them, the newest.
+func HistoryRange(points []HistoryPoint, from, to time.Time) []HistoryPoint {
+	out := make([]HistoryPoint, 0)
+	for _, p := range points {
+		if !p.At.Before(from) && !p.At.After(to) {
+			out = append(out, p)
+		}
+	}
+	if len(out) > MaxHistoryPoints {
+		out = out[len(out)-MaxHistoryPoints:]
+	}
+	return out
+}
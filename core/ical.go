@@ -0,0 +1,94 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProjectedMilestone is an estimated future crossing.
+type ProjectedMilestone struct {
+	Milestone uint64
+	At        time.Time
+}
+
+// projectionHorizon is how far ahead ProjectMilestones looks; slower growth
+// would put milestones centuries away, past what a time.Duration holds.
+const projectionHorizon = 10 * 365 * 24 * time.Hour
+
+// ProjectMilestones estimates when the next n milestones above current will be
+// reached, assuming the average rate since the oldest recorded event holds.
+// events are newest first (as stored). Returns nil when there is not enough
+// history (no events, under an hour of data, or no growth). Milestones more
+// than projectionHorizon away are left out.
+func ProjectMilestones(events []MilestoneEvent, current uint64, now time.Time, n int) []ProjectedMilestone {
+	if len(events) == 0 || n <= 0 {
+		return nil
+	}
+	oldest := events[len(events)-1]
+	elapsed := now.Sub(oldest.At)
+	if elapsed < time.Hour || current <= oldest.Milestone {
+		return nil
+	}
+	perSecond := float64(current-oldest.Milestone) / elapsed.Seconds()
+	var next []uint64
+	for upper := current; len(next) < n && upper <= math.MaxUint64/10; {
+		upper *= 10
+		next = MilestonesCrossed(current, upper)
+	}
+	if len(next) > n {
+		next = next[:n]
+	}
+	out := make([]ProjectedMilestone, 0, len(next))
+	for _, m := range next {
+		secs := float64(m-current) / perSecond
+		if secs > projectionHorizon.Seconds() {
+			break // the later milestones are further still
+		}
+		eta := time.Duration(secs * float64(time.Second))
+		out = append(out, ProjectedMilestone{Milestone: m, At: now.Add(eta)})
+	}
+	return out
+}
+
+// MilestoneICal renders past events and projections as an iCalendar feed of
+// all-day events. Projected entries are marked TENTATIVE.
+func MilestoneICal(id string, events []MilestoneEvent, projected []ProjectedMilestone, now time.Time) []byte {
+	var b strings.Builder
+	line := func(s string) { b.WriteString(s + "\r\n") }
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//nums//milestones//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:" + icalEscape(id+" milestones"))
+	stamp := now.UTC().Format("20060102T150405Z")
+	event := func(uid, summary string, day time.Time, tentative bool) {
+		line("BEGIN:VEVENT")
+		line("UID:" + uid)
+		line("DTSTAMP:" + stamp)
+		line("DTSTART;VALUE=DATE:" + day.UTC().Format("20060102"))
+		line("SUMMARY:" + icalEscape(summary))
+		if tentative {
+			line("STATUS:TENTATIVE")
+		} else {
+			line("STATUS:CONFIRMED")
+		}
+		line("END:VEVENT")
+	}
+	for _, e := range events {
+		event(milestoneGUID(e)+"@nums", e.Title(), e.At, false)
+	}
+	for _, p := range projected {
+		uid := fmt.Sprintf("urn:nums:projection:%s:%s@nums", id, strconv.FormatUint(p.Milestone, 10))
+		event(uid, fmt.Sprintf("%s expected to cross %s views", id, groupThousands(p.Milestone)), p.At, true)
+	}
+	line("END:VCALENDAR")
+	return []byte(b.String())
+}
+
+// icalEscape escapes TEXT values per RFC 5545.
+func icalEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
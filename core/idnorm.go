@@ -0,0 +1,40 @@
+package core
+
+import (
+	"fmt"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ID normalization: clients that spell a page differently ("Blog/Post-1"
+// and "blog/post-1", or "café" typed with a combining accent) would
+// otherwise split its hits across counters.
+
+// ID normalization modes.
+const (
+	IDNormNone = ""
+	IDNormNFC  = "nfc"  // Unicode NFC only
+	IDNormFold = "fold" // NFC and case folding
+)
+
+// ValidateIDNorm checks an ID normalization mode.
+func ValidateIDNorm(mode string) error {
+	switch mode {
+	case IDNormNone, IDNormNFC, IDNormFold:
+		return nil
+	}
+	return fmt.Errorf("unknown id normalization %q (want nfc or fold)", mode)
+}
+
+// NormalizeID returns id in the normal form of mode. Folding is Unicode
+// case folding rather than lowercasing, so "STRASSE" and "straße" are one id.
+func NormalizeID(mode, id string) string {
+	switch mode {
+	case IDNormNFC:
+		return norm.NFC.String(id)
+	case IDNormFold:
+		return norm.NFC.String(cases.Fold().String(id))
+	}
+	return id
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"sort"
+	"time"
+)
+
+// CounterMeta is a counter's history, as served by /counter/meta and
+// /counters. Lifetime counts every hit ever recorded, so after a reset or
+// correction it keeps growing while the current value starts over. Tracking
+// starts with the first hit or reset it sees, at FirstSeen: a counter that
+// already had hits by then starts Lifetime at its count and has no
+// CreatedAt. Float counters are not tracked.
+type CounterMeta struct {
+	ID        string     `json:"id"`
+	Hits      Value      `json:"hits"`
+	Lifetime  uint64     `json:"lifetime_hits"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	FirstSeen *time.Time `json:"first_seen,omitempty"`
+	LastHit   *time.Time `json:"last_hit,omitempty"`
+	Resets    uint64     `json:"resets"`
+	LastReset *time.Time `json:"last_reset,omitempty"`
+}
+
+// Tracked reports whether any hit or reset has been recorded.
+func (m CounterMeta) Tracked() bool {
+	return m.FirstSeen != nil || m.CreatedAt != nil || m.LastHit != nil || m.LastReset != nil
+}
+
+// Hit records n hits at time at that took the counter from prev to prev+n.
+func (m *CounterMeta) Hit(prev, n uint64, at time.Time) {
+	m.begin(prev, at)
+	m.Lifetime += n
+	m.LastHit = &at
+}
+
+// Reset records that the counter, holding prev, was reset or overwritten.
+func (m *CounterMeta) Reset(prev uint64, at time.Time) {
+	m.begin(prev, at)
+	m.Resets++
+	m.LastReset = &at
+}
+
+func (m *CounterMeta) begin(prev uint64, at time.Time) {
+	if m.Tracked() {
+		return
+	}
+	m.Lifetime = prev
+	m.FirstSeen = &at
+	if prev == 0 {
+		m.CreatedAt = &at
+	}
+}
+
+// SortByLastHit orders ms by LastHit, least recent first; counters with no
+// recorded hit come first. It is stable, so equal times keep their order.
+func SortByLastHit(ms []CounterMeta) {
+	sort.SliceStable(ms, func(i, j int) bool {
+		a, b := ms[i].LastHit, ms[j].LastHit
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		return a.Before(*b)
+	})
+}
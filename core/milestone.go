@@ -0,0 +1,137 @@
+package core
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// MilestoneEvent records a counter crossing a notable value.
+type MilestoneEvent struct {
+	ID        string    `json:"id"`
+	Milestone uint64    `json:"milestone"`
+	At        time.Time `json:"at"`
+}
+
+// MilestonesCrossed returns the milestones m with prev < m <= next, in
+// ascending order. Milestones are 10, 25, 50, 100, 250, 500, 1,000, ...
+func MilestonesCrossed(prev, next uint64) []uint64 {
+	var out []uint64
+	for decade := uint64(10); decade <= next && decade <= math.MaxUint64/10; decade *= 10 {
+		for _, m := range [...]uint64{decade, decade * 5 / 2, decade * 5} {
+			if m > prev && m <= next {
+				out = append(out, m)
+			}
+		}
+	}
+	return out
+}
+
+// Title renders e.g. "home crossed 10,000 views".
+func (e MilestoneEvent) Title() string {
+	return fmt.Sprintf("%s crossed %s views", e.ID, groupThousands(e.Milestone))
+}
+
+func groupThousands(n uint64) string {
+	s := strconv.FormatUint(n, 10)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title   string  `xml:"title"`
+	Link    string  `xml:"link"`
+	GUID    rssGUID `xml:"guid"`
+	PubDate string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// MilestoneRSS renders events (newest first) as an RSS 2.0 feed. link is the
+// public page/badge URL for the counter.
+func MilestoneRSS(id, link string, events []MilestoneEvent) ([]byte, error) {
+	feed := rssFeed{Version: "2.0", Channel: rssChannel{
+		Title:       id + " milestones",
+		Link:        link,
+		Description: "Milestones reached by the " + id + " counter",
+	}}
+	for _, e := range events {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:   e.Title(),
+			Link:    link,
+			GUID:    rssGUID{Value: milestoneGUID(e)},
+			PubDate: e.At.UTC().Format(time.RFC1123Z),
+		})
+	}
+	return marshalFeed(feed)
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+}
+
+// MilestoneAtom renders events (newest first) as an Atom feed.
+func MilestoneAtom(id, link string, events []MilestoneEvent) ([]byte, error) {
+	feed := atomFeed{Title: id + " milestones", ID: "urn:nums:milestones:" + id, Link: atomLink{Href: link}}
+	feed.Updated = time.Unix(0, 0).UTC().Format(time.RFC3339)
+	if len(events) > 0 {
+		feed.Updated = events[0].At.UTC().Format(time.RFC3339)
+	}
+	for _, e := range events {
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   e.Title(),
+			ID:      milestoneGUID(e),
+			Updated: e.At.UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: link},
+		})
+	}
+	return marshalFeed(feed)
+}
+
+func milestoneGUID(e MilestoneEvent) string {
+	return "urn:nums:milestone:" + e.ID + ":" + strconv.FormatUint(e.Milestone, 10)
+}
+
+func marshalFeed(v any) ([]byte, error) {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
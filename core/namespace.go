@@ -0,0 +1,33 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Namespaces: ids such as "blog/home" or "acme/docs/home" belong to the
+// namespaces before each "/" ("blog"; "acme" and "acme/docs"), so one
+// deployment can serve several sites or users whose page ids would
+// otherwise collide. Namespaces can be listed, reset and given their own
+// tokens.
+
+// NamespaceSep separates a namespace from the rest of an id.
+const NamespaceSep = "/"
+
+// InNamespace reports whether id is in namespace ns, directly or in one of
+// its sub-namespaces.
+func InNamespace(id, ns string) bool { return strings.HasPrefix(id, ns+NamespaceSep) }
+
+// ValidateNamespace checks a namespace name: one or more non-empty parts
+// separated by "/".
+func ValidateNamespace(ns string) error {
+	if ns == "" {
+		return fmt.Errorf("namespace is required")
+	}
+	for _, part := range strings.Split(ns, NamespaceSep) {
+		if part == "" {
+			return fmt.Errorf("namespace %q has an empty part", ns)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseOffset parses an /admin/offset value (0 removes the offset).
+func ParseOffset(s string) (uint64, error) {
+	n, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("offset must be a non-negative integer")
+	}
+	return n, nil
+}
+
+// Offset returns v plus n, keeping its kind (integers saturate at the maximum).
+func (v Value) Offset(n uint64) Value {
+	if n == 0 {
+		return v
+	}
+	if v.isFloat {
+		return Float(v.f + float64(n))
+	}
+	if v.n > math.MaxUint64-n {
+		return Uint(math.MaxUint64)
+	}
+	return Uint(v.n + n)
+}
@@ -0,0 +1,17 @@
+package core
+
+import (
+	"strings"
+	"time"
+)
+
+// Playground counters: ids with TestIDPrefix let users experiment against a
+// production deployment. They expire TestCounterTTL after creation and must
+// be skipped by anything that lists or exports counters.
+const (
+	TestIDPrefix   = "test:"
+	TestCounterTTL = 24 * time.Hour
+)
+
+// IsTestID reports whether id is a playground counter.
+func IsTestID(id string) bool { return strings.HasPrefix(id, TestIDPrefix) }
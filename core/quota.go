@@ -0,0 +1,124 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Namespace quotas: a namespace (one site or user of a shared deployment)
+// can be limited to a number of counters and of hits per UTC day. Hits past
+// a quota are refused; owners are warned as a namespace nears one.
+
+// Quota kinds.
+const (
+	QuotaCounters = "counters"
+	QuotaHits     = "hits" // per UTC day
+)
+
+// Quota is a namespace's limits; 0 is no limit.
+type Quota struct {
+	Counters uint64 `json:"counters,omitempty"`
+	Hits     uint64 `json:"hits,omitempty"`
+}
+
+// ParseQuotas parses comma-separated namespace=limits entries whose limits
+// are joined with "+", such as "blog=counters:100+hits:10000,acme=hits:5000".
+func ParseQuotas(s string) (map[string]Quota, error) {
+	out := make(map[string]Quota)
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		ns, limits, ok := strings.Cut(entry, "=")
+		ns = strings.TrimSpace(ns)
+		if !ok {
+			return nil, fmt.Errorf("%q should be namespace=counters:N+hits:N", entry)
+		}
+		if err := ValidateNamespace(ns); err != nil {
+			return nil, err
+		}
+		var q Quota
+		for _, limit := range strings.Split(limits, "+") {
+			kind, raw, _ := strings.Cut(strings.TrimSpace(limit), ":")
+			n, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("%q: %s needs a positive limit, e.g. %s:100", entry, kind, kind)
+			}
+			switch kind {
+			case QuotaCounters:
+				q.Counters = n
+			case QuotaHits:
+				q.Hits = n
+			default:
+				return nil, fmt.Errorf("%q: unknown quota %q (want counters or hits)", entry, kind)
+			}
+		}
+		out[ns] = q
+	}
+	return out, nil
+}
+
+// Take turns the outcome of recording a hit against ns's quota q into the
+// usage after it: refused is 0, or 1 when the counters quota refused the hit
+// and 2 when the hits one did, which returns a *QuotaError.
+func (q Quota) Take(ns string, refused int64, counters, hits uint64) ([]QuotaUsage, error) {
+	usage := []QuotaUsage{
+		{Namespace: ns, Kind: QuotaCounters, Used: counters, Limit: q.Counters},
+		{Namespace: ns, Kind: QuotaHits, Used: hits, Limit: q.Hits},
+	}
+	switch refused {
+	case 1:
+		return nil, &QuotaError{QuotaUsage: usage[0]}
+	case 2:
+		return nil, &QuotaError{QuotaUsage: usage[1]}
+	}
+	return usage, nil
+}
+
+// QuotaNamespaces returns the namespaces id is in that have a quota,
+// outermost first.
+func QuotaNamespaces(quotas map[string]Quota, id string) []string {
+	var out []string
+	for ns := range quotas {
+		if InNamespace(id, ns) {
+			out = append(out, ns)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return len(out[i]) < len(out[j]) })
+	return out
+}
+
+// QuotaUsage is how much of one quota a namespace has used.
+type QuotaUsage struct {
+	Namespace string
+	Kind      string // QuotaCounters or QuotaHits
+	Used      uint64
+	Limit     uint64
+}
+
+// Near reports whether u has reached percent of its limit.
+func (u QuotaUsage) Near(percent uint64) bool {
+	return u.Limit > 0 && u.Used*100 >= u.Limit*percent
+}
+
+// Warning describes u for the namespace's owner, e.g. "namespace blog has
+// used 850 of 1000 hits today".
+func (u QuotaUsage) Warning() string {
+	what := "counters"
+	if u.Kind == QuotaHits {
+		what = "hits today"
+	}
+	return fmt.Sprintf("namespace %s has used %d of %d %s", u.Namespace, u.Used, u.Limit, what)
+}
+
+// QuotaError refuses a hit past a namespace's quota.
+type QuotaError struct{ QuotaUsage }
+
+func (e *QuotaError) Error() string {
+	if e.Kind == QuotaHits {
+		return fmt.Sprintf("namespace %s is at its quota of %d hits today", e.Namespace, e.Limit)
+	}
+	return fmt.Sprintf("namespace %s is at its quota of %d counters", e.Namespace, e.Limit)
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Public rounding: owners who prefer approximate public numbers can have a
+// counter's badges and public reads rounded to a step (10, 100, ...) while
+// the admin API keeps returning exact values.
+
+// RoundingDefault is the ROUND_COUNTS (and BADGE_MIN) key that applies to
+// every counter without its own entry.
+const RoundingDefault = "*"
+
+// ParseIDNumbers parses comma-separated id=number pairs such as
+// "home=100,blog=10"; what names the number in errors and every number must
+// be at least min.
+func ParseIDNumbers(s, what string, min uint64) (map[string]uint64, error) {
+	out := make(map[string]uint64)
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		id, raw, ok := strings.Cut(pair, "=")
+		n, err := strconv.ParseUint(strings.TrimSpace(raw), 10, 64)
+		if !ok || strings.TrimSpace(id) == "" || err != nil || n < min {
+			return nil, fmt.Errorf("%q should be id=%s with %s >= %d", pair, what, what, min)
+		}
+		out[strings.TrimSpace(id)] = n
+	}
+	return out, nil
+}
+
+// ParseRoundingStep validates an admin-supplied step (0 clears rounding).
+func ParseRoundingStep(s string) (uint64, error) {
+	step, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || step == 1 {
+		return 0, fmt.Errorf("step must be 0 (exact) or an integer >= 2")
+	}
+	return step, nil
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Scheduled resets: a counter such as "views today" goes back to zero at the
+// start of every UTC day, week (from Monday) or month, and the hits it held
+// are archived as a ResetRecord.
+
+// Reset schedules.
+const (
+	ResetDaily   = "daily"
+	ResetWeekly  = "weekly"
+	ResetMonthly = "monthly"
+)
+
+// resetSchedules are the schedules by code, as kept in per-counter number
+// tables (0 is none).
+var resetSchedules = []string{"", ResetDaily, ResetWeekly, ResetMonthly}
+
+// ResetCode returns the code of schedule every; "none" is 0, to turn off a
+// schedule from the environment.
+func ResetCode(every string) (uint64, error) {
+	if every == "none" {
+		return 0, nil
+	}
+	for code, s := range resetSchedules {
+		if s != "" && s == every {
+			return uint64(code), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown reset schedule %q (want daily, weekly, monthly or none)", every)
+}
+
+// ResetSchedule returns the schedule of code, or "" for none.
+func ResetSchedule(code uint64) string {
+	if code >= uint64(len(resetSchedules)) {
+		return ""
+	}
+	return resetSchedules[code]
+}
+
+// ParseResetSchedules parses comma-separated id=schedule pairs such as
+// "today=daily,week=weekly" into codes. Every counter is named: a "*" entry
+// would reset them all.
+func ParseResetSchedules(s string) (map[string]uint64, error) {
+	out := make(map[string]uint64)
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		id, every, ok := strings.Cut(pair, "=")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" || id == RoundingDefault {
+			return nil, fmt.Errorf("%q should be id=daily, id=weekly or id=monthly", pair)
+		}
+		code, err := ResetCode(strings.TrimSpace(every))
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", pair, err)
+		}
+		out[id] = code
+	}
+	return out, nil
+}
+
+// ResetPeriodStart returns when the current period of schedule every began
+// as of now: midnight UTC today, on Monday or on the 1st.
+func ResetPeriodStart(every string, now time.Time) time.Time {
+	period := map[string]string{ResetDaily: "today", ResetWeekly: "week", ResetMonthly: "month"}[every]
+	days, ok := PeriodDays(period, now)
+	if !ok {
+		return time.Time{}
+	}
+	return days[0]
+}
+
+// NextReset returns when the next period of schedule every begins after
+// now, the time of the counter's next reset.
+func NextReset(every string, now time.Time) time.Time {
+	start := ResetPeriodStart(every, now)
+	switch every {
+	case ResetDaily:
+		return start.AddDate(0, 0, 1)
+	case ResetWeekly:
+		return start.AddDate(0, 0, 7)
+	case ResetMonthly:
+		return start.AddDate(0, 1, 0)
+	}
+	return time.Time{}
+}
+
+// ResetRecord archives the hits a counter held when its schedule reset it.
+type ResetRecord struct {
+	ID      string    `json:"id"`
+	Hits    uint64    `json:"hits"`
+	Every   string    `json:"every"`
+	ResetAt time.Time `json:"reset_at"`
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Target badges (/badge?target=10000) show a count against a goal, for
+// fundraising-style or campaign displays: "7,842 / 10k", or with
+// style=progress a bar filled to the share reached.
+
+// CompactNumber formats n briefly, rounding down to one decimal: 950, 1.5k,
+// 10k, 2.5M.
+func CompactNumber(n uint64) string {
+	for _, u := range []struct {
+		div    uint64
+		suffix string
+	}{{1e12, "T"}, {1e9, "B"}, {1e6, "M"}, {1e3, "k"}} {
+		if n >= u.div {
+			return strconv.FormatFloat(math.Floor(float64(n)/float64(u.div)*10)/10, 'f', -1, 64) + u.suffix
+		}
+	}
+	return strconv.FormatUint(n, 10)
+}
+
+// GroupDigits inserts thousands separators into s when it is a plain
+// integer ("7842" becomes "7,842"); anything else is returned as is.
+func GroupDigits(s string) string {
+	if s == "" || strings.Trim(s, "0123456789") != "" {
+		return s
+	}
+	var b strings.Builder
+	for i, c := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// TargetText shows a formatted count against target, e.g. "7,842 / 10k".
+func TargetText(count string, target uint64) string {
+	return GroupDigits(count) + " / " + CompactNumber(target)
+}
+
+// Progress returns count's share of target as badge text ("78%", rounded
+// down) and the bar fraction (at most 1). Counts below min are not
+// revealed: the text is "<N%" for the share min stands for, and the bar is
+// empty.
+func Progress(count Value, target, min uint64) (text string, fraction float64) {
+	if target == 0 {
+		return "", 0
+	}
+	if !count.IsFloat() && count.Uint64() < min {
+		return "<" + strconv.FormatUint(max(1, (min*100+target-1)/target), 10) + "%", 0
+	}
+	share := count.Float64() / float64(target)
+	return strconv.FormatFloat(math.Floor(share*100), 'f', 0, 64) + "%", math.Min(share, 1)
+}
+
+// Colors of progress badges when the request doesn't pick them.
+const (
+	ProgressLabelColor = "#555"
+	ProgressTrackColor = "#9f9f9f"
+)
+
+// ProgressBadgeSVG creates a classic style badge whose value part is a bar
+// filled with color up to fraction (0 to 1) over a track of trackColor;
+// labelColor is the background of the label.
+func ProgressBadgeSVG(label, textVal, font string, fraction float64, labelColor, color, trackColor string) string {
+	labelWidth := 6*len(label) + 10
+	valWidth := 6*len(textVal) + 10
+	if valWidth < 60 { // room for the bar to show
+		valWidth = 60
+	}
+	total := labelWidth + valWidth
+	fill := int(math.Round(float64(valWidth) * math.Max(0, math.Min(fraction, 1))))
+	label, textVal = html.EscapeString(label), html.EscapeString(textVal)
+	font = html.EscapeString(font)
+	labelColor, color, trackColor = html.EscapeString(labelColor), html.EscapeString(color), html.EscapeString(trackColor)
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">
+<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<rect rx="3" width="%d" height="20" fill="%s"/>
+<rect rx="3" x="%d" width="%d" height="20" fill="%s"/>
+<rect rx="3" x="%d" width="%d" height="20" fill="%s"/>
+<rect rx="3" width="%d" height="20" fill="url(#s)"/>
+<g fill="#fff" text-anchor="middle" font-family="%s" font-size="11">
+<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text>
+<text x="%d" y="15">%s</text>
+<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text>
+<text x="%d" y="15">%s</text>
+</g>
+</svg>`,
+		total, label, textVal,
+		total, labelColor, labelWidth, valWidth, trackColor, labelWidth, fill, color,
+		total, font,
+		labelWidth/2, label,
+		labelWidth/2, label,
+		labelWidth+valWidth/2, textVal,
+		labelWidth+valWidth/2, textVal,
+	)
+}
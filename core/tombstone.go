@@ -0,0 +1,23 @@
+package core
+
+import "time"
+
+// Tombstone is a soft-deleted counter: the hits it held when DELETE /counter
+// removed it, kept for the retention window so POST /counter/restore can
+// put them back. Once the window has passed, the counter is deleted for
+// good.
+type Tombstone struct {
+	ID        string    `json:"id"`
+	Hits      uint64    `json:"hits"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// RestorableUntil returns when the retention window of t ends.
+func (t Tombstone) RestorableUntil(retention time.Duration) time.Time {
+	return t.DeletedAt.Add(retention)
+}
+
+// Expired reports whether the retention window of t has passed as of now.
+func (t Tombstone) Expired(retention time.Duration, now time.Time) bool {
+	return !now.Before(t.RestorableUntil(retention))
+}
@@ -0,0 +1,182 @@
+// Package core holds counter types shared by the standalone server and the
+// serverless handler. It imports neither net/http nor os, so it also builds
+// for GOOS=js and GOOS=wasip1 (Cloudflare Workers, browser badge previews);
+// request handling lives in package web.
+package core
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Value is a counter reading: either an integer hit count (the default) or a
+// float aggregate such as total MB downloaded.
+type Value struct {
+	n       uint64
+	f       float64
+	isFloat bool
+}
+
+// Uint returns an integer Value.
+func Uint(n uint64) Value { return Value{n: n} }
+
+// Float returns a float Value.
+func Float(f float64) Value { return Value{f: f, isFloat: true} }
+
+// IsFloat reports whether v holds a float aggregate.
+func (v Value) IsFloat() bool { return v.isFloat }
+
+// Uint64 returns the integer value (floats are truncated, negatives clamp to 0).
+func (v Value) Uint64() uint64 {
+	if !v.isFloat {
+		return v.n
+	}
+	if v.f <= 0 {
+		return 0
+	}
+	return uint64(v.f)
+}
+
+// Float64 returns the value as a float.
+func (v Value) Float64() float64 {
+	if v.isFloat {
+		return v.f
+	}
+	return float64(v.n)
+}
+
+// IsZero reports whether v is 0 (either kind).
+func (v Value) IsZero() bool { return v.n == 0 && v.f == 0 }
+
+// Next returns the value after a default increment (v+1 for integers).
+func (v Value) Next() Value {
+	if v.isFloat {
+		return Float(v.f + 1)
+	}
+	return Uint(v.n + 1)
+}
+
+// Add returns the value after n increments (v+n for integers).
+func (v Value) Add(n uint64) Value {
+	if v.isFloat {
+		return Float(v.f + float64(n))
+	}
+	return Uint(v.n + n)
+}
+
+// AddFloat returns the float value after adding f (integers become floats).
+func (v Value) AddFloat(f float64) Value { return Float(v.Float64() + f) }
+
+// Round returns v rounded to the nearest multiple of step (halves round up),
+// keeping its kind. A step of 0 or 1 leaves v unchanged.
+func (v Value) Round(step uint64) Value {
+	if step <= 1 {
+		return v
+	}
+	if v.isFloat {
+		return Float(math.Round(v.f/float64(step)) * float64(step))
+	}
+	r := v.n / step * step
+	if v.n-r >= (step+1)/2 && r <= math.MaxUint64-step {
+		r += step
+	}
+	return Uint(r)
+}
+
+// String renders integers exactly and floats in their shortest form.
+func (v Value) String() string {
+	if v.isFloat {
+		return strconv.FormatFloat(v.f, 'f', -1, 64)
+	}
+	return strconv.FormatUint(v.n, 10)
+}
+
+// Format renders v for display. precision < 0 keeps the shortest exact form;
+// otherwise floats are rounded to that many decimals (integers are unaffected).
+// suffix is appended verbatim (e.g. " MB").
+func (v Value) Format(precision int, suffix string) string {
+	s := v.String()
+	if v.isFloat && precision >= 0 {
+		s = strconv.FormatFloat(v.f, 'f', precision, 64)
+	}
+	return s + suffix
+}
+
+// FormatMin is Format, except that values below min render as "<min" plus
+// suffix, so a new counter's badge doesn't show "3 views". min 0 disables it.
+func (v Value) FormatMin(precision int, suffix string, min uint64) string {
+	if min > 0 && v.Float64() < float64(min) {
+		return "<" + strconv.FormatUint(min, 10) + suffix
+	}
+	return v.Format(precision, suffix)
+}
+
+// MarshalJSON encodes v as a JSON number.
+func (v Value) MarshalJSON() ([]byte, error) { return []byte(v.String()), nil }
+
+// UnmarshalJSON decodes a JSON number written by MarshalJSON.
+func (v *Value) UnmarshalJSON(b []byte) error {
+	parsed, err := ParseValue(string(b))
+	if err != nil {
+		return err
+	}
+	*v = parsed
+	return nil
+}
+
+// ErrInvalidValue is returned by ParseValue/ParseAmount for unusable input.
+var ErrInvalidValue = errors.New("invalid counter value")
+
+// ParseValue parses a stored counter value. Plain digits are integers; anything
+// with a decimal point or exponent is a float (as written by INCRBYFLOAT).
+func ParseValue(s string) (Value, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return Uint(n), nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return Value{}, ErrInvalidValue
+	}
+	return Float(f), nil
+}
+
+// ParseAmount parses a positive, finite float increment.
+func ParseAmount(s string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) || f <= 0 {
+		return 0, ErrInvalidValue
+	}
+	return f, nil
+}
+
+// Gauge types. A gauge keeps the type of its first write.
+const (
+	GaugeInt   = "int"
+	GaugeFloat = "float"
+)
+
+// maxExactInt is the largest integer a float64 holds exactly (2^53). Int
+// gauges are kept as floats, so their deltas stay within it.
+const maxExactInt = 1 << 53
+
+// ParseDelta parses a nonzero, finite float gauge delta; negatives lower
+// the gauge.
+func ParseDelta(s string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) || f == 0 {
+		return 0, ErrInvalidValue
+	}
+	return f, nil
+}
+
+// ParseIntDelta parses a nonzero integer gauge delta within ±2^53.
+func ParseIntDelta(s string) (int64, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n == 0 || n > maxExactInt || n < -maxExactInt {
+		return 0, ErrInvalidValue
+	}
+	return n, nil
+}
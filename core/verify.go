@@ -0,0 +1,95 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Attestation is the statement signed by GET /verify. Issuer is the
+// configured PUBLIC_URL, never taken from request headers, so a client
+// cannot get another origin signed; it is left out without one.
+type Attestation struct {
+	ID       string    `json:"id"`
+	Hits     Value     `json:"hits"`
+	IssuedAt time.Time `json:"issued_at"`
+	Issuer   string    `json:"issuer,omitempty"`
+}
+
+// SignedAttestation carries the exact signed bytes (Payload, a JSON string)
+// so verifiers never have to re-serialize anything.
+type SignedAttestation struct {
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"` // base64 (std) Ed25519 signature over Payload
+	KeyID     string `json:"key_id"`
+	Alg       string `json:"alg"`
+}
+
+// ParseSigningKey decodes a base64 Ed25519 seed (32 bytes) or full private key (64 bytes).
+func ParseSigningKey(b64 string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(b64))
+	if err != nil {
+		return nil, fmt.Errorf("decode signing key: %w", err)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	}
+	return nil, fmt.Errorf("signing key must be %d or %d bytes, got %d", ed25519.SeedSize, ed25519.PrivateKeySize, len(raw))
+}
+
+// KeyID is a short fingerprint of a public key (first 8 bytes of its SHA-256, hex).
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Sign serializes a and signs the result with priv.
+func Sign(priv ed25519.PrivateKey, a Attestation) (SignedAttestation, error) {
+	payload, err := json.Marshal(a)
+	if err != nil {
+		return SignedAttestation{}, err
+	}
+	return SignedAttestation{
+		Payload:   string(payload),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, payload)),
+		KeyID:     KeyID(priv.Public().(ed25519.PublicKey)),
+		Alg:       "Ed25519",
+	}, nil
+}
+
+// ErrBadSignature is returned by Verify when the signature does not match.
+var ErrBadSignature = errors.New("signature verification failed")
+
+// Verify checks s against pub and returns the decoded attestation.
+func Verify(pub ed25519.PublicKey, s SignedAttestation) (Attestation, error) {
+	sig, err := base64.StdEncoding.DecodeString(s.Signature)
+	if err != nil || !ed25519.Verify(pub, []byte(s.Payload), sig) {
+		return Attestation{}, ErrBadSignature
+	}
+	var a Attestation
+	if err := json.Unmarshal([]byte(s.Payload), &a); err != nil {
+		return Attestation{}, err
+	}
+	return a, nil
+}
+
+// PublicKeyDocument is served at /.well-known/nums-verify-key.
+type PublicKeyDocument struct {
+	Alg       string `json:"alg"`
+	KeyID     string `json:"key_id"`
+	PublicKey string `json:"public_key"` // base64 (std)
+}
+
+// NewPublicKeyDocument describes pub for publication.
+func NewPublicKeyDocument(pub ed25519.PublicKey) PublicKeyDocument {
+	return PublicKeyDocument{Alg: "Ed25519", KeyID: KeyID(pub), PublicKey: base64.StdEncoding.EncodeToString(pub)}
+}
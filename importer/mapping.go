@@ -0,0 +1,70 @@
+// Package importer holds the pieces shared by the analytics import commands
+// (cmd/ga-import, cmd/analytics-sync): mapping page paths to counter ids.
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Mapping maps normalized page paths to counter ids. Several pages may map to
+// the same id.
+type Mapping map[string]string
+
+// LoadMapping parses "page=id,page=id" or, if raw names an existing file, a
+// CSV of page,id rows ("#" starts a comment).
+func LoadMapping(raw string) (Mapping, error) {
+	pages := make(Mapping)
+	if _, err := os.Stat(raw); err == nil {
+		f, err := os.Open(raw)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r := csv.NewReader(f)
+		r.Comment = '#'
+		r.FieldsPerRecord = 2
+		rows, err := r.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			pages[NormalizePage(row[0])] = strings.TrimSpace(row[1])
+		}
+	} else {
+		for _, pair := range strings.Split(raw, ",") {
+			page, id, ok := strings.Cut(pair, "=")
+			if !ok {
+				return nil, fmt.Errorf("bad pair %q (want page=id)", pair)
+			}
+			pages[NormalizePage(page)] = strings.TrimSpace(id)
+		}
+	}
+	for page, id := range pages {
+		if id == "" {
+			return nil, fmt.Errorf("empty id for page %q", page)
+		}
+	}
+	return pages, nil
+}
+
+// Lookup returns the id mapped to page (normalized first).
+func (m Mapping) Lookup(page string) (string, bool) {
+	id, ok := m[NormalizePage(page)]
+	return id, ok
+}
+
+// NormalizePage trims whitespace, query strings and trailing slashes so
+// "/blog/hello/?utm=x" and "/blog/hello" map to the same id.
+func NormalizePage(p string) string {
+	p = strings.TrimSpace(p)
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p = p[:i]
+	}
+	if len(p) > 1 {
+		p = strings.TrimRight(p, "/")
+	}
+	return p
+}
@@ -0,0 +1,171 @@
+//go:build !minimal
+
+// Package numstest runs the counter handler (api.Handler) for integration
+// tests of programs that embed it. Each Server has its own in-process Redis
+// (miniredis), so counts start at zero and nothing outside the test is
+// touched:
+//
+//	func TestPageCounts(t *testing.T) {
+//		s := numstest.New(t)
+//		s.Hit("home")
+//		s.Hit("home")
+//		s.AssertCount("home", 2)
+//	}
+//
+// The handler is configured per process (its Redis client, Authorize and
+// OnHit hooks), so tests that start a Server must not run in parallel.
+package numstest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/advayc/nums/api"
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/web"
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// Server is the handler on an httptest server, backed by miniredis.
+type Server struct {
+	*httptest.Server
+	Redis *miniredis.Miniredis
+	// Token is sent as X-Auth-Token when set, for handlers that require
+	// SECRET_TOKEN or check it in an Authorize hook.
+	Token string
+
+	tb     testing.TB
+	prefix string // Redis key prefix of counters in the ENVIRONMENT keyspace
+}
+
+// New serves api.Handler. The server and its Redis are closed when the test
+// ends.
+func New(tb testing.TB) *Server {
+	tb.Helper()
+	return Start(tb, http.HandlerFunc(api.Handler))
+}
+
+// Start serves h, a handler that mounts api.Handler (e.g. the program's own
+// mux with its hooks registered), with the counters in a fresh miniredis.
+func Start(tb testing.TB, h http.Handler) *Server {
+	tb.Helper()
+	env, err := web.EnvironmentFromEnv()
+	if err != nil {
+		tb.Fatalf("numstest: %v", err)
+	}
+	mr := miniredis.NewMiniRedis()
+	if err := mr.Start(); err != nil {
+		tb.Fatalf("numstest: start redis: %v", err)
+	}
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	api.UseRedis(rc)
+	s := &Server{Server: httptest.NewServer(h), Redis: mr, tb: tb, prefix: core.EnvKeyPrefix(env) + "hits:"}
+	tb.Cleanup(func() {
+		s.Close()
+		api.UseRedis(nil)
+		_ = rc.Close()
+		mr.Close()
+	})
+	return s
+}
+
+// Do sends a request to path (e.g. "/count?id=home") with the token and
+// returns the status code and body.
+func (s *Server) Do(method, path string, body io.Reader) (int, []byte) {
+	s.tb.Helper()
+	req, err := http.NewRequest(method, s.URL+path, body)
+	if err != nil {
+		s.tb.Fatalf("numstest: %v", err)
+	}
+	if s.Token != "" {
+		req.Header.Set("X-Auth-Token", s.Token)
+	}
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		s.tb.Fatalf("numstest: %s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.tb.Fatalf("numstest: %s %s: %v", method, path, err)
+	}
+	return resp.StatusCode, b
+}
+
+// Hit records a hit on id with POST /hit and returns the hits in the
+// response. A status other than 200 fails the test.
+func (s *Server) Hit(id string) uint64 {
+	s.tb.Helper()
+	return s.hits(http.MethodPost, "/hit?id="+url.QueryEscape(id))
+}
+
+// HitBy records n hits on id at once (/hit?by=n).
+func (s *Server) HitBy(id string, n uint64) uint64 {
+	s.tb.Helper()
+	return s.hits(http.MethodPost, "/hit?id="+url.QueryEscape(id)+"&by="+strconv.FormatUint(n, 10))
+}
+
+// Count returns id's public count from GET /count, with display offsets and
+// rounding applied. A status other than 200 fails the test.
+func (s *Server) Count(id string) uint64 {
+	s.tb.Helper()
+	return s.hits(http.MethodGet, "/count?id="+url.QueryEscape(id))
+}
+
+// Stored returns id's count as kept in Redis, 0 if it has none.
+func (s *Server) Stored(id string) uint64 {
+	s.tb.Helper()
+	v, err := s.Redis.Get(s.prefix + id)
+	if err == miniredis.ErrKeyNotFound {
+		return 0
+	}
+	if err != nil {
+		s.tb.Fatalf("numstest: %s: %v", id, err)
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		s.tb.Fatalf("numstest: %s holds %q, not a hit count", id, v)
+	}
+	return n
+}
+
+// SetCount stores n as id's count, e.g. to start a test past a milestone.
+func (s *Server) SetCount(id string, n uint64) {
+	s.tb.Helper()
+	if err := s.Redis.Set(s.prefix+id, strconv.FormatUint(n, 10)); err != nil {
+		s.tb.Fatalf("numstest: %v", err)
+	}
+}
+
+// AssertCount reports an error unless id's stored count is want.
+func (s *Server) AssertCount(id string, want uint64) {
+	s.tb.Helper()
+	if got := s.Stored(id); got != want {
+		s.tb.Errorf("count of %q = %d, want %d", id, got, want)
+	}
+}
+
+func (s *Server) hits(method, path string) uint64 {
+	s.tb.Helper()
+	status, body := s.Do(method, path, nil)
+	if status != http.StatusOK {
+		s.tb.Fatalf("numstest: %s %s: %d %s", method, path, status, body)
+	}
+	var resp struct {
+		Hits json.Number `json:"hits"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		s.tb.Fatalf("numstest: %s %s: %v in %s", method, path, err, body)
+	}
+	n, err := strconv.ParseUint(resp.Hits.String(), 10, 64)
+	if err != nil {
+		s.tb.Fatalf("numstest: %s %s: hits %q is not a hit count", method, path, resp.Hits)
+	}
+	return n
+}
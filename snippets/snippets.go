@@ -0,0 +1,100 @@
+// Package snippets renders copy-paste embed/client examples for a counter.
+package snippets
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Snippet is one tab of example code.
+type Snippet struct {
+	Lang  string `json:"lang"`
+	Label string `json:"label"`
+	Code  string `json:"code"`
+}
+
+// Generate returns examples for reading and incrementing counter id on the
+// deployment at baseURL (no trailing slash). The write token is never
+// embedded; examples read it from a SECRET_TOKEN environment variable.
+func Generate(baseURL, id string) []Snippet {
+	q := url.Values{"id": {id}}.Encode()
+	hitURL := baseURL + "/hit?" + q
+	countURL := baseURL + "/count?" + q
+	badgeURL := baseURL + "/badge?" + q
+
+	return []Snippet{
+		{
+			Lang:  "markdown",
+			Label: "Markdown",
+			Code:  fmt.Sprintf("![views](%s)", badgeURL),
+		},
+		{
+			Lang:  "html",
+			Label: "HTML",
+			Code:  fmt.Sprintf(`<img src="%s" alt="views">`, badgeURL),
+		},
+		{
+			Lang:  "bash",
+			Label: "curl",
+			Code: fmt.Sprintf(`# increment
+curl -H "X-Auth-Token: $SECRET_TOKEN" "%s"
+# read
+curl "%s"`, hitURL, countURL),
+		},
+		{
+			Lang:  "python",
+			Label: "Python",
+			Code: fmt.Sprintf(`import os
+import requests
+
+r = requests.post(%q, headers={"X-Auth-Token": os.environ["SECRET_TOKEN"]})
+print(r.json()["hits"])`, hitURL),
+		},
+		{
+			Lang:  "javascript",
+			Label: "JavaScript",
+			Code: fmt.Sprintf(`const res = await fetch(%q, {
+  method: "POST",
+  headers: { "X-Auth-Token": process.env.SECRET_TOKEN },
+});
+const { hits } = await res.json();
+console.log(hits);`, hitURL),
+		},
+		{
+			Lang:  "go",
+			Label: "Go",
+			Code: fmt.Sprintf(`req, _ := http.NewRequest(http.MethodPost, %q, nil)
+req.Header.Set("X-Auth-Token", os.Getenv("SECRET_TOKEN"))
+resp, err := http.DefaultClient.Do(req)
+if err != nil {
+	log.Fatal(err)
+}
+defer resp.Body.Close()
+var out struct{ Hits uint64 `+"`json:\"hits\"`"+` }
+_ = json.NewDecoder(resp.Body).Decode(&out)
+fmt.Println(out.Hits)`, hitURL),
+		},
+	}
+}
+
+// BaseURL returns override (e.g. PUBLIC_URL) when set, otherwise the scheme
+// and host the request arrived on, honoring X-Forwarded-Proto/Host.
+func BaseURL(r *http.Request, override string) string {
+	if override != "" {
+		return strings.TrimRight(override, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if p := r.Header.Get("X-Forwarded-Proto"); p != "" {
+		scheme = p
+	}
+	host := r.Host
+	if h := r.Header.Get("X-Forwarded-Host"); h != "" {
+		host = h
+	}
+	return scheme + "://" + host
+}
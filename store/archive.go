@@ -0,0 +1,288 @@
+//go:build !minimal
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/advayc/nums/core"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// Archive keeps a Redis hot store small by moving counters that have not been
+// read or written for IdleAfter into a ColdStore, and restoring them on their
+// next access. Idleness comes from Redis' own OBJECT IDLETIME, so it needs an
+// LRU (or noeviction) maxmemory-policy; with an LFU policy nothing is archived.
+//
+// The ids with a value in the archive are the set "archived:<prefix>", which
+// every access checks (SISMEMBER) before it touches the counter. Archived
+// counters are invisible to listing (Each) and transactions until they are
+// restored by a hit or a read.
+type Archive struct {
+	Hot       *RedisCounter
+	Cold      ColdStore
+	IdleAfter time.Duration
+}
+
+func NewArchive(hot *RedisCounter, cold ColdStore, idleAfter time.Duration) *Archive {
+	return &Archive{Hot: hot, Cold: cold, IdleAfter: idleAfter}
+}
+
+func (a *Archive) Capabilities() Capabilities { return a.Hot.Capabilities() }
+
+func (a *Archive) archivedKey() string { return "archived:" + a.Hot.Prefix() }
+
+func (a *Archive) Inc(ctx context.Context, id string) (uint64, error) {
+	return a.IncBy(ctx, id, 1)
+}
+
+// IncBy adds n, restoring the counter first if it has a value in the archive.
+func (a *Archive) IncBy(ctx context.Context, id string, n uint64) (uint64, error) {
+	a.restoreOrWarn(ctx, id)
+	return a.Hot.IncBy(ctx, id, n)
+}
+
+func (a *Archive) IncFloat(ctx context.Context, id string, by float64) (float64, error) {
+	a.restoreOrWarn(ctx, id)
+	return a.Hot.IncFloat(ctx, id, by)
+}
+
+// Get reads the hot value, restoring the counter first if it has a value in
+// the archive.
+func (a *Archive) Get(ctx context.Context, id string) (core.Value, error) {
+	a.restoreOrWarn(ctx, id)
+	return a.Hot.Get(ctx, id)
+}
+
+func (a *Archive) Expire(ctx context.Context, id string, ttl time.Duration) error {
+	return a.Hot.Expire(ctx, id, ttl)
+}
+
+func (a *Archive) Each(ctx context.Context, fn func(id string, v core.Value) error) error {
+	return a.Hot.Each(ctx, fn)
+}
+
+func (a *Archive) Apply(ctx context.Context, ops []Op) ([]uint64, error) {
+	return a.Hot.Apply(ctx, ops)
+}
+
+// restoreOrWarn restores id, logging a failure: the access goes ahead on the
+// hot value, and the archived one is restored by a later access.
+func (a *Archive) restoreOrWarn(ctx context.Context, id string) {
+	if _, err := a.restore(ctx, id); err != nil {
+		log.Printf("(warn) archive restore of %q failed: %v", id, err)
+	}
+}
+
+// lock makes the caller the only one restoring or archiving id for a
+// minute, or reports false if another already is; unlock ends it.
+func (a *Archive) lock(ctx context.Context, id string) (unlock func(), ok bool, err error) {
+	key := "archive-restore:" + a.Hot.Key(id)
+	ok, err = a.Hot.Client().SetNX(ctx, key, 1, time.Minute).Result()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return func() { a.Hot.Client().Del(context.WithoutCancel(ctx), key) }, true, nil
+}
+
+// restoreScript adds the archived value ARGV[2] (a float if ARGV[3] is 1) to
+// KEYS[1] if ARGV[1] is still in the archived set KEYS[2], and takes it out,
+// so the value is added exactly once. It returns whether it restored.
+var restoreScript = redis.NewScript(`
+if redis.call('SREM', KEYS[2], ARGV[1]) == 0 then
+  return 0
+end
+if ARGV[3] == '1' then
+  redis.call('INCRBYFLOAT', KEYS[1], ARGV[2])
+else
+  redis.call('INCRBY', KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// restore moves id from the archive back into Redis, adding the archived value
+// to whatever the hot key holds. A short Redis lock makes one caller the
+// restorer; restored reports whether this call restored anything.
+func (a *Archive) restore(ctx context.Context, id string) (restored bool, err error) {
+	if core.IsTestID(id) || core.IsDayBucketID(id) {
+		return false, nil
+	}
+	client := a.Hot.Client()
+	archived, err := client.SIsMember(ctx, a.archivedKey(), id).Result()
+	if err != nil || !archived {
+		return false, err
+	}
+	unlock, ok, err := a.lock(ctx, id)
+	if err != nil || !ok {
+		return false, err
+	}
+	defer unlock()
+	v, ok, err := a.Cold.Get(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		if _, cluster := client.(*redis.ClusterClient); cluster {
+			// the set is in another slot: take id out first, so a failure
+			// in between can't add the value twice
+			n, err := client.SRem(ctx, a.archivedKey(), id).Result()
+			if err != nil || n == 0 {
+				return false, err
+			}
+			if v.IsFloat() {
+				err = client.IncrByFloat(ctx, a.Hot.Key(id), v.Float64()).Err()
+			} else {
+				err = client.IncrBy(ctx, a.Hot.Key(id), int64(v.Uint64())).Err()
+			}
+			if err != nil {
+				return false, err
+			}
+		} else {
+			isFloat := "0"
+			if v.IsFloat() {
+				isFloat = "1"
+			}
+			n, err := restoreScript.Run(ctx, client, []string{a.Hot.Key(id), a.archivedKey()}, id, v.String(), isFloat).Int()
+			if err != nil || n == 0 { // another instance restored it first
+				return false, err
+			}
+		}
+	} else if err := client.SRem(ctx, a.archivedKey(), id).Err(); err != nil {
+		return false, err
+	}
+	if err := a.Cold.Delete(ctx, id); err != nil {
+		// harmless: without the id in the archived set the copy is stale, and
+		// the next sweep of id overwrites it
+		log.Printf("(warn) archive copy of restored counter %q could not be deleted: %v", id, err)
+	}
+	return ok, nil
+}
+
+// deleteIfUnchanged removes KEYS[1] only if it still holds ARGV[1].
+var deleteIfUnchanged = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// archiveScript deletes the counter KEYS[1] if it still holds ARGV[1], so a
+// hit that lands mid-archive keeps the counter hot, and adds ARGV[2] to the
+// archived set KEYS[2] (left out on Redis Cluster).
+var archiveScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+  return 0
+end
+redis.call('DEL', KEYS[1])
+if KEYS[2] then
+  redis.call('SADD', KEYS[2], ARGV[2])
+end
+return 1
+`)
+
+// mergeArchived adds v to the archived value old.
+func mergeArchived(old, v core.Value) core.Value {
+	if old.IsFloat() || v.IsFloat() {
+		return core.Float(old.Float64() + v.Float64())
+	}
+	return old.Add(v.Uint64())
+}
+
+// Sweep archives every counter idle for longer than IdleAfter and returns how
+// many were moved. A counter that still has a value in the archive (it was
+// hit while a restore failed) is added to it. Playground counters and day
+// buckets are left alone.
+func (a *Archive) Sweep(ctx context.Context) (int, error) {
+	client, prefix := a.Hot.Client(), a.Hot.Prefix()
+	_, cluster := client.(*redis.ClusterClient)
+	idleSecs := int64(a.IdleAfter / time.Second)
+	moved := 0
+	err := ScanKeys(ctx, client, prefix+"*", func(key string) error {
+		id := strings.TrimPrefix(key, prefix)
+		if core.IsTestID(id) || core.IsDayBucketID(id) {
+			return nil
+		}
+		// OBJECT IDLETIME does not touch the key; reading it (GET) would.
+		idle, err := client.ObjectIdleTime(ctx, key).Result()
+		if err != nil {
+			return fmt.Errorf("object idletime (needs an LRU maxmemory-policy): %w", err)
+		}
+		if int64(idle/time.Second) < idleSecs {
+			return nil
+		}
+		unlock, ok, err := a.lock(ctx, id)
+		if err != nil || !ok { // being restored: it isn't idle
+			return err
+		}
+		defer unlock()
+		raw, err := client.Get(ctx, key).Result()
+		if err != nil {
+			return nil
+		}
+		v, err := core.ParseValue(raw)
+		if err != nil {
+			return nil
+		}
+		archived, err := client.SIsMember(ctx, a.archivedKey(), id).Result()
+		if err != nil {
+			return err
+		}
+		var old core.Value
+		if archived { // otherwise any copy is stale, left by a restore
+			if old, archived, err = a.Cold.Get(ctx, id); err != nil {
+				return fmt.Errorf("archive %q: %w", id, err)
+			}
+		}
+		merged := v
+		if archived {
+			merged = mergeArchived(old, v)
+		}
+		if err := a.Cold.Put(ctx, id, merged); err != nil {
+			return fmt.Errorf("archive %q: %w", id, err)
+		}
+		keys := []string{key, a.archivedKey()}
+		if cluster {
+			keys = keys[:1]
+		}
+		n, err := archiveScript.Run(ctx, client, keys, raw, id).Int()
+		if err != nil || n == 0 { // hit meanwhile (or error): keep it hot, undo the copy
+			if archived {
+				_ = a.Cold.Put(ctx, id, old)
+			} else {
+				_ = a.Cold.Delete(ctx, id)
+			}
+			return nil
+		}
+		if cluster {
+			if err := client.SAdd(ctx, a.archivedKey(), id).Err(); err != nil {
+				return fmt.Errorf("archive %q: value moved but not marked: %w", id, err)
+			}
+		}
+		moved++
+		return nil
+	})
+	return moved, err
+}
+
+// Run sweeps every interval for the process lifetime, skipping the sweeps
+// for which lead (if not nil) reports that another instance does them.
+func (a *Archive) Run(every time.Duration, lead func() bool) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for range t.C {
+		if lead != nil && !lead() {
+			continue
+		}
+		n, err := a.Sweep(context.Background())
+		if err != nil {
+			log.Printf("(warn) archive sweep: %v", err)
+		}
+		if n > 0 {
+			log.Printf("archived %d idle counters", n)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// BatchWriter groups increments in memory and adds them to a store in one
+// flush every FlushInterval, so a program counting many events pays one
+// store call per counter and interval instead of one per event. It is the
+// write-behind machinery of Tiered, for embedders that keep their own read
+// path:
+//
+//	b, err := store.NewBatchWriter(redisCounter, time.Second, nil)
+//	defer b.Close()
+//	b.Add("home", 1)
+//
+// Increments not yet flushed are lost if the process dies. A failed flush
+// keeps them for the next one.
+type BatchWriter struct {
+	FlushInterval time.Duration
+
+	adder   Adder
+	onError func(error)
+	mu      sync.Mutex
+	pending map[string]uint64
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewBatchWriter starts flushing increments to s, which must implement
+// Adder, every flushInterval (default 1s). Stop it with Close. onError
+// receives the errors of background flushes; nil logs them.
+func NewBatchWriter(s Store, flushInterval time.Duration, onError func(error)) (*BatchWriter, error) {
+	a, ok := s.(Adder)
+	if !ok {
+		return nil, fmt.Errorf("batching needs a store that can add deltas (IncBy)")
+	}
+	if flushInterval <= 0 {
+		flushInterval = time.Second
+	}
+	b := &BatchWriter{
+		FlushInterval: flushInterval,
+		adder:         a,
+		onError:       onError,
+		pending:       make(map[string]uint64),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go b.flusher()
+	return b, nil
+}
+
+// Add queues n hits on id for the next flush.
+func (b *BatchWriter) Add(id string, n uint64) {
+	b.mu.Lock()
+	b.pending[id] += n
+	b.mu.Unlock()
+}
+
+// Pending returns the hits on id waiting for a flush, e.g. to add to a value
+// read from the store.
+func (b *BatchWriter) Pending(id string) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.pending[id]
+}
+
+// Flush adds every queued increment to the store now. Increments that fail
+// are queued again, and their errors are returned together.
+func (b *BatchWriter) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = make(map[string]uint64)
+	b.mu.Unlock()
+	var errs []error
+	for id, n := range batch {
+		if _, err := b.adder.IncBy(ctx, id, n); err != nil {
+			errs = append(errs, fmt.Errorf("flush of %d hits for %q failed: %w", n, id, err))
+			b.Add(id, n)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *BatchWriter) flusher() {
+	defer close(b.done)
+	tick := time.NewTicker(b.FlushInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			b.report(b.Flush(context.Background()))
+		case <-b.stop:
+			b.report(b.Flush(context.Background()))
+			return
+		}
+	}
+}
+
+func (b *BatchWriter) report(err error) {
+	switch {
+	case err == nil:
+	case b.onError != nil:
+		b.onError(err)
+	default:
+		log.Printf("(warn) batch writer: %v, will retry", err)
+	}
+}
+
+// Close stops the flusher after a final flush; increments that flush could
+// not write are lost.
+func (b *BatchWriter) Close() {
+	select {
+	case <-b.stop:
+	default:
+		close(b.stop)
+	}
+	<-b.done
+}
@@ -0,0 +1,358 @@
+// Package bolt is an embedded bbolt counter backend: every counter id lives
+// in one local file, so a single cmd/server binary keeps durable per-id
+// counts with no database server.
+//
+// Semantics follow the Redis backend: integer and float counters, TTLs
+// (playground ids expire after core.TestCounterTTL), listing, batches and
+// transactions. bbolt has a single writer, so every update is atomic;
+// concurrent hits are coalesced into shared transactions (DB.Batch) to keep
+// fsyncs down.
+package bolt
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+	bbolt "go.etcd.io/bbolt"
+)
+
+var (
+	countersBucket = []byte("counters") // id -> encoded value
+	expiresBucket  = []byte("expires")  // id -> unix milliseconds, big-endian
+	settingsBucket = []byte("settings") // table -> key -> value
+)
+
+// Value encoding: a kind byte followed by 8 big-endian bytes.
+const (
+	kindUint  = 'u'
+	kindFloat = 'f'
+)
+
+// Store is a bbolt-backed store.Store.
+type Store struct {
+	db *bbolt.DB
+}
+
+// Open opens (and if needed creates) the database file at path. Only one
+// process can hold it open at a time.
+func Open(path string) (*Store, error) {
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open bolt %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, b := range [][]byte{countersBucket, expiresBucket, settingsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error { return s.db.Close() }
+
+func (s *Store) Capabilities() store.Capabilities {
+	return store.Capabilities{AtomicIncrement: true, ReadYourWrites: true, TTL: true, Listing: true, Batch: true, Transactions: true}
+}
+
+// key maps the empty id to "default", like the Redis backend.
+func key(id string) []byte {
+	if id == "" {
+		id = "default"
+	}
+	return []byte(id)
+}
+
+func encode(v core.Value) []byte {
+	b := make([]byte, 9)
+	if v.IsFloat() {
+		b[0] = kindFloat
+		binary.BigEndian.PutUint64(b[1:], math.Float64bits(v.Float64()))
+	} else {
+		b[0] = kindUint
+		binary.BigEndian.PutUint64(b[1:], v.Uint64())
+	}
+	return b
+}
+
+func decode(b []byte) core.Value {
+	if len(b) != 9 {
+		return core.Uint(0)
+	}
+	n := binary.BigEndian.Uint64(b[1:])
+	if b[0] == kindFloat {
+		return core.Float(math.Float64frombits(n))
+	}
+	return core.Uint(n)
+}
+
+// expired reports whether k has a TTL that has run out.
+func expired(tx *bbolt.Tx, k []byte, now time.Time) bool {
+	b := tx.Bucket(expiresBucket).Get(k)
+	return len(b) == 8 && int64(binary.BigEndian.Uint64(b)) <= now.UnixMilli()
+}
+
+// load returns k's live value and whether it exists.
+func load(tx *bbolt.Tx, k []byte, now time.Time) (core.Value, bool) {
+	b := tx.Bucket(countersBucket).Get(k)
+	if b == nil || expired(tx, k, now) {
+		return core.Uint(0), false
+	}
+	return decode(b), true
+}
+
+// put writes k = v. A counter created by this write (absent or expired)
+// restarts its TTL: playground ids get core.TestCounterTTL, others none.
+func put(tx *bbolt.Tx, k []byte, v core.Value, existed bool, now time.Time) error {
+	if err := tx.Bucket(countersBucket).Put(k, encode(v)); err != nil {
+		return err
+	}
+	if existed {
+		return nil
+	}
+	exp := tx.Bucket(expiresBucket)
+	if !core.IsTestID(string(k)) {
+		return exp.Delete(k)
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(now.Add(core.TestCounterTTL).UnixMilli()))
+	return exp.Put(k, b)
+}
+
+// incBy adds n within tx; float counters are refused like INCRBY in Redis.
+func incBy(tx *bbolt.Tx, id string, n uint64) (uint64, error) {
+	k, now := key(id), core.Now()
+	cur, ok := load(tx, k, now)
+	if cur.IsFloat() {
+		return 0, fmt.Errorf("increment %q: %w", id, store.ErrNotInteger)
+	}
+	next := cur.Uint64() + n
+	return next, put(tx, k, core.Uint(next), ok, now)
+}
+
+func (s *Store) Inc(ctx context.Context, id string) (uint64, error) {
+	return s.IncBy(ctx, id, 1)
+}
+
+// IncBy adds n to id. Concurrent calls share a write transaction.
+func (s *Store) IncBy(_ context.Context, id string, n uint64) (uint64, error) {
+	var v uint64
+	err := s.db.Batch(func(tx *bbolt.Tx) error {
+		var err error
+		v, err = incBy(tx, id, n)
+		return err
+	})
+	return v, err
+}
+
+// IncFloat adds by to id, turning an integer counter into a float one (like
+// INCRBYFLOAT).
+func (s *Store) IncFloat(_ context.Context, id string, by float64) (float64, error) {
+	var v float64
+	err := s.db.Batch(func(tx *bbolt.Tx) error {
+		k, now := key(id), core.Now()
+		cur, ok := load(tx, k, now)
+		v = cur.Float64() + by
+		return put(tx, k, core.Float(v), ok, now)
+	})
+	return v, err
+}
+
+// Get returns id's value (zero if it does not exist or has expired).
+func (s *Store) Get(_ context.Context, id string) (core.Value, error) {
+	var v core.Value
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		v, _ = load(tx, key(id), core.Now())
+		return nil
+	})
+	return v, err
+}
+
+// Expire deletes id after ttl (no-op if id does not exist, like EXPIRE).
+func (s *Store) Expire(_ context.Context, id string, ttl time.Duration) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		k := key(id)
+		if _, ok := load(tx, k, core.Now()); !ok {
+			return nil
+		}
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, uint64(core.Now().Add(ttl).UnixMilli()))
+		return tx.Bucket(expiresBucket).Put(k, b)
+	})
+}
+
+// DeleteIfZero deletes id if it holds the integer 0.
+func (s *Store) DeleteIfZero(_ context.Context, id string) (bool, error) {
+	deleted := false
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		k := key(id)
+		v, ok := load(tx, k, core.Now())
+		if !ok || v.IsFloat() || v.Uint64() != 0 {
+			return nil
+		}
+		if err := tx.Bucket(countersBucket).Delete(k); err != nil {
+			return err
+		}
+		deleted = true
+		return tx.Bucket(expiresBucket).Delete(k)
+	})
+	return deleted, err
+}
+
+// IncMany increments ids in one transaction.
+func (s *Store) IncMany(_ context.Context, ids []string) ([]uint64, error) {
+	out := make([]uint64, len(ids))
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		for i, id := range ids {
+			v, err := incBy(tx, id, 1)
+			if err != nil {
+				return err
+			}
+			out[i] = v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Each lists live counters in id order, skipping day buckets. fn runs inside
+// a read transaction and must not write to the store.
+func (s *Store) Each(ctx context.Context, fn func(id string, v core.Value) error) error {
+	now := core.Now()
+	return s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(countersBucket).ForEach(func(k, b []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if core.IsDayBucketID(string(k)) || expired(tx, k, now) {
+				return nil
+			}
+			return fn(string(k), decode(b))
+		})
+	})
+}
+
+// Apply runs ops in one write transaction; nothing is written unless every
+// op succeeds.
+func (s *Store) Apply(_ context.Context, ops []store.Op) ([]uint64, error) {
+	var results []uint64
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		now := core.Now()
+		existed := make(map[string]bool)
+		var final map[string]uint64
+		var err error
+		results, final, err = store.ApplyOps(ops, func(id string) (uint64, error) {
+			v, ok := load(tx, key(id), now)
+			if v.IsFloat() {
+				return 0, store.ErrNotInteger
+			}
+			existed[id] = ok
+			return v.Uint64(), nil
+		})
+		if err != nil {
+			return err
+		}
+		for id, v := range final {
+			if err := put(tx, key(id), core.Uint(v), existed[id], now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// SweepExpired deletes expired counters and returns how many were removed.
+func (s *Store) SweepExpired(context.Context) (int, error) {
+	n := 0
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		now := core.Now()
+		var dead [][]byte
+		err := tx.Bucket(expiresBucket).ForEach(func(k, _ []byte) error {
+			if expired(tx, k, now) {
+				dead = append(dead, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range dead {
+			if err := tx.Bucket(countersBucket).Delete(k); err != nil {
+				return err
+			}
+			if err := tx.Bucket(expiresBucket).Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(dead)
+		return nil
+	})
+	return n, err
+}
+
+// Janitor sweeps expired counters every interval for the process lifetime.
+func (s *Store) Janitor(every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for range t.C {
+		if _, err := s.SweepExpired(context.Background()); err != nil {
+			log.Printf("(warn) bolt expiry sweep: %v", err)
+		}
+	}
+}
+
+// Settings (see store.Settings) live in the settings bucket, one nested
+// bucket per table.
+
+func (s *Store) LoadSettings(_ context.Context, table string) (map[string]string, error) {
+	out := make(map[string]string)
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(settingsBucket).Bucket([]byte(table))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			out[string(k)] = string(v)
+			return nil
+		})
+	})
+	return out, err
+}
+
+func (s *Store) PutSetting(_ context.Context, table, key, value string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.Bucket(settingsBucket).CreateBucketIfNotExists([]byte(table))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), []byte(value))
+	})
+}
+
+func (s *Store) DeleteSetting(_ context.Context, table, key string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket(settingsBucket).Bucket([]byte(table)); b != nil {
+			return b.Delete([]byte(key))
+		}
+		return nil
+	})
+}
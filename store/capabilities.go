@@ -0,0 +1,134 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Capabilities describes the guarantees a backend offers, so higher-level
+// features can degrade (or refuse clearly) when a backend cannot support them.
+// A capability that is true is backed by the matching optional interface
+// (Expirer, Lister, BatchIncrementer, Transactor).
+type Capabilities struct {
+	// AtomicIncrement is true when concurrent Inc calls never lose updates.
+	// Read-modify-write backends (Edge Config) can drop hits under load.
+	AtomicIncrement bool
+	// ReadYourWrites is true when Get reflects a completed Inc immediately.
+	// Eventually consistent backends may serve a stale value for a while
+	// after a write (seconds for Edge Config).
+	ReadYourWrites bool
+	// TTL is true when counters can expire on their own.
+	TTL bool
+	// Listing is true when all counters can be enumerated.
+	Listing bool
+	// Batch is true when several counters can be updated in one round trip.
+	Batch bool
+	// Streams is true when the backend keeps an ordered change feed.
+	Streams bool
+	// Transactions is true when a list of operations can be applied
+	// all-or-nothing (Transactor).
+	Transactions bool
+}
+
+// Feature is a higher-level feature built on top of a store.
+type Feature string
+
+const (
+	FeaturePlayground Feature = "playground counters" // test: ids that expire
+	FeatureAggregate  Feature = "aggregate stats"     // /public/aggregate
+	FeatureTimeSeries Feature = "time series"         // day buckets next to the total (DAY_BUCKETS)
+	FeatureChangeFeed Feature = "change feed"         // /changes
+	FeatureTx         Feature = "transactions"        // POST /tx
+	FeatureExpiring   Feature = "expiring counters"   // /hit?ttl=
+)
+
+// requirements lists the capabilities each feature cannot work without.
+var requirements = map[Feature][]string{
+	FeaturePlayground: {"ttl"},
+	FeatureAggregate:  {"listing"},
+	FeatureTimeSeries: {"atomic increments"},
+	FeatureChangeFeed: {"streams"},
+	FeatureTx:         {"transactions"},
+	FeatureExpiring:   {"ttl"},
+}
+
+func (c Capabilities) has(name string) bool {
+	switch name {
+	case "atomic increments":
+		return c.AtomicIncrement
+	case "ttl":
+		return c.TTL
+	case "listing":
+		return c.Listing
+	case "batch":
+		return c.Batch
+	case "streams":
+		return c.Streams
+	case "transactions":
+		return c.Transactions
+	}
+	return false
+}
+
+// ErrUnsupported matches (errors.Is) every UnsupportedError.
+var ErrUnsupported = errors.New("store: feature not supported by backend")
+
+// UnsupportedError reports a feature the backend cannot provide and why.
+type UnsupportedError struct {
+	Feature Feature
+	Missing []string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s not supported by this storage backend (needs %s)", e.Feature, strings.Join(e.Missing, ", "))
+}
+
+func (e *UnsupportedError) Is(target error) bool { return target == ErrUnsupported }
+
+// Check returns an *UnsupportedError if the backend lacks a capability f
+// requires, or nil.
+func (c Capabilities) Check(f Feature) error {
+	var missing []string
+	for _, name := range requirements[f] {
+		if !c.has(name) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return &UnsupportedError{Feature: f, Missing: missing}
+	}
+	return nil
+}
+
+// Exact reports whether counts are exact and immediately visible. Features
+// that can tolerate approximation (badges, totals) keep working on inexact
+// backends but should say so, e.g. with an "approximate" flag.
+func (c Capabilities) Exact() bool { return c.AtomicIncrement && c.ReadYourWrites }
+
+// Supports is Check on s's capabilities, additionally verifying that s
+// implements the optional interfaces those capabilities promise.
+func Supports(s Store, f Feature) error {
+	if err := s.Capabilities().Check(f); err != nil {
+		return err
+	}
+	for _, name := range requirements[f] {
+		var ok bool
+		switch name {
+		case "ttl":
+			_, ok = s.(Expirer)
+		case "listing":
+			_, ok = s.(Lister)
+		case "batch":
+			_, ok = s.(BatchIncrementer)
+		case "transactions":
+			_, ok = s.(Transactor)
+		default:
+			ok = true
+		}
+		if !ok {
+			return &UnsupportedError{Feature: f, Missing: []string{name}}
+		}
+	}
+	return nil
+}
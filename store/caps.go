@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/advayc/nums/core"
+)
+
+// ErrCapContention is returned by ApplyCapped when a capped counter kept
+// changing between its tries.
+var ErrCapContention = errors.New("store: capped counter changed on every try, retry the hit")
+
+// capTries bounds ApplyCapped's transactions.
+const capTries = 8
+
+// ApplyCapped adds the OpInc ops incs (one per id) in one transaction, after
+// the assertions guards (such as an if_below OpBelow), and applies the cap
+// capFor returns for each id in that same transaction, so a counter never
+// goes past its max even for a moment. A capped hit is first sent with an
+// OpBelow that there is room for all of it. When there isn't, the value the
+// refusal reports is used to work out the hit under the cap's policy, which
+// is sent with an OpExpect of that value and tried again if it changed.
+//
+// If the cap refuses a hit (core.CappedHit.Rejected) nothing is written,
+// and the refused hits report their counters' values. A guard that fails
+// returns its *MismatchError.
+func ApplyCapped(ctx context.Context, tx Transactor, guards, incs []Op, capFor func(id string) (core.Cap, bool)) ([]core.CappedHit, error) {
+	known := make(map[string]uint64) // values learned from refused tries
+	for try := 0; try < capTries; try++ {
+		ops := append([]Op(nil), guards...)
+		at := make([]int, len(incs)) // index of each uncapped result in ops, or -1
+		hits := make([]core.CappedHit, len(incs))
+		var unknown []Op // refused hits on counters whose value isn't known yet
+		for i, inc := range incs {
+			at[i] = -1
+			c, capped := capFor(inc.ID)
+			cur, ok := known[inc.ID]
+			switch {
+			case !capped:
+				at[i] = len(ops)
+				ops = append(ops, inc)
+			case !ok && inc.N <= c.Max:
+				ops = append(ops, Op{Kind: OpBelow, ID: inc.ID, N: c.Max - inc.N + 1})
+				at[i] = len(ops)
+				ops = append(ops, inc)
+			default: // an unknown value is guessed to be 0, which OpExpect checks
+				h := c.Hit(cur+inc.N, inc.N)
+				hits[i] = h
+				if h.Rejected {
+					if !ok {
+						unknown = append(unknown, Op{Kind: OpExpect, ID: inc.ID, N: 0})
+					}
+					continue
+				}
+				ops = append(ops, Op{Kind: OpExpect, ID: inc.ID, N: cur})
+				switch kept := cur + inc.N - h.Back; {
+				case kept > cur:
+					ops = append(ops, Op{Kind: OpInc, ID: inc.ID, N: kept - cur})
+				case kept < cur:
+					ops = append(ops, Op{Kind: OpDec, ID: inc.ID, N: cur - kept})
+				}
+			}
+		}
+		refused := false
+		for _, h := range hits {
+			refused = refused || h.Rejected
+		}
+		if refused && len(unknown) == 0 {
+			return hits, nil
+		}
+		if refused {
+			ops = unknown // only learn the values to report: nothing is written
+		}
+		res, err := tx.Apply(ctx, ops)
+		var mismatch *MismatchError
+		switch {
+		case errors.As(err, &mismatch) && !refused && isGuard(guards, mismatch):
+			return nil, err
+		case errors.As(err, &mismatch):
+			known[mismatch.ID] = mismatch.Current
+			continue
+		case err != nil:
+			return nil, err
+		case refused:
+			for _, op := range unknown {
+				known[op.ID] = 0
+			}
+			continue
+		}
+		for i, inc := range incs {
+			if at[i] >= 0 {
+				v := res[at[i]]
+				hits[i] = core.CappedHit{From: v - inc.N, To: v, Counted: inc.N}
+			}
+		}
+		return hits, nil
+	}
+	return nil, ErrCapContention
+}
+
+// isGuard reports whether m is the failure of one of guards, which come
+// first in the transaction.
+func isGuard(guards []Op, m *MismatchError) bool {
+	for _, g := range guards {
+		if g.ID == m.ID && g.N == m.Expected && (g.Kind == OpBelow) == m.Below {
+			return true
+		}
+	}
+	return false
+}
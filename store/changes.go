@@ -0,0 +1,72 @@
+//go:build !minimal
+
+package store
+
+import (
+	"context"
+	"strconv"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// The change log is the sorted set "changes:<prefix>": each member a counter
+// id, scored by when it last changed (Unix microseconds, the cursor).
+
+// Change is a counter's entry in the change log.
+type Change struct {
+	ID     string
+	Cursor int64
+}
+
+// ChangesSince returns the counters changed after cursor, oldest first, at
+// most limit. Passing the last one's Cursor back pages through the rest.
+func (r *RedisCounter) ChangesSince(ctx context.Context, cursor int64, limit int) ([]Change, error) {
+	out, err := r.changes(ctx, "("+strconv.FormatInt(cursor, 10), "+inf", int64(limit)+1)
+	if err != nil {
+		return nil, err
+	}
+	page := PageChanges(out, limit)
+	if len(page) > limit { // all share one cursor: return every change at it
+		at := strconv.FormatInt(page[0].Cursor, 10)
+		return r.changes(ctx, at, at, 0)
+	}
+	return page, nil
+}
+
+func (r *RedisCounter) changes(ctx context.Context, min, max string, count int64) ([]Change, error) {
+	zs, err := r.client.ZRangeByScoreWithScores(ctx, "changes:"+r.prefix, &redis.ZRangeBy{Min: min, Max: max, Count: count}).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Change, 0, len(zs))
+	for _, z := range zs {
+		id, _ := z.Member.(string)
+		out = append(out, Change{ID: id, Cursor: int64(z.Score)})
+	}
+	return out, nil
+}
+
+// PageChanges cuts changes, sorted oldest first, to at most limit. A page
+// does not end between changes with the same cursor, since the next page
+// starts after it; it only holds more than limit when they all share one.
+func PageChanges(changes []Change, limit int) []Change {
+	if len(changes) <= limit {
+		return changes
+	}
+	last := changes[limit-1].Cursor
+	if changes[limit].Cursor != last {
+		return changes[:limit]
+	}
+	n := limit - 1
+	for n > 0 && changes[n-1].Cursor == last {
+		n--
+	}
+	if n > 0 {
+		return changes[:n]
+	}
+	end := limit
+	for end < len(changes) && changes[end].Cursor == last {
+		end++
+	}
+	return changes[:end]
+}
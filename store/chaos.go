@@ -0,0 +1,209 @@
+//go:build chaos
+
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// ErrChaos is the failure Chaos injects. Failover and Replicated treat it as
+// an outage, like a lost connection.
+var ErrChaos = errors.New("store: injected failure (chaos)")
+
+// Chaos makes a share of an inner store's calls slow or fail, to exercise
+// the failover, replication and cache paths under realistic faults. It is
+// only built with -tags chaos, so release binaries cannot enable it.
+//
+// A failing call never reaches the inner store. Latency is added before the
+// call and gives up when the context ends, as a slow network would.
+type Chaos struct {
+	Inner Store
+
+	ErrorRate   float64       // share of calls that fail with ErrChaos, 0 to 1
+	Latency     time.Duration // added to a share of calls, with up to 50% jitter
+	LatencyRate float64       // share of calls that get Latency, 0 to 1
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewChaos wraps inner; seed makes the sequence of faults repeatable.
+func NewChaos(inner Store, errorRate float64, latency time.Duration, latencyRate float64, seed int64) *Chaos {
+	return &Chaos{Inner: inner, ErrorRate: errorRate, Latency: latency, LatencyRate: latencyRate, rnd: rand.New(rand.NewSource(seed))}
+}
+
+// ChaosFromEnv wraps inner as set by CHAOS_ERROR_RATE (e.g. 0.1), CHAOS_LATENCY
+// (e.g. "300ms"), CHAOS_LATENCY_RATE (default 1 when CHAOS_LATENCY is set) and
+// CHAOS_SEED (default the current time). It returns nil when neither
+// CHAOS_ERROR_RATE nor CHAOS_LATENCY is set.
+func ChaosFromEnv(inner Store) (*Chaos, error) {
+	errorRate, err := chaosRate("CHAOS_ERROR_RATE", 0)
+	if err != nil {
+		return nil, err
+	}
+	var latency time.Duration
+	if s := os.Getenv("CHAOS_LATENCY"); s != "" {
+		latency, err = time.ParseDuration(s)
+		if err != nil || latency < 0 {
+			return nil, fmt.Errorf("CHAOS_LATENCY: %q is not a duration", s)
+		}
+	}
+	latencyRate, err := chaosRate("CHAOS_LATENCY_RATE", 1)
+	if err != nil {
+		return nil, err
+	}
+	if errorRate == 0 && latency == 0 {
+		return nil, nil
+	}
+	seed := time.Now().UnixNano()
+	if s := os.Getenv("CHAOS_SEED"); s != "" {
+		seed, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("CHAOS_SEED: %q is not a number", s)
+		}
+	}
+	return NewChaos(inner, errorRate, latency, latencyRate, seed), nil
+}
+
+func chaosRate(env string, def float64) (float64, error) {
+	s := os.Getenv(env)
+	if s == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 || f > 1 {
+		return 0, fmt.Errorf("%s: %q is not a rate from 0 to 1", env, s)
+	}
+	return f, nil
+}
+
+func (c *Chaos) String() string {
+	return fmt.Sprintf("%.0f%% errors, %s latency on %.0f%% of calls", c.ErrorRate*100, c.Latency, c.LatencyRate*100)
+}
+
+// fault delays the call and reports whether it should fail.
+func (c *Chaos) fault(ctx context.Context) error {
+	c.mu.Lock()
+	fail := c.rnd.Float64() < c.ErrorRate
+	var delay time.Duration
+	if c.Latency > 0 && c.rnd.Float64() < c.LatencyRate {
+		delay = c.Latency + time.Duration(c.rnd.Int63n(int64(c.Latency)/2+1))
+	}
+	c.mu.Unlock()
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if fail {
+		return ErrChaos
+	}
+	return nil
+}
+
+func (c *Chaos) Capabilities() Capabilities { return c.Inner.Capabilities() }
+
+func (c *Chaos) Inc(ctx context.Context, id string) (uint64, error) {
+	if err := c.fault(ctx); err != nil {
+		return 0, err
+	}
+	return c.Inner.Inc(ctx, id)
+}
+
+func (c *Chaos) Get(ctx context.Context, id string) (core.Value, error) {
+	if err := c.fault(ctx); err != nil {
+		return core.Value{}, err
+	}
+	return c.Inner.Get(ctx, id)
+}
+
+func (c *Chaos) IncBy(ctx context.Context, id string, n uint64) (uint64, error) {
+	a, ok := c.Inner.(Adder)
+	if !ok {
+		return 0, ErrUnsupported
+	}
+	if err := c.fault(ctx); err != nil {
+		return 0, err
+	}
+	return a.IncBy(ctx, id, n)
+}
+
+func (c *Chaos) IncFloat(ctx context.Context, id string, by float64) (float64, error) {
+	fi, ok := c.Inner.(FloatIncrementer)
+	if !ok {
+		return 0, ErrUnsupported
+	}
+	if err := c.fault(ctx); err != nil {
+		return 0, err
+	}
+	return fi.IncFloat(ctx, id, by)
+}
+
+func (c *Chaos) Expire(ctx context.Context, id string, ttl time.Duration) error {
+	e, ok := c.Inner.(Expirer)
+	if !ok {
+		return ErrUnsupported
+	}
+	if err := c.fault(ctx); err != nil {
+		return err
+	}
+	return e.Expire(ctx, id, ttl)
+}
+
+func (c *Chaos) DeleteIfZero(ctx context.Context, id string) (bool, error) {
+	d, ok := c.Inner.(ZeroDeleter)
+	if !ok {
+		return false, ErrUnsupported
+	}
+	if err := c.fault(ctx); err != nil {
+		return false, err
+	}
+	return d.DeleteIfZero(ctx, id)
+}
+
+func (c *Chaos) IncMany(ctx context.Context, ids []string) ([]uint64, error) {
+	b, ok := c.Inner.(BatchIncrementer)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	if err := c.fault(ctx); err != nil {
+		return nil, err
+	}
+	return b.IncMany(ctx, ids)
+}
+
+func (c *Chaos) Apply(ctx context.Context, ops []Op) ([]uint64, error) {
+	tx, ok := c.Inner.(Transactor)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	if err := c.fault(ctx); err != nil {
+		return nil, err
+	}
+	return tx.Apply(ctx, ops)
+}
+
+// Each fails or is delayed as a whole, not per counter.
+func (c *Chaos) Each(ctx context.Context, fn func(id string, v core.Value) error) error {
+	l, ok := c.Inner.(Lister)
+	if !ok {
+		return ErrUnsupported
+	}
+	if err := c.fault(ctx); err != nil {
+		return err
+	}
+	return l.Each(ctx, fn)
+}
@@ -0,0 +1,174 @@
+//go:build !minimal
+
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/advayc/nums/core"
+)
+
+// ColdStore keeps archived counters, one gzip-compressed JSON object per id.
+type ColdStore interface {
+	Put(ctx context.Context, id string, v core.Value) error
+	// Get returns the archived value; ok is false when id is not archived.
+	Get(ctx context.Context, id string) (v core.Value, ok bool, err error)
+	Delete(ctx context.Context, id string) error
+}
+
+// archivedCounter is the archived object's JSON body.
+type archivedCounter struct {
+	ID         string     `json:"id"`
+	Value      core.Value `json:"value"`
+	ArchivedAt time.Time  `json:"archived_at"`
+}
+
+// NewColdStore parses an archive location:
+//
+//	file:///var/lib/nums/archive   one .json.gz file per counter
+//	s3://bucket/prefix              one object per counter (standard AWS credentials)
+func NewColdStore(raw string) (ColdStore, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse archive url: %w", err)
+	}
+	switch u.Scheme {
+	case "file":
+		if err := os.MkdirAll(u.Path, 0o700); err != nil {
+			return nil, err
+		}
+		return &fileCold{dir: u.Path}, nil
+	case "s3":
+		cfg, err := awsconfig.LoadDefaultConfig(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("load aws config: %w", err)
+		}
+		prefix := strings.Trim(u.Path, "/")
+		if prefix != "" {
+			prefix += "/"
+		}
+		return &s3Cold{client: s3.NewFromConfig(cfg), bucket: u.Host, prefix: prefix}, nil
+	}
+	return nil, fmt.Errorf("unsupported archive scheme %q (want file:// or s3://)", u.Scheme)
+}
+
+// coldName is the object name for id (hex, so any id is a safe file name).
+func coldName(id string) string { return hex.EncodeToString([]byte(id)) + ".json.gz" }
+
+func encodeArchived(id string, v core.Value) ([]byte, error) {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if err := json.NewEncoder(zw).Encode(archivedCounter{ID: id, Value: v, ArchivedAt: time.Now().UTC()}); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func decodeArchived(r io.Reader) (core.Value, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return core.Value{}, err
+	}
+	defer zr.Close()
+	var a archivedCounter
+	if err := json.NewDecoder(zr).Decode(&a); err != nil {
+		return core.Value{}, err
+	}
+	return a.Value, nil
+}
+
+type fileCold struct{ dir string }
+
+func (f *fileCold) Put(_ context.Context, id string, v core.Value) error {
+	b, err := encodeArchived(id, v)
+	if err != nil {
+		return err
+	}
+	// write then rename so a crash never leaves a truncated archive
+	tmp := filepath.Join(f.dir, "."+coldName(id)+".tmp")
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(f.dir, coldName(id)))
+}
+
+func (f *fileCold) Get(_ context.Context, id string) (core.Value, bool, error) {
+	fh, err := os.Open(filepath.Join(f.dir, coldName(id)))
+	if errors.Is(err, os.ErrNotExist) {
+		return core.Value{}, false, nil
+	}
+	if err != nil {
+		return core.Value{}, false, err
+	}
+	defer fh.Close()
+	v, err := decodeArchived(fh)
+	return v, err == nil, err
+}
+
+func (f *fileCold) Delete(_ context.Context, id string) error {
+	err := os.Remove(filepath.Join(f.dir, coldName(id)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+type s3Cold struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func (s *s3Cold) Put(ctx context.Context, id string, v core.Value) error {
+	b, err := encodeArchived(id, v)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(s.prefix + coldName(id)),
+		Body:            bytes.NewReader(b),
+		ContentType:     aws.String("application/json"),
+		ContentEncoding: aws.String("gzip"),
+	})
+	return err
+}
+
+func (s *s3Cold) Get(ctx context.Context, id string) (core.Value, bool, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(s.prefix + coldName(id))})
+	var nsk *s3types.NoSuchKey
+	if errors.As(err, &nsk) {
+		return core.Value{}, false, nil
+	}
+	if err != nil {
+		return core.Value{}, false, err
+	}
+	defer out.Body.Close()
+	v, err := decodeArchived(out.Body)
+	return v, err == nil, err
+}
+
+func (s *s3Cold) Delete(ctx context.Context, id string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(s.prefix + coldName(id))})
+	return err
+}
@@ -0,0 +1,213 @@
+// Package dynamodb stores counters in a DynamoDB table so the serverless
+// handler can run on AWS without Redis. The table's partition key is the
+// string "id"; the count is the number attribute "hits", incremented with an
+// atomic ADD update expression. TTLs are written to "expires_at" (epoch
+// seconds): enable DynamoDB TTL on that attribute to have expired items
+// deleted. Deletion is lazy, so reads treat expired items as absent
+// themselves.
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+)
+
+// Store is a DynamoDB-backed store.Store.
+type Store struct {
+	client *ddb.Client
+	table  string
+}
+
+// Open uses table through client.
+func Open(client *ddb.Client, table string) *Store {
+	return &Store{client: client, table: table}
+}
+
+// NewFromEnv uses DYNAMO_TABLE and the standard AWS credential chain
+// (AWS_REGION, AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY, roles, ...), or
+// returns store.ErrNotConfigured.
+func NewFromEnv() (*Store, error) {
+	table := os.Getenv("DYNAMO_TABLE")
+	if table == "" {
+		return nil, fmt.Errorf("%w: DYNAMO_TABLE is required", store.ErrNotConfigured)
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("load aws config: %w", err)
+	}
+	return Open(ddb.NewFromConfig(cfg), table), nil
+}
+
+func (d *Store) Capabilities() store.Capabilities {
+	return store.Capabilities{AtomicIncrement: true, ReadYourWrites: true, TTL: true, Listing: true}
+}
+
+func key(id string) map[string]ddbtypes.AttributeValue {
+	if id == "" {
+		id = "default"
+	}
+	return map[string]ddbtypes.AttributeValue{"id": &ddbtypes.AttributeValueMemberS{Value: id}}
+}
+
+func number(s string) ddbtypes.AttributeValue { return &ddbtypes.AttributeValueMemberN{Value: s} }
+
+func (d *Store) Inc(ctx context.Context, id string) (uint64, error) {
+	v, err := d.add(ctx, id, "1")
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("dynamodb: %s is not an integer counter (%s)", id, v)
+	}
+	return n, nil
+}
+
+func (d *Store) IncFloat(ctx context.Context, id string, by float64) (float64, error) {
+	v, err := d.add(ctx, id, strconv.FormatFloat(by, 'f', -1, 64))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(v, 64)
+}
+
+// add adds by to hits and returns the new value. An item whose TTL has run
+// out (but DynamoDB has not deleted yet) is restarted at by without a TTL, as
+// INCR on an expired Redis key would.
+func (d *Store) add(ctx context.Context, id, by string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	for attempt := 0; attempt < 3; attempt++ {
+		now := number(strconv.FormatInt(time.Now().Unix(), 10))
+		out, err := d.client.UpdateItem(ctx, &ddb.UpdateItemInput{
+			TableName:                 aws.String(d.table),
+			Key:                       key(id),
+			UpdateExpression:          aws.String("ADD hits :by"),
+			ConditionExpression:       aws.String("attribute_not_exists(expires_at) OR expires_at > :now"),
+			ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{":by": number(by), ":now": now},
+			ReturnValues:              ddbtypes.ReturnValueUpdatedNew,
+		})
+		var ccf *ddbtypes.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			item := key(id)
+			item["hits"] = number(by)
+			_, err = d.client.PutItem(ctx, &ddb.PutItemInput{
+				TableName:                 aws.String(d.table),
+				Item:                      item,
+				ConditionExpression:       aws.String("expires_at <= :now"),
+				ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{":now": now},
+			})
+			if errors.As(err, &ccf) {
+				continue // someone else restarted it first; add to theirs
+			}
+			if err != nil {
+				return "", fmt.Errorf("dynamodb put: %w", err)
+			}
+			return by, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("dynamodb update: %w", err)
+		}
+		n, ok := out.Attributes["hits"].(*ddbtypes.AttributeValueMemberN)
+		if !ok {
+			return "", fmt.Errorf("dynamodb update: no hits attribute returned")
+		}
+		return n.Value, nil
+	}
+	return "", fmt.Errorf("dynamodb update of %s kept conflicting", id)
+}
+
+// Get reads with strong consistency so a hit is visible to the next read.
+func (d *Store) Get(ctx context.Context, id string) (core.Value, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	out, err := d.client.GetItem(ctx, &ddb.GetItemInput{
+		TableName:      aws.String(d.table),
+		Key:            key(id),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return core.Value{}, fmt.Errorf("dynamodb get: %w", err)
+	}
+	v, ok := value(out.Item, time.Now())
+	if !ok {
+		return core.Uint(0), nil
+	}
+	return v, nil
+}
+
+// value decodes an item's hits, reporting false for missing or expired items.
+func value(item map[string]ddbtypes.AttributeValue, now time.Time) (core.Value, bool) {
+	if exp, ok := item["expires_at"].(*ddbtypes.AttributeValueMemberN); ok {
+		if t, err := strconv.ParseInt(exp.Value, 10, 64); err == nil && t <= now.Unix() {
+			return core.Value{}, false
+		}
+	}
+	n, ok := item["hits"].(*ddbtypes.AttributeValueMemberN)
+	if !ok {
+		return core.Value{}, false
+	}
+	v, err := core.ParseValue(n.Value)
+	return v, err == nil
+}
+
+// Expire sets id's expires_at (no-op if id does not exist, like EXPIRE).
+func (d *Store) Expire(ctx context.Context, id string, ttl time.Duration) error {
+	_, err := d.client.UpdateItem(ctx, &ddb.UpdateItemInput{
+		TableName:                aws.String(d.table),
+		Key:                      key(id),
+		UpdateExpression:         aws.String("SET expires_at = :exp"),
+		ConditionExpression:      aws.String("attribute_exists(#id)"),
+		ExpressionAttributeNames: map[string]string{"#id": "id"},
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":exp": number(strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)),
+		},
+	})
+	var ccf *ddbtypes.ConditionalCheckFailedException
+	if errors.As(err, &ccf) {
+		return nil
+	}
+	return err
+}
+
+// Each scans the whole table, skipping expired items and day buckets.
+func (d *Store) Each(ctx context.Context, fn func(id string, v core.Value) error) error {
+	p := ddb.NewScanPaginator(d.client, &ddb.ScanInput{
+		TableName:                aws.String(d.table),
+		ProjectionExpression:     aws.String("#id, hits, expires_at"),
+		ExpressionAttributeNames: map[string]string{"#id": "id"},
+	})
+	now := time.Now()
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("dynamodb scan: %w", err)
+		}
+		for _, item := range page.Items {
+			idAttr, ok := item["id"].(*ddbtypes.AttributeValueMemberS)
+			if !ok || core.IsDayBucketID(idAttr.Value) {
+				continue
+			}
+			v, ok := value(item, now)
+			if !ok {
+				continue
+			}
+			if err := fn(idAttr.Value, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
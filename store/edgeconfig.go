@@ -0,0 +1,222 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// EdgeConfig stores counters as items of a Vercel Edge Config. It suits
+// low-traffic, purely-Vercel sites only:
+//
+//   - Increments are read-modify-write through the Vercel REST API, so
+//     concurrent hits can be lost (AtomicIncrement false).
+//   - Reads go through the edge-replicated read endpoint and may lag writes
+//     by several seconds (ReadYourWrites false).
+//   - Writes are rate limited and the whole config is size limited.
+//   - Items cannot expire (no TTL), so playground counters are refused, and
+//     there is no change feed.
+//
+// Item keys may only contain letters, digits, '_' and '-', so ids are escaped
+// (see itemKey).
+type EdgeConfig struct {
+	client   *http.Client
+	configID string
+	readURL  string // https://edge-config.vercel.com/<id>
+	readTok  string
+	apiToken string
+	teamID   string
+}
+
+// NewEdgeConfigFromEnv uses EDGE_CONFIG (the connection string Vercel sets,
+// https://edge-config.vercel.com/<id>?token=<read token>) for reads and
+// VERCEL_API_TOKEN (plus VERCEL_TEAM_ID for team projects) for writes.
+func NewEdgeConfigFromEnv() (*EdgeConfig, error) {
+	conn, apiToken := os.Getenv("EDGE_CONFIG"), os.Getenv("VERCEL_API_TOKEN")
+	if conn == "" || apiToken == "" {
+		return nil, fmt.Errorf("%w: EDGE_CONFIG and VERCEL_API_TOKEN are required", ErrNotConfigured)
+	}
+	u, err := url.Parse(conn)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("parse EDGE_CONFIG: invalid connection string")
+	}
+	id := strings.Trim(u.Path, "/")
+	if id == "" || u.Query().Get("token") == "" {
+		return nil, fmt.Errorf("parse EDGE_CONFIG: want https://edge-config.vercel.com/<id>?token=<token>")
+	}
+	return &EdgeConfig{
+		client:   &http.Client{Timeout: 5 * time.Second},
+		configID: id,
+		readURL:  u.Scheme + "://" + u.Host + "/" + id,
+		readTok:  u.Query().Get("token"),
+		apiToken: apiToken,
+		teamID:   os.Getenv("VERCEL_TEAM_ID"),
+	}, nil
+}
+
+func (e *EdgeConfig) Capabilities() Capabilities {
+	return Capabilities{AtomicIncrement: false, ReadYourWrites: false, Listing: true}
+}
+
+// Get reads the edge-replicated value (possibly a few seconds stale).
+func (e *EdgeConfig) Get(ctx context.Context, id string) (core.Value, error) {
+	return e.read(ctx, e.readURL+"/item/"+itemKey(id), e.readTok, false)
+}
+
+// Inc reads the current value from the Vercel API (the source of truth, not
+// the edge cache) and writes back value+1. Not atomic: see the type comment.
+func (e *EdgeConfig) Inc(ctx context.Context, id string) (uint64, error) {
+	cur, err := e.read(ctx, e.apiURL("/item/"+itemKey(id)), e.apiToken, true)
+	if err != nil {
+		return 0, err
+	}
+	next := cur.Uint64() + 1
+	body, _ := json.Marshal(map[string]any{"items": []map[string]any{
+		{"operation": "upsert", "key": itemKey(id), "value": next},
+	}})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, e.apiURL("/items"), bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+e.apiToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("edge config write: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return 0, fmt.Errorf("edge config write: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return next, nil
+}
+
+// Each lists every counter item through the Vercel API.
+func (e *EdgeConfig) Each(ctx context.Context, fn func(id string, v core.Value) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.apiURL("/items"), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+e.apiToken)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("edge config list: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("edge config list: %s", resp.Status)
+	}
+	var items []struct {
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		return fmt.Errorf("edge config list: %w", err)
+	}
+	for _, it := range items {
+		id, ok := idFromItemKey(it.Key)
+		if !ok || core.IsDayBucketID(id) {
+			continue
+		}
+		var v core.Value
+		if json.Unmarshal(it.Value, &v) != nil {
+			continue
+		}
+		if err := fn(id, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *EdgeConfig) apiURL(path string) string {
+	u := "https://api.vercel.com/v1/edge-config/" + e.configID + path
+	if e.teamID != "" {
+		u += "?teamId=" + url.QueryEscape(e.teamID)
+	}
+	return u
+}
+
+// read fetches an item value; the REST API wraps it as {"key", "value", ...}
+// while the edge read endpoint returns the bare value.
+func (e *EdgeConfig) read(ctx context.Context, u, token string, wrapped bool) (core.Value, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return core.Value{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return core.Value{}, fmt.Errorf("edge config read: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return core.Uint(0), nil
+	}
+	if resp.StatusCode >= 300 {
+		return core.Value{}, fmt.Errorf("edge config read: %s", resp.Status)
+	}
+	var item struct {
+		Value core.Value `json:"value"`
+	}
+	dst := any(&item.Value)
+	if wrapped {
+		dst = &item
+	}
+	if err := json.NewDecoder(resp.Body).Decode(dst); err != nil {
+		return core.Value{}, fmt.Errorf("edge config read: %w", err)
+	}
+	return item.Value, nil
+}
+
+// itemKey maps a counter id to a valid Edge Config key: "hits_" followed by
+// the id with every byte outside [A-Za-z0-9_] written as "-XX" (hex).
+func itemKey(id string) string {
+	var b strings.Builder
+	b.WriteString("hits_")
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "-%02x", c)
+	}
+	return b.String()
+}
+
+// idFromItemKey reverses itemKey; ok is false for items nums did not write.
+func idFromItemKey(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, "hits_")
+	if !ok {
+		return "", false
+	}
+	var b strings.Builder
+	for i := 0; i < len(rest); i++ {
+		if rest[i] != '-' {
+			b.WriteByte(rest[i])
+			continue
+		}
+		if i+2 >= len(rest) {
+			return "", false
+		}
+		c, err := strconv.ParseUint(rest[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", false
+		}
+		b.WriteByte(byte(c))
+		i += 2
+	}
+	return b.String(), true
+}
@@ -0,0 +1,346 @@
+// Package etcd is an etcd v3 counter backend for deployments that already run
+// an etcd cluster and want strongly consistent counts without adding Redis.
+//
+// Every counter is one key, ETCD_PREFIX plus its id, holding the value as
+// text ("42", "7.5"). Increments are compare-and-swap loops on the key's mod
+// revision, so concurrent hits never overwrite each other; reads are
+// linearizable. Playground ids are attached to a lease of
+// core.TestCounterTTL and etcd deletes them itself. etcd serializes every
+// write through its leader, so very hot counters are better served by Redis
+// or a Tiered cache in front.
+package etcd
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+	"go.etcd.io/etcd/client/pkg/v3/transport"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+// Store is an etcd-backed store.Store.
+type Store struct {
+	cli    *clientv3.Client
+	prefix string
+}
+
+// New wraps an existing client; keys are prefix plus the counter id.
+func New(cli *clientv3.Client, prefix string) *Store {
+	return &Store{cli: cli, prefix: prefix}
+}
+
+// OpenFromEnv connects to the comma-separated ETCD_ENDPOINTS with optional
+// ETCD_USERNAME / ETCD_PASSWORD and client TLS (ETCD_CACERT, ETCD_CERT,
+// ETCD_KEY, named like etcdctl's flags). Keys go under ETCD_PREFIX (default
+// "nums/"). It returns store.ErrNotConfigured without ETCD_ENDPOINTS.
+func OpenFromEnv() (*Store, error) {
+	var endpoints []string
+	for _, e := range strings.Split(os.Getenv("ETCD_ENDPOINTS"), ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			endpoints = append(endpoints, e)
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("ETCD_ENDPOINTS: %w", store.ErrNotConfigured)
+	}
+	cfg := clientv3.Config{
+		Endpoints:   endpoints,
+		Username:    os.Getenv("ETCD_USERNAME"),
+		Password:    os.Getenv("ETCD_PASSWORD"),
+		DialTimeout: 5 * time.Second,
+		Logger:      zap.NewNop(), // errors are returned to the caller
+	}
+	tlsInfo := transport.TLSInfo{
+		TrustedCAFile: os.Getenv("ETCD_CACERT"),
+		CertFile:      os.Getenv("ETCD_CERT"),
+		KeyFile:       os.Getenv("ETCD_KEY"),
+	}
+	if !tlsInfo.Empty() || tlsInfo.TrustedCAFile != "" {
+		c, err := tlsInfo.ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("etcd tls: %w", err)
+		}
+		cfg.TLS = c
+	} else if strings.HasPrefix(endpoints[0], "https://") {
+		cfg.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	cli, err := clientv3.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("etcd: %w", err)
+	}
+	s := New(cli, envOr("ETCD_PREFIX", "nums/"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := cli.Get(ctx, s.key("default")); err != nil { // fail at startup, not on the first hit
+		cli.Close()
+		return nil, fmt.Errorf("etcd %s: %w", strings.Join(endpoints, ","), err)
+	}
+	return s, nil
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func (s *Store) Close() error { return s.cli.Close() }
+
+func (s *Store) Capabilities() store.Capabilities {
+	return store.Capabilities{AtomicIncrement: true, ReadYourWrites: true, TTL: true, Listing: true, Batch: true, Transactions: true}
+}
+
+// key maps the empty id to "default", like the Redis backend.
+func (s *Store) key(id string) string {
+	if id == "" {
+		id = "default"
+	}
+	return s.prefix + id
+}
+
+// encode writes integers as decimal and floats so that they never parse as
+// an integer again ("2.0", not "2").
+func encode(v core.Value) string {
+	if !v.IsFloat() {
+		return strconv.FormatUint(v.Uint64(), 10)
+	}
+	out := strconv.FormatFloat(v.Float64(), 'g', -1, 64)
+	if !strings.ContainsAny(out, ".eEnN") {
+		out += ".0"
+	}
+	return out
+}
+
+func decode(k string, b []byte) (core.Value, error) {
+	if n, err := strconv.ParseUint(string(b), 10, 64); err == nil {
+		return core.Uint(n), nil
+	}
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return core.Value{}, fmt.Errorf("etcd: %s holds %q, not a number", k, b)
+	}
+	return core.Float(f), nil
+}
+
+// read is one key's value and the mod revision to compare against (0 when
+// the key does not exist).
+type read struct {
+	v   core.Value
+	rev int64
+}
+
+func (r read) exists() bool { return r.rev != 0 }
+
+func (s *Store) get(ctx context.Context, k string) (read, error) {
+	resp, err := s.cli.Get(ctx, k)
+	if err != nil {
+		return read{}, fmt.Errorf("etcd get: %w", err)
+	}
+	if len(resp.Kvs) == 0 {
+		return read{v: core.Uint(0)}, nil
+	}
+	v, err := decode(k, resp.Kvs[0].Value)
+	if err != nil {
+		return read{}, err
+	}
+	return read{v: v, rev: resp.Kvs[0].ModRevision}, nil
+}
+
+// put is the write of k = v in a CAS transaction. Existing keys keep their
+// lease; a playground counter created by this write gets a fresh one.
+func (s *Store) put(ctx context.Context, id, k string, v core.Value, existed bool) (clientv3.Op, error) {
+	if existed {
+		return clientv3.OpPut(k, encode(v), clientv3.WithIgnoreLease()), nil
+	}
+	if !core.IsTestID(id) {
+		return clientv3.OpPut(k, encode(v)), nil
+	}
+	lease, err := s.cli.Grant(ctx, int64(core.TestCounterTTL/time.Second))
+	if err != nil {
+		return clientv3.Op{}, fmt.Errorf("etcd lease: %w", err)
+	}
+	return clientv3.OpPut(k, encode(v), clientv3.WithLease(lease.ID)), nil
+}
+
+// cas commits puts if none of the keys in reads changed since they were read.
+func (s *Store) cas(ctx context.Context, reads map[string]read, puts []clientv3.Op) (bool, error) {
+	cmps := make([]clientv3.Cmp, 0, len(reads))
+	for k, r := range reads {
+		cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(k), "=", r.rev))
+	}
+	resp, err := s.cli.Txn(ctx).If(cmps...).Then(puts...).Commit()
+	if err != nil {
+		return false, fmt.Errorf("etcd txn: %w", err)
+	}
+	return resp.Succeeded, nil
+}
+
+// update applies fn to id's current value with a compare-and-swap, retrying
+// while other writers get in between.
+func (s *Store) update(ctx context.Context, id string, fn func(cur core.Value) (core.Value, error)) (core.Value, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	k := s.key(id)
+	for {
+		r, err := s.get(ctx, k)
+		if err != nil {
+			return core.Value{}, err
+		}
+		next, err := fn(r.v)
+		if err != nil {
+			return core.Value{}, err
+		}
+		op, err := s.put(ctx, id, k, next, r.exists())
+		if err != nil {
+			return core.Value{}, err
+		}
+		ok, err := s.cas(ctx, map[string]read{k: r}, []clientv3.Op{op})
+		if err != nil {
+			return core.Value{}, err
+		}
+		if ok {
+			return next, nil
+		}
+	}
+}
+
+func (s *Store) Inc(ctx context.Context, id string) (uint64, error) {
+	return s.IncBy(ctx, id, 1)
+}
+
+// IncBy adds n to id; float counters are refused like INCRBY in Redis.
+func (s *Store) IncBy(ctx context.Context, id string, n uint64) (uint64, error) {
+	v, err := s.update(ctx, id, func(cur core.Value) (core.Value, error) {
+		if cur.IsFloat() {
+			return core.Value{}, fmt.Errorf("increment %q: %w", id, store.ErrNotInteger)
+		}
+		return core.Uint(cur.Uint64() + n), nil
+	})
+	return v.Uint64(), err
+}
+
+// IncFloat adds by to id, turning an integer counter into a float one (like
+// INCRBYFLOAT).
+func (s *Store) IncFloat(ctx context.Context, id string, by float64) (float64, error) {
+	v, err := s.update(ctx, id, func(cur core.Value) (core.Value, error) {
+		return core.Float(cur.Float64() + by), nil
+	})
+	return v.Float64(), err
+}
+
+// Get returns id's value (zero if it does not exist).
+func (s *Store) Get(ctx context.Context, id string) (core.Value, error) {
+	r, err := s.get(ctx, s.key(id))
+	return r.v, err
+}
+
+// Expire attaches id to a new lease of ttl (no-op if id does not exist, like
+// EXPIRE).
+func (s *Store) Expire(ctx context.Context, id string, ttl time.Duration) error {
+	secs := int64((ttl + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	k := s.key(id)
+	for {
+		r, err := s.get(ctx, k)
+		if err != nil || !r.exists() {
+			return err
+		}
+		lease, err := s.cli.Grant(ctx, secs)
+		if err != nil {
+			return fmt.Errorf("etcd lease: %w", err)
+		}
+		ok, err := s.cas(ctx, map[string]read{k: r}, []clientv3.Op{clientv3.OpPut(k, encode(r.v), clientv3.WithLease(lease.ID))})
+		if err != nil || ok {
+			return err
+		}
+		_, _ = s.cli.Revoke(ctx, lease.ID)
+	}
+}
+
+// IncMany increments ids in one transaction.
+func (s *Store) IncMany(ctx context.Context, ids []string) ([]uint64, error) {
+	ops := make([]store.Op, len(ids))
+	for i, id := range ids {
+		ops[i] = store.Op{Kind: store.OpInc, ID: id, N: 1}
+	}
+	return s.Apply(ctx, ops)
+}
+
+// Apply runs ops in one etcd transaction guarded by the mod revision of every
+// counter it read, retrying when one of them changed meanwhile.
+func (s *Store) Apply(ctx context.Context, ops []store.Op) ([]uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	for {
+		reads := make(map[string]read)
+		results, final, err := store.ApplyOps(ops, func(id string) (uint64, error) {
+			r, err := s.get(ctx, s.key(id))
+			if err != nil {
+				return 0, err
+			}
+			if r.v.IsFloat() {
+				return 0, store.ErrNotInteger
+			}
+			reads[s.key(id)] = r
+			return r.v.Uint64(), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		puts := make([]clientv3.Op, 0, len(final))
+		for id, n := range final {
+			op, err := s.put(ctx, id, s.key(id), core.Uint(n), reads[s.key(id)].exists())
+			if err != nil {
+				return nil, err
+			}
+			puts = append(puts, op)
+		}
+		ok, err := s.cas(ctx, reads, puts)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return results, nil
+		}
+	}
+}
+
+// Each lists counters in key order, a page at a time, skipping day buckets.
+func (s *Store) Each(ctx context.Context, fn func(id string, v core.Value) error) error {
+	end := clientv3.GetPrefixRangeEnd(s.prefix)
+	from := s.prefix
+	for {
+		resp, err := s.cli.Get(ctx, from, clientv3.WithRange(end), clientv3.WithLimit(500))
+		if err != nil {
+			return fmt.Errorf("etcd list: %w", err)
+		}
+		for _, kv := range resp.Kvs {
+			id := strings.TrimPrefix(string(kv.Key), s.prefix)
+			if core.IsDayBucketID(id) {
+				continue
+			}
+			v, err := decode(string(kv.Key), kv.Value)
+			if err != nil {
+				continue // not ours: something else shares the prefix
+			}
+			if err := fn(id, v); err != nil {
+				return err
+			}
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			return nil
+		}
+		from = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+}
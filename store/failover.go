@@ -0,0 +1,357 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// BackendState is the circuit state of a Failover.
+type BackendState int
+
+const (
+	// BackendUp passes every call to the backend (circuit closed).
+	BackendUp BackendState = iota
+	// BackendDown fails calls fast and buffers hits (circuit open).
+	BackendDown
+	// BackendProbing lets one call through to test whether the backend is
+	// back (circuit half-open).
+	BackendProbing
+)
+
+func (s BackendState) String() string {
+	switch s {
+	case BackendUp:
+		return "up"
+	case BackendDown:
+		return "down"
+	case BackendProbing:
+		return "probing"
+	}
+	return fmt.Sprintf("BackendState(%d)", int(s))
+}
+
+// MarshalText reports the state by name in JSON.
+func (s BackendState) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// ErrBackendDown is returned, without calling the backend, while a Failover
+// circuit is open.
+var ErrBackendDown = errors.New("store: backend unavailable (circuit open)")
+
+// Failover puts a circuit breaker in front of a durable backend. After
+// Threshold consecutive failures it stops calling the backend for Cooldown,
+// so hits fail fast (Tiered then counts them locally) instead of each waiting
+// for a timeout. Hits from Inc and IncFloat that the backend did not take are
+// buffered and replayed once a probe succeeds, so the backend catches up with
+// the hits served during the outage instead of losing them.
+//
+// IncBy is not buffered: its callers (Tiered write-behind, replays) keep and
+// retry their own deltas. Playground ids are never buffered.
+type Failover struct {
+	Backend Store
+
+	Threshold int           // consecutive failures that open the circuit (default 3)
+	Cooldown  time.Duration // how long to fail fast before probing (default 5s)
+
+	mu       sync.Mutex
+	state    BackendState
+	since    time.Time // last state change
+	downAt   time.Time // when the current outage began
+	failures int
+	lastErr  error
+	retryAt  time.Time
+	buffered map[string]delta
+	replay   sync.Mutex // one replay at a time
+}
+
+// FailoverStatus is a snapshot of a Failover for status endpoints.
+type FailoverStatus struct {
+	State     BackendState `json:"state"`
+	Since     time.Time    `json:"since"`
+	Failures  int          `json:"failures"`
+	LastError string       `json:"lastError,omitempty"`
+	Buffered  int          `json:"buffered"` // counters with hits waiting for replay
+}
+
+// NewFailover wraps backend, which must implement Adder so buffered hits can
+// be replayed.
+func NewFailover(backend Store, threshold int, cooldown time.Duration) (*Failover, error) {
+	if _, ok := backend.(Adder); !ok {
+		return nil, fmt.Errorf("failover needs a store that can add deltas (IncBy)")
+	}
+	if threshold <= 0 {
+		threshold = 3
+	}
+	if cooldown <= 0 {
+		cooldown = 5 * time.Second
+	}
+	return &Failover{
+		Backend:   backend,
+		Threshold: threshold,
+		Cooldown:  cooldown,
+		since:     time.Now(),
+		buffered:  make(map[string]delta),
+	}, nil
+}
+
+// Capabilities are the backend's.
+func (f *Failover) Capabilities() Capabilities { return f.Backend.Capabilities() }
+
+// Status reports the circuit state and how much is waiting to be replayed.
+func (f *Failover) Status() FailoverStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	st := FailoverStatus{State: f.state, Since: f.since, Failures: f.failures, Buffered: len(f.buffered)}
+	if f.lastErr != nil {
+		st.LastError = f.lastErr.Error()
+	}
+	return st
+}
+
+// RetryAfter is how long until the backend is tried again: the rest of the
+// cooldown while the circuit is open, otherwise a whole cooldown.
+func (f *Failover) RetryAfter() time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.state == BackendDown {
+		if d := time.Until(f.retryAt); d > 0 {
+			return d
+		}
+	}
+	return f.Cooldown
+}
+
+// allow reports whether a call may reach the backend. Once the cooldown is
+// over, the first caller becomes the probe.
+func (f *Failover) allow() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch f.state {
+	case BackendUp:
+		return true
+	case BackendDown:
+		if time.Now().Before(f.retryAt) {
+			return false
+		}
+		f.setState(BackendProbing)
+		return true
+	}
+	return false // a probe is already in flight
+}
+
+// done records the outcome of a backend call.
+func (f *Failover) done(err error) {
+	if !isOutage(err) {
+		f.mu.Lock()
+		recovered := f.state != BackendUp
+		f.failures = 0
+		if recovered {
+			f.setState(BackendUp)
+		}
+		f.mu.Unlock()
+		if recovered {
+			go f.Replay(context.Background())
+		}
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures++
+	f.lastErr = err
+	if f.state == BackendProbing || (f.state == BackendUp && f.failures >= f.Threshold) {
+		f.setState(BackendDown)
+		f.retryAt = time.Now().Add(f.Cooldown)
+	}
+}
+
+// setState changes state and logs the transition (f.mu held).
+func (f *Failover) setState(s BackendState) {
+	if s == f.state {
+		return
+	}
+	switch {
+	case s == BackendDown && f.state == BackendUp:
+		log.Printf("(error) failover: backend down after %d failures, counting locally: %v", f.failures, f.lastErr)
+		f.downAt = time.Now()
+	case s == BackendUp:
+		log.Printf("failover: backend recovered after %s, replaying %d buffered counters", time.Since(f.downAt).Round(time.Second), len(f.buffered))
+	}
+	f.state = s
+	f.since = time.Now()
+}
+
+// isOutage tells backend failures from errors about the request itself
+// (a refused transaction, a cancelled client), which must not open the
+// circuit.
+func isOutage(err error) bool {
+	var mismatch *MismatchError
+	switch {
+	case err == nil,
+		errors.Is(err, context.Canceled),
+		errors.Is(err, ErrUnderflow),
+		errors.Is(err, ErrOverflow),
+		errors.Is(err, ErrNotInteger),
+		errors.Is(err, ErrUnsupported),
+		errors.As(err, &mismatch):
+		return false
+	}
+	return true
+}
+
+func (f *Failover) buffer(id string, d delta) {
+	if core.IsTestID(id) {
+		return
+	}
+	f.mu.Lock()
+	b := f.buffered[id]
+	b.n += d.n
+	b.f += d.f
+	f.buffered[id] = b
+	f.mu.Unlock()
+}
+
+func (f *Failover) Inc(ctx context.Context, id string) (uint64, error) {
+	if !f.allow() {
+		f.buffer(id, delta{n: 1})
+		return 0, ErrBackendDown
+	}
+	v, err := f.Backend.Inc(ctx, id)
+	f.done(err)
+	if isOutage(err) {
+		f.buffer(id, delta{n: 1})
+	}
+	return v, err
+}
+
+// IncBy passes n through; the caller keeps n when it fails.
+func (f *Failover) IncBy(ctx context.Context, id string, n uint64) (uint64, error) {
+	if !f.allow() {
+		return 0, ErrBackendDown
+	}
+	v, err := f.Backend.(Adder).IncBy(ctx, id, n)
+	f.done(err)
+	return v, err
+}
+
+func (f *Failover) IncFloat(ctx context.Context, id string, by float64) (float64, error) {
+	fi, ok := f.Backend.(FloatIncrementer)
+	if !ok {
+		return 0, &UnsupportedError{Feature: "float counters", Missing: []string{"float increments"}}
+	}
+	if !f.allow() {
+		f.buffer(id, delta{f: by})
+		return 0, ErrBackendDown
+	}
+	v, err := fi.IncFloat(ctx, id, by)
+	f.done(err)
+	if isOutage(err) {
+		f.buffer(id, delta{f: by})
+	}
+	return v, err
+}
+
+// Get reads the backend, adding hits still waiting for replay so a counter
+// does not appear to drop back right after a recovery.
+func (f *Failover) Get(ctx context.Context, id string) (core.Value, error) {
+	if !f.allow() {
+		return core.Value{}, ErrBackendDown
+	}
+	v, err := f.Backend.Get(ctx, id)
+	f.done(err)
+	if err != nil {
+		return v, err
+	}
+	f.mu.Lock()
+	b := f.buffered[id]
+	f.mu.Unlock()
+	if b.n > 0 && !v.IsFloat() {
+		v = core.Uint(v.Uint64() + b.n)
+	}
+	if b.f != 0 {
+		v = v.AddFloat(b.f)
+	}
+	return v, nil
+}
+
+func (f *Failover) Expire(ctx context.Context, id string, ttl time.Duration) error {
+	e, ok := f.Backend.(Expirer)
+	if !ok {
+		return nil
+	}
+	if !f.allow() {
+		return ErrBackendDown
+	}
+	err := e.Expire(ctx, id, ttl)
+	f.done(err)
+	return err
+}
+
+func (f *Failover) Apply(ctx context.Context, ops []Op) ([]uint64, error) {
+	tx, ok := f.Backend.(Transactor)
+	if !ok {
+		return nil, &UnsupportedError{Feature: FeatureTx, Missing: []string{"transactions"}}
+	}
+	if !f.allow() {
+		return nil, ErrBackendDown
+	}
+	results, err := tx.Apply(ctx, ops)
+	f.done(err)
+	return results, err
+}
+
+func (f *Failover) Each(ctx context.Context, fn func(id string, v core.Value) error) error {
+	l, ok := f.Backend.(Lister)
+	if !ok {
+		return &UnsupportedError{Feature: FeatureAggregate, Missing: []string{"listing"}}
+	}
+	if !f.allow() {
+		return ErrBackendDown
+	}
+	err := l.Each(ctx, fn)
+	f.done(err)
+	return err
+}
+
+// Replay sends the buffered hits to the backend. Counters that fail stay
+// buffered for the next recovery. It runs by itself after every recovery.
+func (f *Failover) Replay(ctx context.Context) {
+	f.replay.Lock()
+	defer f.replay.Unlock()
+	f.mu.Lock()
+	batch := f.buffered
+	f.buffered = make(map[string]delta)
+	f.mu.Unlock()
+	failed := 0
+	for id, d := range batch {
+		if err := addDelta(ctx, f.Backend, id, d); err != nil {
+			failed++
+			f.buffer(id, d)
+			f.done(err)
+		}
+	}
+	if failed > 0 {
+		log.Printf("(warn) failover: %d of %d counters could not be replayed, will retry", failed, len(batch))
+	}
+}
+
+// Monitor probes the backend every interval while the circuit is open, so
+// recovery (and the replay) happens even when no traffic arrives. It runs
+// for the process lifetime.
+func (f *Failover) Monitor(every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for range t.C {
+		if f.Status().State != BackendDown || !f.allow() {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), every)
+		_, err := f.Backend.Get(ctx, "default")
+		cancel()
+		f.done(err)
+	}
+}
@@ -0,0 +1,255 @@
+// Package firestore stores counters in a Firestore collection so the
+// handlers can run on Cloud Run or Cloud Functions with native GCP storage.
+// Each counter is a document named after its id (path-escaped) holding the
+// number field "hits". Increments are transactions, so they are atomic and
+// return the new value; Firestore sustains about one write per second per
+// document, so very hot counters belong in Redis. TTLs are written to the
+// timestamp "expires_at": add a TTL policy on that field to have expired
+// documents deleted. Deletion is lazy, so reads treat expired documents as
+// absent themselves.
+package firestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	fs "cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+)
+
+// Store is a Firestore-backed store.Store.
+type Store struct {
+	client *fs.Client
+	col    *fs.CollectionRef
+}
+
+// Open uses collection through client.
+func Open(client *fs.Client, collection string) *Store {
+	return &Store{client: client, col: client.Collection(collection)}
+}
+
+// NewFromEnv uses FIRESTORE_PROJECT (default: detected from the
+// environment, e.g. GOOGLE_CLOUD_PROJECT or the metadata server),
+// FIRESTORE_DATABASE (default "(default)"), FIRESTORE_COLLECTION (default
+// "nums") and Application Default Credentials. FIRESTORE_EMULATOR_HOST is
+// honored for local development.
+func NewFromEnv() (*Store, error) {
+	project := os.Getenv("FIRESTORE_PROJECT")
+	if project == "" {
+		project = fs.DetectProjectID
+	}
+	database := os.Getenv("FIRESTORE_DATABASE")
+	if database == "" {
+		database = fs.DefaultDatabaseID
+	}
+	collection := os.Getenv("FIRESTORE_COLLECTION")
+	if collection == "" {
+		collection = "nums"
+	}
+	client, err := fs.NewClientWithDatabase(context.Background(), project, database)
+	if err != nil {
+		return nil, fmt.Errorf("firestore: %w", err)
+	}
+	return Open(client, collection), nil
+}
+
+func (f *Store) Capabilities() store.Capabilities {
+	return store.Capabilities{AtomicIncrement: true, ReadYourWrites: true, TTL: true, Listing: true, Transactions: true}
+}
+
+// doc returns id's document; ids are path-escaped because Firestore document
+// names cannot contain "/".
+func (f *Store) doc(id string) *fs.DocumentRef {
+	if id == "" {
+		id = "default"
+	}
+	return f.col.Doc(url.PathEscape(id))
+}
+
+func isNotFound(err error) bool { return status.Code(err) == codes.NotFound }
+
+// value decodes a document's hits, reporting false for missing or expired documents.
+func value(snap *fs.DocumentSnapshot, now time.Time) (core.Value, bool) {
+	if snap == nil || !snap.Exists() {
+		return core.Value{}, false
+	}
+	data := snap.Data()
+	if exp, ok := data["expires_at"].(time.Time); ok && !exp.After(now) {
+		return core.Value{}, false
+	}
+	switch n := data["hits"].(type) {
+	case int64:
+		if n < 0 {
+			n = 0
+		}
+		return core.Uint(uint64(n)), true
+	case float64:
+		return core.Float(n), true
+	}
+	return core.Value{}, false
+}
+
+func (f *Store) Inc(ctx context.Context, id string) (uint64, error) {
+	return f.IncBy(ctx, id, 1)
+}
+
+// IncBy adds n to id. An expired counter restarts at n.
+func (f *Store) IncBy(ctx context.Context, id string, n uint64) (uint64, error) {
+	var out uint64
+	err := f.update(ctx, id, func(cur core.Value) (map[string]any, error) {
+		if cur.IsFloat() {
+			return nil, fmt.Errorf("%s is a float counter", id)
+		}
+		out = cur.Uint64() + n
+		return map[string]any{"hits": int64(out)}, nil
+	})
+	return out, err
+}
+
+// IncFloat adds by to a float counter (an integer counter is converted).
+func (f *Store) IncFloat(ctx context.Context, id string, by float64) (float64, error) {
+	var out float64
+	err := f.update(ctx, id, func(cur core.Value) (map[string]any, error) {
+		out = cur.Float64() + by
+		return map[string]any{"hits": out}, nil
+	})
+	return out, err
+}
+
+// update reads id and merges the fields fn returns in one transaction; an
+// expired document is replaced instead, dropping its expires_at.
+func (f *Store) update(ctx context.Context, id string, fn func(cur core.Value) (map[string]any, error)) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	ref := f.doc(id)
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *fs.Transaction) error {
+		snap, err := tx.Get(ref)
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		cur, ok := value(snap, time.Now())
+		if !ok {
+			cur = core.Uint(0)
+		}
+		fields, err := fn(cur)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return tx.Set(ref, fields)
+		}
+		return tx.Set(ref, fields, fs.MergeAll)
+	})
+	if err != nil {
+		return fmt.Errorf("firestore update: %w", err)
+	}
+	return nil
+}
+
+// Get reads id; Firestore reads are strongly consistent.
+func (f *Store) Get(ctx context.Context, id string) (core.Value, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	snap, err := f.doc(id).Get(ctx)
+	if err != nil && !isNotFound(err) {
+		return core.Value{}, fmt.Errorf("firestore get: %w", err)
+	}
+	v, ok := value(snap, time.Now())
+	if !ok {
+		return core.Uint(0), nil
+	}
+	return v, nil
+}
+
+// Expire sets id's expires_at (no-op if id does not exist, like EXPIRE).
+func (f *Store) Expire(ctx context.Context, id string, ttl time.Duration) error {
+	_, err := f.doc(id).Update(ctx, []fs.Update{{Path: "expires_at", Value: time.Now().Add(ttl)}})
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// Apply runs ops in one Firestore transaction.
+func (f *Store) Apply(ctx context.Context, ops []store.Op) ([]uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var results []uint64
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *fs.Transaction) error {
+		now := time.Now()
+		absent := make(map[string]bool) // missing or expired: replaced, not merged
+		res, final, err := store.ApplyOps(ops, func(id string) (uint64, error) {
+			snap, err := tx.Get(f.doc(id))
+			if err != nil && !isNotFound(err) {
+				return 0, err
+			}
+			v, ok := value(snap, now)
+			if !ok {
+				absent[id] = true
+				return 0, nil
+			}
+			if v.IsFloat() {
+				return 0, store.ErrNotInteger
+			}
+			return v.Uint64(), nil
+		})
+		if err != nil {
+			return err
+		}
+		for id, n := range final {
+			var opts []fs.SetOption
+			if !absent[id] {
+				opts = append(opts, fs.MergeAll)
+			}
+			if err := tx.Set(f.doc(id), map[string]any{"hits": int64(n)}, opts...); err != nil {
+				return err
+			}
+		}
+		results = res
+		return nil
+	})
+	var mm *store.MismatchError
+	if errors.As(err, &mm) || errors.Is(err, store.ErrUnderflow) || errors.Is(err, store.ErrOverflow) || errors.Is(err, store.ErrNotInteger) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("firestore transaction: %w", err)
+	}
+	return results, nil
+}
+
+// Each lists the whole collection, skipping expired documents and day buckets.
+func (f *Store) Each(ctx context.Context, fn func(id string, v core.Value) error) error {
+	iter := f.col.Documents(ctx)
+	defer iter.Stop()
+	now := time.Now()
+	for {
+		snap, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("firestore list: %w", err)
+		}
+		id, err := url.PathUnescape(snap.Ref.ID)
+		if err != nil || core.IsDayBucketID(id) {
+			continue
+		}
+		v, ok := value(snap, now)
+		if !ok {
+			continue
+		}
+		if err := fn(id, v); err != nil {
+			return err
+		}
+	}
+}
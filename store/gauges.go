@@ -0,0 +1,39 @@
+package store
+
+import "context"
+
+// GaugeTable is the settings table that keeps each gauge's type (id ->
+// core.GaugeInt or core.GaugeFloat), fixed by its first write.
+const GaugeTable = "gauges"
+
+// gaugeClaimer sets a gauge's type atomically when it has none.
+type gaugeClaimer interface {
+	claimGauge(ctx context.Context, id, kind string) (string, error)
+}
+
+// ClaimGauge records kind as id's gauge type unless it has one, and returns
+// a *GaugeTypeError when the type recorded differs.
+func ClaimGauge(ctx context.Context, s Settings, id, kind string) error {
+	var cur string
+	if c, ok := s.(gaugeClaimer); ok {
+		var err error
+		if cur, err = c.claimGauge(ctx, id, kind); err != nil {
+			return err
+		}
+	} else {
+		types, err := s.LoadSettings(ctx, GaugeTable)
+		if err != nil {
+			return err
+		}
+		if cur = types[id]; cur == "" {
+			if err := s.PutSetting(ctx, GaugeTable, id, kind); err != nil {
+				return err
+			}
+			cur = kind
+		}
+	}
+	if cur != kind {
+		return &GaugeTypeError{ID: id, Type: cur, Got: kind}
+	}
+	return nil
+}
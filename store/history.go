@@ -0,0 +1,74 @@
+//go:build !minimal
+
+package store
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/advayc/nums/core"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// A counter's value history is the sorted set "history:<prefix><id>", one
+// "<unix>:<value>" member per interval scored by its start (unix seconds).
+
+func (r *RedisCounter) historyKey(id string) string { return "history:" + r.Key(id) }
+
+// recordHistoryScript sets the point of slot ARGV[1] to ARGV[2] unless it
+// already holds more, so instances that snapshot the same slot at different
+// times keep the latest value of a growing counter whatever order they land
+// in. It then drops the points before ARGV[3] and expires the set after
+// ARGV[4] seconds, so the history of a counter no longer hit goes away with
+// its last point.
+var recordHistoryScript = redis.NewScript(`
+local cur = redis.call('ZRANGEBYSCORE', KEYS[1], ARGV[1], ARGV[1])
+local keep = true
+for _, m in ipairs(cur) do
+  local v = tonumber(string.match(m, ':(.*)$'))
+  if v and v > tonumber(ARGV[2]) then
+    keep = false
+  end
+end
+if keep then
+  redis.call('ZREMRANGEBYSCORE', KEYS[1], ARGV[1], ARGV[1])
+  redis.call('ZADD', KEYS[1], ARGV[1], ARGV[1] .. ':' .. ARGV[2])
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', '(' .. ARGV[3])
+redis.call('EXPIRE', KEYS[1], ARGV[4])
+return 1
+`)
+
+// RecordHistory sets id's value for the interval starting at slot, unless a
+// larger one was recorded for it, keeping retention of history.
+func (r *RedisCounter) RecordHistory(ctx context.Context, id string, slot time.Time, v core.Value, retention time.Duration) error {
+	oldest := slot.Add(-retention).Unix()
+	return recordHistoryScript.Run(ctx, r.client, []string{r.historyKey(id)}, slot.Unix(), v.String(), oldest, int64(retention.Seconds())).Err()
+}
+
+// History returns id's points from..to, oldest first.
+func (r *RedisCounter) History(ctx context.Context, id string, from, to time.Time) ([]core.HistoryPoint, error) {
+	members, err := r.client.ZRangeByScore(ctx, r.historyKey(id), &redis.ZRangeBy{
+		Min: strconv.FormatInt(from.Unix(), 10),
+		Max: strconv.FormatInt(to.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	points := make([]core.HistoryPoint, 0, len(members))
+	for _, m := range members {
+		at, raw, _ := strings.Cut(m, ":")
+		sec, err := strconv.ParseInt(at, 10, 64)
+		if err != nil {
+			continue
+		}
+		v, err := core.ParseValue(raw)
+		if err != nil {
+			continue
+		}
+		points = append(points, core.HistoryPoint{At: time.Unix(sec, 0).UTC(), Hits: v})
+	}
+	return core.HistoryRange(points, from, to), nil
+}
@@ -0,0 +1,188 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// KV stores counters in Vercel KV (Upstash Redis) through its REST API, so a
+// Vercel deployment needs no separately provisioned Redis or TCP connection.
+// Keys match the Redis layout ("hits:<id>"). INCR is atomic and reads are
+// consistent with writes.
+type KV struct {
+	client *http.Client
+	url    string
+	token  string
+	prefix string
+}
+
+// NewKV returns a KV store for the REST endpoint and token.
+func NewKV(restURL, token, prefix string) *KV {
+	if prefix == "" {
+		prefix = "hits:"
+	}
+	return &KV{
+		client: &http.Client{Timeout: 3 * time.Second},
+		url:    strings.TrimRight(restURL, "/"),
+		token:  token,
+		prefix: prefix,
+	}
+}
+
+// NewKVFromEnv uses KV_REST_API_URL and KV_REST_API_TOKEN (set by Vercel when
+// a KV database is connected to the project).
+func NewKVFromEnv() (*KV, error) {
+	u, token := os.Getenv("KV_REST_API_URL"), os.Getenv("KV_REST_API_TOKEN")
+	if u == "" || token == "" {
+		return nil, fmt.Errorf("%w: KV_REST_API_URL and KV_REST_API_TOKEN are required", ErrNotConfigured)
+	}
+	return NewKV(u, token, os.Getenv("REDIS_PREFIX")), nil
+}
+
+func (k *KV) Capabilities() Capabilities {
+	return Capabilities{AtomicIncrement: true, ReadYourWrites: true, TTL: true, Listing: true, Batch: true}
+}
+
+func (k *KV) Inc(ctx context.Context, id string) (uint64, error) {
+	var n uint64
+	if err := k.do(ctx, &n, "INCR", k.prefix+id); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (k *KV) IncFloat(ctx context.Context, id string, by float64) (float64, error) {
+	var s string // INCRBYFLOAT replies with a bulk string
+	if err := k.do(ctx, &s, "INCRBYFLOAT", k.prefix+id, strconv.FormatFloat(by, 'f', -1, 64)); err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func (k *KV) Get(ctx context.Context, id string) (core.Value, error) {
+	var s *string
+	if err := k.do(ctx, &s, "GET", k.prefix+id); err != nil {
+		return core.Value{}, err
+	}
+	if s == nil {
+		return core.Uint(0), nil
+	}
+	return core.ParseValue(*s)
+}
+
+func (k *KV) Expire(ctx context.Context, id string, ttl time.Duration) error {
+	var n int
+	return k.do(ctx, &n, "EXPIRE", k.prefix+id, strconv.FormatInt(int64(ttl/time.Second), 10))
+}
+
+// Each walks "<prefix>*" with SCAN and MGET, skipping day buckets.
+func (k *KV) Each(ctx context.Context, fn func(id string, v core.Value) error) error {
+	cursor := "0"
+	for {
+		var page [2]json.RawMessage // [cursor, [keys...]]
+		if err := k.do(ctx, &page, "SCAN", cursor, "MATCH", k.prefix+"*", "COUNT", "500"); err != nil {
+			return err
+		}
+		var keys []string
+		if err := json.Unmarshal(page[0], &cursor); err != nil {
+			return fmt.Errorf("kv SCAN: %w", err)
+		}
+		if err := json.Unmarshal(page[1], &keys); err != nil {
+			return fmt.Errorf("kv SCAN: %w", err)
+		}
+		if len(keys) > 0 {
+			var vals []*string
+			if err := k.do(ctx, &vals, append([]string{"MGET"}, keys...)...); err != nil {
+				return err
+			}
+			for i, key := range keys {
+				id := strings.TrimPrefix(key, k.prefix)
+				if i >= len(vals) || vals[i] == nil || core.IsDayBucketID(id) {
+					continue
+				}
+				v, err := core.ParseValue(*vals[i])
+				if err != nil {
+					continue
+				}
+				if err := fn(id, v); err != nil {
+					return err
+				}
+			}
+		}
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// IncMany increments ids in one request through the REST pipeline endpoint.
+func (k *KV) IncMany(ctx context.Context, ids []string) ([]uint64, error) {
+	cmds := make([][]string, len(ids))
+	for i, id := range ids {
+		cmds[i] = []string{"INCR", k.prefix + id}
+	}
+	var replies []struct {
+		Result uint64 `json:"result"`
+		Error  string `json:"error"`
+	}
+	if err := k.post(ctx, k.url+"/pipeline", cmds, &replies); err != nil {
+		return nil, fmt.Errorf("kv pipeline: %w", err)
+	}
+	out := make([]uint64, len(ids))
+	for i := range out {
+		if i >= len(replies) {
+			return nil, fmt.Errorf("kv pipeline: %d replies for %d commands", len(replies), len(ids))
+		}
+		if replies[i].Error != "" {
+			return nil, fmt.Errorf("kv pipeline: %s", replies[i].Error)
+		}
+		out[i] = replies[i].Result
+	}
+	return out, nil
+}
+
+// do runs one Redis command via the REST API and decodes its result into out.
+func (k *KV) do(ctx context.Context, out any, args ...string) error {
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  string          `json:"error"`
+	}
+	if err := k.post(ctx, k.url, args, &reply); err != nil {
+		return fmt.Errorf("kv %s: %w", args[0], err)
+	}
+	if reply.Error != "" {
+		return fmt.Errorf("kv %s: %s", args[0], reply.Error)
+	}
+	return json.Unmarshal(reply.Result, out)
+}
+
+// post sends body as JSON to the REST API and decodes the reply into out.
+func (k *KV) post(ctx context.Context, u string, body, out any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+k.token)
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s: %w", resp.Status, err)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+//go:build !minimal
+
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// Redis key layouts. In v1 a counter is "<prefix><id>" (prefix "hits:" by
+// default) and the structures kept next to counters are "<kind>:<prefix>..."
+// (such as "meta:hits:home"). v2 puts the layout version in the prefix,
+// "nums:v2:<prefix>", so a later change of format can tell its keys from
+// older ones and move them without guessing.
+const (
+	LayoutV1 = "v1"
+	LayoutV2 = "v2"
+)
+
+// RedisLayoutFromEnv parses REDIS_KEY_LAYOUT: v1 (the default) or v2.
+func RedisLayoutFromEnv() (string, error) {
+	layout, err := ParseLayout(os.Getenv("REDIS_KEY_LAYOUT"))
+	if err != nil {
+		return "", fmt.Errorf("REDIS_KEY_LAYOUT: %w", err)
+	}
+	return layout, nil
+}
+
+// ParseLayout parses a key layout name: v1 (also "") or v2.
+func ParseLayout(s string) (string, error) {
+	switch s = strings.TrimSpace(s); s {
+	case "", LayoutV1:
+		return LayoutV1, nil
+	case LayoutV2:
+		return LayoutV2, nil
+	default:
+		return "", fmt.Errorf("%q should be v1 or v2", s)
+	}
+}
+
+// LayoutPrefix returns the key prefix that layout gives prefix.
+func LayoutPrefix(layout, prefix string) string {
+	if layout == LayoutV2 {
+		return "nums:" + LayoutV2 + ":" + prefix
+	}
+	return prefix
+}
+
+// ResolvePrefix returns the prefix layout gives prefix (a v1 prefix, such as
+// "staging:hits:"), for the tools that write counters without a
+// RedisCounter. With layout v1 it fails once MigrateLayout has moved
+// prefix's keys to v2, since nothing reads them there any more.
+func ResolvePrefix(ctx context.Context, c redis.Cmdable, layout, prefix string) (string, error) {
+	if layout == LayoutV2 {
+		return LayoutPrefix(layout, prefix), nil
+	}
+	done, err := c.Exists(ctx, layoutMarker(prefix)).Result()
+	if err != nil {
+		return "", err
+	}
+	if done == 1 {
+		return "", fmt.Errorf("the keys under %q were migrated to the v2 layout, set REDIS_KEY_LAYOUT=v2", prefix)
+	}
+	return prefix, nil
+}
+
+// layoutKinds are the "<kind>:<prefix>..." structures moved with counters.
+var layoutKinds = []string{
+	"archived", "badgeusage", "changes", "dailyfirst", "deleted", "frozen", "history", "idem", "meta",
+	"milestones", "offsets", "quota", "ratelimit", "resetperiods", "resets",
+	"resetschedule", "rounding", "salt", "seen", "uniques", "webhooks",
+}
+
+// migrateKeyScript moves KEYS[1] to KEYS[2]. When both exist, two numbers
+// are added up; anything else is left in place as a conflict. It returns 0
+// when there was nothing to move, 1 when moved, 2 when added and -1 on a
+// conflict.
+var migrateKeyScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+  return 0
+end
+if redis.call('EXISTS', KEYS[2]) == 0 then
+  redis.call('RENAME', KEYS[1], KEYS[2])
+  return 1
+end
+if redis.call('TYPE', KEYS[1]).ok ~= 'string' or redis.call('TYPE', KEYS[2]).ok ~= 'string' then
+  return -1
+end
+local old, cur = redis.call('GET', KEYS[1]), redis.call('GET', KEYS[2])
+if string.match(old, '^%d+$') and string.match(cur, '^%d+$') then
+  redis.call('INCRBY', KEYS[2], old)
+elseif tonumber(old) and tonumber(cur) then
+  redis.call('INCRBYFLOAT', KEYS[2], old)
+else
+  return -1
+end
+redis.call('DEL', KEYS[1])
+return 2
+`)
+
+// ErrLayoutCluster is returned by UpgradeFrom and MigrateLayout on Redis
+// Cluster, where the keys of the two layouts can be in different slots and
+// can't be renamed into each other.
+var ErrLayoutCluster = errors.New("the v2 key layout can't be migrated to on Redis Cluster (keys can't be renamed across slots); use REDIS_KEY_LAYOUT=v1")
+
+// legacyLayout is the prefix r's keys are being moved from.
+type legacyLayout struct {
+	prefix string
+	done   atomic.Bool
+}
+
+// LayoutMigration reports a finished MigrateLayout.
+type LayoutMigration struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Moved     int    `json:"moved"`
+	Merged    int    `json:"merged"`    // counters present in both layouts, added up
+	Conflicts int    `json:"conflicts"` // keys present in both layouts, left in the old one
+	Skipped   bool   `json:"skipped"`   // it had already run
+}
+
+// layoutMarker is the key MigrateLayout sets once it has moved everything
+// from the prefix from.
+func layoutMarker(from string) string { return "migrated:" + from }
+
+// UpgradeFrom makes r move each counter from the older layout prefix from on
+// first access, until MigrateLayout has moved the rest (on this or another
+// instance). Call it before r is used. On Redis Cluster it returns
+// ErrLayoutCluster before moving anything.
+func (r *RedisCounter) UpgradeFrom(ctx context.Context, from string) error {
+	if from == r.prefix {
+		return nil
+	}
+	if _, ok := r.client.(*redis.ClusterClient); ok {
+		return ErrLayoutCluster
+	}
+	l := &legacyLayout{prefix: from}
+	done, err := r.client.Exists(ctx, layoutMarker(from)).Result()
+	if err != nil {
+		return err
+	}
+	l.done.Store(done == 1)
+	r.legacy = l
+	return nil
+}
+
+// Upgraded reports whether r has no keys left to move to its layout.
+func (r *RedisCounter) Upgraded() bool { return r.legacy == nil || r.legacy.done.Load() }
+
+// Upgrade moves the counters ids from the older layout, if not done yet.
+func (r *RedisCounter) Upgrade(ctx context.Context, ids ...string) error {
+	l := r.legacy
+	if l == nil || l.done.Load() {
+		return nil
+	}
+	for _, id := range ids {
+		if id == "" {
+			id = "default"
+		}
+		if err := migrateKeyScript.Run(ctx, r.client, []string{l.prefix + id, r.prefix + id}).Err(); err != nil {
+			return fmt.Errorf("move %s to the %s layout: %w", id, r.prefix, err)
+		}
+	}
+	return nil
+}
+
+// MoveSharedKeys moves the structures of the older layout prefix from that
+// are one key for all counters, such as "frozen:<from>" and the settings
+// hashes. They are few, so this is quick enough to do before they are loaded.
+func (r *RedisCounter) MoveSharedKeys(ctx context.Context, from string) error {
+	for _, kind := range layoutKinds {
+		err := migrateKeyScript.Run(ctx, r.client, []string{kind + ":" + from, kind + ":" + r.prefix}).Err()
+		if err != nil {
+			return fmt.Errorf("move %s: %w", kind+":"+from, err)
+		}
+	}
+	return nil
+}
+
+// MigrateLayout moves every key of the older layout prefix from to r's:
+// counters and their day buckets, then each structure of layoutKinds. It is
+// safe to run on several instances at once, and once finished it leaves the
+// marker "migrated:<from>" so it is not run again. On Redis Cluster it
+// returns ErrLayoutCluster.
+func (r *RedisCounter) MigrateLayout(ctx context.Context, from string) (LayoutMigration, error) {
+	m := LayoutMigration{From: from, To: r.prefix}
+	if from == "" || from == r.prefix {
+		return m, fmt.Errorf("nothing to migrate from prefix %q", from)
+	}
+	if _, ok := r.client.(*redis.ClusterClient); ok {
+		return m, ErrLayoutCluster
+	}
+	done, err := r.client.Exists(ctx, layoutMarker(from)).Result()
+	if err != nil {
+		return m, err
+	}
+	if done == 1 {
+		m.Skipped = true
+		r.layoutDone()
+		return m, nil
+	}
+	move := func(oldKey, newKey string) error {
+		res, err := migrateKeyScript.Run(ctx, r.client, []string{oldKey, newKey}).Int()
+		switch {
+		case err != nil:
+			return fmt.Errorf("move %s: %w", oldKey, err)
+		case res == 1:
+			m.Moved++
+		case res == 2:
+			m.Merged++
+		case res == -1:
+			m.Conflicts++
+		}
+		return nil
+	}
+	err = ScanKeys(ctx, r.client, from+"*", func(key string) error {
+		return move(key, r.prefix+strings.TrimPrefix(key, from))
+	})
+	if err != nil {
+		return m, err
+	}
+	for _, kind := range layoutKinds {
+		old := kind + ":" + from
+		err := ScanKeys(ctx, r.client, old+"*", func(key string) error {
+			return move(key, kind+":"+r.prefix+strings.TrimPrefix(key, old))
+		})
+		if err != nil {
+			return m, err
+		}
+	}
+	if err := r.client.Set(ctx, layoutMarker(from), r.prefix, 0).Err(); err != nil {
+		return m, err
+	}
+	r.layoutDone()
+	return m, nil
+}
+
+func (r *RedisCounter) layoutDone() {
+	if r.legacy != nil {
+		r.legacy.done.Store(true)
+	}
+}
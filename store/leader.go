@@ -0,0 +1,43 @@
+//go:build !minimal
+
+package store
+
+import (
+	"context"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// The leader of the instances sharing a prefix is the key "leader:<prefix>",
+// holding the leader's instance name until it expires. The leader extends it
+// well before then; once it stops, another instance takes over.
+
+func (r *RedisCounter) leaderKey() string { return "leader:" + r.prefix }
+
+// claimLeaderScript makes ARGV[1] the leader for ARGV[2] milliseconds when
+// there is none, extends its lease when it already leads, and returns the
+// leader.
+var claimLeaderScript = redis.NewScript(`
+local cur = redis.call('GET', KEYS[1])
+if not cur then
+  redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+  return ARGV[1]
+end
+if cur == ARGV[1] then
+  redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return cur
+`)
+
+// ClaimLeader makes instance the leader for ttl if no instance leads, or
+// extends its lease if it does, and returns the leader.
+func (r *RedisCounter) ClaimLeader(ctx context.Context, instance string, ttl time.Duration) (string, error) {
+	return claimLeaderScript.Run(ctx, r.client, []string{r.leaderKey()}, instance, ttl.Milliseconds()).Text()
+}
+
+// ResignLeader ends instance's lease, if it leads, so another instance can
+// take over without waiting for it to expire.
+func (r *RedisCounter) ResignLeader(ctx context.Context, instance string) error {
+	return deleteIfUnchanged.Run(ctx, r.client, []string{r.leaderKey()}, instance).Err()
+}
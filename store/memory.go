@@ -0,0 +1,229 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// MultiCounter manages counts per id (e.g., per link) in process memory.
+// Playground ids expire core.TestCounterTTL after their first hit once
+// Janitor is running.
+type MultiCounter struct {
+	mu      sync.RWMutex
+	m       map[string]*uint64
+	floats  map[string]float64   // float aggregate counters (guarded by mu)
+	expires map[string]time.Time // ids with a TTL
+}
+
+func NewMultiCounter() *MultiCounter {
+	return &MultiCounter{m: make(map[string]*uint64), floats: make(map[string]float64), expires: make(map[string]time.Time)}
+}
+
+func (mc *MultiCounter) Capabilities() Capabilities {
+	return Capabilities{AtomicIncrement: true, ReadYourWrites: true, TTL: true, Listing: true, Transactions: true}
+}
+
+func (mc *MultiCounter) Inc(ctx context.Context, id string) (uint64, error) {
+	return mc.IncBy(ctx, id, 1)
+}
+
+// IncBy adds n to id and returns the new value.
+func (mc *MultiCounter) IncBy(_ context.Context, id string, n uint64) (uint64, error) {
+	if id == "" {
+		id = "default"
+	}
+	// The add happens under the read lock so Apply (write lock) sees no
+	// concurrent increments.
+	mc.mu.RLock()
+	if ptr, ok := mc.m[id]; ok {
+		v := atomic.AddUint64(ptr, n)
+		mc.mu.RUnlock()
+		return v, nil
+	}
+	mc.mu.RUnlock()
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	ptr, ok := mc.m[id]
+	if !ok {
+		var v uint64
+		ptr = &v
+		mc.m[id] = ptr
+		if core.IsTestID(id) {
+			mc.expires[id] = core.Now().Add(core.TestCounterTTL)
+		}
+	}
+	return atomic.AddUint64(ptr, n), nil
+}
+
+// Apply runs ops atomically with respect to every other operation.
+func (mc *MultiCounter) Apply(_ context.Context, ops []Op) ([]uint64, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	results, final, err := ApplyOps(ops, func(id string) (uint64, error) {
+		if _, ok := mc.floats[id]; ok {
+			return 0, ErrNotInteger
+		}
+		if ptr := mc.m[id]; ptr != nil {
+			return atomic.LoadUint64(ptr), nil
+		}
+		return 0, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for id, v := range final {
+		if ptr := mc.m[id]; ptr != nil {
+			atomic.StoreUint64(ptr, v)
+			continue
+		}
+		n := v
+		mc.m[id] = &n
+		if core.IsTestID(id) {
+			mc.expires[id] = core.Now().Add(core.TestCounterTTL)
+		}
+	}
+	return results, nil
+}
+
+// IncFloat adds by to a float counter. An existing integer counter with the
+// same id is converted, mirroring Redis INCRBYFLOAT.
+func (mc *MultiCounter) IncFloat(_ context.Context, id string, by float64) (float64, error) {
+	if id == "" {
+		id = "default"
+	}
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	f, ok := mc.floats[id]
+	if !ok {
+		if ptr := mc.m[id]; ptr != nil {
+			f = float64(atomic.LoadUint64(ptr))
+			delete(mc.m, id)
+		}
+	}
+	f += by
+	mc.floats[id] = f
+	return f, nil
+}
+
+// Get returns the counter as a typed value (float if it is a float counter).
+func (mc *MultiCounter) Get(_ context.Context, id string) (core.Value, error) {
+	if id == "" {
+		id = "default"
+	}
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	if f, ok := mc.floats[id]; ok {
+		return core.Float(f), nil
+	}
+	if ptr := mc.m[id]; ptr != nil {
+		return core.Uint(atomic.LoadUint64(ptr)), nil
+	}
+	return core.Uint(0), nil
+}
+
+// Set overwrites id with v (used to fill a cache tier).
+func (mc *MultiCounter) Set(_ context.Context, id string, v core.Value) error {
+	if id == "" {
+		id = "default"
+	}
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if v.IsFloat() {
+		delete(mc.m, id)
+		mc.floats[id] = v.Float64()
+		return nil
+	}
+	delete(mc.floats, id)
+	if ptr := mc.m[id]; ptr != nil {
+		atomic.StoreUint64(ptr, v.Uint64())
+		return nil
+	}
+	n := v.Uint64()
+	mc.m[id] = &n
+	return nil
+}
+
+func (mc *MultiCounter) Expire(_ context.Context, id string, ttl time.Duration) error {
+	mc.expireAt(id, core.Now().Add(ttl))
+	return nil
+}
+
+func (mc *MultiCounter) expireAt(id string, at time.Time) {
+	mc.mu.Lock()
+	mc.expires[id] = at
+	mc.mu.Unlock()
+}
+
+// expiry returns when id expires, if it has a TTL.
+func (mc *MultiCounter) expiry(id string) (time.Time, bool) {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	at, ok := mc.expires[id]
+	return at, ok
+}
+
+// expired lists the counters past their expiry at now.
+func (mc *MultiCounter) expired(now time.Time) []string {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	var ids []string
+	for id, exp := range mc.expires {
+		if now.After(exp) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (mc *MultiCounter) remove(id string) {
+	mc.mu.Lock()
+	delete(mc.m, id)
+	delete(mc.floats, id)
+	delete(mc.expires, id)
+	mc.mu.Unlock()
+}
+
+// Each calls fn for every counter (ids in random order).
+func (mc *MultiCounter) Each(_ context.Context, fn func(id string, v core.Value) error) error {
+	mc.mu.RLock()
+	vals := make(map[string]core.Value, len(mc.m)+len(mc.floats))
+	for id, ptr := range mc.m {
+		vals[id] = core.Uint(atomic.LoadUint64(ptr))
+	}
+	for id, f := range mc.floats {
+		vals[id] = core.Float(f)
+	}
+	mc.mu.RUnlock()
+	for id, v := range vals {
+		if err := fn(id, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SweepExpired drops counters past their expiry.
+func (mc *MultiCounter) SweepExpired(now time.Time) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	for id, exp := range mc.expires {
+		if now.After(exp) {
+			delete(mc.m, id)
+			delete(mc.floats, id)
+			delete(mc.expires, id)
+		}
+	}
+}
+
+// Janitor periodically sweeps expired counters (runs for the process lifetime).
+func (mc *MultiCounter) Janitor(every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for range t.C {
+		mc.SweepExpired(core.Now())
+	}
+}
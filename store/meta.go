@@ -0,0 +1,97 @@
+//go:build !minimal
+
+package store
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/advayc/nums/core"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// metaScript records a hit or reset in the hash "meta:<prefix><id>" (fields
+// lifetime, first_seen, created, last_hit, resets, last_reset; times in RFC
+// 3339), the
+// same way core.CounterMeta does in memory. ARGV is the event ("hit" or
+// "reset"), the value before it, the hits added and the time.
+var metaScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+  redis.call('HSET', KEYS[1], 'lifetime', ARGV[2], 'first_seen', ARGV[4])
+  if ARGV[2] == '0' then
+    redis.call('HSET', KEYS[1], 'created', ARGV[4])
+  end
+end
+if ARGV[1] == 'hit' then
+  redis.call('HINCRBY', KEYS[1], 'lifetime', ARGV[3])
+  redis.call('HSET', KEYS[1], 'last_hit', ARGV[4])
+else
+  redis.call('HINCRBY', KEYS[1], 'resets', 1)
+  redis.call('HSET', KEYS[1], 'last_reset', ARGV[4])
+end
+return 1
+`)
+
+func (r *RedisCounter) metaKey(id string) string { return "meta:" + r.Key(id) }
+
+// RecordHit adds n hits that took id from prev to prev+n to its metadata.
+func (r *RedisCounter) RecordHit(ctx context.Context, id string, prev, n uint64, at time.Time) error {
+	return metaScript.Run(ctx, r.client, []string{r.metaKey(id)}, "hit", prev, n, at.UTC().Format(time.RFC3339Nano)).Err()
+}
+
+// RecordReset notes in id's metadata that it was reset or overwritten while
+// holding prev.
+func (r *RedisCounter) RecordReset(ctx context.Context, id string, prev uint64, at time.Time) error {
+	return metaScript.Run(ctx, r.client, []string{r.metaKey(id)}, "reset", prev, 0, at.UTC().Format(time.RFC3339Nano)).Err()
+}
+
+// Meta reads id's metadata. Hits is left for the caller to fill in.
+func (r *RedisCounter) Meta(ctx context.Context, id string) (core.CounterMeta, error) {
+	h, err := r.client.HGetAll(ctx, r.metaKey(id)).Result()
+	if err != nil {
+		return core.CounterMeta{}, err
+	}
+	return parseMeta(id, h), nil
+}
+
+// MetaMany reads the metadata of several counters in one round trip.
+func (r *RedisCounter) MetaMany(ctx context.Context, ids []string) ([]core.CounterMeta, error) {
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	_, err := r.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = p.HGetAll(ctx, r.metaKey(id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]core.CounterMeta, len(ids))
+	for i, id := range ids {
+		out[i] = parseMeta(id, cmds[i].Val())
+	}
+	return out, nil
+}
+
+func parseMeta(id string, h map[string]string) core.CounterMeta {
+	m := core.CounterMeta{ID: id}
+	m.Lifetime, _ = strconv.ParseUint(h["lifetime"], 10, 64)
+	m.Resets, _ = strconv.ParseUint(h["resets"], 10, 64)
+	m.CreatedAt = parseMetaTime(h["created"])
+	m.FirstSeen = parseMetaTime(h["first_seen"])
+	if m.FirstSeen == nil { // tracked before first_seen was recorded
+		m.FirstSeen = m.CreatedAt
+	}
+	m.LastHit = parseMetaTime(h["last_hit"])
+	m.LastReset = parseMetaTime(h["last_reset"])
+	return m
+}
+
+func parseMetaTime(s string) *time.Time {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
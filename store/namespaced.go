@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// Namespaced stores every id of an inner store under a prefix (used for
+// ENVIRONMENT keyspaces on backends that have no key prefix of their own).
+// Listing only returns ids in the namespace, with the prefix stripped.
+// Optional interfaces the inner store lacks return ErrUnsupported.
+type Namespaced struct {
+	Inner  Store
+	Prefix string
+}
+
+func NewNamespaced(inner Store, prefix string) *Namespaced {
+	return &Namespaced{Inner: inner, Prefix: prefix}
+}
+
+// key prefixes id, mapping "" to "default" first as the backends do.
+func (n *Namespaced) key(id string) string {
+	if id == "" {
+		id = "default"
+	}
+	return n.Prefix + id
+}
+
+func (n *Namespaced) Capabilities() Capabilities { return n.Inner.Capabilities() }
+
+func (n *Namespaced) Inc(ctx context.Context, id string) (uint64, error) {
+	return n.Inner.Inc(ctx, n.key(id))
+}
+
+func (n *Namespaced) Get(ctx context.Context, id string) (core.Value, error) {
+	return n.Inner.Get(ctx, n.key(id))
+}
+
+func (n *Namespaced) IncBy(ctx context.Context, id string, by uint64) (uint64, error) {
+	a, ok := n.Inner.(Adder)
+	if !ok {
+		return 0, ErrUnsupported
+	}
+	return a.IncBy(ctx, n.key(id), by)
+}
+
+func (n *Namespaced) IncFloat(ctx context.Context, id string, by float64) (float64, error) {
+	fi, ok := n.Inner.(FloatIncrementer)
+	if !ok {
+		return 0, ErrUnsupported
+	}
+	return fi.IncFloat(ctx, n.key(id), by)
+}
+
+func (n *Namespaced) Expire(ctx context.Context, id string, ttl time.Duration) error {
+	e, ok := n.Inner.(Expirer)
+	if !ok {
+		return ErrUnsupported
+	}
+	return e.Expire(ctx, n.key(id), ttl)
+}
+
+func (n *Namespaced) DeleteIfZero(ctx context.Context, id string) (bool, error) {
+	d, ok := n.Inner.(ZeroDeleter)
+	if !ok {
+		return false, ErrUnsupported
+	}
+	return d.DeleteIfZero(ctx, n.key(id))
+}
+
+func (n *Namespaced) IncMany(ctx context.Context, ids []string) ([]uint64, error) {
+	b, ok := n.Inner.(BatchIncrementer)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	prefixed := make([]string, len(ids))
+	for i, id := range ids {
+		prefixed[i] = n.key(id)
+	}
+	return b.IncMany(ctx, prefixed)
+}
+
+func (n *Namespaced) Apply(ctx context.Context, ops []Op) ([]uint64, error) {
+	tx, ok := n.Inner.(Transactor)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	prefixed := make([]Op, len(ops))
+	for i, op := range ops {
+		op.ID = n.key(op.ID)
+		prefixed[i] = op
+	}
+	results, err := tx.Apply(ctx, prefixed)
+	if me, ok := err.(*MismatchError); ok {
+		me.ID = strings.TrimPrefix(me.ID, n.Prefix)
+	}
+	return results, err
+}
+
+func (n *Namespaced) Each(ctx context.Context, fn func(id string, v core.Value) error) error {
+	l, ok := n.Inner.(Lister)
+	if !ok {
+		return ErrUnsupported
+	}
+	return l.Each(ctx, func(id string, v core.Value) error {
+		if rest, ok := strings.CutPrefix(id, n.Prefix); ok {
+			return fn(rest, v)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,369 @@
+// Package postgres is a PostgreSQL counter backend (DATABASE_URL). Increments
+// are single INSERT ... ON CONFLICT DO UPDATE statements, connections come
+// from a pgxpool, and the schema is migrated automatically on startup.
+//
+// Semantics follow the Redis backend: integer and float counters, TTLs
+// (playground ids expire after core.TestCounterTTL), listing, batches and
+// transactions.
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migrations are applied in order, each once, under an advisory lock so
+// several instances starting together don't race. Never edit an applied
+// migration; append a new one.
+var migrations = []string{
+	`CREATE TABLE counters (
+		id          TEXT PRIMARY KEY,
+		count       BIGINT NOT NULL DEFAULT 0,
+		float_count DOUBLE PRECISION,  -- non-NULL for float counters
+		expires_at  TIMESTAMPTZ        -- NULL for no TTL
+	)`,
+	`CREATE INDEX counters_expires_at ON counters (expires_at) WHERE expires_at IS NOT NULL`,
+	`CREATE TABLE settings (
+		tbl   TEXT NOT NULL,
+		key   TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (tbl, key)
+	)`,
+}
+
+// migrationLock is the pg_advisory_xact_lock key held while migrating.
+const migrationLock = 0x6e756d73 // "nums"
+
+// Store is a PostgreSQL-backed store.Store.
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+// Open connects to databaseURL (pool settings such as pool_max_conns may be
+// given as URL parameters) and migrates the schema.
+func Open(ctx context.Context, databaseURL string) (*Store, error) {
+	pool, err := pgxpool.New(ctx, databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: %w", err)
+	}
+	s := &Store{pool: pool}
+	if err := s.migrate(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("postgres migrate: %w", err)
+	}
+	return s, nil
+}
+
+func (s *Store) migrate(ctx context.Context) error {
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLock); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS nums_schema_migrations (version INT PRIMARY KEY, applied_at TIMESTAMPTZ NOT NULL DEFAULT now())`); err != nil {
+			return err
+		}
+		var applied int
+		if err := tx.QueryRow(ctx, `SELECT coalesce(max(version), 0) FROM nums_schema_migrations`).Scan(&applied); err != nil {
+			return err
+		}
+		for v := applied + 1; v <= len(migrations); v++ {
+			if _, err := tx.Exec(ctx, migrations[v-1]); err != nil {
+				return fmt.Errorf("migration %d: %w", v, err)
+			}
+			if _, err := tx.Exec(ctx, `INSERT INTO nums_schema_migrations (version) VALUES ($1)`, v); err != nil {
+				return err
+			}
+			log.Printf("postgres: applied migration %d", v)
+		}
+		return nil
+	})
+}
+
+func (s *Store) Close() { s.pool.Close() }
+
+func (s *Store) Capabilities() store.Capabilities {
+	return store.Capabilities{AtomicIncrement: true, ReadYourWrites: true, TTL: true, Listing: true, Batch: true, Transactions: true}
+}
+
+// key maps the empty id to "default", like the Redis backend.
+func key(id string) string {
+	if id == "" {
+		return "default"
+	}
+	return id
+}
+
+// newExpiry is the expires_at of a newly created counter: playground ids
+// start their TTL on the first write.
+func newExpiry(id string) *time.Time {
+	if core.IsTestID(id) {
+		t := time.Now().Add(core.TestCounterTTL)
+		return &t
+	}
+	return nil
+}
+
+// An expired row is treated as absent: the upserts below restart it (value,
+// float flag and TTL) instead of adding to it. Integer increments leave float
+// counters alone (no row is returned), as INCRBY fails on a float in Redis.
+const incBySQL = `
+INSERT INTO counters AS c (id, count, expires_at) VALUES ($1, $2, $3)
+ON CONFLICT (id) DO UPDATE SET
+	count = CASE WHEN c.expires_at <= now() THEN excluded.count ELSE c.count + excluded.count END,
+	float_count = NULL,
+	expires_at = CASE WHEN c.expires_at <= now() THEN excluded.expires_at ELSE c.expires_at END
+WHERE c.float_count IS NULL OR c.expires_at <= now()
+RETURNING count`
+
+const incFloatSQL = `
+INSERT INTO counters AS c (id, count, float_count, expires_at) VALUES ($1, 0, $2, $3)
+ON CONFLICT (id) DO UPDATE SET
+	float_count = CASE WHEN c.expires_at <= now() THEN excluded.float_count ELSE coalesce(c.float_count, c.count) + excluded.float_count END,
+	count = 0,
+	expires_at = CASE WHEN c.expires_at <= now() THEN excluded.expires_at ELSE c.expires_at END
+RETURNING float_count`
+
+// incBy scans the result of incBySQL.
+func incBy(q pgx.Row, id string) (uint64, error) {
+	var v int64
+	err := q.Scan(&v)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("increment %q: %w", id, store.ErrNotInteger)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return uint64(v), nil
+}
+
+func (s *Store) Inc(ctx context.Context, id string) (uint64, error) {
+	return s.IncBy(ctx, id, 1)
+}
+
+// IncBy adds n to id in one UPSERT.
+func (s *Store) IncBy(ctx context.Context, id string, n uint64) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return incBy(s.pool.QueryRow(ctx, incBySQL, key(id), int64(n), newExpiry(id)), id)
+}
+
+// IncFloat adds by to id, turning an integer counter into a float one (like
+// INCRBYFLOAT).
+func (s *Store) IncFloat(ctx context.Context, id string, by float64) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var v float64
+	err := s.pool.QueryRow(ctx, incFloatSQL, key(id), by, newExpiry(id)).Scan(&v)
+	return v, err
+}
+
+const getSQL = `SELECT count, float_count FROM counters WHERE id = $1 AND (expires_at IS NULL OR expires_at > now())`
+
+// Get returns id's value (zero if it does not exist or has expired).
+func (s *Store) Get(ctx context.Context, id string) (core.Value, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return scanValue(s.pool.QueryRow(ctx, getSQL, key(id)))
+}
+
+func scanValue(row pgx.Row) (core.Value, error) {
+	var n int64
+	var f *float64
+	err := row.Scan(&n, &f)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return core.Uint(0), nil
+	}
+	if err != nil {
+		return core.Value{}, err
+	}
+	if f != nil {
+		return core.Float(*f), nil
+	}
+	return core.Uint(uint64(n)), nil
+}
+
+// Expire deletes id after ttl (no-op if id does not exist, like EXPIRE).
+func (s *Store) Expire(ctx context.Context, id string, ttl time.Duration) error {
+	_, err := s.pool.Exec(ctx, `UPDATE counters SET expires_at = $1 WHERE id = $2`, time.Now().Add(ttl), key(id))
+	return err
+}
+
+// DeleteIfZero deletes id if it holds the integer 0.
+func (s *Store) DeleteIfZero(ctx context.Context, id string) (bool, error) {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM counters WHERE id = $1 AND count = 0 AND float_count IS NULL`, key(id))
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// IncMany increments ids in one transaction and one round trip.
+func (s *Store) IncMany(ctx context.Context, ids []string) ([]uint64, error) {
+	out := make([]uint64, len(ids))
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		b := &pgx.Batch{}
+		for _, id := range ids {
+			b.Queue(incBySQL, key(id), int64(1), newExpiry(id))
+		}
+		res := tx.SendBatch(ctx, b)
+		defer res.Close()
+		for i, id := range ids {
+			v, err := incBy(res.QueryRow(), id)
+			if err != nil {
+				return err
+			}
+			out[i] = v
+		}
+		return res.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Each lists live counters in id order, skipping day buckets.
+func (s *Store) Each(ctx context.Context, fn func(id string, v core.Value) error) error {
+	rows, err := s.pool.Query(ctx, `SELECT id, count, float_count FROM counters WHERE expires_at IS NULL OR expires_at > now() ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var n int64
+		var f *float64
+		if err := rows.Scan(&id, &n, &f); err != nil {
+			return err
+		}
+		if core.IsDayBucketID(id) {
+			continue
+		}
+		v := core.Uint(uint64(n))
+		if f != nil {
+			v = core.Float(*f)
+		}
+		if err := fn(id, v); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Apply runs ops in one transaction. The touched rows are created if missing
+// and locked (in id order, so concurrent transactions can't deadlock) before
+// anything is read; nothing is written unless every op succeeds.
+func (s *Store) Apply(ctx context.Context, ops []store.Op) ([]uint64, error) {
+	var results []uint64
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		seen := make(map[string]bool)
+		var ids []string
+		for _, op := range ops {
+			if k := key(op.ID); !seen[k] {
+				seen[k] = true
+				ids = append(ids, k)
+			}
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			if _, err := tx.Exec(ctx, `INSERT INTO counters (id, expires_at) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING`, id, newExpiry(id)); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, `SELECT 1 FROM counters WHERE id = $1 FOR UPDATE`, id); err != nil {
+				return err
+			}
+		}
+		var final map[string]uint64
+		var err error
+		results, final, err = store.ApplyOps(ops, func(id string) (uint64, error) {
+			v, err := scanValue(tx.QueryRow(ctx, getSQL, key(id)))
+			if err != nil {
+				return 0, err
+			}
+			if v.IsFloat() {
+				return 0, store.ErrNotInteger
+			}
+			return v.Uint64(), nil
+		})
+		if err != nil {
+			return err
+		}
+		for id, v := range final {
+			// the value is replaced, the TTL kept (SET KEEPTTL in the Redis
+			// backend) unless it already ran out
+			_, err := tx.Exec(ctx, `
+UPDATE counters SET
+	count = $2,
+	float_count = NULL,
+	expires_at = CASE WHEN expires_at <= now() THEN $3 ELSE expires_at END
+WHERE id = $1`, key(id), int64(v), newExpiry(id))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// SweepExpired deletes expired counters and returns how many were removed.
+func (s *Store) SweepExpired(ctx context.Context) (int64, error) {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM counters WHERE expires_at <= now()`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Janitor sweeps expired counters every interval for the process lifetime.
+func (s *Store) Janitor(every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for range t.C {
+		if _, err := s.SweepExpired(context.Background()); err != nil {
+			log.Printf("(warn) postgres expiry sweep: %v", err)
+		}
+	}
+}
+
+// Settings (see store.Settings) are rows of the settings table.
+
+func (s *Store) LoadSettings(ctx context.Context, table string) (map[string]string, error) {
+	rows, err := s.pool.Query(ctx, `SELECT key, value FROM settings WHERE tbl = $1`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]string)
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		out[k] = v
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) PutSetting(ctx context.Context, table, key, value string) error {
+	_, err := s.pool.Exec(ctx, `INSERT INTO settings (tbl, key, value) VALUES ($1, $2, $3)
+ON CONFLICT (tbl, key) DO UPDATE SET value = excluded.value`, table, key, value)
+	return err
+}
+
+func (s *Store) DeleteSetting(ctx context.Context, table, key string) error {
+	_, err := s.pool.Exec(ctx, `DELETE FROM settings WHERE tbl = $1 AND key = $2`, table, key)
+	return err
+}
@@ -0,0 +1,60 @@
+//go:build !minimal
+
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/advayc/nums/core"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// takeQuotaScript records a hit of ARGV[2] on counter ARGV[1] against a
+// namespace's quotas: the set KEYS[1] of its counters when ARGV[3] limits
+// them, and its hits of the day KEYS[2] (expiring after ARGV[5] seconds)
+// when ARGV[4] limits those. Nothing is recorded when either would go past
+// its limit. It returns {refused, counters, hits}, where refused is 0, 1 for
+// the counters quota or 2 for the hits one.
+var takeQuotaScript = redis.NewScript(`
+local n = tonumber(ARGV[2])
+local maxc, maxh = tonumber(ARGV[3]), tonumber(ARGV[4])
+local counters, hits, member = 0, 0, true
+if maxc > 0 then
+  member = redis.call('SISMEMBER', KEYS[1], ARGV[1]) == 1
+  counters = redis.call('SCARD', KEYS[1])
+  if not member then
+    if counters >= maxc then
+      return {1, counters, 0}
+    end
+    counters = counters + 1
+  end
+end
+if maxh > 0 then
+  hits = tonumber(redis.call('GET', KEYS[2]) or '0')
+  if hits + n > maxh then
+    return {2, counters, hits}
+  end
+end
+if not member then
+  redis.call('SADD', KEYS[1], ARGV[1])
+end
+if maxh > 0 then
+  hits = redis.call('INCRBY', KEYS[2], n)
+  redis.call('EXPIRE', KEYS[2], ARGV[5])
+end
+return {0, counters, hits}
+`)
+
+// TakeQuota records n hits on id against namespace ns's quota q for day
+// (YYYYMMDD), as "quota:<prefix><ns>:counters" (a set) and
+// "quota:<prefix><ns>:<day>". It returns the usage after the hit, or the
+// usage that refuses it as a *core.QuotaError.
+func (r *RedisCounter) TakeQuota(ctx context.Context, ns, id, day string, n uint64, q core.Quota) ([]core.QuotaUsage, error) {
+	base := "quota:" + r.prefix + ns + ":"
+	res, err := takeQuotaScript.Run(ctx, r.client, []string{base + "counters", base + day}, id, n, q.Counters, q.Hits, int64((48 * time.Hour).Seconds())).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	return q.Take(ns, res[0], uint64(res[1]), uint64(res[2]))
+}
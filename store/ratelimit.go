@@ -0,0 +1,24 @@
+//go:build !minimal
+
+package store
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// RateWindow counts a request from client in the rate-limit window that ends
+// at reset, the key "ratelimit:<prefix><client>:<reset unix>", and returns
+// how many it has seen. The key expires after window, so every instance
+// shares the count.
+func (r *RedisCounter) RateWindow(ctx context.Context, client string, reset time.Time, window time.Duration) (int64, error) {
+	key := "ratelimit:" + r.prefix + client + ":" + strconv.FormatInt(reset.Unix(), 10)
+	pipe := r.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
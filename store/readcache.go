@@ -0,0 +1,138 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// ReadCache keeps recently read counter values in memory for a short TTL so
+// that badges embedded in busy pages are not read from Redis on every
+// render. It holds at most Size counters and evicts the least recently used
+// one first. A cached value can be up to TTL behind hits counted by other
+// instances; hits counted by this one update it right away (Put). Expired
+// values are kept until evicted, as the last known ones (Last).
+type ReadCache struct {
+	TTL  time.Duration
+	Size int
+
+	mu    sync.Mutex
+	order *list.List // front is most recently used
+	items map[string]*list.Element
+}
+
+type cacheEntry struct {
+	id string
+	v  core.Value
+	at time.Time
+}
+
+// NewReadCache returns a cache of size counters (default 10000) whose values
+// are served for ttl.
+func NewReadCache(size int, ttl time.Duration) *ReadCache {
+	if size <= 0 {
+		size = 10000
+	}
+	return &ReadCache{TTL: ttl, Size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// ReadCacheFromEnv reads READ_CACHE_TTL (e.g. "2s"; unset or 0 disables the
+// cache and returns nil) and READ_CACHE_SIZE.
+func ReadCacheFromEnv() (*ReadCache, error) {
+	ttl := time.Duration(0)
+	if s := os.Getenv("READ_CACHE_TTL"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("READ_CACHE_TTL: %q is not a duration", s)
+		}
+		ttl = d
+	}
+	if ttl == 0 {
+		return nil, nil
+	}
+	size := 0
+	if s := os.Getenv("READ_CACHE_SIZE"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("READ_CACHE_SIZE: %q is not a positive number", s)
+		}
+		size = n
+	}
+	return NewReadCache(size, ttl), nil
+}
+
+// Get returns id's cached value while it is fresh.
+func (c *ReadCache) Get(id string) (core.Value, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[id]
+	if !ok {
+		return core.Value{}, false
+	}
+	e := el.Value.(*cacheEntry)
+	if time.Since(e.at) >= c.TTL {
+		return core.Value{}, false
+	}
+	c.order.MoveToFront(el)
+	return e.v, true
+}
+
+// Last returns id's last cached value, fresh or not, and when it was
+// cached, e.g. to answer with a stale value while the store is down.
+func (c *ReadCache) Last(id string) (v core.Value, at time.Time, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[id]
+	if !ok {
+		return core.Value{}, time.Time{}, false
+	}
+	e := el.Value.(*cacheEntry)
+	return e.v, e.at, true
+}
+
+// Put caches v as id's current value.
+func (c *ReadCache) Put(id string, v core.Value) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[id]; ok {
+		el.Value = &cacheEntry{id: id, v: v, at: time.Now()}
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[id] = c.order.PushFront(&cacheEntry{id: id, v: v, at: time.Now()})
+	for c.order.Len() > c.Size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).id)
+	}
+}
+
+// Forget drops id, e.g. after an admin change this instance cannot express
+// as a new value.
+func (c *ReadCache) Forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[id]; ok {
+		c.order.Remove(el)
+		delete(c.items, id)
+	}
+}
+
+// Read returns id's cached value, or loads it and caches it when load
+// succeeds. Failed loads are not cached.
+func (c *ReadCache) Read(ctx context.Context, id string, load func(ctx context.Context, id string) (core.Value, error)) (core.Value, error) {
+	if v, ok := c.Get(id); ok {
+		return v, nil
+	}
+	v, err := load(ctx, id)
+	if err == nil {
+		c.Put(id, v)
+	}
+	return v, err
+}
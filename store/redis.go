@@ -0,0 +1,381 @@
+//go:build !minimal
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/advayc/nums/core"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// RedisCounter provides persistent counts using Redis. Keys are
+// "<prefix><id>" (prefix "hits:" by default).
+type RedisCounter struct {
+	client redis.UniversalClient
+	prefix string
+	legacy *legacyLayout // set while keys move from an older layout (see UpgradeFrom)
+}
+
+// NewRedisCounter connects to a single node at redisURL.
+func NewRedisCounter(redisURL, prefix string) (*RedisCounter, error) {
+	return NewRedisCounterFromConfig(RedisConfig{URL: redisURL, MaxRetries: 3}, prefix)
+}
+
+// NewRedisCounterFromConfig connects to a single node, a Sentinel-managed
+// master or a Redis Cluster (see RedisConfig).
+func NewRedisCounterFromConfig(cfg RedisConfig, prefix string) (*RedisCounter, error) {
+	c, err := cfg.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := c.Ping(ctx).Err(); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("redis ping: %w", err)
+	}
+	if prefix == "" {
+		prefix = "hits:"
+	}
+	return &RedisCounter{client: c, prefix: prefix}, nil
+}
+
+// NewRedisCounterFromClient wraps a client that is already connected, such
+// as the serverless handler's shared one.
+func NewRedisCounterFromClient(c redis.UniversalClient, prefix string) *RedisCounter {
+	if prefix == "" {
+		prefix = "hits:"
+	}
+	return &RedisCounter{client: c, prefix: prefix}
+}
+
+// Client exposes the underlying client for features that keep their own
+// Redis structures (milestone lists, change feed).
+func (r *RedisCounter) Client() redis.UniversalClient { return r.client }
+
+// Prefix is the key prefix counters are stored under.
+func (r *RedisCounter) Prefix() string { return r.prefix }
+
+// Key returns the Redis key of counter id.
+func (r *RedisCounter) Key(id string) string {
+	if id == "" {
+		id = "default"
+	}
+	return r.prefix + id
+}
+
+func (r *RedisCounter) Capabilities() Capabilities {
+	return Capabilities{AtomicIncrement: true, ReadYourWrites: true, TTL: true, Listing: true, Batch: true, Streams: true, Transactions: true}
+}
+
+func (r *RedisCounter) Inc(ctx context.Context, id string) (uint64, error) {
+	return r.IncBy(ctx, id, 1)
+}
+
+// incrScript adds ARGV[1] to KEYS[1] unless it holds a gauge: a value that is
+// not a whole number of hits (negative or with a fraction), or, when KEYS[2]
+// is the gauge types hash, one listed there under ARGV[2]. It returns
+// {1, value}, or {0, gauge type} without writing.
+var incrScript = redis.NewScript(`
+local kind = KEYS[2] and redis.call('HGET', KEYS[2], ARGV[2])
+if not kind then
+  local cur = redis.call('GET', KEYS[1])
+  if cur and not string.match(cur, '^%d+$') then
+    kind = string.match(cur, '^-?%d+$') and 'int' or 'float'
+  end
+end
+if kind then
+  return {0, kind}
+end
+return {1, redis.call('INCRBY', KEYS[1], ARGV[1])}
+`)
+
+// incrArgs returns incrScript's keys and args for adding n to id. The gauge
+// types hash is left out on Redis Cluster, where it is in another slot.
+func (r *RedisCounter) incrArgs(id string, n uint64) ([]string, []any) {
+	if id == "" {
+		id = "default"
+	}
+	keys := []string{r.Key(id)}
+	if _, ok := r.client.(*redis.ClusterClient); !ok {
+		keys = append(keys, r.settingsKey(GaugeTable))
+	}
+	return keys, []any{n, id}
+}
+
+// incrResult reads incrScript's reply.
+func incrResult(id string, res []any, err error) (uint64, error) {
+	if err != nil {
+		return 0, err
+	}
+	if len(res) != 2 {
+		return 0, fmt.Errorf("increment %q: unexpected reply %v", id, res)
+	}
+	if ok, _ := res[0].(int64); ok == 0 {
+		kind, _ := res[1].(string)
+		return 0, &GaugeTypeError{ID: id, Type: kind}
+	}
+	v, _ := res[1].(int64)
+	return uint64(v), nil
+}
+
+// IncBy adds n to id with INCRBY, refusing gauges (see incrScript). The first
+// write to a playground id starts its TTL.
+func (r *RedisCounter) IncBy(ctx context.Context, id string, n uint64) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if err := r.Upgrade(ctx, id); err != nil {
+		return 0, err
+	}
+	keys, args := r.incrArgs(id, n)
+	res, err := incrScript.Run(ctx, r.client, keys, args...).Slice()
+	v, err := incrResult(id, res, err)
+	if err != nil {
+		return 0, err
+	}
+	if v == n && core.IsTestID(id) { // first write creates the key; start its TTL
+		if err := r.client.Expire(ctx, r.Key(id), core.TestCounterTTL).Err(); err != nil {
+			log.Printf("(warn) redis expire for playground counter %q failed: %v", id, err)
+		}
+	}
+	return v, nil
+}
+
+// IncFloat adds by to a float counter via INCRBYFLOAT.
+func (r *RedisCounter) IncFloat(ctx context.Context, id string, by float64) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if err := r.Upgrade(ctx, id); err != nil {
+		return 0, err
+	}
+	return r.client.IncrByFloat(ctx, r.Key(id), by).Result()
+}
+
+// Get returns the stored value as integer or float (float counters are
+// written by INCRBYFLOAT and may contain a decimal point).
+func (r *RedisCounter) Get(ctx context.Context, id string) (core.Value, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if err := r.Upgrade(ctx, id); err != nil {
+		return core.Value{}, err
+	}
+	s, err := r.client.Get(ctx, r.Key(id)).Result()
+	if err == redis.Nil {
+		return core.Uint(0), nil
+	}
+	if err != nil {
+		return core.Value{}, err
+	}
+	return core.ParseValue(s)
+}
+
+func (r *RedisCounter) Expire(ctx context.Context, id string, ttl time.Duration) error {
+	return r.client.Expire(ctx, r.Key(id), ttl).Err()
+}
+
+// IncMany increments ids in one MULTI/EXEC round trip (on Redis Cluster, one
+// per slot). A gauge among them is left alone and fails the call with a
+// *GaugeTypeError, while the others are still counted.
+func (r *RedisCounter) IncMany(ctx context.Context, ids []string) ([]uint64, error) {
+	if err := r.Upgrade(ctx, ids...); err != nil {
+		return nil, err
+	}
+	pipe := r.client.TxPipeline()
+	cmds := make([]*redis.Cmd, len(ids))
+	for i, id := range ids {
+		keys, args := r.incrArgs(id, 1)
+		cmds[i] = incrScript.Eval(ctx, pipe, keys, args...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	out := make([]uint64, len(ids))
+	var refused error
+	for i, c := range cmds {
+		res, err := c.Slice()
+		if out[i], err = incrResult(ids[i], res, err); err != nil {
+			refused = err
+		}
+	}
+	return out, refused
+}
+
+// Each scans every "<prefix>*" key (SCAN + pipelined GETs in batches),
+// skipping day buckets.
+func (r *RedisCounter) Each(ctx context.Context, fn func(id string, v core.Value) error) error {
+	var batch []string
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		vals, found, err := GetMany(ctx, r.client, batch)
+		if err != nil {
+			return err
+		}
+		for i, s := range vals {
+			if !found[i] {
+				continue
+			}
+			val, err := core.ParseValue(s)
+			if err != nil {
+				continue
+			}
+			if err := fn(strings.TrimPrefix(batch[i], r.prefix), val); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	err := ScanKeys(ctx, r.client, r.prefix+"*", func(key string) error {
+		if core.IsDayBucketID(strings.TrimPrefix(key, r.prefix)) {
+			return nil
+		}
+		batch = append(batch, key)
+		if len(batch) == 500 {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// applyScript runs a transaction server-side so it is atomic. KEYS are the
+// counter keys, one per op, then possibly the gauge types hash; ARGV holds
+// the TTL in seconds for new playground keys, the number of ops and the
+// length of the key prefix, then (kind, n, playground flag) per op. Every op
+// is validated before anything is written; failures return an error reply
+// ("UNDERFLOW ...", "MISMATCH <op index> <current>" or "NOTINT ..." for a
+// gauge or float counter).
+var applyScript = redis.NewScript(`
+local ttl, nops, plen = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local gauges = KEYS[nops+1]
+local vals, existed, results = {}, {}, {}
+for i = 1, nops do
+  local k = KEYS[i]
+  local kind, n = ARGV[3*i+1], tonumber(ARGV[3*i+2])
+  local cur = vals[k]
+  if cur == nil then
+    local raw = redis.call('GET', k)
+    existed[k] = raw ~= false
+    cur = tonumber(raw or '0')
+    if cur == nil or cur < 0 or math.floor(cur) ~= cur then
+      return redis.error_reply('NOTINT ' .. k)
+    end
+    if gauges and redis.call('HEXISTS', gauges, string.sub(k, plen+1)) == 1 then
+      return redis.error_reply('NOTINT ' .. k)
+    end
+  end
+  if kind == 'inc' then
+    cur = cur + n
+  elseif kind == 'expect' then
+    if cur ~= n then
+      return redis.error_reply('MISMATCH ' .. i .. ' ' .. string.format('%d', cur))
+    end
+  elseif kind == 'below' then
+    if cur >= n then
+      return redis.error_reply('MISMATCH ' .. i .. ' ' .. string.format('%d', cur))
+    end
+  elseif kind == 'dec' then
+    if n > cur then
+      return redis.error_reply('UNDERFLOW ' .. k .. ' is ' .. string.format('%d', cur))
+    end
+    cur = cur - n
+  else
+    cur = n
+  end
+  vals[k] = cur
+  results[i] = string.format('%d', cur)
+end
+for i = 1, nops do
+  local k = KEYS[i]
+  if vals[k] ~= nil then
+    redis.call('SET', k, string.format('%d', vals[k]), 'KEEPTTL')
+    if not existed[k] and ARGV[3*i+3] == '1' then
+      redis.call('EXPIRE', k, ttl)
+    end
+    vals[k] = nil
+  end
+end
+return results
+`)
+
+// refuseGauges returns ErrNotInteger if ops touch a gauge. It is for Redis
+// Cluster, where the gauge types hash is in another slot than the counters,
+// so applyScript can't read it; the check is not atomic with the script, but
+// a counter only becomes a gauge once.
+func (r *RedisCounter) refuseGauges(ctx context.Context, ops []Op) error {
+	ids := OpIDs(ops)
+	types, err := r.client.HMGet(ctx, r.settingsKey(GaugeTable), ids...).Result()
+	if err != nil {
+		return err
+	}
+	for _, t := range types {
+		if t != nil {
+			return ErrNotInteger
+		}
+	}
+	return nil
+}
+
+// Apply runs ops atomically in a Lua script.
+func (r *RedisCounter) Apply(ctx context.Context, ops []Op) ([]uint64, error) {
+	for _, op := range ops {
+		if err := r.Upgrade(ctx, op.ID); err != nil {
+			return nil, err
+		}
+	}
+	keys := make([]string, len(ops), len(ops)+1)
+	args := []any{int64(core.TestCounterTTL / time.Second), len(ops), len(r.prefix)}
+	for i, op := range ops {
+		if err := op.Validate(); err != nil {
+			return nil, err
+		}
+		keys[i] = r.Key(op.ID)
+		playground := "0"
+		if core.IsTestID(op.ID) {
+			playground = "1"
+		}
+		args = append(args, op.Kind, op.N, playground)
+	}
+	if _, ok := r.client.(*redis.ClusterClient); !ok {
+		keys = append(keys, r.settingsKey(GaugeTable))
+	} else if err := r.refuseGauges(ctx, ops); err != nil {
+		return nil, err
+	}
+	raw, err := applyScript.Run(ctx, r.client, keys, args...).StringSlice()
+	if err != nil {
+		switch {
+		case strings.HasPrefix(err.Error(), "UNDERFLOW"):
+			return nil, fmt.Errorf("%w: %s", ErrUnderflow, strings.TrimPrefix(err.Error(), "UNDERFLOW "+r.prefix))
+		case strings.HasPrefix(err.Error(), "NOTINT"):
+			return nil, ErrNotInteger
+		case strings.HasPrefix(err.Error(), "CROSSSLOT"):
+			return nil, ErrCrossSlot
+		case strings.HasPrefix(err.Error(), "MISMATCH "):
+			var i int
+			var cur uint64
+			if _, serr := fmt.Sscanf(err.Error(), "MISMATCH %d %d", &i, &cur); serr != nil || i < 1 || i > len(ops) {
+				return nil, err
+			}
+			return nil, &MismatchError{ID: ops[i-1].ID, Expected: ops[i-1].N, Current: cur, Below: ops[i-1].Kind == OpBelow}
+		}
+		return nil, err
+	}
+	out := make([]uint64, len(raw))
+	for i, s := range raw {
+		if out[i], err = strconv.ParseUint(s, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
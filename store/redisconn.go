@@ -0,0 +1,193 @@
+//go:build !minimal
+
+package store
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// ErrCrossSlot is returned when one Redis Cluster transaction touches
+// counters that hash to different slots.
+var ErrCrossSlot = errors.New("counters are in different Redis Cluster slots")
+
+// RedisConfig selects a Redis topology:
+//
+//   - REDIS_URL: a single node (redis:// or rediss://)
+//   - REDIS_SENTINEL_ADDRS (comma-separated host:port) and REDIS_SENTINEL_MASTER:
+//     the master Sentinel currently reports, followed across failovers;
+//     REDIS_SENTINEL_PASSWORD authenticates to the sentinels themselves
+//   - REDIS_CLUSTER_ADDRS (comma-separated seed nodes): Redis Cluster
+//
+// Sentinel and Cluster nodes use REDIS_USERNAME, REDIS_PASSWORD and REDIS_TLS.
+// Commands that fail on a connection error or while a replica is promoted
+// (READONLY, LOADING, CLUSTERDOWN, TRYAGAIN, MOVED/ASK) are retried up to
+// REDIS_MAX_RETRIES times with backoff, so a failover stalls hits instead of
+// dropping them. A retried INCR whose reply was lost can count twice.
+type RedisConfig struct {
+	URL              string
+	SentinelAddrs    []string
+	SentinelMaster   string
+	SentinelPassword string
+	ClusterAddrs     []string
+	Username         string
+	Password         string
+	TLS              bool
+	MaxRetries       int
+}
+
+// RedisConfigFromEnv reads the settings above; url is the (possibly
+// Upstash-derived) single-node REDIS_URL.
+func RedisConfigFromEnv(url string) (RedisConfig, error) {
+	c := RedisConfig{
+		URL:              url,
+		SentinelAddrs:    splitAddrs(os.Getenv("REDIS_SENTINEL_ADDRS")),
+		SentinelMaster:   os.Getenv("REDIS_SENTINEL_MASTER"),
+		SentinelPassword: os.Getenv("REDIS_SENTINEL_PASSWORD"),
+		ClusterAddrs:     splitAddrs(os.Getenv("REDIS_CLUSTER_ADDRS")),
+		Username:         os.Getenv("REDIS_USERNAME"),
+		Password:         os.Getenv("REDIS_PASSWORD"),
+		MaxRetries:       5,
+	}
+	c.TLS, _ = strconv.ParseBool(os.Getenv("REDIS_TLS"))
+	if s := os.Getenv("REDIS_MAX_RETRIES"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return c, fmt.Errorf("REDIS_MAX_RETRIES must be a non-negative integer")
+		}
+		c.MaxRetries = n
+	}
+	switch {
+	case len(c.SentinelAddrs) > 0 && len(c.ClusterAddrs) > 0:
+		return c, fmt.Errorf("set either REDIS_SENTINEL_ADDRS or REDIS_CLUSTER_ADDRS, not both")
+	case len(c.SentinelAddrs) > 0 && c.SentinelMaster == "":
+		return c, fmt.Errorf("REDIS_SENTINEL_ADDRS needs REDIS_SENTINEL_MASTER")
+	}
+	return c, nil
+}
+
+func splitAddrs(s string) []string {
+	var out []string
+	for _, a := range strings.Split(s, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// Configured reports whether any topology is set.
+func (c RedisConfig) Configured() bool {
+	return c.URL != "" || len(c.SentinelAddrs) > 0 || len(c.ClusterAddrs) > 0
+}
+
+// String describes the topology for logs (no credentials).
+func (c RedisConfig) String() string {
+	switch {
+	case len(c.SentinelAddrs) > 0:
+		return fmt.Sprintf("sentinel master=%s sentinels=%s", c.SentinelMaster, strings.Join(c.SentinelAddrs, ","))
+	case len(c.ClusterAddrs) > 0:
+		return "cluster nodes=" + strings.Join(c.ClusterAddrs, ",")
+	}
+	if opt, err := redis.ParseURL(c.URL); err == nil {
+		return "addr=" + opt.Addr
+	}
+	return "addr=?"
+}
+
+// NewClient builds the client for the configured topology (without
+// connecting; the first command does).
+func (c RedisConfig) NewClient() (redis.UniversalClient, error) {
+	const minBackoff, maxBackoff = 100 * time.Millisecond, 2 * time.Second
+	var tlsConfig *tls.Config
+	if c.TLS {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	switch {
+	case len(c.SentinelAddrs) > 0:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       c.SentinelMaster,
+			SentinelAddrs:    c.SentinelAddrs,
+			SentinelPassword: c.SentinelPassword,
+			Username:         c.Username,
+			Password:         c.Password,
+			TLSConfig:        tlsConfig,
+			MaxRetries:       c.MaxRetries,
+			MinRetryBackoff:  minBackoff,
+			MaxRetryBackoff:  maxBackoff,
+		}), nil
+	case len(c.ClusterAddrs) > 0:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:           c.ClusterAddrs,
+			Username:        c.Username,
+			Password:        c.Password,
+			TLSConfig:       tlsConfig,
+			MaxRetries:      c.MaxRetries,
+			MinRetryBackoff: minBackoff,
+			MaxRetryBackoff: maxBackoff,
+		}), nil
+	case c.URL != "":
+		opt, err := redis.ParseURL(c.URL)
+		if err != nil {
+			return nil, fmt.Errorf("parse redis url: %w", err)
+		}
+		opt.MaxRetries, opt.MinRetryBackoff, opt.MaxRetryBackoff = c.MaxRetries, minBackoff, maxBackoff
+		return redis.NewClient(opt), nil
+	}
+	return nil, fmt.Errorf("%w: no Redis configured", ErrNotConfigured)
+}
+
+// ScanKeys calls fn for every key matching match. On Redis Cluster every
+// master is scanned; fn calls are serialized either way.
+func ScanKeys(ctx context.Context, c redis.UniversalClient, match string, fn func(key string) error) error {
+	scan := func(ctx context.Context, node redis.Cmdable, mu *sync.Mutex) error {
+		iter := node.Scan(ctx, 0, match, 500).Iterator()
+		for iter.Next(ctx) {
+			mu.Lock()
+			err := fn(iter.Val())
+			mu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+		return iter.Err()
+	}
+	var mu sync.Mutex
+	if cc, ok := c.(*redis.ClusterClient); ok {
+		return cc.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return scan(ctx, node, &mu)
+		})
+	}
+	return scan(ctx, c, &mu)
+}
+
+// GetMany reads keys in one round trip per node. Missing keys are "" with
+// ok false. It replaces MGET, which Redis Cluster refuses across slots.
+func GetMany(ctx context.Context, c redis.UniversalClient, keys []string) (vals []string, ok []bool, err error) {
+	pipe := c.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, k := range keys {
+		cmds[i] = pipe.Get(ctx, k)
+	}
+	_, _ = pipe.Exec(ctx) // errors are checked per command
+	vals, ok = make([]string, len(keys)), make([]bool, len(keys))
+	for i, cmd := range cmds {
+		switch err := cmd.Err(); err {
+		case nil:
+			vals[i], ok[i] = cmd.Val(), true
+		case redis.Nil:
+		default:
+			return nil, nil, err
+		}
+	}
+	return vals, ok, nil
+}
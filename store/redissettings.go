@@ -0,0 +1,36 @@
+//go:build !minimal
+
+package store
+
+import (
+	"context"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// A settings table is the hash "<table>:<prefix>", shared by every instance.
+
+func (r *RedisCounter) settingsKey(table string) string { return table + ":" + r.prefix }
+
+func (r *RedisCounter) LoadSettings(ctx context.Context, table string) (map[string]string, error) {
+	return r.client.HGetAll(ctx, r.settingsKey(table)).Result()
+}
+
+func (r *RedisCounter) PutSetting(ctx context.Context, table, key, value string) error {
+	return r.client.HSet(ctx, r.settingsKey(table), key, value).Err()
+}
+
+func (r *RedisCounter) DeleteSetting(ctx context.Context, table, key string) error {
+	return r.client.HDel(ctx, r.settingsKey(table), key).Err()
+}
+
+// claimGaugeScript sets field ARGV[1] of the gauge types hash to ARGV[2]
+// unless it is set, and returns it.
+var claimGaugeScript = redis.NewScript(`
+redis.call('HSETNX', KEYS[1], ARGV[1], ARGV[2])
+return redis.call('HGET', KEYS[1], ARGV[1])
+`)
+
+func (r *RedisCounter) claimGauge(ctx context.Context, id, kind string) (string, error) {
+	return claimGaugeScript.Run(ctx, r.client, []string{r.settingsKey(GaugeTable)}, id, kind).Text()
+}
@@ -0,0 +1,384 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// Replicated writes every change to two stores, e.g. Redis as the primary and
+// SQLite as a local secondary copy. Reads are served by the primary and fall
+// back to the secondary when it errors. Failures of one side are logged and
+// answered from the other; only a failure of both is returned as an error.
+//
+// A write that fails on one side is kept as a pending delta (the hit is still
+// counted on the other side). Reconcile replays those deltas and then heals
+// every counter where the two stores still differ, so they converge after an
+// outage of either one, a lost write or a restore from backup.
+type Replicated struct {
+	Primary   Store
+	Secondary Store
+
+	// Settle skips counters written this recently in the full comparison,
+	// so Reconcile never races a hit that reached only one side so far
+	// (default 10s).
+	Settle time.Duration
+
+	mu      sync.Mutex
+	behind  [2]map[string]delta  // per side (0 primary, 1 secondary): writes it missed
+	resync  map[string]bool      // ids whose transaction result the secondary missed
+	touched map[string]time.Time // id -> last write
+}
+
+// delta is an amount one side has not received yet.
+type delta struct {
+	n uint64
+	f float64
+}
+
+const (
+	sidePrimary = iota
+	sideSecondary
+)
+
+// NewReplicated dual-writes to p and s. Both must implement Adder so the hits
+// a side missed can be replayed.
+func NewReplicated(p, s Store) (*Replicated, error) {
+	for _, st := range []Store{p, s} {
+		if _, ok := st.(Adder); !ok {
+			return nil, fmt.Errorf("replication needs stores that can add deltas (IncBy)")
+		}
+	}
+	return &Replicated{
+		Primary:   p,
+		Secondary: s,
+		Settle:    10 * time.Second,
+		behind:    [2]map[string]delta{make(map[string]delta), make(map[string]delta)},
+		resync:    make(map[string]bool),
+		touched:   make(map[string]time.Time),
+	}, nil
+}
+
+// Capabilities are the primary's.
+func (r *Replicated) Capabilities() Capabilities { return r.Primary.Capabilities() }
+
+func (r *Replicated) side(i int) Store {
+	if i == sidePrimary {
+		return r.Primary
+	}
+	return r.Secondary
+}
+
+// miss records that side i did not receive d for id.
+func (r *Replicated) miss(i int, id string, d delta, err error) {
+	log.Printf("(warn) replication: %s write for %q failed, will replay: %v", sideName(i), id, err)
+	r.pend(i, id, d)
+}
+
+func (r *Replicated) pend(i int, id string, d delta) {
+	r.mu.Lock()
+	p := r.behind[i][id]
+	p.n += d.n
+	p.f += d.f
+	r.behind[i][id] = p
+	r.mu.Unlock()
+}
+
+func sideName(i int) string {
+	if i == sidePrimary {
+		return "primary"
+	}
+	return "secondary"
+}
+
+func (r *Replicated) touch(id string) {
+	r.mu.Lock()
+	r.touched[id] = time.Now()
+	r.mu.Unlock()
+}
+
+func (r *Replicated) Inc(ctx context.Context, id string) (uint64, error) {
+	return r.IncBy(ctx, id, 1)
+}
+
+// IncBy adds n on both sides and returns the primary's value (the
+// secondary's when the primary fails).
+func (r *Replicated) IncBy(ctx context.Context, id string, n uint64) (uint64, error) {
+	r.touch(id)
+	v, err := r.Primary.(Adder).IncBy(ctx, id, n)
+	sv, serr := r.Secondary.(Adder).IncBy(ctx, id, n)
+	switch {
+	case err != nil && serr != nil:
+		return 0, fmt.Errorf("replicated increment failed on both stores: %w", errors.Join(err, serr))
+	case err != nil:
+		r.miss(sidePrimary, id, delta{n: n}, err)
+		return sv, nil
+	case serr != nil:
+		r.miss(sideSecondary, id, delta{n: n}, serr)
+	}
+	return v, nil
+}
+
+// IncFloat adds by on both sides (a side without float counters is skipped).
+func (r *Replicated) IncFloat(ctx context.Context, id string, by float64) (float64, error) {
+	r.touch(id)
+	pf, pok := r.Primary.(FloatIncrementer)
+	sf, sok := r.Secondary.(FloatIncrementer)
+	if !pok {
+		return 0, &UnsupportedError{Feature: "float counters", Missing: []string{"float increments"}}
+	}
+	v, err := pf.IncFloat(ctx, id, by)
+	if !sok {
+		return v, err
+	}
+	sv, serr := sf.IncFloat(ctx, id, by)
+	switch {
+	case err != nil && serr != nil:
+		return 0, fmt.Errorf("replicated float increment failed on both stores: %w", errors.Join(err, serr))
+	case err != nil:
+		r.miss(sidePrimary, id, delta{f: by}, err)
+		return sv, nil
+	case serr != nil:
+		r.miss(sideSecondary, id, delta{f: by}, serr)
+	}
+	return v, nil
+}
+
+// Get reads the primary, falling back to the secondary.
+func (r *Replicated) Get(ctx context.Context, id string) (core.Value, error) {
+	v, err := r.Primary.Get(ctx, id)
+	if err == nil {
+		return v, nil
+	}
+	sv, serr := r.Secondary.Get(ctx, id)
+	if serr != nil {
+		return core.Value{}, fmt.Errorf("replicated get failed on both stores: %w", errors.Join(err, serr))
+	}
+	log.Printf("(warn) replication: primary read of %q failed, using the secondary: %v", id, err)
+	return sv, nil
+}
+
+// Expire sets the TTL on both sides that support one.
+func (r *Replicated) Expire(ctx context.Context, id string, ttl time.Duration) error {
+	var errs []error
+	for _, st := range []Store{r.Primary, r.Secondary} {
+		if e, ok := st.(Expirer); ok {
+			errs = append(errs, e.Expire(ctx, id, ttl))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Apply runs the transaction on the primary and copies the resulting values
+// to the secondary; counters the secondary could not take are healed by the
+// next Reconcile.
+func (r *Replicated) Apply(ctx context.Context, ops []Op) ([]uint64, error) {
+	tx, ok := r.Primary.(Transactor)
+	if !ok {
+		return nil, &UnsupportedError{Feature: FeatureTx, Missing: []string{"transactions"}}
+	}
+	results, err := tx.Apply(ctx, ops)
+	if err != nil {
+		return nil, err
+	}
+	final := make(map[string]uint64)
+	for i, op := range ops {
+		final[op.ID] = results[i]
+	}
+	for id, n := range final {
+		if err := setValue(ctx, r.Secondary, id, core.Uint(n)); err != nil {
+			log.Printf("(warn) replication: secondary update of %q failed, Reconcile will heal it: %v", id, err)
+			r.mu.Lock()
+			r.resync[id] = true
+			r.mu.Unlock()
+		}
+	}
+	return results, nil
+}
+
+// Each lists the primary, falling back to the secondary.
+func (r *Replicated) Each(ctx context.Context, fn func(id string, v core.Value) error) error {
+	if l, ok := r.Primary.(Lister); ok {
+		err := l.Each(ctx, fn)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("(warn) replication: primary listing failed, using the secondary: %v", err)
+	}
+	if l, ok := r.Secondary.(Lister); ok {
+		return l.Each(ctx, fn)
+	}
+	return &UnsupportedError{Feature: FeatureAggregate, Missing: []string{"listing"}}
+}
+
+// Reconcile replays the writes each side missed, then compares the two
+// stores counter by counter. Counters only grow outside of transactions, so
+// the larger value wins: a primary that lost data (or a secondary restored
+// from an old copy) is raised to the other side's count. Counters whose
+// transaction result did not reach the secondary take the primary's value.
+// It returns how many counters it changed.
+func (r *Replicated) Reconcile(ctx context.Context) (int, error) {
+	healed := 0
+	for _, i := range []int{sidePrimary, sideSecondary} {
+		r.mu.Lock()
+		batch := r.behind[i]
+		r.behind[i] = make(map[string]delta)
+		r.mu.Unlock()
+		for id, d := range batch {
+			if err := addDelta(ctx, r.side(i), id, d); err != nil {
+				r.pend(i, id, d) // still down; retried next time
+				continue
+			}
+			healed++
+		}
+	}
+	pl, pok := r.Primary.(Lister)
+	sl, sok := r.Secondary.(Lister)
+	if !pok || !sok {
+		return healed, nil
+	}
+	seen := make(map[string]bool)
+	err := pl.Each(ctx, func(id string, v core.Value) error {
+		seen[id] = true
+		if core.IsTestID(id) || r.unsettled(id) {
+			return nil
+		}
+		sv, err := r.Secondary.Get(ctx, id)
+		if err != nil {
+			return fmt.Errorf("read secondary %q: %w", id, err)
+		}
+		if r.heal(ctx, id, v, sv) {
+			healed++
+		}
+		return nil
+	})
+	if err != nil {
+		return healed, fmt.Errorf("list primary: %w", err)
+	}
+	err = sl.Each(ctx, func(id string, sv core.Value) error {
+		if seen[id] || core.IsTestID(id) || r.unsettled(id) || sv.IsZero() {
+			return nil
+		}
+		if r.heal(ctx, id, core.Uint(0), sv) { // missing from the primary
+			healed++
+		}
+		return nil
+	})
+	if err != nil {
+		return healed, fmt.Errorf("list secondary: %w", err)
+	}
+	return healed, nil
+}
+
+// heal brings id's two values v (primary) and sv (secondary) together and
+// reports whether it changed anything.
+func (r *Replicated) heal(ctx context.Context, id string, v, sv core.Value) bool {
+	if v == sv {
+		return false
+	}
+	r.mu.Lock()
+	resync := r.resync[id]
+	delete(r.resync, id)
+	r.mu.Unlock()
+	i, want := sideSecondary, v
+	if !resync && sv.Float64() > v.Float64() {
+		i, want = sidePrimary, sv
+	}
+	if err := setValue(ctx, r.side(i), id, want); err != nil {
+		log.Printf("(warn) replication: cannot heal %q on the %s (primary %s, secondary %s): %v", id, sideName(i), v, sv, err)
+		return false
+	}
+	return true
+}
+
+// unsettled reports whether id was written within Settle or still has
+// writes to replay, pruning old entries.
+func (r *Replicated) unsettled(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, p := r.behind[sidePrimary][id]
+	_, s := r.behind[sideSecondary][id]
+	if p || s {
+		return true
+	}
+	at, ok := r.touched[id]
+	if ok && time.Since(at) >= r.Settle {
+		delete(r.touched, id)
+		return false
+	}
+	return ok
+}
+
+// Reconciler runs Reconcile every interval (runs for the process lifetime).
+func (r *Replicated) Reconciler(every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for range t.C {
+		n, err := r.Reconcile(context.Background())
+		if err != nil {
+			log.Printf("(warn) replication: reconcile: %v", err)
+		}
+		if n > 0 {
+			log.Printf("replication: healed %d counters", n)
+		}
+	}
+}
+
+// addDelta applies a missed write to st.
+func addDelta(ctx context.Context, st Store, id string, d delta) error {
+	if d.n > 0 {
+		if _, err := st.(Adder).IncBy(ctx, id, d.n); err != nil {
+			return err
+		}
+	}
+	if d.f != 0 {
+		fi, ok := st.(FloatIncrementer)
+		if !ok {
+			return nil
+		}
+		if _, err := fi.IncFloat(ctx, id, d.f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setValue overwrites id in st with v: directly for stores with Set, as a
+// transaction for integer counters, or else by adding the difference when
+// st is behind.
+func setValue(ctx context.Context, st Store, id string, v core.Value) error {
+	if s, ok := st.(interface {
+		Set(ctx context.Context, id string, v core.Value) error
+	}); ok {
+		return s.Set(ctx, id, v)
+	}
+	if tx, ok := st.(Transactor); ok && !v.IsFloat() {
+		_, err := tx.Apply(ctx, []Op{{Kind: OpSet, ID: id, N: v.Uint64()}})
+		if !errors.Is(err, ErrNotInteger) {
+			return err
+		}
+	}
+	cur, err := st.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if v.IsFloat() || cur.IsFloat() {
+		diff := v.Float64() - cur.Float64()
+		fi, ok := st.(FloatIncrementer)
+		if !ok || diff <= 0 {
+			return fmt.Errorf("cannot lower a float counter")
+		}
+		_, err = fi.IncFloat(ctx, id, diff)
+		return err
+	}
+	if v.Uint64() < cur.Uint64() {
+		return fmt.Errorf("cannot lower a counter without transactions")
+	}
+	_, err = st.(Adder).IncBy(ctx, id, v.Uint64()-cur.Uint64())
+	return err
+}
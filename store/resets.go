@@ -0,0 +1,76 @@
+//go:build !minimal
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/advayc/nums/core"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// ResetHistoryMax is how many scheduled resets are archived per counter;
+// older records are dropped.
+const ResetHistoryMax = 100
+
+// The archive of a counter's scheduled resets is the list
+// "resets:<prefix><id>", newest first, each a JSON core.ResetRecord.
+func (r *RedisCounter) resetsKey(id string) string { return "resets:" + r.prefix + id }
+
+// ArchiveReset adds rec to the front of its counter's archive.
+func (r *RedisCounter) ArchiveReset(ctx context.Context, rec core.ResetRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.LPush(ctx, r.resetsKey(rec.ID), b)
+		p.LTrim(ctx, r.resetsKey(rec.ID), 0, ResetHistoryMax-1)
+		return nil
+	})
+	return err
+}
+
+// ResetRecords returns id's archived resets, newest first.
+func (r *RedisCounter) ResetRecords(ctx context.Context, id string) ([]core.ResetRecord, error) {
+	raw, err := r.client.LRange(ctx, r.resetsKey(id), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]core.ResetRecord, 0, len(raw))
+	for _, s := range raw {
+		var rec core.ResetRecord
+		if err := json.Unmarshal([]byte(s), &rec); err == nil {
+			out = append(out, rec)
+		}
+	}
+	return out, nil
+}
+
+// claimResetScript moves a counter's last reset period (a field of
+// "resetperiods:<prefix>", in Unix seconds) to ARGV[2] when it is older, and
+// returns 1 if so. A counter without one only has ARGV[2] recorded, so a
+// new schedule first resets at the next period.
+var claimResetScript = redis.NewScript(`
+local last = redis.call('HGET', KEYS[1], ARGV[1])
+local start = tonumber(ARGV[2])
+if last and tonumber(last) >= start then
+  return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+if last then
+  return 1
+end
+return 0
+`)
+
+// ClaimReset reports whether the instance that calls it should reset id for
+// the period that began at start. Exactly one caller per period gets true,
+// however many instances share the Redis.
+func (r *RedisCounter) ClaimReset(ctx context.Context, id string, start time.Time) (bool, error) {
+	n, err := claimResetScript.Run(ctx, r.client, []string{"resetperiods:" + r.prefix}, id, strconv.FormatInt(start.Unix(), 10)).Int()
+	return n == 1, err
+}
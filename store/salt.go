@@ -0,0 +1,39 @@
+//go:build !minimal
+
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// DailySaltTTL is how long a daily salt is kept: through its day, whatever
+// the time zone skew between instances, and then forgotten for good.
+const DailySaltTTL = 48 * time.Hour
+
+// DailySalt returns the salt of day (YYYYMMDD), the key "salt:<prefix><day>".
+// The first instance to ask sets a random one, which every other instance
+// then reads, and it expires after DailySaltTTL so old visitor hashes cannot
+// be recomputed.
+func (r *RedisCounter) DailySalt(ctx context.Context, day string) (string, error) {
+	key := "salt:" + r.prefix + day
+	fresh, err := NewSalt()
+	if err != nil {
+		return "", err
+	}
+	if err := r.client.SetNX(ctx, key, fresh, DailySaltTTL).Err(); err != nil {
+		return "", err
+	}
+	return r.client.Get(ctx, key).Result()
+}
+
+// NewSalt returns a random salt.
+func NewSalt() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
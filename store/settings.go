@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Settings keeps what admin routes change at runtime (per-counter numbers,
+// frozen counters, webhook subscriptions) as named tables of string values,
+// so the changes survive restarts. Tables are small and loaded whole.
+type Settings interface {
+	LoadSettings(ctx context.Context, table string) (map[string]string, error)
+	PutSetting(ctx context.Context, table, key, value string) error
+	DeleteSetting(ctx context.Context, table, key string) error
+}
+
+// FileSettings is Settings in a local JSON file ({"table": {"key": "value"}}),
+// for backends without a place of their own for them. It belongs to one
+// process: every change rewrites the file.
+type FileSettings struct {
+	path string
+
+	mu     sync.Mutex
+	tables map[string]map[string]string
+}
+
+// OpenFileSettings reads the settings file at path, which need not exist yet.
+func OpenFileSettings(path string) (*FileSettings, error) {
+	f := &FileSettings{path: path, tables: make(map[string]map[string]string)}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &f.tables); err != nil {
+		return nil, fmt.Errorf("settings file %s: %w", path, err)
+	}
+	return f, nil
+}
+
+func (f *FileSettings) LoadSettings(_ context.Context, table string) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make(map[string]string, len(f.tables[table]))
+	for k, v := range f.tables[table] {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (f *FileSettings) PutSetting(_ context.Context, table, key, value string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.tables[table] == nil {
+		f.tables[table] = make(map[string]string)
+	}
+	f.tables[table][key] = value
+	return f.save()
+}
+
+func (f *FileSettings) DeleteSetting(_ context.Context, table, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.tables[table][key]; !ok {
+		return nil
+	}
+	delete(f.tables[table], key)
+	return f.save()
+}
+
+// save writes the file then renames it into place, so a crash never leaves
+// it truncated. f.mu is held.
+func (f *FileSettings) save() error {
+	b, err := json.MarshalIndent(f.tables, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
@@ -0,0 +1,350 @@
+// Package sqlite is a SQLite counter backend for self-hosters who want
+// durable per-id counts without running Redis. It uses the pure-Go
+// modernc.org/sqlite driver, so no cgo is needed.
+//
+// Counters live in one table. Increments are single UPSERT statements, so
+// concurrent hits are never lost; semantics follow the Redis backend: integer
+// and float counters, TTLs (playground ids expire after core.TestCounterTTL),
+// listing, batches and transactions.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/advayc/nums/core"
+	"github.com/advayc/nums/store"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS counters (
+	id         TEXT PRIMARY KEY,
+	n          INTEGER NOT NULL DEFAULT 0,
+	f          REAL,    -- non-NULL for float counters
+	expires_at INTEGER  -- unix milliseconds, NULL for no TTL
+) WITHOUT ROWID;
+CREATE INDEX IF NOT EXISTS counters_expires_at ON counters (expires_at) WHERE expires_at IS NOT NULL;
+CREATE TABLE IF NOT EXISTS settings (
+	tbl   TEXT NOT NULL,
+	key   TEXT NOT NULL,
+	value TEXT NOT NULL,
+	PRIMARY KEY (tbl, key)
+) WITHOUT ROWID;
+`
+
+// Store is a SQLite-backed store.Store.
+type Store struct {
+	db *sql.DB
+}
+
+// defaultParams are added to the DSN unless it sets them: wait for locks
+// instead of failing with SQLITE_BUSY, WAL so reads don't block writes, and
+// IMMEDIATE transactions so read-then-write transactions can't deadlock.
+var defaultParams = []struct{ key, value string }{
+	{"_pragma=busy_timeout", "_pragma=busy_timeout(5000)"},
+	{"_pragma=journal_mode", "_pragma=journal_mode(WAL)"},
+	{"_txlock=", "_txlock=immediate"},
+}
+
+// Open opens (and if needed creates) the database at dsn, e.g.
+// "/var/lib/nums/counts.db" or "file:counts.db?_pragma=synchronous(NORMAL)".
+func Open(dsn string) (*Store, error) {
+	for _, p := range defaultParams {
+		if strings.Contains(dsn, p.key) {
+			continue
+		}
+		if strings.Contains(dsn, "?") {
+			dsn += "&" + p.value
+		} else {
+			dsn += "?" + p.value
+		}
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("sqlite schema: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// NewFromEnv opens SQLITE_DSN, or returns store.ErrNotConfigured.
+func NewFromEnv() (*Store, error) {
+	dsn := os.Getenv("SQLITE_DSN")
+	if dsn == "" {
+		return nil, fmt.Errorf("%w: SQLITE_DSN is required", store.ErrNotConfigured)
+	}
+	return Open(dsn)
+}
+
+func (s *Store) Close() error { return s.db.Close() }
+
+func (s *Store) Capabilities() store.Capabilities {
+	return store.Capabilities{AtomicIncrement: true, ReadYourWrites: true, TTL: true, Listing: true, Batch: true, Transactions: true}
+}
+
+// key maps the empty id to "default", like the Redis backend.
+func key(id string) string {
+	if id == "" {
+		return "default"
+	}
+	return id
+}
+
+// newExpiry is the expires_at of a newly created counter: playground ids
+// start their TTL on the first write.
+func newExpiry(id string, now time.Time) any {
+	if core.IsTestID(id) {
+		return now.Add(core.TestCounterTTL).UnixMilli()
+	}
+	return nil
+}
+
+// querier is satisfied by *sql.DB and *sql.Tx.
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// An expired row is treated as absent: the upserts below restart it (value,
+// float flag and TTL) instead of adding to it. Integer increments leave float
+// counters alone (no row is returned), as INCRBY fails on a float in Redis.
+const incBySQL = `
+INSERT INTO counters (id, n, expires_at) VALUES (?1, ?2, ?3)
+ON CONFLICT (id) DO UPDATE SET
+	n = CASE WHEN expires_at <= ?4 THEN excluded.n ELSE n + excluded.n END,
+	f = NULL,
+	expires_at = CASE WHEN expires_at <= ?4 THEN excluded.expires_at ELSE expires_at END
+WHERE f IS NULL OR expires_at <= ?4
+RETURNING n`
+
+const incFloatSQL = `
+INSERT INTO counters (id, n, f, expires_at) VALUES (?1, 0, ?2, ?3)
+ON CONFLICT (id) DO UPDATE SET
+	f = CASE WHEN expires_at <= ?4 THEN excluded.f ELSE coalesce(f, n) + excluded.f END,
+	n = 0,
+	expires_at = CASE WHEN expires_at <= ?4 THEN excluded.expires_at ELSE expires_at END
+RETURNING f`
+
+func incBy(ctx context.Context, q querier, id string, n uint64) (uint64, error) {
+	now := core.Now()
+	var v int64
+	err := q.QueryRowContext(ctx, incBySQL, key(id), int64(n), newExpiry(id, now), now.UnixMilli()).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("increment %q: %w", id, store.ErrNotInteger)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return uint64(v), nil
+}
+
+func (s *Store) Inc(ctx context.Context, id string) (uint64, error) {
+	return s.IncBy(ctx, id, 1)
+}
+
+// IncBy adds n to id in one UPSERT.
+func (s *Store) IncBy(ctx context.Context, id string, n uint64) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return incBy(ctx, s.db, id, n)
+}
+
+// IncFloat adds by to id, turning an integer counter into a float one (like
+// INCRBYFLOAT).
+func (s *Store) IncFloat(ctx context.Context, id string, by float64) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	now := core.Now()
+	var v float64
+	err := s.db.QueryRowContext(ctx, incFloatSQL, key(id), by, newExpiry(id, now), now.UnixMilli()).Scan(&v)
+	return v, err
+}
+
+// Get returns id's value (zero if it does not exist or has expired).
+func (s *Store) Get(ctx context.Context, id string) (core.Value, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return get(ctx, s.db, id)
+}
+
+func get(ctx context.Context, q querier, id string) (core.Value, error) {
+	var n int64
+	var f sql.NullFloat64
+	err := q.QueryRowContext(ctx,
+		`SELECT n, f FROM counters WHERE id = ? AND (expires_at IS NULL OR expires_at > ?)`,
+		key(id), core.Now().UnixMilli()).Scan(&n, &f)
+	if errors.Is(err, sql.ErrNoRows) {
+		return core.Uint(0), nil
+	}
+	if err != nil {
+		return core.Value{}, err
+	}
+	if f.Valid {
+		return core.Float(f.Float64), nil
+	}
+	return core.Uint(uint64(n)), nil
+}
+
+// Expire deletes id after ttl (no-op if id does not exist, like EXPIRE).
+func (s *Store) Expire(ctx context.Context, id string, ttl time.Duration) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE counters SET expires_at = ? WHERE id = ?`,
+		core.Now().Add(ttl).UnixMilli(), key(id))
+	return err
+}
+
+// DeleteIfZero deletes id if it holds the integer 0.
+func (s *Store) DeleteIfZero(ctx context.Context, id string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM counters WHERE id = ? AND n = 0 AND f IS NULL`, key(id))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// IncMany increments ids in one transaction.
+func (s *Store) IncMany(ctx context.Context, ids []string) ([]uint64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	out := make([]uint64, len(ids))
+	for i, id := range ids {
+		if out[i], err = incBy(ctx, tx, id, 1); err != nil {
+			return nil, err
+		}
+	}
+	return out, tx.Commit()
+}
+
+// Each lists live counters in id order, skipping day buckets.
+func (s *Store) Each(ctx context.Context, fn func(id string, v core.Value) error) error {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, n, f FROM counters WHERE expires_at IS NULL OR expires_at > ? ORDER BY id`,
+		core.Now().UnixMilli())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var n int64
+		var f sql.NullFloat64
+		if err := rows.Scan(&id, &n, &f); err != nil {
+			return err
+		}
+		if core.IsDayBucketID(id) {
+			continue
+		}
+		v := core.Uint(uint64(n))
+		if f.Valid {
+			v = core.Float(f.Float64)
+		}
+		if err := fn(id, v); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Apply runs ops in one IMMEDIATE transaction; nothing is written unless
+// every op succeeds.
+func (s *Store) Apply(ctx context.Context, ops []store.Op) ([]uint64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	results, final, err := store.ApplyOps(ops, func(id string) (uint64, error) {
+		v, err := get(ctx, tx, id)
+		if err != nil {
+			return 0, err
+		}
+		if v.IsFloat() {
+			return 0, store.ErrNotInteger
+		}
+		return v.Uint64(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := core.Now()
+	for id, v := range final {
+		// the value is replaced, the TTL kept (SET KEEPTTL in the Redis backend)
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO counters (id, n, expires_at) VALUES (?1, ?2, ?3)
+ON CONFLICT (id) DO UPDATE SET
+	n = excluded.n,
+	f = NULL,
+	expires_at = CASE WHEN expires_at <= ?4 THEN excluded.expires_at ELSE expires_at END`,
+			key(id), int64(v), newExpiry(id, now), now.UnixMilli())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, tx.Commit()
+}
+
+// SweepExpired deletes expired counters and returns how many were removed.
+func (s *Store) SweepExpired(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM counters WHERE expires_at <= ?`, core.Now().UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Janitor sweeps expired counters every interval for the process lifetime.
+func (s *Store) Janitor(every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for range t.C {
+		if _, err := s.SweepExpired(context.Background()); err != nil {
+			log.Printf("(warn) sqlite expiry sweep: %v", err)
+		}
+	}
+}
+
+// Settings (see store.Settings) are rows of the settings table.
+
+func (s *Store) LoadSettings(ctx context.Context, table string) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT key, value FROM settings WHERE tbl = ?`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]string)
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		out[k] = v
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) PutSetting(ctx context.Context, table, key, value string) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO settings (tbl, key, value) VALUES (?, ?, ?)
+ON CONFLICT (tbl, key) DO UPDATE SET value = excluded.value`, table, key, value)
+	return err
+}
+
+func (s *Store) DeleteSetting(ctx context.Context, table, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM settings WHERE tbl = ? AND key = ?`, table, key)
+	return err
+}
@@ -0,0 +1,72 @@
+// Package store defines the counter storage interface and its backends:
+// in-memory (MultiCounter), Redis (RedisCounter), hosted stores that do not
+// speak the Redis protocol (Vercel KV over REST, Vercel Edge Config) and the
+// Tiered composition of a local cache over a durable remote store.
+//
+// Building with -tags minimal leaves out the backends that need a client
+// library (Redis, the S3 archive), so the package then depends on the
+// standard library only. Backends with their own driver (SQLite, Bolt,
+// PostgreSQL, etcd, DynamoDB, Firestore) are subpackages.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// Store is a counter backend. Ids are raw counter ids; backends add their own
+// key prefix.
+type Store interface {
+	// Inc adds one hit to id and returns the new value.
+	Inc(ctx context.Context, id string) (uint64, error)
+	// Get returns the current value of id (zero if it does not exist).
+	Get(ctx context.Context, id string) (core.Value, error)
+	// Capabilities reports what the backend guarantees.
+	Capabilities() Capabilities
+}
+
+// FloatIncrementer is implemented by stores that keep float aggregate
+// counters (?type=float).
+type FloatIncrementer interface {
+	IncFloat(ctx context.Context, id string, by float64) (float64, error)
+}
+
+// Adder is implemented by stores that can add an arbitrary amount in one
+// operation (needed as the remote tier of a write-behind Tiered store).
+type Adder interface {
+	IncBy(ctx context.Context, id string, n uint64) (uint64, error)
+}
+
+// Expirer is implemented by stores with TTL support (Capabilities.TTL).
+type Expirer interface {
+	// Expire deletes id after ttl.
+	Expire(ctx context.Context, id string, ttl time.Duration) error
+}
+
+// ZeroDeleter is implemented by stores that can delete a counter for good,
+// as the purge of a soft-deleted counter does.
+type ZeroDeleter interface {
+	// DeleteIfZero deletes id if it holds the integer 0, i.e. had no hits
+	// since it was zeroed, and reports whether it did.
+	DeleteIfZero(ctx context.Context, id string) (bool, error)
+}
+
+// Lister is implemented by stores that can enumerate counters
+// (Capabilities.Listing).
+type Lister interface {
+	// Each calls fn for every stored counter until fn returns an error.
+	Each(ctx context.Context, fn func(id string, v core.Value) error) error
+}
+
+// BatchIncrementer is implemented by stores that can increment several
+// counters in one round trip (Capabilities.Batch).
+type BatchIncrementer interface {
+	IncMany(ctx context.Context, ids []string) ([]uint64, error)
+}
+
+// ErrNotConfigured is returned by the FromEnv constructors when the backend's
+// environment variables are missing.
+var ErrNotConfigured = errors.New("store: not configured")
@@ -0,0 +1,311 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// TierMode selects how Tiered propagates writes to the remote tier.
+type TierMode int
+
+const (
+	// WriteThrough increments the remote store first and caches the result
+	// locally. If the remote is down the hit is counted locally instead; one
+	// it refuses (such as a plain hit on a gauge) is not counted.
+	WriteThrough TierMode = iota
+	// WriteBehind increments locally and flushes accumulated deltas to the
+	// remote store every FlushInterval. Hits not yet flushed are lost if the
+	// process dies; the remote must implement Adder.
+	WriteBehind
+)
+
+// ParseTierMode accepts "write-through" (or "") and "write-behind".
+func ParseTierMode(s string) (TierMode, error) {
+	switch s {
+	case "", "write-through":
+		return WriteThrough, nil
+	case "write-behind":
+		return WriteBehind, nil
+	}
+	return 0, fmt.Errorf("unknown tier mode %q (want write-through or write-behind)", s)
+}
+
+// Tiered composes a fast local MultiCounter with a durable remote Store.
+//
+// Reads are served from the local tier while the cached value is younger than
+// CacheTTL (0 always reads the remote). When the remote errors, Tiered falls
+// back to the local tier and returns the local value together with the error,
+// so callers can report the failure and still answer.
+type Tiered struct {
+	Local  *MultiCounter
+	Remote Store
+
+	Mode          TierMode
+	CacheTTL      time.Duration
+	FlushInterval time.Duration // WriteBehind only (default 1s)
+
+	mu      sync.Mutex
+	fetched map[string]time.Time // id -> when the local copy was last synced with the remote
+	writes  map[string]uint64    // id -> writes cached so far, so a slower read cannot undo one
+	batch   *BatchWriter         // WriteBehind: deltas not yet flushed
+}
+
+// NewTiered builds a tiered store and, for WriteBehind, starts the flusher
+// (stop it with Close).
+func NewTiered(local *MultiCounter, remote Store, mode TierMode, cacheTTL, flushInterval time.Duration) (*Tiered, error) {
+	if _, ok := remote.(Adder); mode == WriteBehind && !ok {
+		return nil, fmt.Errorf("write-behind needs a remote store that can add deltas (IncBy)")
+	}
+	if flushInterval <= 0 {
+		flushInterval = time.Second
+	}
+	t := &Tiered{
+		Local:         local,
+		Remote:        remote,
+		Mode:          mode,
+		CacheTTL:      cacheTTL,
+		FlushInterval: flushInterval,
+		fetched:       make(map[string]time.Time),
+		writes:        make(map[string]uint64),
+	}
+	if mode == WriteBehind {
+		b, err := NewBatchWriter(remote, flushInterval, func(err error) { log.Printf("(warn) tiered: %v, will retry", err) })
+		if err != nil {
+			return nil, err
+		}
+		t.batch = b
+	}
+	return t, nil
+}
+
+// Capabilities are the remote's, except that write-behind reads are only
+// eventually consistent across instances.
+func (t *Tiered) Capabilities() Capabilities {
+	c := t.Remote.Capabilities()
+	if t.Mode == WriteBehind {
+		c.ReadYourWrites = false
+	}
+	return c
+}
+
+func (t *Tiered) Inc(ctx context.Context, id string) (uint64, error) {
+	if t.Mode == WriteBehind {
+		if err := t.warm(ctx, id); err != nil {
+			log.Printf("(warn) tiered: could not load %q from remote before counting: %v", id, err)
+		}
+		v, _ := t.Local.Inc(ctx, id)
+		t.batch.Add(id, 1)
+		return v, nil
+	}
+	v, err := t.Remote.Inc(ctx, id)
+	if err != nil && !isOutage(err) { // refused, e.g. a gauge: nothing to count
+		return 0, err
+	}
+	if err != nil {
+		local, _ := t.Local.Inc(ctx, id)
+		return local, fmt.Errorf("remote increment failed, counted locally: %w", err)
+	}
+	t.raise(ctx, id, v)
+	return v, nil
+}
+
+// IncBy adds n like Inc; writing it through needs a remote Adder.
+func (t *Tiered) IncBy(ctx context.Context, id string, n uint64) (uint64, error) {
+	if t.Mode == WriteBehind {
+		if err := t.warm(ctx, id); err != nil {
+			log.Printf("(warn) tiered: could not load %q from remote before counting: %v", id, err)
+		}
+		v, _ := t.Local.IncBy(ctx, id, n)
+		t.batch.Add(id, n)
+		return v, nil
+	}
+	a, ok := t.Remote.(Adder)
+	if !ok {
+		return 0, ErrUnsupported
+	}
+	v, err := a.IncBy(ctx, id, n)
+	if err != nil && !isOutage(err) { // refused, e.g. a gauge: nothing to count
+		return 0, err
+	}
+	if err != nil {
+		local, _ := t.Local.IncBy(ctx, id, n)
+		return local, fmt.Errorf("remote increment failed, counted locally: %w", err)
+	}
+	t.raise(ctx, id, v)
+	return v, nil
+}
+
+// IncFloat writes through to the remote when it keeps float counters.
+func (t *Tiered) IncFloat(ctx context.Context, id string, by float64) (float64, error) {
+	fi, ok := t.Remote.(FloatIncrementer)
+	if !ok {
+		return t.Local.IncFloat(ctx, id, by)
+	}
+	f, err := fi.IncFloat(ctx, id, by)
+	if err != nil && !isOutage(err) {
+		return 0, err
+	}
+	if err != nil {
+		local, _ := t.Local.IncFloat(ctx, id, by)
+		return local, fmt.Errorf("remote float increment failed, counted locally: %w", err)
+	}
+	t.wrote(ctx, id, core.Float(f))
+	return f, nil
+}
+
+func (t *Tiered) Get(ctx context.Context, id string) (core.Value, error) {
+	if t.fresh(id) {
+		return t.Local.Get(ctx, id)
+	}
+	seq := t.seq(id)
+	v, err := t.Remote.Get(ctx, id)
+	if err != nil {
+		local, _ := t.Local.Get(ctx, id)
+		return local, fmt.Errorf("remote get failed, using local value: %w", err)
+	}
+	if t.batch != nil && !v.IsFloat() { // unflushed local hits
+		if pend := t.batch.Pending(id); pend > 0 {
+			v = core.Uint(v.Uint64() + pend)
+		}
+	}
+	t.fill(ctx, id, v, seq)
+	return v, nil
+}
+
+// Apply runs the transaction on the remote (after flushing write-behind
+// deltas so they are not applied on top of a set) and refreshes the cache.
+func (t *Tiered) Apply(ctx context.Context, ops []Op) ([]uint64, error) {
+	tx, ok := t.Remote.(Transactor)
+	if !ok {
+		return nil, &UnsupportedError{Feature: FeatureTx, Missing: []string{"transactions"}}
+	}
+	if t.Mode == WriteBehind {
+		t.Flush(ctx)
+	}
+	results, err := tx.Apply(ctx, ops)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range ops {
+		t.wrote(ctx, op.ID, core.Uint(results[i]))
+	}
+	return results, nil
+}
+
+// Expire sets id's TTL on the remote (after flushing write-behind deltas, so
+// the remote counter exists) and on the local copy.
+func (t *Tiered) Expire(ctx context.Context, id string, ttl time.Duration) error {
+	e, ok := t.Remote.(Expirer)
+	if !ok {
+		return ErrUnsupported
+	}
+	if t.Mode == WriteBehind {
+		t.Flush(ctx)
+	}
+	if err := e.Expire(ctx, id, ttl); err != nil {
+		return err
+	}
+	return t.Local.Expire(ctx, id, ttl)
+}
+
+// Each lists the remote when it can, else the local tier.
+func (t *Tiered) Each(ctx context.Context, fn func(id string, v core.Value) error) error {
+	if l, ok := t.Remote.(Lister); ok {
+		return l.Each(ctx, fn)
+	}
+	return t.Local.Each(ctx, fn)
+}
+
+func (t *Tiered) fresh(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	at, ok := t.fetched[id]
+	return ok && t.CacheTTL > 0 && time.Since(at) < t.CacheTTL
+}
+
+// wrote caches v, the value a write left on the remote.
+func (t *Tiered) wrote(ctx context.Context, id string, v core.Value) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_ = t.Local.Set(ctx, id, v)
+	t.fetched[id] = time.Now()
+	t.writes[id]++
+}
+
+// raise caches v, an increment's result, unless a larger value is cached:
+// concurrent increments can return out of order. A larger value is left to
+// age as it was, so one the remote no longer has (after a reset elsewhere)
+// is read again after CacheTTL.
+func (t *Tiered) raise(ctx context.Context, id string, v uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if cur, _ := t.Local.Get(ctx, id); cur.IsFloat() || cur.Uint64() < v {
+		_ = t.Local.Set(ctx, id, core.Uint(v))
+		t.fetched[id] = time.Now()
+	}
+	t.writes[id]++
+}
+
+// seq is taken before reading id from the remote, for fill.
+func (t *Tiered) seq(id string) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.writes[id]
+}
+
+// fill caches v, read from the remote, unless a write was cached since the
+// read began (seq), which would be newer than v.
+func (t *Tiered) fill(ctx context.Context, id string, v core.Value, seq uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.writes[id] != seq {
+		return
+	}
+	_ = t.Local.Set(ctx, id, v)
+	t.fetched[id] = time.Now()
+}
+
+// warm loads id from the remote into the local tier the first time it is
+// seen, so write-behind increments continue from the durable value.
+func (t *Tiered) warm(ctx context.Context, id string) error {
+	t.mu.Lock()
+	_, seen := t.fetched[id]
+	t.mu.Unlock()
+	if seen {
+		return nil
+	}
+	v, err := t.Remote.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, seen := t.fetched[id]; !seen { // lost a race with another warm: keep its value
+		_ = t.Local.Set(ctx, id, v)
+		t.fetched[id] = time.Now()
+	}
+	return nil
+}
+
+// Flush sends pending write-behind deltas to the remote. Failed deltas are
+// kept for the next flush.
+func (t *Tiered) Flush(ctx context.Context) {
+	if t.batch == nil {
+		return
+	}
+	if err := t.batch.Flush(ctx); err != nil {
+		log.Printf("(warn) tiered: %v, will retry", err)
+	}
+}
+
+// Close stops the write-behind flusher after a final flush.
+func (t *Tiered) Close() {
+	if t.batch != nil {
+		t.batch.Close()
+	}
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// flakyStore is a memory remote whose increments and reads fail with err
+// while it is set.
+type flakyStore struct {
+	*MultiCounter
+	err error
+}
+
+func (f *flakyStore) Inc(ctx context.Context, id string) (uint64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.MultiCounter.Inc(ctx, id)
+}
+
+func (f *flakyStore) IncBy(ctx context.Context, id string, n uint64) (uint64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.MultiCounter.IncBy(ctx, id, n)
+}
+
+func wantCount(t *testing.T, s Store, name, id string, want uint64) {
+	t.Helper()
+	v, err := s.Get(context.Background(), id)
+	if err != nil {
+		t.Fatalf("%s get %s: %v", name, id, err)
+	}
+	if v.Uint64() != want {
+		t.Errorf("%s %s = %d, want %d", name, id, v.Uint64(), want)
+	}
+}
+
+func TestTieredWriteThrough(t *testing.T) {
+	ctx := context.Background()
+	local, remote := NewMultiCounter(), &flakyStore{MultiCounter: NewMultiCounter()}
+	tiers, err := NewTiered(local, remote, WriteThrough, time.Minute, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the remote is written before the hit returns, and its result cached
+	if v, err := tiers.Inc(ctx, "a"); err != nil || v != 1 {
+		t.Fatalf("Inc = %d, %v; want 1", v, err)
+	}
+	wantCount(t, remote, "remote", "a", 1)
+	wantCount(t, local, "local", "a", 1)
+
+	// a hit counted elsewhere shows in the next result, which raises the cache
+	_, _ = remote.IncBy(ctx, "a", 10)
+	if v, err := tiers.IncBy(ctx, "a", 2); err != nil || v != 13 {
+		t.Fatalf("IncBy = %d, %v; want 13", v, err)
+	}
+	wantCount(t, local, "local", "a", 13)
+
+	// a remote outage counts the hit locally and reports it
+	remote.err = errors.New("connection refused")
+	if v, err := tiers.Inc(ctx, "a"); err == nil || v != 14 {
+		t.Fatalf("Inc during an outage = %d, %v; want 14 and an error", v, err)
+	}
+	wantCount(t, remote.MultiCounter, "remote", "a", 13)
+
+	// a hit the remote refuses is not counted at all
+	remote.err = ErrNotInteger
+	if _, err := tiers.Inc(ctx, "a"); !errors.Is(err, ErrNotInteger) {
+		t.Fatalf("refused Inc: %v, want ErrNotInteger", err)
+	}
+	wantCount(t, local, "local", "a", 14)
+}
+
+func TestTieredWriteBehind(t *testing.T) {
+	ctx := context.Background()
+	local, remote := NewMultiCounter(), NewMultiCounter()
+	_, _ = remote.IncBy(ctx, "a", 5)
+	tiers, err := NewTiered(local, remote, WriteBehind, 0, time.Hour) // flushed by hand
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tiers.Close()
+
+	// hits continue from the remote value but stay local until flushed
+	if v, err := tiers.Inc(ctx, "a"); err != nil || v != 6 {
+		t.Fatalf("Inc = %d, %v; want 6", v, err)
+	}
+	wantCount(t, remote, "remote", "a", 5)
+	wantCount(t, tiers, "tiered", "a", 6) // the remote plus the pending hit
+	tiers.Flush(ctx)
+	wantCount(t, remote, "remote", "a", 6)
+
+	// a transaction flushes pending hits first, so none lands on top of it
+	_, _ = tiers.IncBy(ctx, "a", 2)
+	if _, err := tiers.Apply(ctx, []Op{{Kind: OpSet, ID: "a", N: 0}}); err != nil {
+		t.Fatal(err)
+	}
+	tiers.Flush(ctx)
+	wantCount(t, remote, "remote", "a", 0)
+	wantCount(t, tiers, "tiered", "a", 0)
+}
@@ -0,0 +1,134 @@
+//go:build !minimal
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/advayc/nums/core"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// Tombstones of soft-deleted counters are the fields of the hash
+// "deleted:<prefix>", keyed by id, each a JSON core.Tombstone.
+func (r *RedisCounter) tombstonesKey() string { return "deleted:" + r.prefix }
+
+// SetTombstone saves t, replacing any earlier tombstone of t.ID.
+func (r *RedisCounter) SetTombstone(ctx context.Context, t core.Tombstone) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return r.client.HSet(ctx, r.tombstonesKey(), t.ID, b).Err()
+}
+
+// AddTombstone saves t, adding the hits of an earlier tombstone of t.ID not
+// yet restored, and returns what was saved. It retries if the tombstone
+// changes in between (WATCH), so concurrent deletes don't lose hits.
+func (r *RedisCounter) AddTombstone(ctx context.Context, t core.Tombstone) (core.Tombstone, error) {
+	key := r.tombstonesKey()
+	hits := t.Hits
+	for {
+		err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+			t.Hits = hits
+			s, err := tx.HGet(ctx, key, t.ID).Result()
+			switch {
+			case errors.Is(err, redis.Nil):
+			case err != nil:
+				return err
+			default:
+				var prev core.Tombstone
+				if err := json.Unmarshal([]byte(s), &prev); err != nil {
+					return err
+				}
+				t.Hits += prev.Hits
+			}
+			b, err := json.Marshal(t)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+				return p.HSet(ctx, key, t.ID, b).Err()
+			})
+			return err
+		}, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return t, err
+		}
+	}
+}
+
+// GetTombstone returns id's tombstone; ok is false when it has none.
+func (r *RedisCounter) GetTombstone(ctx context.Context, id string) (t core.Tombstone, ok bool, err error) {
+	s, err := r.client.HGet(ctx, r.tombstonesKey(), id).Result()
+	if errors.Is(err, redis.Nil) {
+		return core.Tombstone{}, false, nil
+	}
+	if err != nil {
+		return core.Tombstone{}, false, err
+	}
+	return t, true, json.Unmarshal([]byte(s), &t)
+}
+
+// takeTombstoneScript removes and returns a tombstone in one step, so two
+// restores of the same counter can't both get its hits.
+var takeTombstoneScript = redis.NewScript(`
+local v = redis.call('HGET', KEYS[1], ARGV[1])
+if v then
+  redis.call('HDEL', KEYS[1], ARGV[1])
+end
+return v
+`)
+
+// TakeTombstone removes id's tombstone and returns it; ok is false when it
+// had none.
+func (r *RedisCounter) TakeTombstone(ctx context.Context, id string) (t core.Tombstone, ok bool, err error) {
+	s, err := takeTombstoneScript.Run(ctx, r.client, []string{r.tombstonesKey()}, id).Text()
+	if errors.Is(err, redis.Nil) {
+		return core.Tombstone{}, false, nil
+	}
+	if err != nil {
+		return core.Tombstone{}, false, err
+	}
+	return t, true, json.Unmarshal([]byte(s), &t)
+}
+
+// Tombstones returns every tombstone, in no particular order.
+func (r *RedisCounter) Tombstones(ctx context.Context) ([]core.Tombstone, error) {
+	h, err := r.client.HGetAll(ctx, r.tombstonesKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]core.Tombstone, 0, len(h))
+	for _, s := range h {
+		var t core.Tombstone
+		if json.Unmarshal([]byte(s), &t) == nil {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// deleteZeroScript deletes a counter key that still holds 0, i.e. that had
+// no hits since it was soft-deleted.
+var deleteZeroScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == '0' then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// PurgeTombstone deletes id for good: its tombstone and, unless it was hit
+// again after the soft delete, its key and metadata.
+func (r *RedisCounter) PurgeTombstone(ctx context.Context, id string) error {
+	if err := r.client.HDel(ctx, r.tombstonesKey(), id).Err(); err != nil {
+		return err
+	}
+	deleted, err := deleteZeroScript.Run(ctx, r.client, []string{r.Key(id)}).Int()
+	if err != nil || deleted == 0 {
+		return err
+	}
+	return r.client.Del(ctx, r.metaKey(id)).Err()
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/advayc/nums/core"
+)
+
+// Operation kinds for Transactor.Apply.
+const (
+	OpInc = "inc" // add N
+	OpDec = "dec" // subtract N (fails the whole transaction below zero)
+	OpSet = "set" // overwrite with N
+	// OpExpect asserts the counter currently equals N (compare-and-set when
+	// followed by a set); on mismatch nothing is applied and Apply returns
+	// a *MismatchError.
+	OpExpect = "expect"
+	// OpBelow asserts the counter is currently below N, e.g. to count only
+	// the first N signups when followed by an inc; otherwise it fails like
+	// OpExpect.
+	OpBelow = "below"
+)
+
+// Op is one step of a transaction.
+type Op struct {
+	Kind string
+	ID   string
+	N    uint64
+}
+
+// Validate checks the kind and id.
+func (o Op) Validate() error {
+	switch o.Kind {
+	case OpInc, OpDec, OpSet, OpExpect, OpBelow:
+	default:
+		return fmt.Errorf("unknown op %q (want inc, dec, set, expect or below)", o.Kind)
+	}
+	if o.ID == "" {
+		return errors.New("id is required")
+	}
+	return nil
+}
+
+// OpIDs returns the ids ops touch, in order, each once.
+func OpIDs(ops []Op) []string {
+	ids := make([]string, 0, len(ops))
+	seen := make(map[string]bool, len(ops))
+	for _, op := range ops {
+		if !seen[op.ID] {
+			seen[op.ID] = true
+			ids = append(ids, op.ID)
+		}
+	}
+	return ids
+}
+
+// ErrUnderflow is returned when a dec would take a counter below zero.
+var ErrUnderflow = errors.New("store: decrement below zero")
+
+// ErrOverflow is returned when an inc would take a counter past the largest
+// uint64.
+var ErrOverflow = errors.New("store: increment past the largest count")
+
+// ErrNotInteger is returned when a transaction touches a float counter.
+var ErrNotInteger = errors.New("store: transactions only apply to integer counters")
+
+// GaugeTypeError refuses a write that does not match a gauge's type. Got is
+// the write's type, "" for a plain hit. It is an ErrNotInteger.
+type GaugeTypeError struct {
+	ID   string
+	Type string // the gauge's: core.GaugeInt or core.GaugeFloat
+	Got  string
+}
+
+func (e *GaugeTypeError) Error() string {
+	gauge := "a float gauge"
+	if e.Type == core.GaugeInt {
+		gauge = "an int gauge"
+	}
+	if e.Got == "" {
+		return fmt.Sprintf("counter %s is %s: change it with type=%s&by=<delta>, not a plain hit", e.ID, gauge, e.Type)
+	}
+	return fmt.Sprintf("counter %s is %s: send type=%s, not type=%s", e.ID, gauge, e.Type, e.Got)
+}
+
+func (e *GaugeTypeError) Is(target error) bool { return target == ErrNotInteger }
+
+// MismatchError reports a failed expect or below op and the value actually
+// stored.
+type MismatchError struct {
+	ID       string
+	Expected uint64
+	Current  uint64
+	Below    bool // a below op: the value was expected under Expected
+}
+
+func (e *MismatchError) Error() string {
+	if e.Below {
+		return fmt.Sprintf("store: %s is %d, expected below %d", e.ID, e.Current, e.Expected)
+	}
+	return fmt.Sprintf("store: %s is %d, expected %d", e.ID, e.Current, e.Expected)
+}
+
+// Transactor is implemented by stores that apply several operations
+// atomically (Capabilities.Transactions): either every op is applied or none.
+// Apply returns each op's resulting value, in order.
+type Transactor interface {
+	Apply(ctx context.Context, ops []Op) ([]uint64, error)
+}
+
+// ApplyOps computes the results of ops over the current values (get) without
+// writing anything. It is shared by the backends' implementations.
+func ApplyOps(ops []Op, get func(id string) (uint64, error)) (results []uint64, final map[string]uint64, err error) {
+	final = make(map[string]uint64)
+	results = make([]uint64, len(ops))
+	for i, op := range ops {
+		if err := op.Validate(); err != nil {
+			return nil, nil, err
+		}
+		cur, ok := final[op.ID]
+		if !ok {
+			if cur, err = get(op.ID); err != nil {
+				return nil, nil, err
+			}
+		}
+		switch op.Kind {
+		case OpInc:
+			if cur > math.MaxUint64-op.N {
+				return nil, nil, fmt.Errorf("%w: %s is %d, cannot add %d", ErrOverflow, op.ID, cur, op.N)
+			}
+			cur += op.N
+		case OpDec:
+			if op.N > cur {
+				return nil, nil, fmt.Errorf("%w: %s is %d, cannot subtract %d", ErrUnderflow, op.ID, cur, op.N)
+			}
+			cur -= op.N
+		case OpSet:
+			cur = op.N
+		case OpExpect:
+			if cur != op.N {
+				return nil, nil, &MismatchError{ID: op.ID, Expected: op.N, Current: cur}
+			}
+		case OpBelow:
+			if cur >= op.N {
+				return nil, nil, &MismatchError{ID: op.ID, Expected: op.N, Current: cur, Below: true}
+			}
+		}
+		final[op.ID] = cur
+		results[i] = cur
+	}
+	return results, final, nil
+}
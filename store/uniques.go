@@ -0,0 +1,38 @@
+//go:build !minimal
+
+package store
+
+import (
+	"context"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+func (r *RedisCounter) uniquesKey(id string) string { return "uniques:" + r.Key(id) }
+
+// AddUnique adds visitor to id's unique visitors, the HyperLogLog
+// "uniques:<prefix><id>". A ttl > 0 makes it expire, with a counter created
+// by the same hit.
+func (r *RedisCounter) AddUnique(ctx context.Context, id, visitor string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return r.client.PFAdd(ctx, r.uniquesKey(id), visitor).Err()
+	}
+	_, err := r.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.PFAdd(ctx, r.uniquesKey(id), visitor)
+		p.Expire(ctx, r.uniquesKey(id), ttl)
+		return nil
+	})
+	return err
+}
+
+// Uniques estimates id's unique visitors (HyperLogLog, about 0.8% error).
+func (r *RedisCounter) Uniques(ctx context.Context, id string) (uint64, error) {
+	n, err := r.client.PFCount(ctx, r.uniquesKey(id)).Result()
+	return uint64(n), err
+}
+
+// ResetUniques forgets id's unique visitors.
+func (r *RedisCounter) ResetUniques(ctx context.Context, id string) error {
+	return r.client.Del(ctx, r.uniquesKey(id)).Err()
+}
@@ -0,0 +1,362 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// WAL makes a MultiCounter survive restarts and crashes: every change is
+// appended to a log file before the call returns, and OpenWAL replays the
+// log into a fresh counter. Records are single lines:
+//
+//	inc "id" 1
+//	incf "id" 2.5
+//	set "id" 42
+//	setf "id" 2.5
+//	tx [{"Kind":"dec","ID":"old","N":10},...]
+//	exp "id" 1767225600
+//	del "id"
+//
+// exp gives a counter an expiry (Unix seconds) and del records that it
+// expired. A truncated last line (the process died mid-write) is ignored. Playground
+// ids are not logged; they expire within a day anyway. Writes go to the OS
+// right away, so a crash of the process loses nothing; with sync set every
+// write is also fsynced, which survives power loss at the cost of latency.
+type WAL struct {
+	*MultiCounter
+
+	mu   sync.Mutex // orders log records like the changes they describe
+	path string
+	sync bool
+	f    *os.File
+	w    *bufio.Writer
+}
+
+// OpenWAL replays the log at path (if any) into mc, compacts it to one set
+// record per counter and keeps appending to it. mc should be empty and only
+// changed through the returned WAL from then on.
+func OpenWAL(mc *MultiCounter, path string, sync bool) (*WAL, error) {
+	w := &WAL{MultiCounter: mc, path: path, sync: sync}
+	n, err := w.replay()
+	if err != nil {
+		return nil, err
+	}
+	mc.SweepExpired(core.Now()) // expired while the process was down
+	if err := w.Compact(); err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		log.Printf("wal: replayed %d records from %s", n, path)
+	}
+	return w, nil
+}
+
+// replay applies every record in the log and returns how many there were.
+func (w *WAL) replay() (int, error) {
+	f, err := os.Open(w.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("wal: %w", err)
+	}
+	defer f.Close()
+	ctx := context.Background()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	n, line := 0, 0
+	for sc.Scan() {
+		line++
+		text := sc.Text()
+		if err := w.apply(ctx, text); err != nil {
+			if sc.Scan() { // not the last line: the log is corrupt, not torn
+				return n, fmt.Errorf("wal: %s line %d: %w", w.path, line, err)
+			}
+			log.Printf("(warn) wal: ignoring truncated last record in %s: %v", w.path, err)
+			break
+		}
+		n++
+	}
+	if err := sc.Err(); err != nil {
+		return n, fmt.Errorf("wal: %w", err)
+	}
+	return n, nil
+}
+
+// apply replays one record against the in-memory counter.
+func (w *WAL) apply(ctx context.Context, rec string) error {
+	op, rest, _ := strings.Cut(rec, " ")
+	if op == "tx" {
+		var ops []Op
+		if err := json.Unmarshal([]byte(rest), &ops); err != nil {
+			return err
+		}
+		_, err := w.MultiCounter.Apply(ctx, ops)
+		return err
+	}
+	quoted, err := strconv.QuotedPrefix(rest)
+	if err != nil {
+		return fmt.Errorf("bad id in %q", rec)
+	}
+	id, _ := strconv.Unquote(quoted)
+	arg := strings.TrimPrefix(rest[len(quoted):], " ")
+	switch op {
+	case "inc":
+		n, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return err
+		}
+		_, err = w.MultiCounter.IncBy(ctx, id, n)
+		return err
+	case "incf", "setf":
+		f, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return err
+		}
+		if op == "setf" {
+			return w.MultiCounter.Set(ctx, id, core.Float(f))
+		}
+		_, err = w.MultiCounter.IncFloat(ctx, id, f)
+		return err
+	case "set":
+		n, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return err
+		}
+		return w.MultiCounter.Set(ctx, id, core.Uint(n))
+	case "exp":
+		sec, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return err
+		}
+		w.MultiCounter.expireAt(id, time.Unix(sec, 0))
+		return nil
+	case "del":
+		w.MultiCounter.remove(id)
+		return nil
+	}
+	return fmt.Errorf("unknown record %q", op)
+}
+
+// record appends one line; the caller holds w.mu.
+func (w *WAL) record(format string, args ...any) error {
+	if _, err := fmt.Fprintf(w.w, format+"\n", args...); err != nil {
+		return fmt.Errorf("wal: %w", err)
+	}
+	if err := w.w.Flush(); err != nil {
+		return fmt.Errorf("wal: %w", err)
+	}
+	if w.sync {
+		if err := w.f.Sync(); err != nil {
+			return fmt.Errorf("wal: %w", err)
+		}
+	}
+	return nil
+}
+
+func (w *WAL) Inc(ctx context.Context, id string) (uint64, error) {
+	return w.IncBy(ctx, id, 1)
+}
+
+// IncBy logs and adds n to id.
+func (w *WAL) IncBy(ctx context.Context, id string, n uint64) (uint64, error) {
+	if id == "" {
+		id = "default"
+	}
+	if core.IsTestID(id) {
+		return w.MultiCounter.IncBy(ctx, id, n)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.record("inc %q %d", id, n); err != nil {
+		return 0, err
+	}
+	return w.MultiCounter.IncBy(ctx, id, n)
+}
+
+// IncFloat logs and adds by to a float counter.
+func (w *WAL) IncFloat(ctx context.Context, id string, by float64) (float64, error) {
+	if id == "" {
+		id = "default"
+	}
+	if core.IsTestID(id) {
+		return w.MultiCounter.IncFloat(ctx, id, by)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.record("incf %q %s", id, strconv.FormatFloat(by, 'g', -1, 64)); err != nil {
+		return 0, err
+	}
+	return w.MultiCounter.IncFloat(ctx, id, by)
+}
+
+// Set logs and overwrites id with v.
+func (w *WAL) Set(ctx context.Context, id string, v core.Value) error {
+	if id == "" {
+		id = "default"
+	}
+	if core.IsTestID(id) {
+		return w.MultiCounter.Set(ctx, id, v)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.recordValue(id, v); err != nil {
+		return err
+	}
+	return w.MultiCounter.Set(ctx, id, v)
+}
+
+func (w *WAL) recordValue(id string, v core.Value) error {
+	if v.IsFloat() {
+		return w.record("setf %q %s", id, strconv.FormatFloat(v.Float64(), 'g', -1, 64))
+	}
+	return w.record("set %q %d", id, v.Uint64())
+}
+
+// Apply runs ops atomically and logs them if they were applied. Replaying the
+// same ops on the same state gives the same result, so the ops themselves
+// are the record.
+func (w *WAL) Apply(ctx context.Context, ops []Op) ([]uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	results, err := w.MultiCounter.Apply(ctx, ops)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.record("tx %s", b); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Expire logs and sets id's expiry, so it outlives a restart.
+func (w *WAL) Expire(ctx context.Context, id string, ttl time.Duration) error {
+	if id == "" {
+		id = "default"
+	}
+	if core.IsTestID(id) {
+		return w.MultiCounter.Expire(ctx, id, ttl)
+	}
+	at := core.Now().Add(ttl)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.record("exp %q %d", id, at.Unix()); err != nil {
+		return err
+	}
+	w.MultiCounter.expireAt(id, at)
+	return nil
+}
+
+// SweepExpired logs and drops counters past their expiry, so a replay does
+// not bring them back.
+func (w *WAL) SweepExpired(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, id := range w.MultiCounter.expired(now) {
+		if !core.IsTestID(id) {
+			if err := w.record("del %q", id); err != nil {
+				log.Printf("(warn) %v; %q expires on the next sweep", err, id)
+				continue
+			}
+		}
+		w.MultiCounter.remove(id)
+	}
+}
+
+// Janitor periodically sweeps expired counters (runs for the process
+// lifetime). Run it instead of the MultiCounter's.
+func (w *WAL) Janitor(every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for range t.C {
+		w.SweepExpired(core.Now())
+	}
+}
+
+// Compact rewrites the log as one set record per counter, plus an exp record
+// for those with an expiry, replacing the file atomically, and reopens it
+// for appending.
+func (w *WAL) Compact() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	tmp := w.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("wal: %w", err)
+	}
+	bw := bufio.NewWriter(f)
+	err = w.MultiCounter.Each(context.Background(), func(id string, v core.Value) error {
+		if core.IsTestID(id) {
+			return nil
+		}
+		var err error
+		if v.IsFloat() {
+			_, err = fmt.Fprintf(bw, "setf %q %s\n", id, strconv.FormatFloat(v.Float64(), 'g', -1, 64))
+		} else {
+			_, err = fmt.Fprintf(bw, "set %q %d\n", id, v.Uint64())
+		}
+		if at, ok := w.MultiCounter.expiry(id); ok && err == nil {
+			_, err = fmt.Fprintf(bw, "exp %q %d\n", id, at.Unix())
+		}
+		return err
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, w.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("wal: compact: %w", err)
+	}
+	if w.f != nil {
+		_ = w.f.Close()
+	}
+	if w.f, err = os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644); err != nil {
+		return fmt.Errorf("wal: %w", err)
+	}
+	w.w = bufio.NewWriter(w.f)
+	return nil
+}
+
+// Compactor compacts the log periodically (runs for the process lifetime).
+func (w *WAL) Compactor(every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for range t.C {
+		if err := w.Compact(); err != nil {
+			log.Printf("(warn) %v", err)
+		}
+	}
+}
+
+// Close flushes and closes the log.
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	return w.f.Close()
+}
@@ -0,0 +1,48 @@
+package web
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// DailySalt returns the salt of a UTC day (YYYYMMDD), the same on every
+// instance, for the "anon" identity.
+type DailySalt func(ctx context.Context, day string) (string, error)
+
+var dailySalt atomic.Pointer[DailySalt]
+
+// UseDailySalt sets where the anon identity gets its salts; until it is set,
+// anon hits carry no identity and are all counted.
+func UseDailySalt(fn DailySalt) { dailySalt.Store(&fn) }
+
+// anonMaxWindow bounds the anon identity's DEDUPE_WINDOW: its salt, and so
+// every visitor's hash, changes daily.
+const anonMaxWindow = 24 * time.Hour
+
+func init() {
+	RegisterIdentity("anon", func(string) (Identity, error) { return anonIdentity{}, nil })
+}
+
+// anonIdentity hashes the client IP and User-Agent with a salt that changes
+// every UTC day. The salt is forgotten after it, so yesterday's hashes can no
+// longer be tied to an IP, and the same visitor hashes differently each day.
+type anonIdentity struct{}
+
+func (a anonIdentity) Visitor(_ http.ResponseWriter, r *http.Request) string {
+	fn := dailySalt.Load()
+	if fn == nil {
+		return ""
+	}
+	salt, err := (*fn)(r.Context(), core.Now().UTC().Format("20060102"))
+	if err != nil || salt == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(salt + "|" + ClientIP(r) + "|" + r.UserAgent()))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,25 @@
+package web
+
+import (
+	"encoding/base64"
+	"html"
+	"strings"
+
+	"github.com/advayc/nums/core"
+)
+
+// BadgeMatrixPage is the /debug/badge-matrix page: every core.BadgeMatrix
+// case on a light and a dark background, to eyeball the badge builders
+// after a change.
+func BadgeMatrixPage() string {
+	var b strings.Builder
+	b.WriteString("<!doctype html><meta charset=utf-8><title>nums badge matrix</title>\n")
+	b.WriteString("<style>body{font:14px sans-serif}td{padding:6px 12px}.dark{background:#0d1117}code{color:#555}</style>\n")
+	b.WriteString("<table><tr><th>case</th><th>/badge params</th><th>light</th><th>dark</th></tr>\n")
+	for _, c := range core.BadgeMatrix() {
+		img := `<img alt="` + html.EscapeString(c.Name) + `" src="data:image/svg+xml;base64,` + base64.StdEncoding.EncodeToString([]byte(c.SVG)) + `">`
+		b.WriteString("<tr><td>" + html.EscapeString(c.Name) + "</td><td><code>" + html.EscapeString(c.Query) + "</code></td><td>" + img + "</td><td class=dark>" + img + "</td></tr>\n")
+	}
+	b.WriteString("</table>\n")
+	return b.String()
+}
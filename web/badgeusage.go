@@ -0,0 +1,131 @@
+package web
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// badgeStyles are the style values counted by name. Besides the styles nums
+// renders (classic, terminal, mono, velocity, progress) it lists the Shields.io names people try,
+// so an instance can see demand for them; any other value counts as "other".
+var badgeStyles = map[string]bool{
+	"classic": true, "terminal": true, "mono": true, "velocity": true, "progress": true,
+	"flat": true, "flat-square": true, "plastic": true, "for-the-badge": true, "social": true,
+}
+
+// badgeParams are the display parameters whose use is counted. Only their
+// presence is recorded, never their values.
+var badgeParams = []string{"label", "color", "font", "min", "precision", "suffix", "bg", "labelColor", "valueColor", "cacheSeconds", "uniques", "target", "trackColor"}
+
+// BadgeUsageKeys names the usage counters a badge request on route (e.g.
+// "badge") adds one to: "route:<route>", "style:<style>" and "param:<name>"
+// for each display parameter it sets. The set of keys is small and fixed,
+// whatever the request asks for.
+func BadgeUsageKeys(route string, q url.Values) []string {
+	style := strings.ToLower(q.Get("style"))
+	switch {
+	case style == "":
+		style = "classic"
+	case !badgeStyles[style]:
+		style = "other"
+	}
+	keys := []string{"route:" + route, "style:" + style}
+	for _, p := range badgeParams {
+		if q.Get(p) != "" {
+			keys = append(keys, "param:"+p)
+		}
+	}
+	return keys
+}
+
+// BadgeUsage counts badge requests by BadgeUsageKeys, in memory.
+type BadgeUsage struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+// Record counts one request on route.
+func (u *BadgeUsage) Record(route string, q url.Values) {
+	keys := BadgeUsageKeys(route, q)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.counts == nil {
+		u.counts = make(map[string]uint64)
+	}
+	for _, k := range keys {
+		u.counts[k]++
+	}
+}
+
+// Counts returns a copy of the counters.
+func (u *BadgeUsage) Counts() map[string]uint64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	m := make(map[string]uint64, len(u.counts))
+	for k, n := range u.counts {
+		m[k] = n
+	}
+	return m
+}
+
+// BadgeUsageReport groups badge usage counters for /admin/stats.
+type BadgeUsageReport struct {
+	Routes map[string]uint64 `json:"routes"`
+	Styles map[string]uint64 `json:"styles"`
+	Params map[string]uint64 `json:"params"`
+}
+
+// NewBadgeUsageReport groups counts keyed as by BadgeUsageKeys; unknown keys
+// are ignored.
+func NewBadgeUsageReport(counts map[string]uint64) BadgeUsageReport {
+	rep := BadgeUsageReport{Routes: map[string]uint64{}, Styles: map[string]uint64{}, Params: map[string]uint64{}}
+	for k, n := range counts {
+		kind, name, ok := strings.Cut(k, ":")
+		if !ok {
+			continue
+		}
+		switch kind {
+		case "route":
+			rep.Routes[name] = n
+		case "style":
+			rep.Styles[name] = n
+		case "param":
+			rep.Params[name] = n
+		}
+	}
+	return rep
+}
+
+// WriteMetrics writes the report in the Prometheus text format, as
+// nums_badge_requests_total{route}, nums_badge_style_requests_total{style}
+// and nums_badge_param_requests_total{param}.
+func (rep BadgeUsageReport) WriteMetrics(w io.Writer) error {
+	families := []struct {
+		name, help, label string
+		m                 map[string]uint64
+	}{
+		{"nums_badge_requests_total", "Badge requests by route.", "route", rep.Routes},
+		{"nums_badge_style_requests_total", "Badge requests by style (classic when unset, other when unknown).", "style", rep.Styles},
+		{"nums_badge_param_requests_total", "Badge requests that set each display parameter.", "param", rep.Params},
+	}
+	for _, f := range families {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", f.name, f.help, f.name); err != nil {
+			return err
+		}
+		names := make([]string, 0, len(f.m))
+		for name := range f.m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if _, err := fmt.Fprintf(w, "%s{%s=%q} %d\n", f.name, f.label, name, f.m[name]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
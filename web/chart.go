@@ -0,0 +1,34 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/advayc/nums/core"
+)
+
+// ParseChart reads the params of /chart: one to core.MaxChartSeries id
+// params, one per line, and days (default 30, at most core.MaxChartDays).
+func ParseChart(r *http.Request) (ids []string, days int, err error) {
+	q := r.URL.Query()
+	seen := make(map[string]bool)
+	for _, id := range q["id"] {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 || len(ids) > core.MaxChartSeries {
+		return nil, 0, fmt.Errorf("chart takes 1 to %d id params", core.MaxChartSeries)
+	}
+	days = 30
+	if s := q.Get("days"); s != "" {
+		days, err = strconv.Atoi(s)
+		if err != nil || days < 1 || days > core.MaxChartDays {
+			return nil, 0, fmt.Errorf("days must be a whole number from 1 to %d", core.MaxChartDays)
+		}
+	}
+	return ids, days, nil
+}
@@ -0,0 +1,79 @@
+package web
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// trustedProxies is how many proxies in front of the server ClientIP trusts
+// to report the caller's address; 0 trusts none.
+var trustedProxies atomic.Int32
+
+// UseTrustedProxies makes ClientIP take the caller's address from the
+// X-Forwarded-For entry added by the outermost of the n proxies in front of
+// the server (the n-th from the right), or from X-Real-IP without one. With 0
+// both headers are ignored, since any client can send them.
+func UseTrustedProxies(n int) { trustedProxies.Store(int32(n)) }
+
+// TrustProxyFromEnv applies TRUST_PROXY with UseTrustedProxies and returns
+// it: the number of proxies in front of the server, def when unset. "true"
+// and "false" mean 1 and 0.
+func TrustProxyFromEnv(def int) (int, error) {
+	n := def
+	if s := strings.TrimSpace(os.Getenv("TRUST_PROXY")); s != "" {
+		v, err := strconv.Atoi(s)
+		if b, berr := strconv.ParseBool(s); err != nil && berr == nil {
+			v, err = 0, nil
+			if b {
+				v = 1
+			}
+		}
+		if err != nil || v < 0 || v > 16 {
+			return 0, fmt.Errorf("TRUST_PROXY: %q should be the number of proxies in front of the server (0 trusts none)", s)
+		}
+		n = v
+	}
+	UseTrustedProxies(n)
+	return n, nil
+}
+
+// ClientIP returns the caller's address: the connection's, or with
+// TRUST_PROXY the one the proxies in front of the server report.
+func ClientIP(r *http.Request) string {
+	if n := int(trustedProxies.Load()); n > 0 {
+		if ip := forwardedFor(r.Header.Values("X-Forwarded-For"), n); ip != "" {
+			return ip
+		}
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// forwardedFor returns the X-Forwarded-For entry the outermost of n proxies
+// added. Each proxy appends the address it was called from, so entries left
+// of it were sent by the client and can't be trusted.
+func forwardedFor(headers []string, n int) string {
+	var entries []string
+	for _, h := range headers {
+		for _, e := range strings.Split(h, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				entries = append(entries, e)
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return ""
+	}
+	return entries[max(len(entries)-n, 0)]
+}
@@ -0,0 +1,67 @@
+package web
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// compatModes rename the keys of /hit and /count responses (WriteCounter)
+// for clients written for other hit counters, so they can switch to nums
+// without changes.
+var compatModes = map[string]map[string]string{
+	"hitsdotsh":    {"hits": "count"},
+	"visitorbadge": {"hits": "value"},
+}
+
+// compat is the mode's renames; nil writes our own keys.
+var compat atomic.Pointer[map[string]string]
+
+// UseCompat makes WriteCounter write the keys of compatibility mode name
+// ("hitsdotsh" or "visitorbadge"); "" restores ours.
+func UseCompat(name string) error {
+	if name == "" {
+		compat.Store(nil)
+		return nil
+	}
+	renames, ok := compatModes[name]
+	if !ok {
+		modes := make([]string, 0, len(compatModes))
+		for m := range compatModes {
+			modes = append(modes, m)
+		}
+		sort.Strings(modes)
+		return fmt.Errorf("unknown compatibility mode %q (want %s)", name, strings.Join(modes, " or "))
+	}
+	compat.Store(&renames)
+	return nil
+}
+
+// CompatFromEnv applies COMPAT with UseCompat.
+func CompatFromEnv() error {
+	if err := UseCompat(strings.TrimSpace(os.Getenv("COMPAT"))); err != nil {
+		return fmt.Errorf("COMPAT: %w", err)
+	}
+	return nil
+}
+
+// compatKeys renames ps's keys for the compatibility mode, dropping later
+// keys (hook fields) that would repeat a new name.
+func compatKeys(ps []pair) []pair {
+	renames := compat.Load()
+	if renames == nil {
+		return ps
+	}
+	out := make([]pair, 0, len(ps))
+	for _, p := range ps {
+		if to, ok := (*renames)[p.key]; ok {
+			p.key = to
+		}
+		if !hasKey(out, p.key) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,152 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Compatibility routes answer badge URLs in the shapes of other hit counter
+// services, so READMEs that embed them keep working once the service's host
+// points at nums:
+//
+//	hitsdotsh:    /github.com/user/repo.svg?label=views
+//	seeyoufarm:   /api/count/incr/badge.svg?url=https://github.com/user/repo&title=hits
+//	              (/api/count/keep/badge.svg shows the count without a hit)
+//	visitorbadge: /badge?page_id=user.repo&left_text=visitors
+//
+// Like the services they stand in for, they count hits without a token.
+var compatRouteNames = []string{"hitsdotsh", "seeyoufarm", "visitorbadge"}
+
+// CompatRoutesFromEnv parses COMPAT_ROUTES, a comma-separated list of the
+// services whose URLs to answer ("*" for all of them).
+func CompatRoutesFromEnv() (map[string]bool, error) {
+	on := make(map[string]bool)
+	for _, name := range strings.Split(os.Getenv("COMPAT_ROUTES"), ",") {
+		switch name = strings.TrimSpace(name); {
+		case name == "":
+		case name == "*":
+			for _, n := range compatRouteNames {
+				on[n] = true
+			}
+		case contains(compatRouteNames, name):
+			on[name] = true
+		default:
+			return nil, fmt.Errorf("COMPAT_ROUTES: unknown service %q (want %s or *)", name, strings.Join(compatRouteNames, ", "))
+		}
+	}
+	return on, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// CompatRoute is a badge request in another service's URL shape.
+type CompatRoute struct {
+	Service string
+	ID      string
+	Count   bool       // the URL records a hit, rather than only showing the count
+	Badge   url.Values // the equivalent /badge params
+}
+
+// ParseCompatRoute recognizes r as a route of one of the enabled services.
+func ParseCompatRoute(r *http.Request, enabled map[string]bool) (CompatRoute, bool) {
+	if len(enabled) == 0 || r.Method != http.MethodGet {
+		return CompatRoute{}, false
+	}
+	q := r.URL.Query()
+	var c CompatRoute
+	switch path := r.URL.Path; {
+	case path == "/api/count/incr/badge.svg" || path == "/api/count/keep/badge.svg":
+		c = CompatRoute{Service: "seeyoufarm", ID: pageID(q.Get("url")), Count: strings.Contains(path, "/incr/")}
+		c.Badge = compatBadge(q, "title", "hits", "count_bg", "title_bg")
+	case path == "/badge" && q.Get("page_id") != "" && q.Get("id") == "":
+		c = CompatRoute{Service: "visitorbadge", ID: q.Get("page_id"), Count: true}
+		c.Badge = compatBadge(q, "left_text", "visitors", "right_color", "left_color")
+	case strings.HasSuffix(path, ".svg"):
+		id := strings.TrimSuffix(strings.TrimPrefix(path, "/"), ".svg")
+		host, _, _ := strings.Cut(id, "/")
+		if !strings.Contains(host, ".") { // hits.sh ids start with the page's host
+			return CompatRoute{}, false
+		}
+		c = CompatRoute{Service: "hitsdotsh", ID: id, Count: true}
+		c.Badge = compatBadge(q, "label", "hits", "color", "labelColor")
+	default:
+		return CompatRoute{}, false
+	}
+	if c.ID == "" || !enabled[c.Service] {
+		return CompatRoute{}, false
+	}
+	if c.ID = NormalizeID(c.ID); CheckID(c.ID) != nil {
+		return CompatRoute{}, false
+	}
+	c.Badge.Set("id", c.ID)
+	return c, true
+}
+
+// pageID turns a page URL into a counter id: github.com/user/repo for
+// https://github.com/user/repo/.
+func pageID(raw string) string {
+	if u, err := url.Parse(strings.TrimSpace(raw)); err == nil && u.Host != "" {
+		raw = u.Host + u.Path
+	}
+	return strings.TrimSuffix(raw, "/")
+}
+
+// compatBadge maps a service's label and color params onto label, color and
+// labelColor.
+func compatBadge(q url.Values, label, defaultLabel, color, labelColor string) url.Values {
+	out := url.Values{"label": {defaultLabel}}
+	for from, to := range map[string]string{label: "label", color: "color", labelColor: "labelColor"} {
+		if v := q.Get(from); v != "" {
+			out.Set(to, v)
+		}
+	}
+	if v := q.Get("style"); v != "" {
+		out.Set("style", v)
+	}
+	return out
+}
+
+type compatKey struct{}
+
+// CompatRequest reports whether r is the hit or badge request of a
+// compatibility route, which is allowed without a token.
+func CompatRequest(r *http.Request) bool {
+	return r.Context().Value(compatKey{}) != nil
+}
+
+// ServeCompatRoute answers c through h: a GET /hit first when the route
+// counts, whose body is dropped but whose cookies are kept, then the GET
+// /badge that is the response. Both requests pass CompatRequest.
+func ServeCompatRoute(w http.ResponseWriter, r *http.Request, c CompatRoute, h http.Handler) {
+	ctx := context.WithValue(r.Context(), compatKey{}, c.Service)
+	if c.Count {
+		hit := r.Clone(ctx)
+		hit.URL.Path, hit.URL.RawQuery = "/hit", url.Values{"id": {c.ID}}.Encode()
+		rec := &discardWriter{header: make(http.Header)}
+		h.ServeHTTP(rec, hit)
+		for _, cookie := range rec.header.Values("Set-Cookie") {
+			w.Header().Add("Set-Cookie", cookie)
+		}
+	}
+	badge := r.Clone(ctx)
+	badge.URL.Path, badge.URL.RawQuery = "/badge", c.Badge.Encode()
+	h.ServeHTTP(w, badge)
+}
+
+// discardWriter keeps the headers of a response and drops the rest.
+type discardWriter struct{ header http.Header }
+
+func (d *discardWriter) Header() http.Header         { return d.header }
+func (d *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardWriter) WriteHeader(int)             {}
@@ -0,0 +1,163 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// Counter is the JSON body of /hit and /count. Its keys are always written in
+// the order below, and the optional ones are left out when zero.
+type Counter struct {
+	ID          string
+	Hits        core.Value
+	Previous    *core.Value // dry runs: the value before the hit
+	Uniques     *uint64     // metric=uniques: estimated unique visitors
+	Period      string      // set when Hits counts one period (today, week or month)
+	Source      string
+	Environment string
+	Test        bool
+	ExpiresAt   *time.Time // set when the hit created a counter with a TTL
+	Approximate bool
+	Frozen      bool
+	Excluded    bool
+	Reason      string
+	Duplicate   bool
+	DryRun      bool
+	Offset      uint64
+	Rounded     uint64
+	FirstSeen   *time.Time     // only when fields asks for it (see FieldRequested)
+	LastHit     *time.Time     // likewise
+	Velocity    *core.Velocity // likewise: recent hits per hour and per day
+	Warnings    []string       // written as meta.warnings, e.g. a namespace nearing its quota
+	// Extra holds fields added by hooks. They follow the built-in keys in
+	// key order and never replace one.
+	Extra map[string]any
+}
+
+type pair struct {
+	key string
+	val any
+}
+
+// pairs lists c's keys in output order. With strs, counts are JSON strings.
+func (c Counter) pairs(strs bool) []pair {
+	num := func(v core.Value) any {
+		if strs {
+			return v.String()
+		}
+		return v
+	}
+	ps := []pair{{"id", c.ID}, {"hits", num(c.Hits)}}
+	add := func(key string, val any, ok bool) {
+		if ok {
+			ps = append(ps, pair{key, val})
+		}
+	}
+	if c.Previous != nil {
+		ps = append(ps, pair{"previous", num(*c.Previous)})
+	}
+	if c.Uniques != nil {
+		ps = append(ps, pair{"uniques", num(core.Uint(*c.Uniques))})
+	}
+	add("period", c.Period, c.Period != "")
+	add("source", c.Source, c.Source != "")
+	add("environment", c.Environment, c.Environment != "")
+	add("test", true, c.Test)
+	add("expiresAt", c.ExpiresAt, c.ExpiresAt != nil)
+	add("approximate", true, c.Approximate)
+	add("frozen", true, c.Frozen)
+	add("excluded", true, c.Excluded)
+	add("reason", c.Reason, c.Reason != "")
+	add("duplicate", true, c.Duplicate)
+	add("dryRun", true, c.DryRun)
+	add("offset", num(core.Uint(c.Offset)), c.Offset > 0)
+	add("rounded", num(core.Uint(c.Rounded)), c.Rounded > 0)
+	add("firstSeen", c.FirstSeen, c.FirstSeen != nil)
+	add("lastHit", c.LastHit, c.LastHit != nil)
+	add("velocity", c.Velocity, c.Velocity != nil)
+	add("meta", map[string]any{"warnings": c.Warnings}, len(c.Warnings) > 0)
+	extra := make([]string, 0, len(c.Extra))
+	for k := range c.Extra {
+		extra = append(extra, k)
+	}
+	sort.Strings(extra)
+	for _, k := range extra {
+		if !hasKey(ps, k) {
+			ps = append(ps, pair{k, c.Extra[k]})
+		}
+	}
+	return ps
+}
+
+func hasKey(ps []pair, key string) bool {
+	for _, p := range ps {
+		if p.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// requestedFields is the set of keys listed in the fields param, or nil
+// without one.
+func requestedFields(r *http.Request) map[string]bool {
+	list := r.URL.Query().Get("fields")
+	if strings.TrimSpace(list) == "" {
+		return nil
+	}
+	want := make(map[string]bool)
+	for _, k := range strings.Split(list, ",") {
+		want[strings.TrimSpace(k)] = true
+	}
+	return want
+}
+
+// FieldRequested reports whether r's fields param lists key, for keys such
+// as firstSeen that cost an extra read and are only filled in on request.
+func FieldRequested(r *http.Request, key string) bool {
+	return requestedFields(r)[key]
+}
+
+// WriteCounter writes c as JSON. Two query parameters shape the body:
+// fields=hits,source keeps only the listed keys, in the usual order (names c
+// does not carry are skipped), so clients get a stable payload however much
+// the default one grows; numberFormat=string writes counts as strings for
+// clients such as JavaScript that lose precision above 2^53. Keys are
+// renamed first for the COMPAT mode (UseCompat).
+func WriteCounter(w http.ResponseWriter, r *http.Request, c Counter) {
+	q := r.URL.Query()
+	ps := compatKeys(c.pairs(q.Get("numberFormat") == "string"))
+	if want := requestedFields(r); want != nil {
+		var only []pair
+		for _, p := range ps {
+			if want[p.key] {
+				only = append(only, p)
+			}
+		}
+		ps = only
+	}
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, p := range ps {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(p.key)
+		v, err := json.Marshal(p.val)
+		if err != nil {
+			v = []byte("null")
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteString("}\n")
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = b.WriteTo(w)
+}
@@ -0,0 +1,55 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/advayc/nums/core"
+)
+
+// MaxCountIDs is how many counters one GET /counts may read.
+const MaxCountIDs = 100
+
+// ParseCountIDs reads /counts?ids=a,b,c (repeated ids= params work too) in
+// request order, without duplicates.
+func ParseCountIDs(r *http.Request) ([]string, error) {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, list := range r.URL.Query()["ids"] {
+		for _, id := range strings.Split(list, ",") {
+			if id = strings.TrimSpace(id); id != "" && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("ids is required, e.g. ids=home,blog")
+	}
+	if len(ids) > MaxCountIDs {
+		return nil, fmt.Errorf("ids may list at most %d counters", MaxCountIDs)
+	}
+	return ids, nil
+}
+
+// WriteCounts writes a GET /counts body, {"hits":{"blog":3,"home":12}}, with
+// the environment when it is set. numberFormat=string writes the counts as
+// strings, as WriteCounter does.
+func WriteCounts(w http.ResponseWriter, r *http.Request, hits map[string]core.Value, environment string) {
+	body := map[string]any{"hits": hits}
+	if r.URL.Query().Get("numberFormat") == "string" {
+		strs := make(map[string]string, len(hits))
+		for id, v := range hits {
+			strs[id] = v.String()
+		}
+		body["hits"] = strs
+	}
+	if environment != "" {
+		body["environment"] = environment
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
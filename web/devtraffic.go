@@ -0,0 +1,50 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/advayc/nums/core"
+)
+
+// DevHostsFromEnv returns the development hostnames when IGNORE_DEV_TRAFFIC
+// is on: core.DefaultDevHosts plus the comma-separated DEV_HOSTNAMES (setting
+// DEV_HOSTNAMES alone also turns the filter on). nil means the filter is off.
+func DevHostsFromEnv() []string {
+	on, _ := strconv.ParseBool(os.Getenv("IGNORE_DEV_TRAFFIC"))
+	extra := os.Getenv("DEV_HOSTNAMES")
+	if !on && extra == "" {
+		return nil
+	}
+	hosts := append([]string(nil), core.DefaultDevHosts...)
+	for _, h := range strings.Split(extra, ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// FromDevHost reports whether r was sent by a page on a development host,
+// judged by its Origin (or, failing that, Referer) header. It is false when
+// devHosts is nil or neither header is present.
+func FromDevHost(r *http.Request, devHosts []string) bool {
+	if devHosts == nil {
+		return false
+	}
+	src := r.Header.Get("Origin")
+	if src == "" || src == "null" {
+		src = r.Header.Get("Referer")
+	}
+	if src == "" {
+		return false
+	}
+	u, err := url.Parse(src)
+	if err != nil {
+		return false
+	}
+	return core.IsDevHost(u.Hostname(), devHosts)
+}
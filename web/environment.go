@@ -0,0 +1,17 @@
+package web
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/advayc/nums/core"
+)
+
+// EnvironmentFromEnv returns the validated ENVIRONMENT, "production" if unset.
+func EnvironmentFromEnv() (string, error) {
+	name, err := core.ParseEnvironment(os.Getenv("ENVIRONMENT"))
+	if err != nil {
+		return "", fmt.Errorf("ENVIRONMENT: %w", err)
+	}
+	return name, nil
+}
@@ -0,0 +1,19 @@
+package web
+
+import (
+	"os"
+	"strings"
+)
+
+// FrozenIDsFromEnv returns the counters listed in FROZEN_IDS (comma-separated).
+// Frozen counters keep their value forever: hits are answered with the current
+// count and frozen: true but not recorded.
+func FrozenIDsFromEnv() map[string]bool {
+	ids := make(map[string]bool)
+	for _, id := range strings.Split(os.Getenv("FROZEN_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids[id] = true
+		}
+	}
+	return ids
+}
@@ -0,0 +1,34 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/advayc/nums/core"
+)
+
+// ParseGauge reads the type and by params of a /hit on a gauge: type=float
+// adds a float such as by=-2.5, type=int a whole number such as by=-3. kind
+// is "" for plain hit counters (no type, or type=uint), else core.GaugeInt
+// or core.GaugeFloat. Both kinds of gauge are kept as float counters, so int
+// gauges are exact within ±2^53.
+func ParseGauge(r *http.Request) (kind string, by float64, err error) {
+	q := r.URL.Query()
+	switch q.Get("type") {
+	case "", "uint":
+		return "", 0, nil
+	case core.GaugeFloat:
+		by, err := core.ParseDelta(q.Get("by"))
+		if err != nil {
+			return core.GaugeFloat, 0, fmt.Errorf("float counters require by=<nonzero number>")
+		}
+		return core.GaugeFloat, by, nil
+	case core.GaugeInt:
+		n, err := core.ParseIntDelta(q.Get("by"))
+		if err != nil {
+			return core.GaugeInt, 0, fmt.Errorf("int counters require by=<nonzero whole number> within ±2^53")
+		}
+		return core.GaugeInt, float64(n), nil
+	}
+	return "", 0, fmt.Errorf("type must be uint, int or float")
+}
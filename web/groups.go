@@ -0,0 +1,88 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/advayc/nums/core"
+)
+
+// GroupsFromEnv parses GROUPS, the counter groups that /count?group= and
+// /badge?group= add up (see core.ParseGroups).
+func GroupsFromEnv() (map[string][]string, error) {
+	groups, err := core.ParseGroups(os.Getenv("GROUPS"))
+	if err != nil {
+		return nil, fmt.Errorf("GROUPS: %w", err)
+	}
+	return groups, nil
+}
+
+// ParseGroup reads the group param of /count and /badge: "" when it is not
+// set. A group total is only the hits, so it does not combine with id,
+// metric=uniques, period, wait or style=velocity.
+func ParseGroup(r *http.Request) (string, error) {
+	q := r.URL.Query()
+	name := q.Get("group")
+	if name == "" {
+		return "", nil
+	}
+	for _, p := range []string{"id", "period", "wait"} {
+		if q.Get(p) != "" {
+			return "", fmt.Errorf("%s is not supported with group", p)
+		}
+	}
+	switch {
+	case q.Get("metric") == "uniques" || q.Get("uniques") == "1":
+		return "", errors.New("unique visitors are not supported with group")
+	case q.Get("style") == "velocity":
+		return "", errors.New("style=velocity is not supported with group")
+	}
+	return name, nil
+}
+
+// GroupAuthorized reports whether r carries a namespace token that covers
+// every member of a group (see IDAuthorized).
+func GroupAuthorized(tokens map[string]string, r *http.Request, members []string) bool {
+	ids, namespaces := core.GroupMembers(members)
+	for _, id := range ids {
+		if !IDAuthorized(tokens, r, id) {
+			return false
+		}
+	}
+	for _, ns := range namespaces {
+		if !NamespaceAuthorized(tokens, r, ns) {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteGroup writes a GET /count?group= body, {"group":"blog","hits":1234,
+// "counters":12}, with the environment when it is set. total's float
+// counters are counted but not summed. format=txt and format=github-output
+// and numberFormat=string work as for a counter.
+func WriteGroup(w http.ResponseWriter, r *http.Request, name string, total core.Aggregate, environment string) {
+	hits := core.Uint(total.TotalHits)
+	switch r.URL.Query().Get("format") {
+	case "txt", "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(hits.String()))
+		return
+	case "github-output":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(core.GitHubOutput([2]string{"hits", hits.String()}, [2]string{"group", name})))
+		return
+	}
+	body := map[string]any{"group": name, "hits": hits, "counters": total.Counters}
+	if r.URL.Query().Get("numberFormat") == "string" {
+		body["hits"] = hits.String()
+	}
+	if environment != "" {
+		body["environment"] = environment
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,102 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// HistoryFromEnv parses HISTORY_INTERVAL, how often counter values are
+// snapshotted for /history (default 1h, from 1m to 24h; 0 turns history
+// off), and HISTORY_RETENTION, how long snapshots are kept (default 90d).
+func HistoryFromEnv() (interval, retention time.Duration, err error) {
+	interval, retention = core.DefaultHistoryInterval, core.DefaultHistoryRetention
+	if s := strings.TrimSpace(os.Getenv("HISTORY_INTERVAL")); s == "0" || s == "off" {
+		return 0, 0, nil
+	} else if s != "" {
+		interval, err = time.ParseDuration(s)
+		if err != nil || interval < time.Minute || interval > 24*time.Hour || interval%time.Minute != 0 {
+			return 0, 0, fmt.Errorf("HISTORY_INTERVAL: %q should be whole minutes from 1m to 24h, or 0 for off", s)
+		}
+	}
+	if s := strings.TrimSpace(os.Getenv("HISTORY_RETENTION")); s != "" {
+		retention, err = parseDays(s)
+		if err != nil || retention < interval {
+			return 0, 0, fmt.Errorf("HISTORY_RETENTION: %q is not a duration such as 720h or 90d of at least HISTORY_INTERVAL", s)
+		}
+	}
+	return interval, retention, nil
+}
+
+// ParseHistory reads /history?id=x&from=&to=. from and to are unix seconds,
+// RFC 3339 times or YYYY-MM-DD dates (UTC midnight); to defaults to now and
+// from to core.DefaultHistoryRange before to.
+func ParseHistory(r *http.Request) (id string, from, to time.Time, err error) {
+	q := r.URL.Query()
+	id = q.Get("id")
+	if id == "" {
+		return "", from, to, fmt.Errorf("id is required")
+	}
+	to = core.Now().UTC()
+	if s := q.Get("to"); s != "" {
+		if to, err = parseHistoryTime(s); err != nil {
+			return "", from, to, fmt.Errorf("to: %w", err)
+		}
+	}
+	from = to.Add(-core.DefaultHistoryRange)
+	if s := q.Get("from"); s != "" {
+		if from, err = parseHistoryTime(s); err != nil {
+			return "", from, to, fmt.Errorf("from: %w", err)
+		}
+	}
+	if from.After(to) {
+		return "", from, to, fmt.Errorf("from is after to")
+	}
+	return id, from, to, nil
+}
+
+func parseHistoryTime(s string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0).UTC(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not unix seconds, an RFC 3339 time or a YYYY-MM-DD date", s)
+}
+
+// WriteHistory answers /history with {id, interval, from, to, points}, the
+// points oldest first as {at, hits}.
+func WriteHistory(w http.ResponseWriter, id string, interval time.Duration, from, to time.Time, points []core.HistoryPoint) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"id":       id,
+		"interval": shortDuration(interval),
+		"from":     from,
+		"to":       to,
+		"points":   points,
+	})
+}
+
+// shortDuration formats d without zero minutes and seconds, e.g. "1h".
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
@@ -0,0 +1,60 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxHitBy is the largest /hit?by= accepted when MAX_HIT_BY is unset.
+const DefaultMaxHitBy = 1000
+
+// MaxHitByFromEnv parses MAX_HIT_BY, the most hits one /hit?by=N may record
+// (1 turns ?by= off).
+func MaxHitByFromEnv() (uint64, error) {
+	s := strings.TrimSpace(os.Getenv("MAX_HIT_BY"))
+	if s == "" {
+		return DefaultMaxHitBy, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("MAX_HIT_BY: %q should be a whole number of at least 1", s)
+	}
+	return n, nil
+}
+
+// ParseHitBy reads /hit?by=N, the number of hits a batch client records in
+// one call: 1 when absent, otherwise a whole number from 1 to max.
+func ParseHitBy(r *http.Request, max uint64) (uint64, error) {
+	s := r.URL.Query().Get("by")
+	if s == "" {
+		return 1, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || n < 1 || n > max {
+		return 0, fmt.Errorf("by must be a whole number from 1 to %d", max)
+	}
+	return n, nil
+}
+
+// ParseIfBelow reads /hit?if_below=N, which counts the hit only while the
+// counter is below N, e.g. for the first 100 signups: 0 when absent,
+// otherwise a whole number of at least 1.
+func ParseIfBelow(r *http.Request) (uint64, error) {
+	s := r.URL.Query().Get("if_below")
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("if_below must be a whole number of at least 1")
+	}
+	return n, nil
+}
+
+// IfBelowError is the error of a hit that if_below refused.
+func IfBelowError(id string, n uint64) string {
+	return fmt.Sprintf("counter %s is not below %d", id, n)
+}
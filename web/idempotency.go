@@ -0,0 +1,45 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// IdempotencyHeader names one delivery of a /hit. Clients that retry, or
+// proxies that fetch twice, send the same key each time, and only the first
+// delivery within the window is counted.
+const IdempotencyHeader = "Idempotency-Key"
+
+// maxIdempotencyKey bounds the header; a UUID or a hash easily fits.
+const maxIdempotencyKey = 255
+
+// ParseIdempotencyKey returns r's Idempotency-Key, or "" without one. Keys
+// must be printable ASCII of at most 255 characters.
+func ParseIdempotencyKey(r *http.Request) (string, error) {
+	key := r.Header.Get(IdempotencyHeader)
+	if len(key) > maxIdempotencyKey {
+		return "", fmt.Errorf("%s is longer than %d characters", IdempotencyHeader, maxIdempotencyKey)
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return "", fmt.Errorf("%s must be printable ASCII", IdempotencyHeader)
+		}
+	}
+	return key, nil
+}
+
+// IdempotencyWindowFromEnv parses IDEMPOTENCY_WINDOW, how long a delivery's
+// key is remembered (default 24h).
+func IdempotencyWindowFromEnv() (time.Duration, error) {
+	s := os.Getenv("IDEMPOTENCY_WINDOW")
+	if s == "" {
+		return 24 * time.Hour, nil
+	}
+	w, err := time.ParseDuration(s)
+	if err != nil || w <= 0 {
+		return 0, fmt.Errorf("IDEMPOTENCY_WINDOW: %q is not a positive duration", s)
+	}
+	return w, nil
+}
@@ -0,0 +1,202 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// Identity decides who a hit comes from, so repeat hits from the same visitor
+// within the dedupe window count once. Different embeds want different
+// notions: a README badge only has the IP and User-Agent, a logged-in app
+// can send its own user id.
+type Identity interface {
+	// Visitor returns a stable key for the visitor sending r, or "" when r
+	// carries no identity (the hit is always counted). It may set a cookie
+	// on w.
+	Visitor(w http.ResponseWriter, r *http.Request) string
+}
+
+// IdentityFunc adapts a function to Identity.
+type IdentityFunc func(w http.ResponseWriter, r *http.Request) string
+
+func (f IdentityFunc) Visitor(w http.ResponseWriter, r *http.Request) string { return f(w, r) }
+
+// VisitorCookie is the cookie the "cookie" identity sets.
+const VisitorCookie = "nums_vid"
+
+var (
+	identitiesMu sync.RWMutex
+	identities   = map[string]func(arg string) (Identity, error){
+		"none":   func(string) (Identity, error) { return IdentityFunc(noVisitor), nil },
+		"ipua":   func(string) (Identity, error) { return IdentityFunc(ipUAVisitor), nil },
+		"cookie": func(string) (Identity, error) { return IdentityFunc(cookieVisitor), nil },
+		"header": func(name string) (Identity, error) {
+			if name == "" {
+				return nil, fmt.Errorf("header identity needs a header name, e.g. header:X-User-Id")
+			}
+			return IdentityFunc(func(_ http.ResponseWriter, r *http.Request) string {
+				return r.Header.Get(name)
+			}), nil
+		},
+	}
+)
+
+// RegisterIdentity adds a named strategy for DEDUPE; arg is the text after
+// the first ':' in "name:arg".
+func RegisterIdentity(name string, fn func(arg string) (Identity, error)) {
+	identitiesMu.Lock()
+	defer identitiesMu.Unlock()
+	identities[name] = fn
+}
+
+// ParseIdentity builds the strategy named by s: none, ipua (client IP and
+// User-Agent), anon (their hash with a daily salt), cookie (a random id in
+// the nums_vid cookie), signed (the counted hits in the signed nums_seen
+// cookie), header:<Name> (the value of a request header the embedding app
+// sets) or a registered one.
+func ParseIdentity(s string) (Identity, error) {
+	name, arg, _ := strings.Cut(strings.TrimSpace(s), ":")
+	identitiesMu.RLock()
+	fn, ok := identities[name]
+	identitiesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown identity %q (want %s)", name, identityNames())
+	}
+	return fn(arg)
+}
+
+func identityNames() string {
+	identitiesMu.RLock()
+	defer identitiesMu.RUnlock()
+	names := make([]string, 0, len(identities))
+	for n := range identities {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Dedupe is the per-counter identity configuration from DEDUPE.
+type Dedupe struct {
+	byID    map[string]Identity
+	names   map[string]string        // id -> name of its identity
+	windows map[string]time.Duration // identity name -> its own window
+	Window  time.Duration
+}
+
+// DedupeFromEnv parses DEDUPE, comma-separated id=identity pairs such as
+// "home=ipua,app=header:X-User-Id" ("*=cookie" applies to every other
+// counter), and DEDUPE_WINDOW: the window (default 24h), then optional
+// identity=window overrides, as in "24h,anon=30m".
+func DedupeFromEnv() (*Dedupe, error) {
+	d := &Dedupe{byID: make(map[string]Identity), names: make(map[string]string), windows: make(map[string]time.Duration), Window: 24 * time.Hour}
+	for _, part := range strings.Split(os.Getenv("DEDUPE_WINDOW"), ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		name, s, override := strings.Cut(part, "=")
+		if !override {
+			s = name
+		}
+		w, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil || w <= 0 {
+			return nil, fmt.Errorf("DEDUPE_WINDOW: %q is not a positive duration", part)
+		}
+		if !override {
+			d.Window = w
+			continue
+		}
+		name = strings.TrimSpace(name)
+		identitiesMu.RLock()
+		_, ok := identities[name]
+		identitiesMu.RUnlock()
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("DEDUPE_WINDOW: unknown identity %q (want %s)", name, identityNames())
+		case name == "anon" && w > anonMaxWindow:
+			return nil, fmt.Errorf("DEDUPE_WINDOW: %q is longer than the anon identity's %s, after which its salt changes", part, anonMaxWindow)
+		}
+		d.windows[name] = w
+	}
+	for _, pair := range strings.Split(os.Getenv("DEDUPE"), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		id, spec, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(id) == "" {
+			return nil, fmt.Errorf("DEDUPE: %q should be id=identity", pair)
+		}
+		ident, err := ParseIdentity(spec)
+		if err != nil {
+			return nil, fmt.Errorf("DEDUPE: %s: %w", strings.TrimSpace(id), err)
+		}
+		d.byID[strings.TrimSpace(id)] = ident
+		name, _, _ := strings.Cut(strings.TrimSpace(spec), ":")
+		d.names[strings.TrimSpace(id)] = name
+	}
+	return d, nil
+}
+
+// Enabled reports whether any counter is deduplicated.
+func (d *Dedupe) Enabled() bool { return len(d.byID) > 0 }
+
+// For returns id's identity; counters without one are never deduplicated.
+func (d *Dedupe) For(id string) Identity {
+	if ident, ok := d.byID[id]; ok {
+		return ident
+	}
+	if ident, ok := d.byID[core.RoundingDefault]; ok {
+		return ident
+	}
+	return IdentityFunc(noVisitor)
+}
+
+// WindowFor returns id's dedupe window: its identity's override in
+// DEDUPE_WINDOW, or Window.
+func (d *Dedupe) WindowFor(id string) time.Duration {
+	name, ok := d.names[id]
+	if !ok {
+		name = d.names[core.RoundingDefault]
+	}
+	if w, ok := d.windows[name]; ok {
+		return w
+	}
+	return d.Window
+}
+
+// SeenKey is the storage key marking visitor as counted for id. Visitors are
+// hashed so raw IPs and user ids are never stored.
+func SeenKey(id, visitor string) string {
+	sum := sha256.Sum256([]byte(id + "\x00" + visitor))
+	return hex.EncodeToString(sum[:16])
+}
+
+func noVisitor(http.ResponseWriter, *http.Request) string { return "" }
+
+func ipUAVisitor(_ http.ResponseWriter, r *http.Request) string {
+	return ClientIP(r) + "|" + r.UserAgent()
+}
+
+func cookieVisitor(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(VisitorCookie); err == nil && c.Value != "" {
+		return c.Value
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	c := OptOutCookieFor(r, true) // same attributes: sent from embeds on other sites
+	c.Name, c.Value = VisitorCookie, hex.EncodeToString(b)
+	http.SetCookie(w, c)
+	return c.Value
+}
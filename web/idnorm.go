@@ -0,0 +1,68 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/advayc/nums/core"
+)
+
+// idNorm is the core ID normalization mode applied to incoming ids.
+var idNorm atomic.Pointer[string]
+
+// UseIDNorm makes NormalizeIDs, NormalizeID and ParseTx normalize ids with
+// mode (core.IDNormNFC or core.IDNormFold); "" keeps ids as sent.
+func UseIDNorm(mode string) error {
+	if err := core.ValidateIDNorm(mode); err != nil {
+		return err
+	}
+	idNorm.Store(&mode)
+	return nil
+}
+
+// IDNormFromEnv applies ID_NORMALIZE with UseIDNorm and returns the mode.
+func IDNormFromEnv() (string, error) {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("ID_NORMALIZE")))
+	if err := UseIDNorm(mode); err != nil {
+		return "", fmt.Errorf("ID_NORMALIZE: %w", err)
+	}
+	return mode, nil
+}
+
+// NormalizeID returns id in the deployment's normal form.
+func NormalizeID(id string) string {
+	if mode := idNorm.Load(); mode != nil {
+		return core.NormalizeID(*mode, id)
+	}
+	return id
+}
+
+// idParams are the query params that carry ids or id prefixes.
+var idParams = []string{"id", "ids", "namespace"}
+
+// NormalizeIDs returns r with the ids of its idParams normalized, and
+// whether any changed, so every route reads the same counter for "Blog" and
+// "blog".
+func NormalizeIDs(r *http.Request) (*http.Request, bool) {
+	if mode := idNorm.Load(); mode == nil || *mode == core.IDNormNone {
+		return r, false
+	}
+	q := r.URL.Query()
+	changed := false
+	for _, name := range idParams {
+		for i, v := range q[name] {
+			if n := NormalizeID(v); n != v {
+				q[name][i], changed = n, true
+			}
+		}
+	}
+	if !changed {
+		return r, false
+	}
+	out := r.Clone(r.Context())
+	out.URL.RawQuery = q.Encode()
+	return out, true
+}
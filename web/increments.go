@@ -0,0 +1,51 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// MaxIncrements is how many counters one POST /hits may touch.
+const MaxIncrements = 100
+
+// Increment is one counter of a POST /hits body.
+type Increment struct {
+	ID string
+	N  uint64
+}
+
+// ParseIncrements reads a POST /hits body, {"increments":{"home":3,"blog":1}},
+// sorted by id. Each amount must be a whole number from 1 to max (MAX_HIT_BY).
+func ParseIncrements(body io.Reader, max uint64) ([]Increment, error) {
+	var req struct {
+		Increments map[string]uint64 `json:"increments"`
+	}
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		return nil, errors.New(`body must be JSON like {"increments":{"home":3,"blog":1}}`)
+	}
+	if len(req.Increments) == 0 || len(req.Increments) > MaxIncrements {
+		return nil, fmt.Errorf("increments must contain 1 to %d counters", MaxIncrements)
+	}
+	sums := make(map[string]uint64, len(req.Increments))
+	for id, n := range req.Increments {
+		if id == "" {
+			return nil, errors.New("increments: id must not be empty")
+		}
+		if n < 1 || n > max {
+			return nil, fmt.Errorf("increments[%q] must be a whole number from 1 to %d", id, max)
+		}
+		if err := CheckID(id); err != nil {
+			return nil, fmt.Errorf("increments: %v", err)
+		}
+		sums[NormalizeID(id)] += n // ids that normalize alike count together
+	}
+	out := make([]Increment, 0, len(sums))
+	for id, n := range sums {
+		out = append(out, Increment{ID: id, N: n})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
@@ -0,0 +1,36 @@
+package web
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// NotModified sets Last-Modified to changed, when the counter behind a read
+// last changed, and reports whether r's If-Modified-Since shows the client
+// already has that version; it then writes the 304 and the caller stops.
+// Read the change time before the value, so a change in between can only
+// make Last-Modified older than the value.
+//
+// Changes less than settle ago are not advertised: HTTP dates have whole
+// seconds, so a second change within the same second would carry the same
+// date, and a read cache may not show a change for up to its TTL. settle
+// should cover both. A zero changed sends nothing. If-None-Match, when sent,
+// takes precedence, as RFC 9110 asks.
+func NotModified(w http.ResponseWriter, r *http.Request, changed time.Time, settle time.Duration) bool {
+	if changed.IsZero() || core.Now().Sub(changed) < settle {
+		return false
+	}
+	lm := changed.UTC().Truncate(time.Second)
+	w.Header().Set("Last-Modified", lm.Format(http.TimeFormat))
+	if (r.Method != http.MethodGet && r.Method != http.MethodHead) || r.Header.Get("If-None-Match") != "" {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || lm.After(since) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
@@ -0,0 +1,73 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// LongPoll is a parsed /count?wait=30s&ifChangedFrom=N request.
+type LongPoll struct {
+	Wait time.Duration // 0: answer right away
+	From string        // the value the client has; "" means the current one
+}
+
+// ParseLongPoll reads wait (a duration such as "30s", cut to max) and
+// ifChangedFrom (a counter value).
+func ParseLongPoll(r *http.Request, max time.Duration) (LongPoll, error) {
+	q := r.URL.Query()
+	var lp LongPoll
+	if s := q.Get("wait"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return lp, fmt.Errorf("wait must be a duration such as 30s")
+		}
+		lp.Wait = min(d, max)
+	}
+	if s := q.Get("ifChangedFrom"); s != "" {
+		v, err := core.ParseValue(s)
+		if err != nil {
+			return lp, fmt.Errorf("ifChangedFrom must be a counter value")
+		}
+		lp.From = v.String()
+	}
+	return lp, nil
+}
+
+// Await returns read's value once it differs from lp.From, or the last value
+// read when lp.Wait runs out or ctx ends. It reads again whenever wake (which
+// may be nil) fires and at least every poll, for changes made elsewhere.
+func (lp LongPoll) Await(ctx context.Context, poll time.Duration, wake func() <-chan struct{}, read func() core.Value) core.Value {
+	if lp.Wait <= 0 {
+		return read()
+	}
+	from := lp.From
+	if from == "" {
+		from = read().String()
+	}
+	deadline := time.NewTimer(lp.Wait)
+	defer deadline.Stop()
+	tick := time.NewTicker(poll)
+	defer tick.Stop()
+	for {
+		var woken <-chan struct{}
+		if wake != nil {
+			woken = wake() // before reading, so a change in between still wakes us
+		}
+		v := read()
+		if v.String() != from {
+			return v
+		}
+		select {
+		case <-ctx.Done():
+			return v
+		case <-deadline.C:
+			return v
+		case <-woken:
+		case <-tick.C:
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/advayc/nums/core"
+)
+
+// NamespaceTokensFromEnv parses NAMESPACE_TOKENS, comma-separated
+// namespace=token pairs such as "blog=s3cret,acme/docs=t0ken". A namespace
+// token authorizes what the main token does, but only for counters in that
+// namespace.
+func NamespaceTokensFromEnv() (map[string]string, error) {
+	out := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv("NAMESPACE_TOKENS"), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		ns, token, ok := strings.Cut(pair, "=")
+		ns, token = strings.TrimSpace(ns), strings.TrimSpace(token)
+		if !ok || token == "" {
+			return nil, fmt.Errorf("NAMESPACE_TOKENS: %q should be namespace=token", pair)
+		}
+		if err := core.ValidateNamespace(ns); err != nil {
+			return nil, fmt.Errorf("NAMESPACE_TOKENS: %w", err)
+		}
+		out[ns] = token
+	}
+	return out, nil
+}
+
+// NamespaceAuthorized reports whether r carries (as an X-Auth-Token header
+// or token param) the token of namespace ns or of a namespace containing it.
+func NamespaceAuthorized(tokens map[string]string, r *http.Request, ns string) bool {
+	sent := r.Header.Get("X-Auth-Token")
+	if sent == "" {
+		sent = r.URL.Query().Get("token")
+	}
+	if sent == "" {
+		return false
+	}
+	for tns, token := range tokens {
+		if token == sent && (ns == tns || core.InNamespace(ns, tns)) {
+			return true
+		}
+	}
+	return false
+}
+
+// IDAuthorized reports whether r carries the token of a namespace id is in.
+func IDAuthorized(tokens map[string]string, r *http.Request, id string) bool {
+	i := strings.LastIndex(id, core.NamespaceSep)
+	return i > 0 && NamespaceAuthorized(tokens, r, id[:i])
+}
+
+// ParseNamespace reads the optional namespace param of /counters and
+// /admin/export: "" for every counter.
+func ParseNamespace(r *http.Request) (string, error) {
+	ns := r.URL.Query().Get("namespace")
+	if ns == "" {
+		return "", nil
+	}
+	if err := core.ValidateNamespace(ns); err != nil {
+		return "", err
+	}
+	return ns, nil
+}
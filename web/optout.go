@@ -0,0 +1,64 @@
+package web
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+)
+
+// Own-traffic exclusion: a browser that visited /optout carries OptOutCookie,
+// and scripts can send the EXCLUDE_TOKEN value as ExcludeHeader or ?exclude=.
+// Excluded hits are answered with the current count but not recorded.
+const (
+	OptOutCookie  = "nums_optout"
+	ExcludeHeader = "X-Nums-Exclude"
+)
+
+// Excluded reports whether r opted out of counting. token is EXCLUDE_TOKEN
+// (empty disables the token check).
+func Excluded(r *http.Request, token string) bool {
+	if c, err := r.Cookie(OptOutCookie); err == nil && c.Value == "1" {
+		return true
+	}
+	if token == "" {
+		return false
+	}
+	got := r.Header.Get(ExcludeHeader)
+	if got == "" {
+		got = r.URL.Query().Get("exclude")
+	}
+	return got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// OptOutCookieFor returns the cookie that turns exclusion on (or, with on
+// false, clears it). It is SameSite=None so it is still sent when a site on
+// another domain embeds the counter; browsers only accept that over HTTPS.
+func OptOutCookieFor(r *http.Request, on bool) *http.Cookie {
+	c := &http.Cookie{
+		Name:     OptOutCookie,
+		Value:    "1",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteNoneMode,
+		Expires:  time.Now().Add(400 * 24 * time.Hour), // the longest browsers keep
+	}
+	if !c.Secure {
+		c.SameSite = http.SameSiteLaxMode // SameSite=None requires Secure
+	}
+	if !on {
+		c.Value = ""
+		c.Expires = time.Unix(0, 0)
+		c.MaxAge = -1
+	}
+	return c
+}
+
+// OptOutPage is the small confirmation page /optout serves.
+func OptOutPage(on bool) string {
+	msg, link := "Hits from this browser are no longer counted.", `<a href="?off=1">Count me again</a>`
+	if !on {
+		msg, link = "Hits from this browser are counted again.", `<a href="?">Opt out again</a>`
+	}
+	return "<!doctype html><meta charset=utf-8><title>nums opt-out</title><p>" + msg + "</p><p>" + link + "</p>\n"
+}
@@ -0,0 +1,35 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+)
+
+// pathIDRoutes take their id in the path as well as in ?id=, for markdown
+// renderers and proxies that mangle query strings: /hit/blog/post-1 is
+// /hit?id=blog/post-1, and /badge/blog/post-1.svg is /badge?id=blog/post-1.
+var pathIDRoutes = []string{"/hit/", "/badge/"}
+
+// PathID returns r rewritten into its ?id= form when its path carries the id
+// of one of pathIDRoutes (slashes included). The path id replaces any id
+// param, and a badge's .svg extension is dropped.
+func PathID(r *http.Request) (*http.Request, bool) {
+	for _, prefix := range pathIDRoutes {
+		id, ok := strings.CutPrefix(r.URL.Path, prefix)
+		if !ok {
+			continue
+		}
+		if prefix == "/badge/" {
+			id = strings.TrimSuffix(id, ".svg")
+		}
+		if id == "" {
+			return r, false
+		}
+		out := r.Clone(r.Context())
+		q := out.URL.Query()
+		q.Set("id", id)
+		out.URL.Path, out.URL.RawPath, out.URL.RawQuery = strings.TrimSuffix(prefix, "/"), "", q.Encode()
+		return out, true
+	}
+	return r, false
+}
@@ -0,0 +1,52 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// DayBucketsFromEnv reports whether hits are also counted per UTC day, for
+// period reads. They are unless DAY_BUCKETS=0.
+func DayBucketsFromEnv() bool { return os.Getenv("DAY_BUCKETS") != "0" }
+
+// CheckID refuses an id shaped like a day bucket ("home:20261018"), whose
+// hits would be mixed into the bucket of the counter before the colon.
+func CheckID(id string) error {
+	if core.IsDayBucketID(id) {
+		return fmt.Errorf("id %q ends in :YYYYMMDD, which is reserved for day buckets", id)
+	}
+	return nil
+}
+
+// CheckIDs applies CheckID to r's id and ids params.
+func CheckIDs(r *http.Request) error {
+	q := r.URL.Query()
+	ids := q["id"]
+	for _, list := range q["ids"] {
+		ids = append(ids, strings.Split(list, ",")...)
+	}
+	for _, id := range ids {
+		if err := CheckID(strings.TrimSpace(id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParsePeriod reads the period param of /count and badges: "" for the
+// counter's total, or "today", "week" or "month", summed from day buckets.
+func ParsePeriod(r *http.Request) (string, error) {
+	p := r.URL.Query().Get("period")
+	if p == "" {
+		return "", nil
+	}
+	if _, ok := core.PeriodDays(p, time.Time{}); !ok {
+		return "", fmt.Errorf("period must be today, week or month, not %q", p)
+	}
+	return p, nil
+}
@@ -0,0 +1,62 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// QuotaWarningHeader carries one warning per namespace quota a hit's
+// counter is nearing, so client owners hear of it before hits are refused.
+const QuotaWarningHeader = "Nums-Quota-Warning"
+
+// NamespaceQuotasFromEnv parses NAMESPACE_QUOTAS (see core.ParseQuotas) and
+// QUOTA_WARN_AT, the percent of a quota at which hits start carrying
+// warnings (default 80).
+func NamespaceQuotasFromEnv() (quotas map[string]core.Quota, warnAt uint64, err error) {
+	quotas, err = core.ParseQuotas(os.Getenv("NAMESPACE_QUOTAS"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("NAMESPACE_QUOTAS: %w", err)
+	}
+	warnAt = 80
+	if s := strings.TrimSpace(os.Getenv("QUOTA_WARN_AT")); s != "" {
+		warnAt, err = strconv.ParseUint(strings.TrimSuffix(s, "%"), 10, 64)
+		if err != nil || warnAt == 0 || warnAt > 100 {
+			return nil, 0, fmt.Errorf("QUOTA_WARN_AT: %q should be a percent from 1 to 100", s)
+		}
+	}
+	return quotas, warnAt, nil
+}
+
+// QuotaWarnings returns the warnings of the usages that reached warnAt
+// percent, and sets a QuotaWarningHeader for each.
+func QuotaWarnings(h http.Header, usage []core.QuotaUsage, warnAt uint64) []string {
+	var out []string
+	for _, u := range usage {
+		if u.Near(warnAt) {
+			out = append(out, u.Warning())
+			h.Add(QuotaWarningHeader, u.Warning())
+		}
+	}
+	return out
+}
+
+// WriteQuotaExceeded answers 429 {error, namespace, quota, limit} for a hit
+// past a namespace quota. A daily hits quota is retried after the next UTC
+// midnight; a counters quota only lifts when the deployment raises it.
+func WriteQuotaExceeded(w http.ResponseWriter, e *core.QuotaError) {
+	if e.Kind == core.QuotaHits {
+		now := core.Now().UTC()
+		midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		SetRetryAfter(w.Header(), midnight.Sub(now))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": e.Error(), "namespace": e.Namespace, "quota": e.Kind, "limit": e.Limit})
+}
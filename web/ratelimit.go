@@ -0,0 +1,101 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// RateLimit is RATE_LIMIT: each client (ClientIP) may make Limit requests per
+// fixed Window. Every response carries RateLimit-Limit, RateLimit-Remaining
+// and RateLimit-Reset (seconds until the window ends); requests over the
+// limit are answered 429 with Retry-After and a JSON body.
+type RateLimit struct {
+	Limit  int64
+	Window time.Duration
+
+	mu     sync.Mutex
+	start  time.Time // window the counts belong to
+	counts map[string]int64
+}
+
+// RateLimitFromEnv parses RATE_LIMIT, requests per window such as "120/m",
+// "10/s", "5000/h" or "100/10s". It returns nil when RATE_LIMIT is unset.
+func RateLimitFromEnv() (*RateLimit, error) {
+	s := strings.TrimSpace(os.Getenv("RATE_LIMIT"))
+	if s == "" {
+		return nil, nil
+	}
+	n, per, ok := strings.Cut(s, "/")
+	limit, err := strconv.ParseInt(strings.TrimSpace(n), 10, 64)
+	if !ok || err != nil || limit <= 0 {
+		return nil, fmt.Errorf("RATE_LIMIT: %q should be requests/window, e.g. 120/m", s)
+	}
+	var window time.Duration
+	switch per = strings.TrimSpace(per); per {
+	case "s":
+		window = time.Second
+	case "m":
+		window = time.Minute
+	case "h":
+		window = time.Hour
+	default:
+		window, err = time.ParseDuration(per)
+		if err != nil || window < time.Second {
+			return nil, fmt.Errorf("RATE_LIMIT: window %q should be s, m, h or a duration of at least 1s", per)
+		}
+	}
+	return &RateLimit{Limit: limit, Window: window, counts: make(map[string]int64)}, nil
+}
+
+// Reset returns the end of the window containing now.
+func (l *RateLimit) Reset(now time.Time) time.Time {
+	return now.Truncate(l.Window).Add(l.Window)
+}
+
+// Take counts a request from client in memory and returns how many it has
+// made in the current window. Shared stores count with their own keys.
+func (l *RateLimit) Take(client string, now time.Time) int64 {
+	start := now.Truncate(l.Window)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !start.Equal(l.start) { // a new window: forget the old counts
+		l.start = start
+		l.counts = make(map[string]int64)
+	}
+	l.counts[client]++
+	return l.counts[client]
+}
+
+// Allow sets the rate-limit headers for a client that has made used requests
+// in the window ending at reset. Over the limit it answers 429 and returns
+// false.
+func (l *RateLimit) Allow(w http.ResponseWriter, used int64, reset time.Time) bool {
+	secs := int64(reset.Sub(core.Now()).Round(time.Second) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.FormatInt(l.Limit, 10))
+	h.Set("RateLimit-Remaining", strconv.FormatInt(max(l.Limit-used, 0), 10))
+	h.Set("RateLimit-Reset", strconv.FormatInt(secs, 10))
+	if used <= l.Limit {
+		return true
+	}
+	h.Set("Retry-After", strconv.FormatInt(secs, 10))
+	h.Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": "rate limit exceeded", "limit": l.Limit, "window": l.Window.String(), "retryAfter": secs})
+	return false
+}
+
+// RateLimitHeaders are the headers browsers must be allowed to read (CORS
+// Access-Control-Expose-Headers) for clients to back off.
+var RateLimitHeaders = []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"}
@@ -0,0 +1,43 @@
+package web
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// The query parameters and headers that carry secrets: SECRET_TOKEN and the
+// namespace tokens, and EXCLUDE_TOKEN. Whatever records requests, such as
+// error reports and request samples, leaves their values out.
+var (
+	SecretParams  = []string{"token", "exclude"}
+	SecretHeaders = []string{"X-Auth-Token", ExcludeHeader}
+)
+
+// SecretParam reports whether the query parameter name carries a secret.
+func SecretParam(name string) bool { return slices.Contains(SecretParams, name) }
+
+// SecretHeader reports whether the header name carries a secret.
+func SecretHeader(name string) bool {
+	return slices.ContainsFunc(SecretHeaders, func(h string) bool { return strings.EqualFold(h, name) })
+}
+
+// ScrubQuery returns the query string raw with the values of SecretParams
+// replaced by "[Filtered]".
+func ScrubQuery(raw string) string {
+	q, err := url.ParseQuery(raw)
+	if err != nil {
+		return raw
+	}
+	filtered := false
+	for k := range q {
+		if SecretParam(k) {
+			q.Set(k, "[Filtered]")
+			filtered = true
+		}
+	}
+	if !filtered {
+		return raw
+	}
+	return q.Encode()
+}
@@ -0,0 +1,52 @@
+// Package web holds the request and environment handling shared by the
+// standalone server and the serverless handler: opt-out cookies, visitor
+// identity, development-traffic detection and settings read from environment
+// variables. It keeps net/http and os out of package core, which also builds
+// for GOOS=js and GOOS=wasip1.
+package web
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/advayc/nums/core"
+)
+
+// RoundingFromEnv parses ROUND_COUNTS, comma-separated id=step pairs such as
+// "home=100,blog=10" ("*=10" rounds every other counter).
+func RoundingFromEnv() (map[string]uint64, error) {
+	return idNumbersFromEnv("ROUND_COUNTS", "step", 2)
+}
+
+// BadgeMinFromEnv parses BADGE_MIN, comma-separated id=threshold pairs such
+// as "home=100" ("*=50" applies to every other counter). Badges show "<100"
+// until the counter reaches its threshold.
+func BadgeMinFromEnv() (map[string]uint64, error) {
+	return idNumbersFromEnv("BADGE_MIN", "threshold", 1)
+}
+
+// DisplayOffsetsFromEnv parses DISPLAY_OFFSETS, comma-separated id=offset
+// pairs such as "home=15000": hits carried over from an older counter that
+// are added to the public value while the stored count stays as recorded.
+func DisplayOffsetsFromEnv() (map[string]uint64, error) {
+	return idNumbersFromEnv("DISPLAY_OFFSETS", "offset", 0)
+}
+
+// CapsFromEnv parses MAX_VALUES, comma-separated id=max or id=max:policy
+// entries such as "quota=1000,api=500:clamp" ("*=..." caps every other
+// counter). The policy is reject (the default), clamp or wrap.
+func CapsFromEnv() (map[string]core.Cap, error) {
+	caps, err := core.ParseCaps(os.Getenv("MAX_VALUES"))
+	if err != nil {
+		return nil, fmt.Errorf("MAX_VALUES: %w", err)
+	}
+	return caps, nil
+}
+
+func idNumbersFromEnv(name, what string, min uint64) (map[string]uint64, error) {
+	out, err := core.ParseIDNumbers(os.Getenv(name), what, min)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return out, nil
+}
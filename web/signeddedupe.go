@@ -0,0 +1,131 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// SeenCookie is the cookie the "signed" identity sets: the counters this
+// browser was counted on and until when, signed so it cannot be edited.
+const SeenCookie = "nums_seen"
+
+// seenCookieMax is how many counters one SeenCookie remembers; the entries
+// that expire soonest are dropped first, keeping it under 1 KB.
+const seenCookieMax = 32
+
+// Deduper is an Identity that decides repeat hits itself rather than through
+// seen keys in the store.
+type Deduper interface {
+	Identity
+	// First reports whether r's hit on id is its visitor's first within
+	// window, marking it seen.
+	First(w http.ResponseWriter, r *http.Request, id string, window time.Duration) bool
+}
+
+func init() {
+	RegisterIdentity("signed", func(string) (Identity, error) {
+		secret := os.Getenv("DEDUPE_SECRET")
+		if secret == "" {
+			secret = os.Getenv("SECRET_TOKEN")
+		}
+		if secret == "" {
+			return nil, errors.New("signed identity needs DEDUPE_SECRET (or SECRET_TOKEN) to sign its cookie")
+		}
+		return signedDedupe{key: []byte(secret)}, nil
+	})
+}
+
+// signedDedupe keeps a visitor's counted hits in SeenCookie, so it needs no
+// storage and works the same on every instance and in the serverless
+// handler. Clearing cookies counts the visitor again.
+type signedDedupe struct{ key []byte }
+
+// Visitor is "": the cookie, not a seen key, marks the visitor.
+func (signedDedupe) Visitor(http.ResponseWriter, *http.Request) string { return "" }
+
+func (s signedDedupe) First(w http.ResponseWriter, r *http.Request, id string, window time.Duration) bool {
+	now := core.Now()
+	seen := make(map[string]int64)
+	if c, err := r.Cookie(SeenCookie); err == nil {
+		seen = s.parse(c.Value, now)
+	}
+	h := seenHash(id)
+	if _, ok := seen[h]; ok {
+		return false
+	}
+	seen[h] = now.Add(window).Unix()
+	c := OptOutCookieFor(r, true) // same attributes: sent from embeds on other sites
+	c.Name, c.Value = SeenCookie, s.format(seen)
+	c.Expires = time.Unix(maxExpiry(seen), 0)
+	http.SetCookie(w, c)
+	return true
+}
+
+// seenHash shortens id for the cookie.
+func seenHash(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:6])
+}
+
+// format writes seen as "<hash>-<expiry>_..." followed by "." and the
+// signature, keeping the seenCookieMax entries that expire last.
+func (s signedDedupe) format(seen map[string]int64) string {
+	hashes := make([]string, 0, len(seen))
+	for h := range seen {
+		hashes = append(hashes, h)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		if seen[hashes[i]] != seen[hashes[j]] {
+			return seen[hashes[i]] > seen[hashes[j]]
+		}
+		return hashes[i] < hashes[j]
+	})
+	entries := make([]string, 0, min(len(hashes), seenCookieMax))
+	for _, h := range hashes[:min(len(hashes), seenCookieMax)] {
+		entries = append(entries, h+"-"+strconv.FormatInt(seen[h], 10))
+	}
+	payload := strings.Join(entries, "_")
+	return payload + "." + s.sign(payload)
+}
+
+// parse reads a cookie written by format, dropping expired entries. A
+// cookie with a bad signature reads as empty.
+func (s signedDedupe) parse(v string, now time.Time) map[string]int64 {
+	seen := make(map[string]int64)
+	payload, sig, ok := strings.Cut(v, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.sign(payload))) {
+		return seen
+	}
+	for _, e := range strings.Split(payload, "_") {
+		h, exp, ok := strings.Cut(e, "-")
+		n, err := strconv.ParseInt(exp, 10, 64)
+		if ok && err == nil && n > now.Unix() {
+			seen[h] = n
+		}
+	}
+	return seen
+}
+
+func (s signedDedupe) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func maxExpiry(seen map[string]int64) int64 {
+	var last int64
+	for _, exp := range seen {
+		last = max(last, exp)
+	}
+	return last
+}
@@ -0,0 +1,22 @@
+package web
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// DeleteRetentionFromEnv parses DELETE_RETENTION, how long a counter removed
+// with DELETE /counter can be restored before it is deleted for good: a
+// duration such as 72h or a number of days such as 30d (the default).
+func DeleteRetentionFromEnv() (time.Duration, error) {
+	s := os.Getenv("DELETE_RETENTION")
+	if s == "" {
+		return 30 * 24 * time.Hour, nil
+	}
+	d, err := parseDays(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("DELETE_RETENTION: %q is not a positive duration such as 72h or 30d", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,40 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bounds of /hit?ttl=. Expired counters are removed within a minute, so
+// shorter TTLs would not be honored.
+const (
+	MinCounterTTL = time.Minute
+	MaxCounterTTL = 366 * 24 * time.Hour
+)
+
+// ParseTTL reads /hit?ttl=24h, how long a counter created by the hit lives:
+// 0 when absent, otherwise a Go duration or a number of days ("30d") from
+// MinCounterTTL to MaxCounterTTL.
+func ParseTTL(r *http.Request) (time.Duration, error) {
+	s := r.URL.Query().Get("ttl")
+	if s == "" {
+		return 0, nil
+	}
+	d, err := parseDays(s)
+	if err != nil || d < MinCounterTTL || d > MaxCounterTTL {
+		return 0, fmt.Errorf("ttl must be a duration from 1m to 366d, e.g. ttl=24h or ttl=30d")
+	}
+	return d, nil
+}
+
+// parseDays parses a Go duration or a number of days such as "30d".
+func parseDays(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		return time.Duration(n) * 24 * time.Hour, err
+	}
+	return time.ParseDuration(s)
+}
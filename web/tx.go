@@ -0,0 +1,53 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/advayc/nums/store"
+)
+
+// MaxTxOps is how many operations one POST /tx (or /transact) may apply.
+const MaxTxOps = 20
+
+// ParseTx reads a POST /tx body, {"ops":[{"op":"dec","id":"old","by":10},
+// {"op":"inc","id":"new","by":10}]}. inc and dec take by (default 1), set,
+// expect and below take value.
+func ParseTx(body io.Reader) ([]store.Op, error) {
+	var req struct {
+		Ops []struct {
+			Op    string  `json:"op"`
+			ID    string  `json:"id"`
+			By    *uint64 `json:"by"`
+			Value *uint64 `json:"value"`
+		} `json:"ops"`
+	}
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		return nil, errors.New("invalid JSON body")
+	}
+	if len(req.Ops) == 0 || len(req.Ops) > MaxTxOps {
+		return nil, fmt.Errorf("ops must contain 1 to %d operations", MaxTxOps)
+	}
+	ops := make([]store.Op, len(req.Ops))
+	for i, o := range req.Ops {
+		op := store.Op{Kind: o.Op, ID: NormalizeID(o.ID), N: 1}
+		switch {
+		case (o.Op == store.OpSet || o.Op == store.OpExpect || o.Op == store.OpBelow) && o.Value == nil:
+			return nil, fmt.Errorf("ops[%d]: %s requires value", i, o.Op)
+		case o.Op == store.OpSet || o.Op == store.OpExpect || o.Op == store.OpBelow:
+			op.N = *o.Value
+		case o.By != nil:
+			op.N = *o.By
+		}
+		if err := op.Validate(); err != nil {
+			return nil, fmt.Errorf("ops[%d]: %v", i, err)
+		}
+		if err := CheckID(op.ID); err != nil {
+			return nil, fmt.Errorf("ops[%d]: %v", i, err)
+		}
+		ops[i] = op
+	}
+	return ops, nil
+}
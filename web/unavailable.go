@@ -0,0 +1,72 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/advayc/nums/core"
+)
+
+// StoreRetryAfter is the Retry-After of a store failure when the server has
+// no better estimate of when the store will be back.
+const StoreRetryAfter = 5 * time.Second
+
+// SetRetryAfter sets Retry-After to d in whole seconds, at least one.
+func SetRetryAfter(h http.Header, d time.Duration) {
+	secs := int64((d + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	h.Set("Retry-After", strconv.FormatInt(secs, 10))
+}
+
+// WriteUnavailable answers 503 {"error":"store unavailable"} for a failed
+// store call, with Retry-After so clients back off instead of retrying right
+// away. fields are added to the body, e.g. those of Stale.
+func WriteUnavailable(w http.ResponseWriter, retryAfter time.Duration, fields map[string]any) {
+	body := map[string]any{"error": "store unavailable"}
+	for k, v := range fields {
+		body[k] = v
+	}
+	SetRetryAfter(w.Header(), retryAfter)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// LastKnown returns a counter's last known value and when it was known.
+type LastKnown func(id string) (core.Value, time.Time, bool)
+
+// Stale returns the body fields of a failed read or write of id for clients
+// that would rather show an old count than none: "stale", its last known
+// value, and "stale_at", when it was known. It is nil when id has none.
+func Stale(last LastKnown, id string) map[string]any {
+	v, at, ok := last(id)
+	if !ok {
+		return nil
+	}
+	return map[string]any{"stale": v, "stale_at": at.UTC().Truncate(time.Second)}
+}
+
+// StaleBatch is Stale for the ids of a batch: "stale" maps each id with a
+// last known value to it, and "stale_at" is when the oldest was known.
+func StaleBatch(last LastKnown, ids []string) map[string]any {
+	vals := make(map[string]core.Value, len(ids))
+	var oldest time.Time
+	for _, id := range ids {
+		v, at, ok := last(id)
+		if !ok {
+			continue
+		}
+		vals[id] = v
+		if oldest.IsZero() || at.Before(oldest) {
+			oldest = at
+		}
+	}
+	if len(vals) == 0 {
+		return nil
+	}
+	return map[string]any{"stale": vals, "stale_at": oldest.UTC().Truncate(time.Second)}
+}
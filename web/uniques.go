@@ -0,0 +1,64 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/advayc/nums/core"
+)
+
+// UniquesFromEnv returns the counters listed in UNIQUES (comma-separated),
+// whose unique visitors are counted besides their hits; "*" counts them for
+// every counter.
+func UniquesFromEnv() map[string]bool {
+	ids := make(map[string]bool)
+	for _, id := range strings.Split(os.Getenv("UNIQUES"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// TracksUniques reports whether ids (from UniquesFromEnv) covers id.
+// Playground counters are never tracked.
+func TracksUniques(ids map[string]bool, id string) bool {
+	if core.IsTestID(id) {
+		return false
+	}
+	if id == "" {
+		id = "default"
+	}
+	return ids[id] || ids[core.RoundingDefault]
+}
+
+// UniqueVisitor identifies the visitor sending r for unique counts: a hash
+// of the client IP and User-Agent, as the ipua identity uses, so raw IPs are
+// never stored.
+func UniqueVisitor(r *http.Request) string {
+	sum := sha256.Sum256([]byte(ClientIP(r) + "|" + r.UserAgent()))
+	return hex.EncodeToString(sum[:16])
+}
+
+// ParseMetric reads /count's metric param: "hits" (the default) or
+// "uniques".
+func ParseMetric(r *http.Request) (string, error) {
+	switch m := r.URL.Query().Get("metric"); m {
+	case "", "hits":
+		return "hits", nil
+	case "uniques":
+		return m, nil
+	default:
+		return "", fmt.Errorf("metric must be hits or uniques, not %q", m)
+	}
+}
+
+// WithUniques appends a unique visitor count to a badge value, e.g.
+// "1204 · 318 uniques"; like the hits, counts below min show as "<min".
+func WithUniques(value string, uniques, min uint64) string {
+	return value + " · " + core.Uint(uniques).FormatMin(-1, "", min) + " uniques"
+}